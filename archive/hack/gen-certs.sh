@@ -3,7 +3,7 @@ WD=$(cd "$WD"; pwd)
 
 set -e
 
-openssl req -x509 -sha256 -nodes -days 365 -newkey rsa:2048 -subj '/O=example Inc./CN=gateway.local' -keyout /tmp/root.key -out /tmp/root.crt
-openssl req -out /tmp/cert.csr -newkey rsa:2048 -nodes -keyout /tmp/cert.key -subj "/CN=gateway.local/O=example organization"
-openssl x509 -req -days 365 -CA /tmp/root.crt -CAkey /tmp/root.key -set_serial 0 -in /tmp/cert.csr -out /tmp/cert.crt
-kubectl create -n istio-system secret tls service-apis-cert --key=/tmp/cert.key --cert=/tmp/cert.crt --dry-run=client -oyaml > "${WD}"/../certificate.yaml
+# The CA, intermediate and leaf certificates are generated by the recipes
+# command of the repository, see test/certs.
+cd "${WD}"/../..
+go run ./cmd/recipes certs --secret=service-apis-cert --hosts=gateway.local --namespace=istio-system --key-type=rsa-2048 --validity=8760h > "${WD}"/../certificate.yaml
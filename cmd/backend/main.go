@@ -0,0 +1,97 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command backend runs the test backend of the recipes, a drop-in replacement
+// for whereami recording the requests it receives, with configurable failures,
+// see package backend. Build its image from the root of the repository:
+//
+//	make backend-image IMAGE=us-docker.pkg.dev/$PROJECT/recipes/backend
+//	kubectl set image deployment/sample-app whereami=us-docker.pkg.dev/$PROJECT/recipes/backend
+//
+// and configure it with its arguments, e.g. to fail every third request with
+// a 503 and serve gRPC health checks on port 9090:
+//
+//	args: ["--status=503", "--status-every=3", "--grpc-port=9090"]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/backend"
+	"google.golang.org/grpc"
+	"k8s.io/klog/v2"
+)
+
+var (
+	flags struct {
+		port             int
+		grpcPort         int
+		recordedRequests int
+		status           int
+		statusEvery      int
+		latency          time.Duration
+		unready          bool
+	}
+)
+
+func init() {
+	flag.IntVar(&flags.port, "port", 8080, "port to serve on, the port of whereami")
+	flag.IntVar(&flags.grpcPort, "grpc-port", 0, "port to serve the gRPC health service on, none if 0")
+	flag.IntVar(&flags.recordedRequests, "recorded-requests", backend.DefaultRecordedRequests, "number of requests recorded, the most recent ones")
+	flag.IntVar(&flags.status, "status", 0, "status code of the responses, 200 if 0")
+	flag.IntVar(&flags.statusEvery, "status-every", 0, "answer only one request out of status-every with --status, all of them if 0")
+	flag.DurationVar(&flags.latency, "latency", 0, "delay of the responses")
+	flag.BoolVar(&flags.unready, "unready", false, "fail the health checks until set ready with a POST to "+backend.ReadinessPath+"?ready=true")
+}
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	config := backend.ConfigFromEnv(os.Getenv)
+	config.RecordedRequests = flags.recordedRequests
+	config.Status = flags.status
+	config.StatusEvery = flags.statusEvery
+	config.Latency = flags.latency
+	config.Unready = flags.unready
+	if config.PodName == "" {
+		config.PodName, _ = os.Hostname()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	if err := config.LookupGCE(ctx, http.DefaultClient, backend.GCEMetadataURL); err != nil {
+		klog.Warningf("No GCE metadata, the cluster, project and zone are unknown: %v", err)
+	}
+	cancel()
+
+	s := backend.NewServer(config)
+	if flags.grpcPort != 0 {
+		lis, err := net.Listen("tcp", fmt.Sprintf(":%d", flags.grpcPort))
+		if err != nil {
+			klog.Fatalf("Listen() = %v, want nil", err)
+		}
+		g := grpc.NewServer()
+		s.RegisterGRPC(g)
+		klog.Infof("gRPC health service listening on %s", lis.Addr())
+		go func() { klog.Fatal(g.Serve(lis)) }()
+	}
+	addr := fmt.Sprintf(":%d", flags.port)
+	klog.Infof("Backend %q listening on %s", config.Metadata, addr)
+	klog.Fatal(http.ListenAndServe(addr, s))
+}
@@ -0,0 +1,75 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command fakeboskos runs a local fake boskos server, so that the Prow code
+// path of the test harness can be simulated outside of Prow:
+//
+//	go run ./cmd/fakeboskos --config=boskos.yaml --port=8080
+//	make test RUN_IN_PROW=true BOSKOS_URL=http://localhost:8080 BOSKOS_OWNER=$USER
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/fakeboskos"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/boskos/common"
+)
+
+var (
+	flags struct {
+		config       string
+		port         int
+		reapTimeout  time.Duration
+		cleanDelay   time.Duration
+		reapInterval time.Duration
+	}
+)
+
+func init() {
+	flag.StringVar(&flags.config, "config", "", "path to a boskos configuration file declaring the resources to serve")
+	flag.IntVar(&flags.port, "port", 8080, "port to serve the boskos API on")
+	flag.DurationVar(&flags.reapTimeout, "reap-timeout", 30*time.Minute, "how long a busy resource can go without update before it is reaped")
+	flag.DurationVar(&flags.cleanDelay, "clean-delay", time.Minute, "how long a dirty resource stays dirty before it is free again")
+	flag.DurationVar(&flags.reapInterval, "reap-interval", 10*time.Second, "how often the reaper and the janitor run")
+}
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	if flags.config == "" {
+		klog.Fatalf("--config is required")
+	}
+	bc, err := common.ParseConfig(flags.config)
+	if err != nil {
+		klog.Fatalf("ParseConfig(%q) = %v, want nil", flags.config, err)
+	}
+
+	s := fakeboskos.NewServerFromConfig(fakeboskos.Config{
+		ReapTimeout: flags.reapTimeout,
+		CleanDelay:  flags.cleanDelay,
+	}, bc)
+	go s.Run(flags.reapInterval, make(chan struct{}))
+
+	for _, r := range s.Resources() {
+		klog.Infof("Serving %s of type %s", r.Name, r.Type)
+	}
+	addr := fmt.Sprintf(":%d", flags.port)
+	klog.Infof("Listening on %s", addr)
+	klog.Fatal(http.ListenAndServe(addr, s))
+}
@@ -0,0 +1,191 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command grpcprobe probes a gRPC service served with TLS, see package
+// grpcprobe: it checks the health of the service, then calls a unary method,
+// the first one found with the reflection service by default, and asserts on
+// the status and the metadata of the responses, e.g. for gateway/grpc:
+//
+//	go run ./cmd/grpcprobe --address=$GW_XLB_VIP:443 \
+//	  --server-name=grpc.domain.com --ca=certs/CA_crt.pem \
+//	  --method=echo.EchoServer/SayHelloUnary --request='{"name": "unary RPC msg"}' \
+//	  --repeat=10
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/grpcprobe"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"k8s.io/klog/v2"
+)
+
+var (
+	flags struct {
+		address      string
+		serverName   string
+		ca           string
+		protoset     string
+		service      string
+		method       string
+		request      string
+		metadata     string
+		wantCode     string
+		wantMetadata string
+		wantMessage  string
+		repeat       int
+		timeout      time.Duration
+	}
+)
+
+func init() {
+	flag.StringVar(&flags.address, "address", "", "host:port of the gRPC service")
+	flag.StringVar(&flags.serverName, "server-name", "", "server name to verify the certificate of the service with, the host of --address if empty")
+	flag.StringVar(&flags.ca, "ca", "", "file of the PEM CA bundle to verify the certificate of the service with, the system roots if empty")
+	flag.StringVar(&flags.protoset, "protoset", "", "file of the descriptors of the service, a FileDescriptorSet, if the service has no reflection service")
+	flag.StringVar(&flags.service, "service", "", "service to check the health of, the server if empty")
+	flag.StringVar(&flags.method, "method", "", "unary method to call, as service/Method, the first one of the reflection service if empty")
+	flag.StringVar(&flags.request, "request", "", "request of the method, in JSON")
+	flag.StringVar(&flags.metadata, "metadata", "", "comma separated key=value metadata of the requests")
+	flag.StringVar(&flags.wantCode, "want-code", "OK", "expected status code of the responses")
+	flag.StringVar(&flags.wantMetadata, "want-metadata", "", "comma separated key=value metadata expected in the headers or the trailers of the responses")
+	flag.StringVar(&flags.wantMessage, "want-message", "", "text expected in the responses, in JSON")
+	flag.IntVar(&flags.repeat, "repeat", 1, "number of calls of the method")
+	flag.DurationVar(&flags.timeout, "timeout", time.Minute, "timeout of the probe")
+}
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	if err := probe(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func probe() error {
+	if flags.address == "" {
+		return fmt.Errorf("--address is required")
+	}
+	opts := grpcprobe.Options{Address: flags.address, ServerName: flags.serverName}
+	if flags.ca != "" {
+		ca, err := os.ReadFile(flags.ca)
+		if err != nil {
+			return err
+		}
+		opts.CA = ca
+	}
+	if flags.protoset != "" {
+		b, err := os.ReadFile(flags.protoset)
+		if err != nil {
+			return err
+		}
+		set := &descriptorpb.FileDescriptorSet{}
+		if err := proto.Unmarshal(b, set); err != nil {
+			return fmt.Errorf("protoset %s: %w", flags.protoset, err)
+		}
+		if opts.Files, err = protodesc.NewFiles(set); err != nil {
+			return fmt.Errorf("protoset %s: %w", flags.protoset, err)
+		}
+	}
+	want := grpcprobe.Expectation{Message: flags.wantMessage}
+	if err := want.Code.UnmarshalJSON([]byte(fmt.Sprintf("%q", strings.ToUpper(flags.wantCode)))); err != nil {
+		return fmt.Errorf("--want-code: %w", err)
+	}
+	md, err := pairs(flags.metadata)
+	if err != nil {
+		return fmt.Errorf("--metadata: %w", err)
+	}
+	wantMD, err := pairs(flags.wantMetadata)
+	if err != nil {
+		return fmt.Errorf("--want-metadata: %w", err)
+	}
+	if len(wantMD) > 0 {
+		want.Metadata = map[string]string{}
+		for k, v := range wantMD {
+			want.Metadata[k] = v[0]
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), flags.timeout)
+	defer cancel()
+	p, err := grpcprobe.Dial(opts)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	health, err := p.Health(ctx, flags.service)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Health(%q): %s\n", flags.service, health)
+	if health != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("service %q is %s, want %s", flags.service, health, healthpb.HealthCheckResponse_SERVING)
+	}
+
+	method := flags.method
+	if method == "" {
+		methods, err := p.Methods(ctx)
+		if err != nil {
+			return err
+		}
+		if len(methods) == 0 {
+			return fmt.Errorf("no unary method found with the reflection service of %s", flags.address)
+		}
+		method = methods[0]
+	}
+	failures := 0
+	for i := 0; i < flags.repeat; i++ {
+		resp, err := p.Call(ctx, method, flags.request, md)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s %s %v %v\n", method, resp.Code, resp.Message, resp.Header, resp.Trailer)
+		if err := grpcprobe.Check(resp, want); err != nil {
+			fmt.Printf("  %v\n", err)
+			failures++
+		}
+	}
+	if failures > 0 {
+		return fmt.Errorf("%d of the %d calls of %s failed", failures, flags.repeat, method)
+	}
+	return nil
+}
+
+// pairs parses comma separated key=value pairs into metadata.
+func pairs(s string) (metadata.MD, error) {
+	md := metadata.MD{}
+	if s == "" {
+		return md, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("%q is not a key=value pair", pair)
+		}
+		md.Append(k, v)
+	}
+	return md, nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/placement"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/utils"
+)
+
+// runApply applies the manifests of a multi-cluster recipe to the clusters
+// they are placed on, reached through the kubeconfig contexts named after the
+// declared clusters.
+func runApply(args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	kubeconfig := fs.String("kubeconfig", defaultKubeconfig(), "kubeconfig with a context for each declared cluster")
+	del := fs.Bool("delete", false, "delete the objects of the manifests instead, in the reverse order")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	r, err := loadRecipe(positional)
+	if err != nil {
+		return err
+	}
+	errs, err := placement.Validate(r)
+	if err != nil {
+		return err
+	}
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	var contexts []string
+	for _, c := range r.Metadata.Clusters {
+		contexts = append(contexts, c.Name)
+	}
+	clusters, err := utils.LoadClusters(*kubeconfig, contexts...)
+	if err != nil {
+		return err
+	}
+	if *del {
+		return placement.Delete(context.Background(), placement.ExecKubectl(nil), clusters, r, os.Getenv)
+	}
+	return placement.Apply(context.Background(), placement.ExecKubectl(nil), clusters, r, os.Getenv)
+}
+
+// defaultKubeconfig returns the kubeconfig used by kubectl, the first file of
+// KUBECONFIG or ~/.kube/config.
+func defaultKubeconfig() string {
+	if paths := filepath.SplitList(os.Getenv("KUBECONFIG")); len(paths) > 0 {
+		return paths[0]
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kube", "config")
+}
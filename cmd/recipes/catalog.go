@@ -0,0 +1,66 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/catalog"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/cost"
+)
+
+// runCatalog regenerates the recipe catalog in the README.md of the
+// repository.
+func runCatalog(args []string) error {
+	fs := flag.NewFlagSet("catalog", flag.ExitOnError)
+	check := fs.Bool("check", false, "only check that the catalog is up to date")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	return updateCatalog(*check)
+}
+
+// updateCatalog regenerates the recipe catalog in the README.md of the
+// repository, or only checks that it is up to date.
+func updateCatalog(check bool) error {
+	prices, err := cost.LoadPrices("")
+	if err != nil {
+		return err
+	}
+	entries, err := catalog.Load(flags.root, prices)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(flags.root, "README.md")
+	readme, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	updated, err := catalog.UpdateReadme(readme, catalog.Render(entries, prices))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if bytes.Equal(readme, updated) {
+		return nil
+	}
+	if check {
+		return fmt.Errorf("the recipe catalog in %s is stale, run go run ./cmd/recipes catalog", path)
+	}
+	return os.WriteFile(path, updated, 0644)
+}
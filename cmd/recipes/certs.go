@@ -0,0 +1,78 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/certs"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"k8s.io/klog/v2"
+)
+
+// runCerts generates the certificates declared by a recipe, or the one of a
+// Secret given by flags without a path, and prints their manifests, to be
+// piped to kubectl apply.
+func runCerts(args []string) error {
+	fs := flag.NewFlagSet("certs", flag.ExitOnError)
+	namespace := fs.String("namespace", "", "namespace of the manifests, the namespace of kubectl by default")
+	keyType := fs.String("key-type", certs.DefaultKeyType, "type of the keys, one of "+strings.Join(certs.KeyTypes, ", "))
+	validity := fs.Duration("validity", certs.DefaultValidity, "how long the certificates are valid for")
+	out := fs.String("out", "", "directory to also write the certificates and keys to as PEM files, e.g. for the clients of the recipe")
+	secret := fs.String("secret", "", "without a path, name of the kubernetes.io/tls Secret to generate")
+	hosts := fs.String("hosts", "", "without a path, comma separated list of the hosts of the certificate of --secret")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	name := *secret
+	var declared *recipe.Certificates
+	if len(positional) == 0 && *secret != "" {
+		declared = &recipe.Certificates{Secrets: []recipe.CertificateSecret{{Name: *secret, Hosts: strings.Split(*hosts, ",")}}}
+	} else {
+		r, err := loadRecipe(positional)
+		if err != nil {
+			return err
+		}
+		if r.Metadata.Certificates == nil {
+			return fmt.Errorf("recipe %s declares no certificates in its %s", r.Path, recipe.MetadataFile)
+		}
+		name, declared = r.Name(), r.Metadata.Certificates
+	}
+
+	g, err := certs.Generate(name, declared, certs.GenerateOptions{KeyType: *keyType, Validity: *validity})
+	if err != nil {
+		return err
+	}
+	manifests, err := g.Manifests(*namespace)
+	if err != nil {
+		return err
+	}
+	if *out != "" {
+		files, err := g.WriteFiles(*out)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			klog.Infof("Wrote %s", f)
+		}
+	}
+	_, err = os.Stdout.Write(manifests)
+	return err
+}
@@ -0,0 +1,89 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/cost"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+)
+
+// runCost prints the estimated cost of a recipe, item by item, or the
+// estimated costs of all the recipes without a path.
+func runCost(args []string) error {
+	fs := flag.NewFlagSet("cost", flag.ExitOnError)
+	format := fs.String("format", "table", "output format, table or json")
+	pricesPath := fs.String("prices", "", "price table to use instead of the checked-in one, see test/cost/prices.yaml")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("unknown format %q, want table or json", *format)
+	}
+	prices, err := cost.LoadPrices(*pricesPath)
+	if err != nil {
+		return err
+	}
+
+	var recipes []*recipe.Recipe
+	if len(positional) == 0 {
+		if recipes, err = recipe.Discover(flags.root); err != nil {
+			return err
+		}
+	} else {
+		r, err := loadRecipe(positional)
+		if err != nil {
+			return err
+		}
+		recipes = append(recipes, r)
+	}
+	var estimates []*cost.Estimate
+	for _, r := range recipes {
+		d, err := recipe.Describe(r)
+		if err != nil {
+			return err
+		}
+		e, err := cost.ForRecipe(d, prices)
+		if err != nil {
+			return fmt.Errorf("failed to estimate the cost of recipe %s: %w", r.Path, err)
+		}
+		estimates = append(estimates, e)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if len(positional) > 0 {
+			return enc.Encode(estimates[0])
+		}
+		return enc.Encode(estimates)
+	}
+	if len(positional) > 0 {
+		return estimates[0].WriteTable(os.Stdout)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "RECIPE\tHOURLY\tMONTHLY (%s)\tUNPRICED\n", prices.Currency)
+	for _, e := range estimates {
+		fmt.Fprintf(w, "%s\t%.4f\t%.2f\t%d\n", e.Recipe, e.Hourly(), e.Monthly(), len(e.Unpriced))
+	}
+	fmt.Fprintf(w, "\nPrices version %s, without usage-based charges.\n", prices.Version)
+	return w.Flush()
+}
@@ -0,0 +1,92 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/healthcheck"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+)
+
+// runDescribe prints the objects, the GCP resources they reference, the
+// prerequisites and the health check problems of a recipe.
+func runDescribe(args []string) error {
+	fs := flag.NewFlagSet("describe", flag.ExitOnError)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	r, err := loadRecipe(positional)
+	if err != nil {
+		return err
+	}
+	d, err := recipe.Describe(r)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Recipe:      %s\n", r.Path)
+	if r.Metadata.Description != "" {
+		fmt.Printf("Description: %s\n", r.Metadata.Description)
+	}
+	fmt.Printf("Tags:        %s\n", orNone(strings.Join(d.Tags(), ", ")))
+	fmt.Printf("Tested:      %s\n", yesNo(r.Tested()))
+	section := func(title string, items []string) {
+		fmt.Printf("\n%s:\n", title)
+		if len(items) == 0 {
+			fmt.Println("  none")
+		}
+		for _, item := range items {
+			fmt.Printf("  %s\n", item)
+		}
+	}
+	var objects, resources, prereqs, healthChecks, errs []string
+	for _, o := range d.Objects {
+		objects = append(objects, o.String())
+	}
+	for _, res := range d.Resources {
+		resources = append(resources, res.String())
+	}
+	for _, p := range d.Prerequisites {
+		prereqs = append(prereqs, p.String())
+	}
+	for _, p := range healthcheck.Check(d.Objects) {
+		healthChecks = append(healthChecks, p.String())
+	}
+	for _, err := range d.Errors {
+		errs = append(errs, err.Error())
+	}
+	section("Objects", objects)
+	section("GCP resources", resources)
+	section("Prerequisites", prereqs)
+	if len(healthChecks) > 0 {
+		section("Health check problems", healthChecks)
+	}
+	if len(errs) > 0 {
+		section("Errors", errs)
+	}
+	return nil
+}
+
+// loadRecipe returns the recipe whose path is the only positional argument.
+func loadRecipe(positional []string) (*recipe.Recipe, error) {
+	if len(positional) != 1 {
+		return nil, fmt.Errorf("want the path of a recipe, e.g. ingress/single-cluster/ingress-https, got %q", positional)
+	}
+	return recipe.Load(flags.root, positional[0])
+}
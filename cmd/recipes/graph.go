@@ -0,0 +1,53 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/graph"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+)
+
+// runGraph prints the graph of the objects of a recipe, the GCP resources they
+// reference and the GCE resources created for them.
+func runGraph(args []string) error {
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	format := fs.String("format", "mermaid", "output format, dot or mermaid")
+	gce := fs.Bool("gce", true, "include the GCE resources created by the GKE controllers")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	r, err := loadRecipe(positional)
+	if err != nil {
+		return err
+	}
+	d, err := recipe.Describe(r)
+	if err != nil {
+		return err
+	}
+	g := graph.Build(d, graph.Options{GCE: *gce})
+	switch *format {
+	case "dot":
+		fmt.Print(g.DOT())
+	case "mermaid":
+		fmt.Print(g.Mermaid())
+	default:
+		return fmt.Errorf("unknown format %q, want dot or mermaid", *format)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+)
+
+// runList prints the recipes with their tags, the environment variables they
+// require and whether they are tested.
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	tag := fs.String("tag", "", "only list the recipes with this tag")
+	tested := fs.Bool("tested", false, "only list the tested recipes")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	recipes, err := recipe.Discover(flags.root)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "RECIPE\tTESTED\tTAGS\tENV")
+	for _, r := range recipes {
+		if *tested && !r.Tested() {
+			continue
+		}
+		d, err := recipe.Describe(r)
+		if err != nil {
+			return err
+		}
+		tags := d.Tags()
+		if *tag != "" && !contains(tags, *tag) {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Path, yesNo(r.Tested()), orNone(strings.Join(tags, ",")), orNone(strings.Join(d.EnvVars, ",")))
+	}
+	return w.Flush()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,119 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command recipes manages the recipes of the repository. Run it from the root
+// of the repository:
+//
+//	go run ./cmd/recipes list --tested
+//	go run ./cmd/recipes describe ingress/single-cluster/ingress-https
+//	go run ./cmd/recipes preflight ingress/single-cluster/ingress-iap
+//	go run ./cmd/recipes run ingress/single-cluster/ingress-https
+//	go run ./cmd/recipes apply ingress/multi-cluster/mci-basic
+//	go run ./cmd/recipes rollout gateway/multi-cluster/mcg-internal-blue-green
+//	go run ./cmd/recipes plan ingress/single-cluster/ingress-https --format=json
+//	go run ./cmd/recipes cost ingress/single-cluster/ingress-https
+//	go run ./cmd/recipes certs gateway/grpc --out=certs | kubectl apply -f -
+//	go run ./cmd/recipes graph ingress/single-cluster/ingress-https --format=dot | dot -Tsvg > graph.svg
+//	go run ./cmd/recipes new ingress/single-cluster/my-recipe --kind=ingress --ilb
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"k8s.io/klog/v2"
+)
+
+var (
+	flags struct {
+		root string
+	}
+)
+
+// command is a subcommand of recipes.
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"apply":     {usage: "apply PATH [--kubeconfig=FILE] [--delete]", run: runApply},
+	"catalog":   {usage: "catalog [--check]", run: runCatalog},
+	"certs":     {usage: "certs PATH|--secret=NAME --hosts=HOST,... [--namespace=NS] [--key-type=TYPE] [--validity=DURATION] [--out=DIR]", run: runCerts},
+	"cost":      {usage: "cost [PATH] [--format=table|json] [--prices=FILE]", run: runCost},
+	"describe":  {usage: "describe PATH", run: runDescribe},
+	"graph":     {usage: "graph PATH [--format=dot|mermaid] [--gce]", run: runGraph},
+	"list":      {usage: "list [--tag=TAG] [--tested]", run: runList},
+	"new":       {usage: "new PATH [--kind=ingress|gateway|service] [--ilb]", run: runNew},
+	"plan":      {usage: "plan PATH [--format=table|json]", run: runPlan},
+	"preflight": {usage: "preflight PATH [--project=PROJECT] [--region=REGION]", run: runPreflight},
+	"rollout":   {usage: "rollout PATH [--kubeconfig=FILE] [--context=CONTEXT]", run: runRollout},
+	"run":       {usage: "run PATH [--project=PROJECT] [--phases=setup,run-test,cleanup] [--run-id=ID] [--skip-preflight]", run: runRun},
+}
+
+func init() {
+	flag.StringVar(&flags.root, "root", ".", "root of the repository")
+	flag.Usage = usage
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] COMMAND [args]\n\nCommands:\n", os.Args[0])
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(flag.CommandLine.Output(), "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintf(flag.CommandLine.Output(), "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(flag.Args()[1:]); err != nil {
+		klog.Fatalf("%s: %v", flag.Arg(0), err)
+	}
+}
+
+// parseArgs parses the flags of a subcommand, allowing them after its
+// positional arguments, and returns the positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/naming"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+)
+
+// runNew scaffolds a new recipe, warns about the names it produces which are
+// invalid, and adds it to the recipe catalog of the README.md of the
+// repository.
+func runNew(args []string) error {
+	fs := flag.NewFlagSet("new", flag.ExitOnError)
+	kind := fs.String("kind", string(recipe.Ingress), fmt.Sprintf("kind of load balancer of the recipe, one of %v", recipe.Kinds))
+	ilb := fs.Bool("ilb", false, "use an internal load balancer")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("want the path of the recipe, e.g. ingress/single-cluster/my-recipe, got %q", positional)
+	}
+
+	files, err := recipe.Scaffold(flags.root, positional[0], recipe.ScaffoldOptions{Kind: recipe.Kind(*kind), ILB: *ilb})
+	for _, file := range files {
+		fmt.Println(file)
+	}
+	if err != nil {
+		return err
+	}
+	errs, err := naming.ValidateRecipe(filepath.Join(flags.root, positional[0]))
+	if err != nil {
+		return err
+	}
+	for _, err := range errs {
+		fmt.Printf("warning: %v\n", err)
+	}
+	if err := updateCatalog(false); err != nil {
+		return fmt.Errorf("failed to update the recipe catalog, run go run ./cmd/recipes catalog: %w", err)
+	}
+	fmt.Println(filepath.Join(flags.root, "README.md"))
+	return nil
+}
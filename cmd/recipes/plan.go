@@ -0,0 +1,56 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/plan"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+)
+
+// runPlan prints the GCE resources the GKE controllers create for the load
+// balancers of a recipe.
+func runPlan(args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	format := fs.String("format", "table", "output format, table or json")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	r, err := loadRecipe(positional)
+	if err != nil {
+		return err
+	}
+	d, err := recipe.Describe(r)
+	if err != nil {
+		return err
+	}
+	p := plan.ForRecipe(d)
+	switch *format {
+	case "table":
+		return p.WriteTable(os.Stdout)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p)
+	default:
+		return fmt.Errorf("unknown format %q, want table or json", *format)
+	}
+}
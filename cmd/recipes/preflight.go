@@ -0,0 +1,81 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/preflight"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/sweeper"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/utils"
+	"k8s.io/klog/v2"
+)
+
+// runPreflight checks the APIs, IAM roles and quotas a recipe needs in the
+// default gcloud project.
+func runPreflight(args []string) error {
+	fs := flag.NewFlagSet("preflight", flag.ExitOnError)
+	project := fs.String("project", "", "project to check the recipe in, defaults to the gcloud default project")
+	region := fs.String("region", os.Getenv("REGION"), "region to check the regional quotas in, defaults to REGION")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	r, err := loadRecipe(positional)
+	if err != nil {
+		return err
+	}
+	if *project == "" {
+		if *project, err = utils.DefaultProject(); err != nil {
+			return fmt.Errorf("no --project and no default project: %w", err)
+		}
+	}
+	getenv := func(key string) string {
+		switch key {
+		case preflight.DefaultProject:
+			return *project
+		case "REGION":
+			return *region
+		}
+		return os.Getenv(key)
+	}
+	if err := checkPrerequisites(sweeper.ExecRunner(nil), getenv, r); err != nil {
+		return err
+	}
+	fmt.Printf("Recipe %s has all its prerequisites in project %s.\n", r.Path, *project)
+	return nil
+}
+
+// checkPrerequisites checks the prerequisites of a recipe with gcloud run by
+// run, in the projects and region named by the environment variables looked
+// up with getenv. The prerequisites which can't be checked are logged.
+func checkPrerequisites(run sweeper.Runner, getenv func(string) string, r *recipe.Recipe) error {
+	d, err := recipe.Describe(r)
+	if err != nil {
+		return err
+	}
+	report := preflight.Check(context.Background(), preflight.GcloudProjects(run, getenv, d), getenv("REGION"), d)
+	for _, err := range report.Errors {
+		klog.Warningf("Prerequisite not checked: %v", err)
+	}
+	for _, p := range report.Skipped {
+		klog.V(2).Infof("Prerequisite not checked: %s", p)
+	}
+	return report.Err()
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/placement"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/rollout"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/utils"
+)
+
+// runRollout runs the rollout of a recipe, once its manifests are applied,
+// reaching its clusters through the kubeconfig contexts named after them, or
+// the current context for a single-cluster recipe.
+func runRollout(args []string) error {
+	fs := flag.NewFlagSet("rollout", flag.ExitOnError)
+	kubeconfig := fs.String("kubeconfig", defaultKubeconfig(), "kubeconfig with a context for each declared cluster")
+	kubeContext := fs.String("context", "", "context of the cluster of a single-cluster recipe, defaults to the current context")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	r, err := loadRecipe(positional)
+	if err != nil {
+		return err
+	}
+	if r.Metadata.Rollout == nil {
+		return fmt.Errorf("recipe %s declares no rollout", r.Path)
+	}
+	clusters := map[string]*utils.Cluster{"": {Context: *kubeContext, Kubeconfig: *kubeconfig}}
+	if cluster := r.Metadata.Rollout.Cluster; cluster != "" {
+		if clusters, err = utils.LoadClusters(*kubeconfig, cluster); err != nil {
+			return err
+		}
+	}
+	rn := &rollout.Runner{Kubectl: placement.ExecKubectl(nil), Output: os.Stdout}
+	report, err := rn.Run(context.Background(), clusters, r)
+	if err != nil {
+		return err
+	}
+	fmt.Print("\n", report)
+	return report.Err()
+}
@@ -0,0 +1,98 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/naming"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/provision"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/sweeper"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/utils"
+	"k8s.io/klog/v2"
+)
+
+// runRun runs the test scripts of a recipe in the default gcloud project, like
+// the test framework does in Prow.
+func runRun(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	project := fs.String("project", "", "project to run the recipe in, defaults to the gcloud default project")
+	phases := fs.String("phases", "", "comma separated list of the phases to run, among setup, run-test and cleanup, defaults to all of them")
+	runID := fs.String("run-id", "", "ID of the run, used to name and label the resources, defaults to a random ID. Reuse the ID of a previous run to clean it up with --phases=cleanup")
+	resourceTTL := fs.Duration("resource-ttl", 6*time.Hour, "how long the resources created by the recipe are needed, recorded in their expires-at label")
+	skipPreflight := fs.Bool("skip-preflight", false, "don't check the APIs, IAM roles and quotas the recipe needs before running setup.sh")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	r, err := loadRecipe(positional)
+	if err != nil {
+		return err
+	}
+	if !r.Tested() {
+		return fmt.Errorf("recipe %s has no %s", r.Path, recipe.RunTestScript)
+	}
+	opts := recipe.RunOptions{
+		RunID:     *runID,
+		Owner:     os.Getenv("USER"),
+		ExpiresAt: time.Now().Add(*resourceTTL),
+		Output:    os.Stdout,
+	}
+	if *phases != "" {
+		for _, phase := range strings.Split(*phases, ",") {
+			opts.Phases = append(opts.Phases, strings.TrimSuffix(strings.TrimSpace(phase), ".sh")+".sh")
+		}
+	}
+	if opts.RunID == "" {
+		opts.RunID = naming.NewRunID(time.Now())
+	}
+	if *project == "" {
+		if *project, err = utils.DefaultProject(); err != nil {
+			return fmt.Errorf("no --project and no default project: %w", err)
+		}
+	}
+
+	env, err := utils.NewEnv(*project)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := env.Cleanup(); err != nil {
+			klog.Errorf("Cleanup() = %v", err)
+		}
+	}()
+	if missing := r.MissingEnv(env.Get); len(missing) > 0 {
+		return fmt.Errorf("recipe %s requires the environment variables %s", r.Path, strings.Join(missing, ", "))
+	}
+	if !*skipPreflight && runsSetup(opts.Phases) {
+		if err := checkPrerequisites(sweeper.ExecRunner(env.Environ()), env.Get, r); err != nil {
+			return fmt.Errorf("%w\nrun with --skip-preflight to run the recipe anyway", err)
+		}
+	}
+	opts.Clusters = provision.New(&provision.GcloudCloud{Run: sweeper.ExecRunner(env.Environ()), Project: *project})
+	klog.Infof("Running recipe %s in project %s, run ID %s", r.Path, *project, opts.RunID)
+	return recipe.Run(env, r, opts)
+}
+
+// runsSetup returns true if phases, as in recipe.RunOptions, include the
+// setup script.
+func runsSetup(phases []string) bool {
+	return len(phases) == 0 || contains(phases, recipe.SetupScript)
+}
@@ -0,0 +1,69 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command sweeper deletes the resources left behind by recipe tests in a
+// project. It only lists them unless --dry-run=false is set:
+//
+//	go run ./cmd/sweeper --project=PROJECT_ID --older-than=3h --dry-run=false
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/sweeper"
+	"k8s.io/klog/v2"
+)
+
+var (
+	flags struct {
+		project    string
+		dnsProject string
+		dnsZone    string
+		opts       sweeper.Options
+	}
+)
+
+func init() {
+	flags.opts = sweeper.DefaultOptions()
+	flag.StringVar(&flags.project, "project", os.Getenv("PROJECT"), "project to sweep, defaults to PROJECT or the gcloud default project")
+	flag.StringVar(&flags.dnsProject, "dns-project", os.Getenv("DNS_PROJECT"), "project of the Cloud DNS zone the recipe tests create records in")
+	flag.StringVar(&flags.dnsZone, "dns-zone", os.Getenv("DNS_ZONE"), "Cloud DNS zone the recipe tests create records in, DNS records are not swept if empty")
+	flag.StringVar(&flags.opts.Prefix, "prefix", flags.opts.Prefix, "name prefix of the resources created by recipe tests")
+	flag.StringVar(&flags.opts.Label, "label", flags.opts.Label, "key of the label holding the run ID of the resources created by recipe tests")
+	flag.DurationVar(&flags.opts.OlderThan, "older-than", 0, "only delete resources created at least this long ago, or whose expires-at label is in the past")
+	flag.StringVar(&flags.opts.RunID, "run-id", "", "ID of a test run whose resources are deleted whatever their age")
+	flag.BoolVar(&flags.opts.DryRun, "dry-run", true, "only print the resources that would be deleted, set to false to delete them")
+}
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	inventory := &sweeper.GcloudInventory{
+		Run:        sweeper.ExecRunner(nil),
+		Project:    flags.project,
+		DNSProject: flags.dnsProject,
+		DNSZone:    flags.dnsZone,
+	}
+	resources, err := sweeper.New(inventory, flags.opts).Sweep(context.Background())
+	for _, r := range resources {
+		fmt.Println(r)
+	}
+	if err != nil {
+		klog.Fatalf("Sweep() = %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+#!/bin/bash
+
+# Copyright 2023 Google LLC
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -o errexit;
+set -o nounset;
+set -o pipefail;
+set -o xtrace;
+source ./test/helper.sh
+test_name="mcg-internal-basic"
+region="us-west1"
+resource_suffix=$(get_resource_suffix "${test_name}")
+
+# The Gateway is deleted first, so that its load balancer is deleted before the
+# proxy-only subnet and the clusters, which the test framework deletes
+# afterwards along with the network.
+go run ./cmd/recipes apply --delete gateway/multi-cluster/mcg-internal-basic || true
+gcloud compute firewall-rules delete "allow-proxy-${resource_suffix}" --quiet || true
+gcloud compute networks subnets delete "proxy-only-${resource_suffix}" --region="${region}" --quiet || true
@@ -0,0 +1,49 @@
+#!/bin/bash
+
+# Copyright 2023 Google LLC
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -o errexit;
+set -o nounset;
+set -o pipefail;
+set -o xtrace;
+source ./test/helper.sh
+test_name="mcg-internal-basic"
+ns="store"
+region="us-west1"
+resource_suffix=$(get_resource_suffix "${test_name}")
+network=$(get_resource_name "${test_name}")
+
+# The clusters gke-1 and gke-2 are created by the test framework in the
+# network of the test, see test/provision, each reached through the kubeconfig
+# context named after it. The proxies of the internal load balancer run in a
+# proxy-only subnet of the network, and reach the pods on port 8080.
+gcloud compute networks subnets create "proxy-only-${resource_suffix}" \
+    --region="${region}" \
+    --purpose="REGIONAL_MANAGED_PROXY" \
+    --role="ACTIVE" \
+    --network="${network}" \
+    --range="10.129.0.0/23"
+gcloud compute firewall-rules create "allow-proxy-${resource_suffix}" \
+    --allow="TCP:8080" \
+    --source-ranges="10.129.0.0/23" \
+    --network="${network}"
+
+go run ./cmd/recipes apply gateway/multi-cluster/mcg-internal-basic
+for context in gke-1 gke-2; do
+    kubectl --context "${context}" label namespace "${ns}" \
+        $(get_resource_labels "${test_name}" | tr ',' ' ') --overwrite
+    kubectl --context "${context}" label deployments --all -n "${ns}" \
+        $(get_resource_labels "${test_name}" | tr ',' ' ') --overwrite
+done
@@ -0,0 +1,34 @@
+#!/bin/bash
+
+# Copyright 2023 Google LLC
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -o errexit;
+set -o nounset;
+set -o pipefail;
+set -o xtrace;
+
+source ./test/helper.sh
+test_name="mci-basic"
+ns="multi-cluster-demo"
+
+# The clusters gke-1 and gke-2 are created by the test framework, see
+# test/provision, each reached through the kubeconfig context named after it.
+go run ./cmd/recipes apply ingress/multi-cluster/mci-basic
+for context in gke-1 gke-2; do
+    kubectl --context "${context}" label namespace "${ns}" \
+        $(get_resource_labels "${test_name}" | tr ',' ' ') --overwrite
+    kubectl --context "${context}" label deployments --all -n "${ns}" \
+        $(get_resource_labels "${test_name}" | tr ',' ' ') --overwrite
+done
@@ -20,12 +20,12 @@ set -o pipefail;
 set -o xtrace;
 
 if [[ -z "${SUPPORT_EMAIL-}" ]]; then
-    echo "Required environment variable is not set. See ingress-asm-multi-backendconfig/REAME.md for details."
-    exit 0
+    echo "Required environment variable is not set. See ingress-asm-multi-backendconfig/README.md for details." >&2
+    exit 1
 fi
 
 source ./test/helper.sh
-test_name="ingress-asm-multi-backendconfig"
+test_name="asm-multi-bc"
 context=$(get_context "${test_name}")
 
 if [[ ! -z "${context}" ]]; then
@@ -20,12 +20,12 @@ set -o pipefail;
 set -o xtrace;
 
 if [[ -z "${SUPPORT_EMAIL-}" ]]; then
-    echo "Required environment variable is not set. See ingress-asm-multi-backendconfig/REAME.md for details."
-    exit 0
+    echo "Required environment variable is not set. See ingress-asm-multi-backendconfig/README.md for details." >&2
+    exit 1
 fi
 
 source ./test/helper.sh
-test_name="ingress-asm-multi-backendconfig"
+test_name="asm-multi-bc"
 context=$(get_context "${test_name}")
 
 if [[ -z "${context}" ]]; then
@@ -36,5 +36,6 @@ vip=$(wait_for_ingress_ip "ingressgateway" "${test_name}" "${context}")
 check_http_status "${vip}" 404
 
 kubectl --context "${context}" apply -f ingress/single-cluster/ingress-asm-multi-backendconfig/backend-services.yaml -n "${test_name}"
+label_resources "${context}" "${test_name}"
 check_http_status "${vip}" 200 "host: foo.example.com"
 check_http_status "${vip}" 302 "host: bar.example.com"
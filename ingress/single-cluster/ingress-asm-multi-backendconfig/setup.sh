@@ -20,16 +20,16 @@ set -o pipefail;
 set -o xtrace;
 
 if [[ -z "${SUPPORT_EMAIL-}" ]]; then
-    echo "Required environment variable is not set. See ingress-asm-multi-backendconfig/REAME.md for details."
-    exit 0
+    echo "Required environment variable is not set. See ingress-asm-multi-backendconfig/README.md for details." >&2
+    exit 1
 fi
 
 source ./test/helper.sh
-test_name="ingress-asm-multi-backendconfig"
+test_name="asm-multi-bc"
 
 project=$( gcloud config get-value project 2>&1 | head -n 1 )
-suffix=$(get_hash "${test_name}")
-resource_name="gke-net-recipes-${suffix}"
+resource_name=$(get_resource_name "${test_name}")
+labels=$(get_resource_labels "${test_name}")
 network="${resource_name}"
 subnet="${resource_name}"
 instance="${resource_name}"
@@ -45,7 +45,8 @@ gcloud compute instances create "${instance}" \
     --subnet="${subnet}" \
     --image-family="debian-11" \
     --image-project="debian-cloud" \
-    --tags="allow-ssh"
+    --tags="allow-ssh" \
+    --labels="${labels}"
 gcloud container clusters create "${cluster}" \
     --zone="${ZONE}" \
     --enable-ip-alias \
@@ -53,7 +54,8 @@ gcloud container clusters create "${cluster}" \
     --workload-pool="${project}.svc.id.goog" \
     --release-channel rapid \
     --network="${network}" \
-    --subnetwork="${subnet}"
+    --subnetwork="${subnet}" \
+    --labels="${labels}"
 gcloud container clusters get-credentials "${cluster}" --zone="${ZONE}"
 context=$(get_context "${test_name}")
 
@@ -61,7 +63,7 @@ if [[ -z "${context}" ]]; then
     exit 1
 fi
 
-kubectl --context "${context}" create namespace "${test_name}"
+create_namespace "${context}" "${test_name}"
 
 # Install Gateway CRD with istioctl.
 curl -L https://istio.io/downloadIstio | sh -
@@ -108,3 +110,4 @@ kubectl --context "${context}" apply \
         -f ingress/single-cluster/ingress-asm-multi-backendconfig/asm/samples/gateways/istio-ingressgateway/role.yaml \
         -f ingress/single-cluster/ingress-asm-multi-backendconfig/asm/samples/gateways/istio-ingressgateway/deployment.yaml \
         -f ingress/single-cluster/ingress-asm-multi-backendconfig/istio-ingressgateway-service.yaml
+label_resources "${context}" "${test_name}"
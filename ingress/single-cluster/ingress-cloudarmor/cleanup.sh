@@ -22,6 +22,7 @@ set -o xtrace;
 source ./test/helper.sh
 test_name="ingress-cloudarmor"
 context=$(get_context "${test_name}")
+policy_name=$(get_resource_name "${test_name}" "allow-my-ip")
 
 if [[ ! -z "${context}" ]]; then
     ingress_name="cloudarmor-test"
@@ -34,12 +35,12 @@ if [[ ! -z "${context}" ]]; then
 
     resource_yaml="ingress/single-cluster/ingress-cloudarmor/cloudarmor-ingress.yaml"
     kubectl --context "${context}" delete -f "${resource_yaml}" -n "${test_name}" || true
-    sed -i'.bak' "s/allow-my-ip/\$POLICY_NAME/g" "${resource_yaml}"
+    sed -i'.bak' "s/${policy_name}/\$POLICY_NAME/g" "${resource_yaml}"
     rm -f "${resource_yaml}".bak
     wait_for_glbc_deletion "${fr}" "${thp}" "${thsp}" "${um}" "${backends}" "${negs}"
     kubectl --context "${context}" delete namespace "${test_name}" || true
 fi
 
-gcloud compute security-policies delete allow-my-ip --quiet || true
+gcloud compute security-policies delete "${policy_name}" --quiet || true
 
 cleanup_gke_basic "${test_name}" "${ZONE}" "${REGION}"
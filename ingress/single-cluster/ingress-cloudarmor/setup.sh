@@ -28,10 +28,10 @@ if [[ -z "${context}" ]]; then
     exit 1
 fi
 
-kubectl --context "${context}" create namespace "${test_name}"
+create_namespace "${context}" "${test_name}"
 
 currentIP=$(curl -s ifconfig.me)
-policy_name="allow-my-ip"
+policy_name=$(get_resource_name "${test_name}" "allow-my-ip")
 gcloud compute security-policies create "${policy_name}"
 gcloud compute security-policies rules update 2147483647 \
     --security-policy "${policy_name}" \
@@ -44,3 +44,4 @@ gcloud compute security-policies rules create 1000 \
 resource_yaml="ingress/single-cluster/ingress-cloudarmor/cloudarmor-ingress.yaml"
 sed -i'.bak' "s/\$POLICY_NAME/${policy_name}/g" "${resource_yaml}"
 kubectl --context "${context}" apply -f "${resource_yaml}" -n "${test_name}"
+label_resources "${context}" "${test_name}"
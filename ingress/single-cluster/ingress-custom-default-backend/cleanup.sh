@@ -20,7 +20,7 @@ set -o pipefail;
 set -o xtrace;
 
 source ./test/helper.sh
-test_name="ingress-custom-default-backend"
+test_name="ingress-default-backend"
 context=$(get_context "${test_name}")
 
 if [[ ! -z "${context}" ]]; then
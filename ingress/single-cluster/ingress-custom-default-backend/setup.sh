@@ -20,7 +20,7 @@ set -o pipefail;
 set -o xtrace;
 
 source ./test/helper.sh
-test_name="ingress-custom-default-backend"
+test_name="ingress-default-backend"
 setup_gke_basic "${test_name}" "${ZONE}" "${REGION}"
 context=$(get_context "${test_name}")
 
@@ -30,5 +30,6 @@ fi
 
 setup_ilb "${test_name}" "${REGION}"
 
-kubectl --context "${context}" create namespace "${test_name}"
+create_namespace "${context}" "${test_name}"
 kubectl --context "${context}" apply -f ingress/single-cluster/ingress-custom-default-backend/ingress-custom-default-backend.yaml -n "${test_name}"
+label_resources "${context}" "${test_name}"
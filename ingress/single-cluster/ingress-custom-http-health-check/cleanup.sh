@@ -20,7 +20,7 @@ set -o pipefail;
 set -o xtrace;
 
 source ./test/helper.sh
-test_name="ingress-custom-http-health-check"
+test_name="ingress-custom-http-hc"
 context=$(get_context "${test_name}")
 
 if [[ ! -z "${context}" ]]; then
@@ -20,7 +20,7 @@ set -o pipefail;
 set -o xtrace;
 
 source ./test/helper.sh
-test_name="ingress-custom-http-health-check"
+test_name="ingress-custom-http-hc"
 setup_gke_basic "${test_name}" "${ZONE}" "${REGION}"
 context=$(get_context "${test_name}")
 
@@ -28,5 +28,6 @@ if [[ -z "${context}" ]]; then
     exit 1
 fi
 
-kubectl --context "${context}" create namespace "${test_name}"
+create_namespace "${context}" "${test_name}"
 kubectl --context "${context}" apply -f ingress/single-cluster/ingress-custom-http-health-check/custom-http-hc-ingress.yaml -n "${test_name}"
+label_resources "${context}" "${test_name}"
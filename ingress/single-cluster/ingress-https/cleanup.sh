@@ -20,16 +20,19 @@ set -o pipefail;
 set -o xtrace;
 
 if [[ -z "${DNS_PROJECT-}" ||  -z "${DNS_ZONE-}" ||  -z "${DNS_NAME-}" ]]; then
-    echo "Required environment variables are not set. See ingress-https/REAME.md for details."
-    exit 0
+    echo "Required environment variables are not set. See ingress-https/README.md for details." >&2
+    exit 1
 fi
 
 source ./test/helper.sh
 test_name="ingress-https"
 context=$(get_context "${test_name}")
 
-foo_dns_record="foo.${DNS_NAME}"
-bar_dns_record="bar.${DNS_NAME}"
+static_ip_name=$(get_resource_name "${test_name}" "ip")
+ssl_policy_name=$(get_resource_name "${test_name}" "ssl-policy")
+dns_suffix=$(get_resource_suffix "${test_name}")
+foo_dns_record="foo-${dns_suffix:0:8}.${DNS_NAME}"
+bar_dns_record="bar-${dns_suffix:0:8}.${DNS_NAME}"
 
 if [[ ! -z "${context}" ]]; then
     ingress_name="secure-ingress"
@@ -44,13 +47,15 @@ if [[ ! -z "${context}" ]]; then
     kubectl --context "${context}" delete -f "${resource_yaml}" -n "${test_name}" || true
     sed -i'.bak' "s/${foo_dns_record}/foo.\${DOMAIN}.com/g" "${resource_yaml}"
     sed -i'.bak' "s/${bar_dns_record}/bar.\${DOMAIN}.com/g" "${resource_yaml}"
+    sed -i'.bak' "s/${static_ip_name}/gke-foobar-public-ip/g" "${resource_yaml}"
+    sed -i'.bak' "s/${ssl_policy_name}/gke-ingress-ssl-policy-https/g" "${resource_yaml}"
     rm -f "${resource_yaml}".bak
     wait_for_glbc_deletion "${fr}" "${thp}" "${thsp}" "${um}" "${backends}" "${negs}"
     kubectl --context "${context}" delete namespace "${test_name}" || true
 fi
 
-gcloud compute ssl-policies delete gke-ingress-ssl-policy-https --quiet || true
-gcloud compute addresses delete --global gke-foobar-public-ip --quiet || true
+gcloud compute ssl-policies delete "${ssl_policy_name}" --quiet || true
+gcloud compute addresses delete --global "${static_ip_name}" --quiet || true
 gcloud dns --project="${DNS_PROJECT}" record-sets delete "${foo_dns_record}" \
     --zone="${DNS_ZONE}" \
     --type="A" || true
@@ -20,8 +20,8 @@ set -o pipefail;
 set -o xtrace;
 
 if [[ -z "${DNS_PROJECT-}" ||  -z "${DNS_ZONE-}" ||  -z "${DNS_NAME-}" ]]; then
-    echo "Required environment variables are not set. See ingress-https/REAME.md for details."
-    exit 0
+    echo "Required environment variables are not set. See ingress-https/README.md for details." >&2
+    exit 1
 fi
 
 source ./test/helper.sh
@@ -36,8 +36,9 @@ vip=$(wait_for_ingress_ip "secure-ingress" "${test_name}" "${context}")
 
 wait_for_managed_cert "foobar-certificate" "ingress-https" "${context}"
 
-foo_dns_record="foo.${DNS_NAME}"
-bar_dns_record="bar.${DNS_NAME}"
+dns_suffix=$(get_resource_suffix "${test_name}")
+foo_dns_record="foo-${dns_suffix:0:8}.${DNS_NAME}"
+bar_dns_record="bar-${dns_suffix:0:8}.${DNS_NAME}"
 check_http_status "https://${foo_dns_record}" 200
 check_http_status "https://${bar_dns_record}" 200
 check_http_status "http://${foo_dns_record}" 301
@@ -20,8 +20,8 @@ set -o pipefail;
 set -o xtrace;
 
 if [[ -z "${DNS_PROJECT-}" ||  -z "${DNS_ZONE-}" ||  -z "${DNS_NAME-}" ]]; then
-    echo "Required environment variables are not set. See ingress-https/REAME.md for details."
-    exit 0
+    echo "Required environment variables are not set. See ingress-https/README.md for details." >&2
+    exit 1
 fi
 
 source ./test/helper.sh
@@ -33,15 +33,19 @@ if [[ -z "${context}" ]]; then
     exit 1
 fi
 
-kubectl --context "${context}" create namespace "${test_name}"
+create_namespace "${context}" "${test_name}"
 
-static_ip_name=gke-foobar-public-ip
+static_ip_name=$(get_resource_name "${test_name}" "ip")
+ssl_policy_name=$(get_resource_name "${test_name}" "ssl-policy")
 gcloud compute addresses create --global "${static_ip_name}"
+gcloud compute addresses update --global "${static_ip_name}" \
+    --update-labels="$(get_resource_labels "${test_name}")"
 static_ip=$(gcloud compute addresses describe --global "${static_ip_name}" --format="value(address)")
-gcloud compute ssl-policies create gke-ingress-ssl-policy-https --profile MODERN --min-tls-version 1.2
+gcloud compute ssl-policies create "${ssl_policy_name}" --profile MODERN --min-tls-version 1.2
 
-foo_dns_record="foo.${DNS_NAME}"
-bar_dns_record="bar.${DNS_NAME}"
+dns_suffix=$(get_resource_suffix "${test_name}")
+foo_dns_record="foo-${dns_suffix:0:8}.${DNS_NAME}"
+bar_dns_record="bar-${dns_suffix:0:8}.${DNS_NAME}"
 gcloud dns --project="${DNS_PROJECT}" record-sets create "${foo_dns_record}" \
     --zone="${DNS_ZONE}" \
     --type="A" \
@@ -56,4 +60,7 @@ gcloud dns --project="${DNS_PROJECT}" record-sets create "${bar_dns_record}" \
 resource_yaml="ingress/single-cluster/ingress-https/secure-ingress.yaml"
 sed -i'.bak' "s/foo.\${DOMAIN}.com/${foo_dns_record}/g" "${resource_yaml}"
 sed -i'.bak' "s/bar.\${DOMAIN}.com/${bar_dns_record}/g" "${resource_yaml}"
+sed -i'.bak' "s/gke-foobar-public-ip/${static_ip_name}/g" "${resource_yaml}"
+sed -i'.bak' "s/gke-ingress-ssl-policy-https/${ssl_policy_name}/g" "${resource_yaml}"
 kubectl --context "${context}" apply -f "${resource_yaml}" -n "${test_name}"
+label_resources "${context}" "${test_name}"
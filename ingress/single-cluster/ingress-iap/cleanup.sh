@@ -20,15 +20,17 @@ set -o pipefail;
 set -o xtrace;
 
 if [[ -z "${DNS_PROJECT-}" ||  -z "${DNS_ZONE-}" ||  -z "${DNS_NAME-}" || -z "${SUPPORT_EMAIL-}" ]]; then
-    echo "Required environment variables are not set. See ingress-iap/REAME.md for details."
-    exit 0
+    echo "Required environment variables are not set. See ingress-iap/README.md for details." >&2
+    exit 1
 fi
 
 source ./test/helper.sh
 test_name="ingress-iap"
 context=$(get_context "${test_name}")
 
-iap_dns_record="iap.${DNS_NAME}"
+static_ip_name=$(get_resource_name "${test_name}" "ip")
+dns_suffix=$(get_resource_suffix "${test_name}")
+iap_dns_record="iap-${dns_suffix:0:8}.${DNS_NAME}"
 
 if [[ ! -z "${context}" ]]; then
     ingress_name="iap-test"
@@ -42,6 +44,7 @@ if [[ ! -z "${context}" ]]; then
     resource_yaml="ingress/single-cluster/ingress-iap/iap-ingress.yaml"
     kubectl --context "${context}" delete -f "${resource_yaml}" -n "${test_name}" || true
     sed -i'.bak' "s/${iap_dns_record}/\$DOMAIN/g" "${resource_yaml}"
+    sed -i'.bak' "s/global-static-ip-name: ${static_ip_name}/global-static-ip-name: iap-test/g" "${resource_yaml}"
     rm -f "${resource_yaml}".bak
     wait_for_glbc_deletion "${fr}" "${thp}" "${thsp}" "${um}" "${backends}" "${negs}"
 
@@ -53,7 +56,7 @@ brand=$(get_or_create_oauth_brand "${SUPPORT_EMAIL}")
 result=( $(get_oauth_client "${brand}" "${test_name}") )
 oauth_client_name="${result[0]}"
 gcloud iap oauth-clients delete "${oauth_client_name}" --brand="${brand}" --quiet || true
-gcloud compute addresses delete --global "iap-test" --quiet || true
+gcloud compute addresses delete --global "${static_ip_name}" --quiet || true
 gcloud dns --project="${DNS_PROJECT}" record-sets delete "${iap_dns_record}" \
     --zone="${DNS_ZONE}" \
     --type="A" || true
@@ -20,8 +20,8 @@ set -o pipefail;
 set -o xtrace;
 
 if [[ -z "${DNS_PROJECT-}" ||  -z "${DNS_ZONE-}" ||  -z "${DNS_NAME-}" || -z "${SUPPORT_EMAIL-}" ]]; then
-    echo "Required environment variables are not set. See ingress-iap/REAME.md for details."
-    exit 0
+    echo "Required environment variables are not set. See ingress-iap/README.md for details." >&2
+    exit 1
 fi
 
 source ./test/helper.sh
@@ -36,5 +36,6 @@ vip=$(wait_for_ingress_ip "iap-test" "${test_name}" "${context}")
 
 wait_for_managed_cert "iap-test" "${test_name}" "${context}"
 
-iap_dns_record="iap.${DNS_NAME}"
+dns_suffix=$(get_resource_suffix "${test_name}")
+iap_dns_record="iap-${dns_suffix:0:8}.${DNS_NAME}"
 check_http_status "https://${iap_dns_record}" 302 "" "" "" "insecure"
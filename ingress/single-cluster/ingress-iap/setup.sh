@@ -20,8 +20,8 @@ set -o pipefail;
 set -o xtrace;
 
 if [[ -z "${DNS_PROJECT-}" ||  -z "${DNS_ZONE-}" ||  -z "${DNS_NAME-}" || -z "${SUPPORT_EMAIL-}" ]]; then
-    echo "Required environment variables are not set. See ingress-iap/REAME.md for details."
-    exit 0
+    echo "Required environment variables are not set. See ingress-iap/README.md for details." >&2
+    exit 1
 fi
 
 source ./test/helper.sh
@@ -33,13 +33,16 @@ if [[ -z "${context}" ]]; then
     exit 1
 fi
 
-kubectl --context "${context}" create namespace "${test_name}"
+create_namespace "${context}" "${test_name}"
 
-static_ip_name="iap-test"
+static_ip_name=$(get_resource_name "${test_name}" "ip")
 gcloud compute addresses create --global "${static_ip_name}"
+gcloud compute addresses update --global "${static_ip_name}" \
+    --update-labels="$(get_resource_labels "${test_name}")"
 static_ip=$(gcloud compute addresses describe --global "${static_ip_name}" --format="value(address)")
 
-iap_dns_record="iap.${DNS_NAME}"
+dns_suffix=$(get_resource_suffix "${test_name}")
+iap_dns_record="iap-${dns_suffix:0:8}.${DNS_NAME}"
 gcloud dns --project="${DNS_PROJECT}" record-sets create "${iap_dns_record}" \
     --zone="${DNS_ZONE}" \
     --type="A" \
@@ -58,4 +61,6 @@ kubectl --context "${context}" create secret generic iap-test \
 
 resource_yaml="ingress/single-cluster/ingress-iap/iap-ingress.yaml"
 sed -i'.bak' "s/\$DOMAIN/${iap_dns_record}/g" "${resource_yaml}"
+sed -i'.bak' "s/global-static-ip-name: iap-test/global-static-ip-name: ${static_ip_name}/g" "${resource_yaml}"
 kubectl --context "${context}" apply -f "${resource_yaml}" -n "${test_name}"
+label_resources "${context}" "${test_name}"
@@ -29,5 +29,6 @@ if [[ -z "${context}" ]]; then
     exit 1
 fi
 
-kubectl --context "${context}" create namespace "${test_name}"
+create_namespace "${context}" "${test_name}"
 kubectl --context "${context}" apply -f ingress/single-cluster/ingress-internal-basic/internal-ingress-basic.yaml -n "${test_name}"
+label_resources "${context}" "${test_name}"
@@ -28,7 +28,7 @@ if [[ -z "${context}" ]]; then
     exit 1
 fi
 
-kubectl --context "${context}" create namespace "${test_name}"
+create_namespace "${context}" "${test_name}"
 kubectl --context "${context}" create clusterrolebinding cluster-admin-binding \
   --clusterrole cluster-admin \
   --user $(gcloud config get-value account)
@@ -40,3 +40,4 @@ for ATTEMPT in $(seq 30); do
     fi
     sleep 10 # Wait for webhook to be fully setup.
 done
+label_resources "${context}" "${test_name}"
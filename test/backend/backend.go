@@ -0,0 +1,405 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package backend implements a test backend compatible with whereami, the
+// application of most recipes: it answers with the same JSON fields, and
+// records the requests it receives, so that tests can check requests the
+// clients can't see, e.g. the copies of a RequestMirror filter. Its failures
+// and latency are configurable, to exercise health checks, outlier detection
+// and retry policies deterministically.
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Paths of the admin endpoints, which are not recorded.
+const (
+	// RequestsPath serves the recorded requests, oldest first, as a JSON
+	// array of Request. A DELETE forgets them.
+	RequestsPath = "/admin/requests"
+	// HealthPath answers OK while the backend is ready, and 503 otherwise.
+	HealthPath = "/healthz"
+	// ReadinessPath serves the readiness of the backend, ready or unready.
+	// A POST with ready=true or ready=false in its query sets it.
+	ReadinessPath = "/admin/readiness"
+)
+
+// Headers of the requests overriding the configuration of the backend for
+// the request, e.g. to fail a single request.
+const (
+	// StatusHeader sets the status code of the response, e.g. 503.
+	StatusHeader = "X-Backend-Status"
+	// LatencyHeader delays the response, e.g. 100ms.
+	LatencyHeader = "X-Backend-Latency"
+)
+
+// DefaultRecordedRequests is the default number of requests recorded.
+const DefaultRecordedRequests = 1000
+
+// Config configures the fields of the responses, the pod, node and cluster
+// the backend runs on.
+type Config struct {
+	// Metadata is a free form value identifying the backend, e.g.
+	// sample-app-blue, set like whereami from the METADATA environment
+	// variable.
+	Metadata       string
+	PodName        string
+	PodNamespace   string
+	PodIP          string
+	ServiceAccount string
+	NodeName       string
+	ClusterName    string
+	ProjectID      string
+	Zone           string
+	// EchoHeaders adds the headers of the request to the responses, like
+	// whereami with ECHO_HEADERS=True.
+	EchoHeaders bool
+	// RecordedRequests is the number of requests recorded, the most recent
+	// ones, DefaultRecordedRequests if 0.
+	RecordedRequests int
+	// Status is the status code of the responses, 200 if 0, e.g. 503 for a
+	// failing backend.
+	Status int
+	// StatusEvery restricts Status to one request out of StatusEvery, e.g.
+	// 3 for the third, sixth... requests, the others being answered with
+	// 200. Status applies to all the requests if it is 0 or 1.
+	StatusEvery int
+	// Latency delays the responses.
+	Latency time.Duration
+	// Unready starts the backend unready: its health checks fail until it
+	// is set ready, see ReadinessPath.
+	Unready bool
+}
+
+// ConfigFromEnv returns the configuration set by the environment variables
+// whereami reads, looked up with getenv.
+func ConfigFromEnv(getenv func(string) string) Config {
+	return Config{
+		Metadata:       getenv("METADATA"),
+		PodName:        getenv("POD_NAME"),
+		PodNamespace:   getenv("POD_NAMESPACE"),
+		PodIP:          getenv("POD_IP"),
+		ServiceAccount: getenv("POD_SERVICE_ACCOUNT"),
+		NodeName:       getenv("NODE_NAME"),
+		EchoHeaders:    strings.EqualFold(getenv("ECHO_HEADERS"), "true"),
+	}
+}
+
+// GCEMetadataURL is the URL of the GCE metadata server.
+const GCEMetadataURL = "http://metadata.google.internal/computeMetadata/v1"
+
+// LookupGCE sets the cluster, project and zone of c which are empty from the
+// GCE metadata server at url, e.g. GCEMetadataURL. It returns an error if the
+// server can't be reached, e.g. outside of GCE.
+func (c *Config) LookupGCE(ctx context.Context, client *http.Client, url string) error {
+	for _, f := range []struct {
+		field *string
+		path  string
+	}{
+		{&c.ClusterName, "/instance/attributes/cluster-name"},
+		{&c.ProjectID, "/project/project-id"},
+		{&c.Zone, "/instance/zone"},
+	} {
+		if *f.field != "" {
+			continue
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+f.path, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("GET %s: %s", f.path, resp.Status)
+		}
+		// The zone is projects/NUMBER/zones/ZONE.
+		*f.field = path.Base(strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
+// Request is a request received by the backend.
+type Request struct {
+	Time       time.Time         `json:"time"`
+	Method     string            `json:"method"`
+	Host       string            `json:"host"`
+	Path       string            `json:"path"`
+	RemoteAddr string            `json:"remoteAddr"`
+	Headers    map[string]string `json:"headers"`
+}
+
+// Server is a whereami-compatible backend.
+type Server struct {
+	config Config
+	now    func() time.Time
+	sleep  func(ctx context.Context, d time.Duration)
+	health *health.Server
+
+	mu       sync.Mutex
+	requests []Request
+	// served is the number of requests served, admin requests excluded.
+	served int
+	ready  bool
+}
+
+// NewServer returns a backend answering with the fields of config.
+func NewServer(config Config) *Server {
+	if config.RecordedRequests == 0 {
+		config.RecordedRequests = DefaultRecordedRequests
+	}
+	s := &Server{config: config, now: time.Now, sleep: sleep, health: health.NewServer()}
+	s.SetReady(!config.Unready)
+	return s
+}
+
+// SetReady sets the readiness of the backend, reported by HealthPath and by
+// its gRPC health service.
+func (s *Server) SetReady(ready bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ready = ready
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if ready {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	// The empty service is the health of the whole server.
+	s.health.SetServingStatus("", status)
+}
+
+// Ready returns the readiness of the backend.
+func (s *Server) Ready() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ready
+}
+
+// RegisterGRPC registers the gRPC health service of the backend, following
+// its readiness, on g, for gRPC health checks.
+func (s *Server) RegisterGRPC(g *grpc.Server) {
+	healthpb.RegisterHealthServer(g, s.health)
+}
+
+// Requests returns the recorded requests, oldest first.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// ServeHTTP answers like whereami: with the JSON fields describing the
+// backend, or with the value of one field for the path named after it, e.g.
+// /metadata. Requests to other paths are answered like /.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.URL.Path {
+	case HealthPath:
+		if !s.Ready() {
+			http.Error(w, "Unready", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "OK")
+		return
+	case RequestsPath:
+		s.handleRequests(w, req)
+		return
+	case ReadinessPath:
+		s.handleReadiness(w, req)
+		return
+	}
+	status, latency, err := s.behavior(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if latency > 0 {
+		s.sleep(req.Context(), latency)
+	}
+
+	fields := s.fields(req)
+	if value, ok := fields[strings.TrimPrefix(req.URL.Path, "/")]; ok {
+		if v, ok := value.(string); ok {
+			w.WriteHeader(status)
+			fmt.Fprint(w, v)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(fields)
+}
+
+// behavior records req and returns the status code and the latency of its
+// response, from the configuration of the backend or the headers of req.
+func (s *Server) behavior(req *http.Request) (int, time.Duration, error) {
+	s.record(req)
+	s.mu.Lock()
+	s.served++
+	n := s.served
+	s.mu.Unlock()
+
+	status, latency := http.StatusOK, s.config.Latency
+	if s.config.Status != 0 && (s.config.StatusEvery <= 1 || n%s.config.StatusEvery == 0) {
+		status = s.config.Status
+	}
+	if v := req.Header.Get(StatusHeader); v != "" {
+		code, err := strconv.Atoi(v)
+		if err != nil || code < 100 || code > 599 {
+			return 0, 0, fmt.Errorf("invalid %s %q", StatusHeader, v)
+		}
+		status = code
+	}
+	if v := req.Header.Get(LatencyHeader); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return 0, 0, fmt.Errorf("invalid %s %q", LatencyHeader, v)
+		}
+		latency = d
+	}
+	return status, latency, nil
+}
+
+// fields returns the fields of the response to req, named like the fields
+// of whereami.
+func (s *Server) fields(req *http.Request) map[string]interface{} {
+	c := s.config
+	fields := map[string]interface{}{
+		"cluster_name":        c.ClusterName,
+		"host_header":         req.Host,
+		"metadata":            c.Metadata,
+		"node_name":           c.NodeName,
+		"pod_ip":              c.PodIP,
+		"pod_name":            c.PodName,
+		"pod_name_emoji":      emoji(c.PodName),
+		"pod_namespace":       c.PodNamespace,
+		"pod_service_account": c.ServiceAccount,
+		"project_id":          c.ProjectID,
+		"timestamp":           s.now().UTC().Format("2006-01-02T15:04:05"),
+		"zone":                c.Zone,
+	}
+	if c.EchoHeaders {
+		fields["headers"] = headers(req)
+	}
+	return fields
+}
+
+// record records req, forgetting the oldest request if there are too many.
+func (s *Server) record(req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, Request{
+		Time:       s.now(),
+		Method:     req.Method,
+		Host:       req.Host,
+		Path:       req.URL.RequestURI(),
+		RemoteAddr: req.RemoteAddr,
+		Headers:    headers(req),
+	})
+	if n := len(s.requests) - s.config.RecordedRequests; n > 0 {
+		s.requests = append([]Request(nil), s.requests[n:]...)
+	}
+}
+
+func (s *Server) handleRequests(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		requests := s.Requests()
+		if requests == nil {
+			requests = []Request{}
+		}
+		if err := json.NewEncoder(w).Encode(requests); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	case http.MethodDelete:
+		s.mu.Lock()
+		s.requests = nil
+		s.mu.Unlock()
+	default:
+		http.Error(w, fmt.Sprintf("Method %v, %s only accepts GET and DELETE.", req.Method, req.URL.Path), http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleReadiness(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		ready, err := strconv.ParseBool(req.URL.Query().Get("ready"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid ready %q.", req.URL.Query().Get("ready")), http.StatusBadRequest)
+			return
+		}
+		s.SetReady(ready)
+	default:
+		http.Error(w, fmt.Sprintf("Method %v, %s only accepts GET and POST.", req.Method, req.URL.Path), http.StatusMethodNotAllowed)
+		return
+	}
+	if s.Ready() {
+		fmt.Fprintln(w, "ready")
+	} else {
+		fmt.Fprintln(w, "unready")
+	}
+}
+
+// sleep waits for d, or until ctx is done, e.g. when the client gives up.
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
+
+// headers returns the headers of req, with their canonical names. The values
+// of repeated headers are joined with commas.
+func headers(req *http.Request) map[string]string {
+	h := make(map[string]string, len(req.Header))
+	for k, v := range req.Header {
+		h[k] = strings.Join(v, ",")
+	}
+	return h
+}
+
+// emojis are the emojis identifying the pods at a glance, like the
+// pod_name_emoji of whereami.
+var emojis = []string{"🐳", "🦄", "🐙", "🦊", "🐢", "🦉", "🐝", "🦋", "🍄", "🌵", "🌻", "🍉", "🚀", "🎈", "🗄", "🧭"}
+
+// emoji returns the emoji of a pod, derived from its name.
+func emoji(podName string) string {
+	h := fnv.New32a()
+	h.Write([]byte(podName))
+	return emojis[h.Sum32()%uint32(len(emojis))]
+}
@@ -0,0 +1,265 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func get(t *testing.T, h http.Handler, method, path string, header http.Header) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w.Result()
+}
+
+func body(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestServeHTTP(t *testing.T) {
+	s := NewServer(Config{Metadata: "sample-app-blue", PodName: "sample-app-1", ClusterName: "gke-1", Zone: "us-west1-a"})
+	s.now = func() time.Time { return time.Date(2023, 4, 22, 6, 57, 33, 0, time.UTC) }
+
+	resp := get(t, s, http.MethodGet, "/", nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("GET / = %s %q, want a JSON response", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(body(t, resp)), &fields); err != nil {
+		t.Fatalf("GET / = %v, want JSON", err)
+	}
+	for k, want := range map[string]string{
+		"metadata":     "sample-app-blue",
+		"pod_name":     "sample-app-1",
+		"cluster_name": "gke-1",
+		"zone":         "us-west1-a",
+		"host_header":  "example.com",
+		"timestamp":    "2023-04-22T06:57:33",
+	} {
+		if fields[k] != want {
+			t.Errorf("GET / field %s = %v, want %q", k, fields[k], want)
+		}
+	}
+	if _, ok := fields["headers"]; ok {
+		t.Errorf("GET / has headers, want them only with EchoHeaders")
+	}
+	if got := body(t, get(t, s, http.MethodGet, "/metadata", nil)); got != "sample-app-blue" {
+		t.Errorf("GET /metadata = %q, want %q", got, "sample-app-blue")
+	}
+	if got := body(t, get(t, s, http.MethodGet, HealthPath, nil)); got != "OK\n" {
+		t.Errorf("GET %s = %q, want OK", HealthPath, got)
+	}
+
+	echo := NewServer(Config{EchoHeaders: true})
+	resp = get(t, echo, http.MethodGet, "/", http.Header{"X-Probe-Id": {"42"}})
+	if got := body(t, resp); !strings.Contains(got, `"headers":{"X-Probe-Id":"42"}`) {
+		t.Errorf("GET / = %s, want the headers of the request", got)
+	}
+}
+
+func TestRecordedRequests(t *testing.T) {
+	s := NewServer(Config{RecordedRequests: 2})
+	for i := 0; i < 3; i++ {
+		get(t, s, http.MethodGet, fmt.Sprintf("/path?i=%d", i), http.Header{"X-Probe-Id": {fmt.Sprint(i)}})
+	}
+	get(t, s, http.MethodGet, HealthPath, nil)
+
+	resp := get(t, s, http.MethodGet, RequestsPath, nil)
+	var requests []Request
+	if err := json.Unmarshal([]byte(body(t, resp)), &requests); err != nil {
+		t.Fatalf("GET %s = %v, want JSON", RequestsPath, err)
+	}
+	var got []string
+	for _, r := range requests {
+		got = append(got, r.Method+" "+r.Path+" "+r.Headers["X-Probe-Id"])
+	}
+	if want := "GET /path?i=1 1, GET /path?i=2 2"; strings.Join(got, ", ") != want {
+		t.Errorf("GET %s = %q, want the 2 most recent requests %q", RequestsPath, got, want)
+	}
+
+	get(t, s, http.MethodDelete, RequestsPath, nil)
+	if got := body(t, get(t, s, http.MethodGet, RequestsPath, nil)); got != "[]\n" {
+		t.Errorf("GET %s = %q after DELETE, want no requests", RequestsPath, got)
+	}
+	if resp := get(t, s, http.MethodPost, RequestsPath, nil); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST %s = %s, want %d", RequestsPath, resp.Status, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	s := NewServer(Config{Metadata: "sample-app", Status: http.StatusServiceUnavailable, StatusEvery: 3})
+	var got []int
+	for i := 0; i < 6; i++ {
+		got = append(got, get(t, s, http.MethodGet, "/", nil).StatusCode)
+	}
+	if want := "[200 200 503 200 200 503]"; fmt.Sprint(got) != want {
+		t.Errorf("GET / = %v, want %s", got, want)
+	}
+	resp := get(t, s, http.MethodGet, "/metadata", http.Header{StatusHeader: {"429"}})
+	if resp.StatusCode != http.StatusTooManyRequests || body(t, resp) != "sample-app" {
+		t.Errorf("GET /metadata with %s = %s, want %d and the metadata", StatusHeader, resp.Status, http.StatusTooManyRequests)
+	}
+	if resp := get(t, s, http.MethodGet, "/", http.Header{StatusHeader: {"600"}}); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET / with an invalid %s = %s, want %d", StatusHeader, resp.Status, http.StatusBadRequest)
+	}
+
+	all := NewServer(Config{Status: http.StatusInternalServerError})
+	if resp := get(t, all, http.MethodGet, "/", nil); resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("GET / = %s, want %d for every request", resp.Status, http.StatusInternalServerError)
+	}
+	if resp := get(t, all, http.MethodGet, HealthPath, nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET %s = %s, want the health checks unaffected by the status", HealthPath, resp.Status)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	s := NewServer(Config{Latency: time.Second})
+	var sleeps []time.Duration
+	s.sleep = func(_ context.Context, d time.Duration) { sleeps = append(sleeps, d) }
+	get(t, s, http.MethodGet, "/", nil)
+	get(t, s, http.MethodGet, "/", http.Header{LatencyHeader: {"250ms"}})
+	get(t, s, http.MethodGet, HealthPath, nil)
+	if want := "[1s 250ms]"; fmt.Sprint(sleeps) != want {
+		t.Errorf("latencies = %v, want %s", sleeps, want)
+	}
+	if resp := get(t, s, http.MethodGet, "/", http.Header{LatencyHeader: {"soon"}}); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET / with an invalid %s = %s, want %d", LatencyHeader, resp.Status, http.StatusBadRequest)
+	}
+
+	// The actual sleep gives up with the client.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	sleep(ctx, time.Hour)
+	if time.Since(start) > time.Minute {
+		t.Errorf("sleep() didn't return when the context was done")
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	s := NewServer(Config{Unready: true})
+	if resp := get(t, s, http.MethodGet, HealthPath, nil); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("GET %s = %s, want %d when unready", HealthPath, resp.Status, http.StatusServiceUnavailable)
+	}
+	if got := body(t, get(t, s, http.MethodGet, ReadinessPath, nil)); got != "unready\n" {
+		t.Errorf("GET %s = %q, want unready", ReadinessPath, got)
+	}
+	if got := body(t, get(t, s, http.MethodPost, ReadinessPath+"?ready=true", nil)); got != "ready\n" {
+		t.Errorf("POST %s?ready=true = %q, want ready", ReadinessPath, got)
+	}
+	if resp := get(t, s, http.MethodGet, HealthPath, nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET %s = %s, want %d when ready", HealthPath, resp.Status, http.StatusOK)
+	}
+	if resp := get(t, s, http.MethodPost, ReadinessPath+"?ready=maybe", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST %s?ready=maybe = %s, want %d", ReadinessPath, resp.Status, http.StatusBadRequest)
+	}
+	if len(s.Requests()) != 0 {
+		t.Errorf("Requests() = %v, want the health checks and admin requests not recorded", s.Requests())
+	}
+}
+
+func TestGRPCHealth(t *testing.T) {
+	s := NewServer(Config{})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := grpc.NewServer()
+	s.RegisterGRPC(g)
+	go g.Serve(lis)
+	defer g.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Dial() = %v, want nil", err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, ready := range []bool{true, false} {
+		s.SetReady(ready)
+		want := healthpb.HealthCheckResponse_SERVING
+		if !ready {
+			want = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		if err != nil || resp.GetStatus() != want {
+			t.Errorf("Check() when ready is %v = %v, %v, want %v", ready, resp.GetStatus(), err, want)
+		}
+	}
+}
+
+func TestLookupGCE(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "missing Metadata-Flavor", http.StatusForbidden)
+			return
+		}
+		switch req.URL.Path {
+		case "/instance/attributes/cluster-name":
+			fmt.Fprint(w, "gke-1")
+		case "/project/project-id":
+			fmt.Fprint(w, "my-project")
+		case "/instance/zone":
+			fmt.Fprint(w, "projects/123/zones/us-west1-a")
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	c := Config{ProjectID: "set-project"}
+	if err := c.LookupGCE(context.Background(), server.Client(), server.URL); err != nil {
+		t.Fatalf("LookupGCE() = %v, want nil", err)
+	}
+	if c.ClusterName != "gke-1" || c.ProjectID != "set-project" || c.Zone != "us-west1-a" {
+		t.Errorf("LookupGCE() = %+v, want the cluster and zone of the server, and the project already set", c)
+	}
+	if err := (&Config{}).LookupGCE(context.Background(), server.Client(), server.URL+"/missing"); err == nil {
+		t.Errorf("LookupGCE() = nil, want an error for a missing field")
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	env := map[string]string{"METADATA": "sample-app-green", "POD_NAMESPACE": "mcgi-bg", "ECHO_HEADERS": "True"}
+	c := ConfigFromEnv(func(k string) string { return env[k] })
+	if c.Metadata != "sample-app-green" || c.PodNamespace != "mcgi-bg" || !c.EchoHeaders {
+		t.Errorf("ConfigFromEnv(%v) = %+v, want the metadata, namespace and echo of the headers", env, c)
+	}
+}
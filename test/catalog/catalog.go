@@ -0,0 +1,298 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package catalog generates the recipe catalog of the README.md of the
+// repository from the recipes.
+package catalog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/cost"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/manifest"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// The markers delimiting the generated recipe catalog in the README.md of
+// the repository.
+const (
+	Begin = "<!-- BEGIN RECIPE CATALOG: generated by `go run ./cmd/recipes catalog`, do not edit. -->"
+	End   = "<!-- END RECIPE CATALOG -->"
+)
+
+// sections are the sections of the catalog, in order.
+var sections = []struct {
+	category, title string
+}{
+	{"ingress", "Ingress"},
+	{"services", "Services"},
+	{"gateway", "Gateway"},
+	{"service-directory", "Service Directory"},
+	{"authz", "Authorization"},
+}
+
+// ignoredKinds are the kinds of objects which are not listed in the
+// catalog, used by most recipes to deploy their application.
+var ignoredKinds = map[string]bool{
+	"ClusterRole":        true,
+	"ClusterRoleBinding": true,
+	"ConfigMap":          true,
+	"DaemonSet":          true,
+	"Deployment":         true,
+	"Namespace":          true,
+	"Pod":                true,
+	"Role":               true,
+	"RoleBinding":        true,
+	"Secret":             true,
+	"ServiceAccount":     true,
+	"StatefulSet":        true,
+}
+
+var (
+	markdownLink  = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	sentenceBreak = regexp.MustCompile(`[.!?](\s|$)`)
+)
+
+// Entry is the entry of a recipe in the catalog.
+type Entry struct {
+	Recipe *recipe.Recipe
+	// Title is the title of its README.md.
+	Title string
+	// Summary is its description, or the first sentence of its README.md.
+	Summary string
+	// Kinds are the kinds of its objects, except the common ones.
+	Kinds []string
+	// LoadBalancers are the types of the load balancers it creates, e.g.
+	// "external global".
+	LoadBalancers []string
+	// Cost is the estimated cost of leaving it running.
+	Cost   *cost.Estimate
+	Tested bool
+}
+
+// NewEntry returns the catalog entry of a recipe, with its cost estimated
+// with prices.
+func NewEntry(r *recipe.Recipe, prices *cost.Prices) (*Entry, error) {
+	e := &Entry{Recipe: r, Title: r.Metadata.Title, Summary: r.Metadata.Description, Tested: r.Tested()}
+	b, err := os.ReadFile(filepath.Join(r.Dir, "README.md"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	readmeTitle, summary := readmeSummary(string(b))
+	if e.Title == "" {
+		e.Title = readmeTitle
+	}
+	if e.Title == "" {
+		e.Title = recipe.Title(r.Name())
+	}
+	if e.Summary == "" {
+		e.Summary = summary
+	}
+
+	d, err := recipe.Describe(r)
+	if err != nil {
+		return nil, err
+	}
+	if e.Cost, err = cost.ForRecipe(d, prices); err != nil {
+		return nil, err
+	}
+	kinds := make(map[string]bool)
+	lbs := make(map[string]bool)
+	for _, o := range d.Objects {
+		if !ignoredKinds[o.GetKind()] {
+			kinds[o.GetKind()] = true
+		}
+		if lb := loadBalancerType(o); lb != "" {
+			lbs[lb] = true
+		}
+	}
+	e.Kinds = sortedKeys(kinds)
+	e.LoadBalancers = sortedKeys(lbs)
+	return e, nil
+}
+
+// readmeSummary returns the title of a README, its first heading, and the
+// first sentence of its first paragraph, without links.
+func readmeSummary(readme string) (string, string) {
+	var heading string
+	var paragraph []string
+	for _, line := range strings.Split(readme, "\n") {
+		line = strings.TrimSpace(line)
+		if heading == "" {
+			if strings.HasPrefix(line, "# ") {
+				heading = strings.TrimSpace(strings.TrimPrefix(line, "# "))
+			}
+			continue
+		}
+		if !isProse(line) {
+			if len(paragraph) > 0 {
+				break
+			}
+			continue
+		}
+		paragraph = append(paragraph, line)
+	}
+	summary := markdownLink.ReplaceAllString(strings.Join(paragraph, " "), "$1")
+	if loc := sentenceBreak.FindStringIndex(summary); loc != nil {
+		summary = summary[:loc[0]+1]
+	}
+	return heading, strings.TrimSpace(summary)
+}
+
+// isProse returns true if a line of markdown is part of a paragraph of text,
+// not empty, a heading, a list, a table, a quote, an image or HTML.
+func isProse(line string) bool {
+	if line == "" {
+		return false
+	}
+	for _, prefix := range []string{"#", "```", "<", ">", "|", "* ", "- ", "!"} {
+		if strings.HasPrefix(line, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// loadBalancerType returns the type of the load balancer created for an
+// object, "external" or "internal" and "global" or "regional", or "" if it
+// doesn't create one.
+func loadBalancerType(o *manifest.Object) string {
+	switch o.GetKind() {
+	case "Ingress":
+		switch recipe.IngressClass(o) {
+		case "", "gce":
+			return "external global"
+		case "gce-internal":
+			return "internal regional"
+		}
+	case "MultiClusterIngress":
+		return "external global"
+	case "Gateway":
+		if !recipe.IsGatewayAPI(o) {
+			return ""
+		}
+		class, _, _ := unstructured.NestedString(o.Object, "spec", "gatewayClassName")
+		switch {
+		case strings.Contains(class, "cross-regional-internal"):
+			return "internal global"
+		case strings.Contains(class, "rilb") || strings.Contains(class, "regional-internal"):
+			return "internal regional"
+		case strings.Contains(class, "regional-external"):
+			return "external regional"
+		case strings.Contains(class, "xlb") || strings.Contains(class, "global-external"):
+			return "external global"
+		}
+	case "Service":
+		if typ, _, _ := unstructured.NestedString(o.Object, "spec", "type"); typ != "LoadBalancer" {
+			return ""
+		}
+		annotations := o.GetAnnotations()
+		if annotations["networking.gke.io/load-balancer-type"] == "Internal" || annotations["cloud.google.com/load-balancer-type"] == "Internal" {
+			return "internal regional"
+		}
+		return "external regional"
+	}
+	return ""
+}
+
+// Load returns the catalog entries of the recipes of the repository at root,
+// with their costs estimated with prices.
+func Load(root string, prices *cost.Prices) ([]*Entry, error) {
+	recipes, err := recipe.Discover(root)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	for _, r := range recipes {
+		e, err := NewEntry(r, prices)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe recipe %s: %w", r.Path, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Render renders entries as markdown tables, one per category, between Begin
+// and End, followed by a note on the costs estimated with prices.
+func Render(entries []*Entry, prices *cost.Prices) string {
+	var b strings.Builder
+	b.WriteString(Begin + "\n")
+	for _, section := range sections {
+		var rows []*Entry
+		for _, e := range entries {
+			if strings.HasPrefix(e.Recipe.Path, section.category+"/") {
+				rows = append(rows, e)
+			}
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n### %s\n\n", section.title)
+		b.WriteString("| Recipe | Summary | Resources | Load balancer | Est. cost | Tested |\n")
+		b.WriteString("| --- | --- | --- | --- | --- | --- |\n")
+		for _, e := range rows {
+			tested := "no"
+			if e.Tested {
+				tested = "yes"
+			}
+			fmt.Fprintf(&b, "| [%s](./%s) | %s | %s | %s | %s | %s |\n",
+				cell(e.Title), e.Recipe.Path, cell(e.Summary), cell(strings.Join(e.Kinds, ", ")), cell(strings.Join(e.LoadBalancers, ", ")), cell(e.Cost.String()), tested)
+		}
+	}
+	fmt.Fprintf(&b, "\nThe estimated costs are the monthly costs of leaving the load balancers of a recipe running, with the clusters and VMs created by its test scripts, "+
+		"in %s with the prices of version %s of the [price table](./test/cost/prices.yaml), without usage-based charges. "+
+		"A `+` marks resources without a price. See `go run ./cmd/recipes cost PATH` for the details.\n", prices.Currency, prices.Version)
+	b.WriteString("\n" + End)
+	return b.String()
+}
+
+// UpdateReadme returns readme with the section between Begin and End replaced
+// by catalog, as rendered by Render.
+func UpdateReadme(readme []byte, catalog string) ([]byte, error) {
+	begin := bytes.Index(readme, []byte(Begin))
+	end := bytes.Index(readme, []byte(End))
+	if begin < 0 || end < begin {
+		return nil, fmt.Errorf("no %q ... %q section", Begin, End)
+	}
+	var b bytes.Buffer
+	b.Write(readme[:begin])
+	b.WriteString(catalog)
+	b.Write(readme[end+len(End):])
+	return b.Bytes(), nil
+}
+
+// cell escapes s for a markdown table cell, "-" if empty.
+func cell(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
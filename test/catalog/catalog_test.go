@@ -0,0 +1,178 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catalog
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/cost"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/testfiles"
+)
+
+// repoRoot is the root of the repository, relative to this package.
+const repoRoot = "../.."
+
+func loadPrices(t *testing.T) *cost.Prices {
+	t.Helper()
+	prices, err := cost.LoadPrices("")
+	if err != nil {
+		t.Fatalf("LoadPrices() = %v, want nil", err)
+	}
+	return prices
+}
+
+func TestReadmeSummary(t *testing.T) {
+	for _, tc := range []struct {
+		readme, title, summary string
+	}{
+		{
+			readme:  "# Basic Ingress\n\n> **Note**\n> Read this.\n\nDeploys an [Ingress](https://example.com). It is basic.\n\n## Use-cases\n",
+			title:   "Basic Ingress",
+			summary: "Deploys an Ingress.",
+		},
+		{
+			readme:  "<!-- comment -->\n# Title\n![diagram](d.png)\nA summary\non two lines\n\nNot this one.",
+			title:   "Title",
+			summary: "A summary on two lines",
+		},
+		{readme: "no title"},
+	} {
+		title, summary := readmeSummary(tc.readme)
+		if title != tc.title || summary != tc.summary {
+			t.Errorf("readmeSummary(%q) = %q, %q, want %q, %q", tc.readme, title, summary, tc.title, tc.summary)
+		}
+	}
+}
+
+func TestNewEntry(t *testing.T) {
+	root := t.TempDir()
+	testfiles.Write(t, root, map[string]string{
+		"gateway/foo/README.md": "# Foo Gateway\n\nRoutes foo.\n",
+		"gateway/foo/foo.yaml": `
+apiVersion: gateway.networking.k8s.io/v1beta1
+kind: Gateway
+metadata:
+  name: internal
+spec:
+  gatewayClassName: gke-l7-rilb
+---
+apiVersion: gateway.networking.k8s.io/v1beta1
+kind: Gateway
+metadata:
+  name: external
+spec:
+  gatewayClassName: gke-l7-global-external-managed
+---
+apiVersion: gateway.networking.k8s.io/v1beta1
+kind: HTTPRoute
+metadata:
+  name: foo
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: foo
+`,
+		"gateway/foo/run-test.sh":       "",
+		"services/bar/gke-1/bar.yaml":   "apiVersion: v1\nkind: Service\nmetadata:\n  name: bar\nspec:\n  type: LoadBalancer\n",
+		"services/bar/README.md":        "# Bar\n",
+		"services/bar/recipe.yaml":      "title: Bar | Baz\ndescription: Declared.\n",
+		"ingress/missing-app/README.md": "# Missing\n",
+	})
+
+	prices := loadPrices(t)
+	entries, err := Load(root, prices)
+	if err != nil {
+		t.Fatalf("Load() = %v, want nil", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Load() = %d entries, want 2", len(entries))
+	}
+	foo := entries[0]
+	want := &Entry{
+		Recipe:        foo.Recipe,
+		Title:         "Foo Gateway",
+		Summary:       "Routes foo.",
+		Kinds:         []string{"Gateway", "HTTPRoute"},
+		LoadBalancers: []string{"external global", "internal regional"},
+		Cost:          foo.Cost,
+		Tested:        true,
+	}
+	if !reflect.DeepEqual(foo, want) {
+		t.Errorf("NewEntry(%s) = %+v, want %+v", foo.Recipe.Path, foo, want)
+	}
+	bar := entries[1]
+	if bar.Title != "Bar | Baz" || bar.Summary != "Declared." || !reflect.DeepEqual(bar.LoadBalancers, []string{"external regional"}) {
+		t.Errorf("NewEntry(%s) = %+v, want the declared title and summary, and the manifests of gke-1", bar.Recipe.Path, bar)
+	}
+
+	if got, want := bar.Cost.String(), "$18.25/month"; got != want {
+		t.Errorf("NewEntry(%s).Cost = %s, want %s for a forwarding rule", bar.Recipe.Path, got, want)
+	}
+
+	catalog := Render(entries, prices)
+	for _, want := range []string{
+		"### Services\n\n| Recipe |",
+		"| [Foo Gateway](./gateway/foo) | Routes foo. | Gateway, HTTPRoute | external global, internal regional | $0.00/month | yes |\n",
+		`| [Bar \| Baz](./services/bar) | Declared. | Service | external regional | $18.25/month | no |`,
+		"with the prices of version " + prices.Version + " of the [price table]",
+	} {
+		if !strings.Contains(catalog, want) {
+			t.Errorf("Render() = %s, want it to contain %q", catalog, want)
+		}
+	}
+	if strings.Contains(catalog, "### Ingress") {
+		t.Errorf("Render() = %s, want no empty section", catalog)
+	}
+}
+
+func TestUpdateReadme(t *testing.T) {
+	readme := "# Recipes\n\n" + Begin + "\nstale\n" + End + "\n\n## More\n"
+	got, err := UpdateReadme([]byte(readme), Begin+"\nfresh\n"+End)
+	if err != nil {
+		t.Fatalf("UpdateReadme() = %v, want nil", err)
+	}
+	if want := "# Recipes\n\n" + Begin + "\nfresh\n" + End + "\n\n## More\n"; string(got) != want {
+		t.Errorf("UpdateReadme() = %q, want %q", got, want)
+	}
+	if _, err := UpdateReadme([]byte("# Recipes\n"), "catalog"); err == nil {
+		t.Errorf("UpdateReadme() = nil, want an error without markers")
+	}
+}
+
+// TestCatalogUpToDate checks that the recipe catalog in the README.md of the
+// repository matches its recipes.
+func TestCatalogUpToDate(t *testing.T) {
+	prices := loadPrices(t)
+	entries, err := Load(repoRoot, prices)
+	if err != nil {
+		t.Fatalf("Load(%q) = %v, want nil", repoRoot, err)
+	}
+	readme, err := os.ReadFile(filepath.Join(repoRoot, "README.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err := UpdateReadme(readme, Render(entries, prices))
+	if err != nil {
+		t.Fatalf("UpdateReadme() = %v, want nil", err)
+	}
+	if string(updated) != string(readme) {
+		t.Errorf("The recipe catalog in README.md is stale, regenerate it with: go run ./cmd/recipes catalog")
+	}
+}
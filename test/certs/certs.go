@@ -0,0 +1,396 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package certs finds the certificates and private keys embedded in the
+// recipes, in PEM files and in the data of Secrets and ConfigMaps, and checks
+// that they are still usable: not about to expire, not relying on weak keys or
+// signature algorithms, valid for the hosts of the recipe, and matching each
+// other.
+package certs
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/manifest"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// DefaultExpiryWindow is how long before they expire certificates are
+// reported by default.
+const DefaultExpiryWindow = 30 * 24 * time.Hour
+
+// Minimum sizes of the keys, in bits, following the NIST recommendations.
+const (
+	MinRSABits   = 2048
+	MinECDSABits = 256
+)
+
+// Material is a certificate or a private key found in a recipe.
+type Material struct {
+	// Location is where the material is defined, e.g. a file, or the key of
+	// a Secret.
+	Location string
+	// Group is the set of material a private key must have its certificate
+	// in: the object defining it, or the files with the same name and
+	// another extension, e.g. server.crt and server.key.
+	Group string
+	// Exactly one of Cert and Key is set.
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+// Finding is a problem of the material at Location.
+type Finding struct {
+	Location string
+	Message  string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s", f.Location, f.Message)
+}
+
+// Options configure Check.
+type Options struct {
+	// Now is the time the validity of the certificates is checked at, the
+	// current time if zero.
+	Now time.Time
+	// ExpiryWindow is how long before they expire certificates are
+	// reported.
+	ExpiryWindow time.Duration
+}
+
+// dataField is a field of an object holding data by key.
+type dataField struct {
+	name   string
+	base64 bool
+}
+
+// dataFields are the fields holding data by kind of object.
+var dataFields = map[string][]dataField{
+	"Secret":    {{name: "data", base64: true}, {name: "stringData"}},
+	"ConfigMap": {{name: "data"}, {name: "binaryData", base64: true}},
+}
+
+// Find returns the certificates and private keys in data, read from file: the
+// PEM blocks of data, and for YAML files the PEM blocks in the data of its
+// Secrets and ConfigMaps, base64 encoded or not. The material which can't be
+// decoded is reported as findings.
+func Find(file string, data []byte) ([]Material, []Finding) {
+	group := strings.TrimSuffix(file, filepath.Ext(file))
+	materials, findings := decode(file, group, data)
+	if !isYAML(file) {
+		return materials, findings
+	}
+	// The YAML files which can't be parsed are reported by manifest.Lint.
+	objects, _ := manifest.Parse(file, data)
+	for _, o := range objects {
+		for _, field := range dataFields[o.GetKind()] {
+			values, _, _ := unstructured.NestedStringMap(o.Object, field.name)
+			keys := make([]string, 0, len(values))
+			for key := range values {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				location := fmt.Sprintf("%s, key %s", o, key)
+				value := []byte(values[key])
+				if field.base64 {
+					b, err := base64.StdEncoding.DecodeString(values[key])
+					if err != nil {
+						findings = append(findings, Finding{Location: location, Message: fmt.Sprintf("invalid base64 %s: %v", field.name, err)})
+						continue
+					}
+					value = b
+				}
+				m, f := decode(location, o.String(), value)
+				materials = append(materials, m...)
+				findings = append(findings, f...)
+			}
+		}
+	}
+	return materials, findings
+}
+
+// decode returns the certificates and private keys of the PEM blocks of data.
+// Other blocks, e.g. certificate requests, are ignored.
+func decode(location, group string, data []byte) ([]Material, []Finding) {
+	var materials []Material
+	var findings []Finding
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return materials, findings
+		}
+		m := Material{Location: location, Group: group}
+		var err error
+		switch block.Type {
+		case "CERTIFICATE":
+			m.Cert, err = x509.ParseCertificate(block.Bytes)
+		case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY":
+			m.Key, err = parseKey(block)
+		default:
+			continue
+		}
+		if err != nil {
+			findings = append(findings, Finding{Location: location, Message: fmt.Sprintf("invalid %s: %v", block.Type, err)})
+			continue
+		}
+		materials = append(materials, m)
+	}
+}
+
+// parseKey parses the private key of a PKCS #8, PKCS #1 or SEC 1 PEM block.
+func parseKey(block *pem.Block) (crypto.Signer, error) {
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// Check returns the problems of materials: certificates expiring within the
+// expiry window, weak keys and signature algorithms, server certificates
+// valid for none of hosts, and private keys matching no certificate of their
+// group.
+func Check(materials []Material, hosts []string, opts Options) []Finding {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	var findings []Finding
+	add := func(m Material, format string, args ...interface{}) {
+		findings = append(findings, Finding{Location: m.Location, Message: fmt.Sprintf(format, args...)})
+	}
+	for _, m := range materials {
+		if m.Key != nil {
+			if weak := weakKey(m.Key.Public()); weak != "" {
+				add(m, "private key is a weak %s", weak)
+			}
+			if !matchesCertificate(m, materials) {
+				add(m, "private key matches no certificate of %s", m.Group)
+			}
+			continue
+		}
+		cert := m.Cert
+		name := "certificate " + cert.Subject.String()
+		switch {
+		case now.After(cert.NotAfter):
+			add(m, "%s expired on %s", name, cert.NotAfter.Format(time.RFC3339))
+		case now.Add(opts.ExpiryWindow).After(cert.NotAfter):
+			add(m, "%s expires on %s, in less than %s", name, cert.NotAfter.Format(time.RFC3339), opts.ExpiryWindow)
+		case now.Before(cert.NotBefore):
+			add(m, "%s is not valid before %s", name, cert.NotBefore.Format(time.RFC3339))
+		}
+		if weakSignature(cert.SignatureAlgorithm) {
+			add(m, "%s is signed with the weak algorithm %s", name, cert.SignatureAlgorithm)
+		}
+		if weak := weakKey(cert.PublicKey); weak != "" {
+			add(m, "%s has a weak %s", name, weak)
+		}
+		if cert.IsCA || len(hosts) == 0 {
+			continue
+		}
+		if len(cert.DNSNames) == 0 && len(cert.IPAddresses) == 0 {
+			add(m, "%s has no subject alternative names, clients don't check the common name", name)
+			continue
+		}
+		matched := false
+		for _, host := range hosts {
+			matched = matched || validFor(cert, host)
+		}
+		if !matched {
+			add(m, "%s is valid for %s, none of the hosts of the recipe: %s", name, strings.Join(cert.DNSNames, ", "), strings.Join(hosts, ", "))
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Location < findings[j].Location })
+	return findings
+}
+
+// weakSignature returns whether certificates signed with alg can be forged.
+func weakSignature(alg x509.SignatureAlgorithm) bool {
+	switch alg {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		return true
+	}
+	return false
+}
+
+// weakKey describes the public key if it is too weak, or returns "".
+func weakKey(key crypto.PublicKey) string {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if bits := k.N.BitLen(); bits < MinRSABits {
+			return fmt.Sprintf("%d bits RSA key, want at least %d bits", bits, MinRSABits)
+		}
+	case *ecdsa.PublicKey:
+		if bits := k.Curve.Params().BitSize; bits < MinECDSABits {
+			return fmt.Sprintf("%d bits ECDSA key, want at least %d bits", bits, MinECDSABits)
+		}
+	case ed25519.PublicKey:
+	default:
+		return fmt.Sprintf("%T key of an unsupported type", key)
+	}
+	return ""
+}
+
+// matchesCertificate returns whether the private key of m is the one of a
+// certificate of its group.
+func matchesCertificate(m Material, materials []Material) bool {
+	public, ok := m.Key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return false
+	}
+	for _, c := range materials {
+		if c.Cert != nil && c.Group == m.Group && public.Equal(c.Cert.PublicKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// validFor returns whether cert is valid for host, which may be a wildcard.
+func validFor(cert *x509.Certificate, host string) bool {
+	if cert.VerifyHostname(host) == nil {
+		return true
+	}
+	for _, name := range cert.DNSNames {
+		if strings.EqualFold(name, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Hosts returns the host names the objects serve, sorted: the hosts of the
+// Ingresses, the hostnames of the Gateways and routes, and the domains of the
+// ManagedCertificates. The hosts set from environment variables by the test
+// scripts are skipped.
+func Hosts(objects []*manifest.Object) []string {
+	seen := make(map[string]bool)
+	var hosts []string
+	add := func(host string) {
+		if host != "" && !strings.Contains(host, "$") && !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	slice := func(obj map[string]interface{}, fields ...string) []map[string]interface{} {
+		items, _, _ := unstructured.NestedSlice(obj, fields...)
+		var maps []map[string]interface{}
+		for _, item := range items {
+			if m, ok := item.(map[string]interface{}); ok {
+				maps = append(maps, m)
+			}
+		}
+		return maps
+	}
+	strs := func(obj map[string]interface{}, fields ...string) []string {
+		s, _, _ := unstructured.NestedStringSlice(obj, fields...)
+		return s
+	}
+	for _, o := range objects {
+		switch o.GetKind() {
+		case "Ingress":
+			for _, rule := range slice(o.Object, "spec", "rules") {
+				host, _, _ := unstructured.NestedString(rule, "host")
+				add(host)
+			}
+			for _, tls := range slice(o.Object, "spec", "tls") {
+				for _, host := range strs(tls, "hosts") {
+					add(host)
+				}
+			}
+		case "Gateway":
+			for _, listener := range slice(o.Object, "spec", "listeners") {
+				host, _, _ := unstructured.NestedString(listener, "hostname")
+				add(host)
+			}
+		case "HTTPRoute", "GRPCRoute", "TLSRoute":
+			for _, host := range strs(o.Object, "spec", "hostnames") {
+				add(host)
+			}
+		case "ManagedCertificate":
+			for _, host := range strs(o.Object, "spec", "domains") {
+				add(host)
+			}
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// CheckRecipe returns the problems of the certificates and private keys in
+// the files of r, see Find and Check. The server certificates must be valid
+// for one of the hosts of its manifests.
+func CheckRecipe(r *recipe.Recipe, opts Options) ([]Finding, error) {
+	files, err := r.Files()
+	if err != nil {
+		return nil, err
+	}
+	var materials []Material
+	var findings []Finding
+	var objects []*manifest.Object
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if !isYAML(file) && !bytes.Contains(data, []byte("-----BEGIN")) {
+			continue
+		}
+		m, f := Find(file, data)
+		materials = append(materials, m...)
+		findings = append(findings, f...)
+		if isYAML(file) {
+			objs, _ := manifest.Parse(file, data)
+			objects = append(objects, objs...)
+		}
+	}
+	findings = append(findings, Check(materials, Hosts(objects), opts)...)
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Location < findings[j].Location })
+	return findings, nil
+}
+
+func isYAML(file string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+	return ext == ".yaml" || ext == ".yml"
+}
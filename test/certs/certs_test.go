@@ -0,0 +1,315 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"flag"
+	"math/big"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/manifest"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe/recipetest"
+)
+
+// repoRoot is the root of the repository, relative to this package.
+const repoRoot = "../.."
+
+var expiryWindow = flag.Duration("expiry-window", DefaultExpiryWindow, "how long before they expire the certificates of the recipes are reported")
+
+// now is the time the test certificates are checked at.
+var now = time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+
+// testCert is a certificate and its private key, PEM encoded.
+type testCert struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+	pem  string
+	// keyPEM is the PKCS #8 PEM encoding of key.
+	keyPEM string
+}
+
+// newCert returns a certificate of key for the DNS names, valid for days from
+// now, signed by parent or self-signed if nil.
+func newCert(t *testing.T, cn string, key crypto.Signer, parent *testCert, days int, dnsNames ...string) *testCert {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(int64(len(cn))),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             now.Add(-24 * time.Hour),
+		NotAfter:              now.Add(time.Duration(days) * 24 * time.Hour),
+		DNSNames:              dnsNames,
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+	}
+	issuer, signer := template, key
+	if parent != nil {
+		issuer, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, key.Public(), signer)
+	if err != nil {
+		t.Fatalf("CreateCertificate(%s) = %v, want nil", cn, err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{
+		cert:   cert,
+		key:    key,
+		pem:    string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		keyPEM: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})),
+	}
+}
+
+func ecdsaKey(t *testing.T) crypto.Signer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestFind(t *testing.T) {
+	ca := newCert(t, "Test CA", ecdsaKey(t), nil, 365)
+	server := newCert(t, "grpc.example.com", ecdsaKey(t), ca, 90, "grpc.example.com")
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	indent := func(s string) string { return "    " + strings.ReplaceAll(strings.TrimSpace(s), "\n", "\n    ") }
+
+	data := `apiVersion: v1
+kind: Secret
+metadata:
+  name: fe-secret
+type: kubernetes.io/tls
+data:
+  tls.crt: ` + b64(server.pem) + `
+  tls.key: ` + b64(server.keyPEM) + `
+  broken: "not base64!"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  ca.pem: |
+` + indent(ca.pem) + `
+  other: value
+`
+	materials, findings := Find("fe.yaml", []byte(data))
+	var got []string
+	for _, m := range materials {
+		kind := "key"
+		if m.Cert != nil {
+			kind = m.Cert.Subject.CommonName
+		}
+		got = append(got, m.Location+": "+kind)
+	}
+	want := []string{
+		"Secret fe-secret (fe.yaml:1), key tls.crt: grpc.example.com",
+		"Secret fe-secret (fe.yaml:1), key tls.key: key",
+		"ConfigMap settings (fe.yaml:11), key ca.pem: Test CA",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Find() = %q, want %q", got, want)
+	}
+	if len(findings) != 1 || !strings.HasPrefix(findings[0].String(), "Secret fe-secret (fe.yaml:1), key broken: invalid base64 data") {
+		t.Errorf("Find() findings = %v, want the invalid base64 of broken", findings)
+	}
+
+	materials, findings = Find("server.crt", []byte(server.pem+ca.pem+"-----BEGIN CERTIFICATE-----\nbm90IGEgY2VydA==\n-----END CERTIFICATE-----\n"))
+	if len(materials) != 2 || materials[0].Group != "server" || len(findings) != 1 {
+		t.Errorf("Find() = %+v, %v, want the 2 certificates of the server group and the invalid one", materials, findings)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	ca := newCert(t, "Test CA", ecdsaKey(t), nil, 365)
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	materials := []Material{
+		{Location: "ca.pem", Group: "ca", Cert: ca.cert},
+	}
+	add := func(name string, c *testCert) {
+		materials = append(materials,
+			Material{Location: name + ".crt", Group: name, Cert: c.cert},
+			Material{Location: name + ".key", Group: name, Key: c.key})
+	}
+	add("good", newCert(t, "good", ecdsaKey(t), ca, 90, "grpc.example.com"))
+	add("wildcard", newCert(t, "wildcard", ecdsaKey(t), ca, 90, "*.example.com"))
+	add("expiring", newCert(t, "expiring", ecdsaKey(t), ca, 10, "grpc.example.com"))
+	add("expired", newCert(t, "expired", ecdsaKey(t), ca, -1, "grpc.example.com"))
+	add("weak", newCert(t, "weak", weakKey, ca, 90, "grpc.example.com"))
+	add("other-host", newCert(t, "other-host", ecdsaKey(t), ca, 90, "http.example.com"))
+	add("no-san", newCert(t, "grpc.example.com", ecdsaKey(t), ca, 90))
+	// The key of the pair doesn't match its certificate.
+	materials = append(materials,
+		Material{Location: "mismatch.crt", Group: "mismatch", Cert: newCert(t, "mismatch", ecdsaKey(t), ca, 90, "grpc.example.com").cert},
+		Material{Location: "mismatch.key", Group: "mismatch", Key: ecdsaKey(t)})
+
+	var got []string
+	for _, f := range Check(materials, []string{"grpc.example.com", "*.example.com"}, Options{Now: now, ExpiryWindow: 30 * 24 * time.Hour}) {
+		got = append(got, f.String())
+	}
+	want := []string{
+		"expired.crt: certificate CN=expired expired on 2023-05-31T00:00:00Z",
+		"expiring.crt: certificate CN=expiring expires on 2023-06-11T00:00:00Z, in less than 720h0m0s",
+		"mismatch.key: private key matches no certificate of mismatch",
+		"no-san.crt: certificate CN=grpc.example.com has no subject alternative names, clients don't check the common name",
+		"other-host.crt: certificate CN=other-host is valid for http.example.com, none of the hosts of the recipe: grpc.example.com, *.example.com",
+		"weak.crt: certificate CN=weak has a weak 1024 bits RSA key, want at least 2048 bits",
+		"weak.key: private key is a weak 1024 bits RSA key, want at least 2048 bits",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check() = %q, want %q", got, want)
+	}
+}
+
+func TestWeakSignature(t *testing.T) {
+	for alg, want := range map[x509.SignatureAlgorithm]bool{
+		x509.SHA1WithRSA:      true,
+		x509.MD5WithRSA:       true,
+		x509.ECDSAWithSHA1:    true,
+		x509.SHA256WithRSA:    false,
+		x509.ECDSAWithSHA256:  false,
+		x509.PureEd25519:      false,
+		x509.SHA256WithRSAPSS: false,
+	} {
+		if got := weakSignature(alg); got != want {
+			t.Errorf("weakSignature(%s) = %t, want %t", alg, got, want)
+		}
+	}
+}
+
+func TestHosts(t *testing.T) {
+	objects, err := manifest.Parse("test.yaml", []byte(`
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: foo
+spec:
+  tls:
+  - hosts:
+    - grpc.example.com
+  rules:
+  - host: "grpc.example.com"
+  - host: "$DNS_NAME"
+---
+apiVersion: gateway.networking.k8s.io/v1beta1
+kind: Gateway
+metadata:
+  name: gw
+spec:
+  listeners:
+  - hostname: "*.example.com"
+---
+apiVersion: gateway.networking.k8s.io/v1beta1
+kind: HTTPRoute
+metadata:
+  name: route
+spec:
+  hostnames:
+  - store.example.com
+---
+apiVersion: networking.gke.io/v1
+kind: ManagedCertificate
+metadata:
+  name: cert
+spec:
+  domains:
+  - www.example.com
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"*.example.com", "grpc.example.com", "store.example.com", "www.example.com"}
+	if got := Hosts(objects); !reflect.DeepEqual(got, want) {
+		t.Errorf("Hosts() = %q, want %q", got, want)
+	}
+}
+
+// TestRecipes checks the certificates and private keys of the recipes of the
+// repository, so that the recipes don't ship expired or insecure material,
+// and the ones generated for the certificates they declare. Pass
+// -expiry-window to report the certificates expiring sooner or later than in
+// DefaultExpiryWindow.
+func TestRecipes(t *testing.T) {
+	recipetest.ForEach(t, repoRoot, func(t *testing.T, r *recipe.Recipe) {
+		findings, err := CheckRecipe(r, Options{ExpiryWindow: *expiryWindow})
+		if err != nil {
+			t.Fatalf("CheckRecipe(%s) = %v, want nil", r.Path, err)
+		}
+		for _, f := range findings {
+			t.Error(f)
+		}
+
+		checkGenerated(t, r)
+		// The example of a recipe may declare its own certificates, see
+		// recipe.ExampleDir.
+		if _, err := os.Stat(filepath.Join(r.Dir, recipe.ExampleDir, recipe.MetadataFile)); err == nil {
+			checkGenerated(t, recipetest.Find(t, repoRoot, path.Join(r.Path, recipe.ExampleDir)))
+		}
+	})
+}
+
+// checkGenerated checks the certificates generated for the ones declared by
+// the recipe r, if any.
+func checkGenerated(t *testing.T, r *recipe.Recipe) {
+	t.Helper()
+	declared := r.Metadata.Certificates
+	if declared == nil {
+		return
+	}
+	g, err := Generate(r.Name(), declared, GenerateOptions{})
+	if err != nil {
+		t.Fatalf("Generate(%s) = %v, want nil", r.Path, err)
+	}
+	b, err := g.Manifests("")
+	if err != nil {
+		t.Fatalf("Manifests(%s) = %v, want nil", r.Path, err)
+	}
+	var hosts []string
+	for _, s := range declared.Secrets {
+		hosts = append(hosts, s.Hosts...)
+	}
+	materials, findings := Find(r.Path+"/certificates.yaml", b)
+	if len(materials) == 0 {
+		t.Errorf("Find(Manifests(%s)) = no material, want the generated certificates", r.Path)
+	}
+	for _, f := range append(findings, Check(materials, hosts, Options{ExpiryWindow: DefaultExpiryWindow})...) {
+		t.Errorf("generated: %s", f)
+	}
+}
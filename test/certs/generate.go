@@ -0,0 +1,371 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certs
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// Key types of the generated certificates.
+const (
+	KeyECDSAP256 = "ecdsa-p256"
+	KeyECDSAP384 = "ecdsa-p384"
+	KeyRSA2048   = "rsa-2048"
+	KeyRSA3072   = "rsa-3072"
+	KeyRSA4096   = "rsa-4096"
+)
+
+// KeyTypes are the supported key types, supported by the Google Cloud load
+// balancers too.
+var KeyTypes = []string{KeyECDSAP256, KeyECDSAP384, KeyRSA2048, KeyRSA3072, KeyRSA4096}
+
+// Defaults of the generated certificates.
+const (
+	DefaultKeyType      = KeyECDSAP256
+	DefaultValidity     = 90 * 24 * time.Hour
+	DefaultOrganization = "GKE networking recipes"
+)
+
+// GenerateOptions configure the generated certificates.
+type GenerateOptions struct {
+	// KeyType is the type of the keys of all the certificates,
+	// DefaultKeyType if empty.
+	KeyType string
+	// Validity is how long the certificates are valid for, DefaultValidity
+	// if zero.
+	Validity time.Duration
+	// Organization is the organization of the subject of the certificates,
+	// DefaultOrganization if empty.
+	Organization string
+	// Now is the time the certificates are valid from, the current time if
+	// zero.
+	Now time.Time
+}
+
+func (o GenerateOptions) withDefaults() GenerateOptions {
+	if o.KeyType == "" {
+		o.KeyType = DefaultKeyType
+	}
+	if o.Validity == 0 {
+		o.Validity = DefaultValidity
+	}
+	if o.Organization == "" {
+		o.Organization = DefaultOrganization
+	}
+	if o.Now.IsZero() {
+		o.Now = time.Now()
+	}
+	return o
+}
+
+// Pair is a certificate and its private key.
+type Pair struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+// CertPEM returns the PEM encoding of the certificate.
+func (p *Pair) CertPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p.Cert.Raw})
+}
+
+// KeyPEM returns the PKCS #8 PEM encoding of the private key.
+func (p *Pair) KeyPEM() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(p.Key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// CA is a private certificate authority: a root certificate, and the
+// intermediate certificate it signs, which issues the certificates of the
+// hosts.
+type CA struct {
+	Root         *Pair
+	Intermediate *Pair
+	opts         GenerateOptions
+}
+
+// NewCA returns a new CA whose certificates are named after name, e.g. the
+// name of the recipe.
+func NewCA(name string, opts GenerateOptions) (*CA, error) {
+	opts = opts.withDefaults()
+	ca := &CA{opts: opts}
+	var err error
+	ca.Root, err = ca.sign(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: name + " Root CA", Organization: []string{opts.Organization}},
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	ca.Intermediate, err = ca.sign(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: name + " Intermediate CA", Organization: []string{opts.Organization}},
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+		BasicConstraintsValid: true,
+	}, ca.Root)
+	if err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+// Issue returns a new server certificate for hosts, DNS names or IP
+// addresses, signed by the intermediate certificate of the CA.
+func (ca *CA) Issue(hosts []string) (*Pair, error) {
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts to issue a certificate for")
+	}
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: hosts[0], Organization: []string{ca.opts.Organization}},
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	if strings.HasPrefix(ca.opts.KeyType, "rsa-") {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	return ca.sign(template, ca.Intermediate)
+}
+
+// Bundle returns the PEM encoding of the certificates of the CA, the
+// intermediate and the root one, which clients verify the certificates it
+// issues with.
+func (ca *CA) Bundle() []byte {
+	return append(ca.Intermediate.CertPEM(), ca.Root.CertPEM()...)
+}
+
+// Chain returns the PEM encoding of the certificate of leaf followed by the
+// intermediate certificate of the CA, the chain servers present.
+func (ca *CA) Chain(leaf *Pair) []byte {
+	return append(leaf.CertPEM(), ca.Intermediate.CertPEM()...)
+}
+
+// sign completes template with a new key of the CA key type, and signs it
+// with parent, or self-signs it if parent is nil.
+func (ca *CA) sign(template *x509.Certificate, parent *Pair) (*Pair, error) {
+	key, err := newKey(ca.opts.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template.SerialNumber = serial
+	// Tolerate the clock skew of the machines checking the certificate.
+	template.NotBefore = ca.opts.Now.Add(-time.Hour)
+	template.NotAfter = ca.opts.Now.Add(ca.opts.Validity)
+	issuer, signer := template, key
+	if parent != nil {
+		issuer, signer = parent.Cert, parent.Key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, key.Public(), signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign the certificate of %s: %w", template.Subject.CommonName, err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Pair{Cert: cert, Key: key}, nil
+}
+
+// newKey returns a new private key of keyType, one of KeyTypes.
+func newKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case KeyECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyRSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case KeyRSA3072:
+		return rsa.GenerateKey(rand.Reader, 3072)
+	case KeyRSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	}
+	return nil, fmt.Errorf("unknown key type %q, want one of %s", keyType, strings.Join(KeyTypes, ", "))
+}
+
+// Generated is the material generated for the certificates declared by a
+// recipe.
+type Generated struct {
+	Declared *recipe.Certificates
+	CA       *CA
+	// Secrets are the certificates of the declared Secrets, by name.
+	Secrets map[string]*Pair
+}
+
+// Generate returns a new CA named name, and the certificates it issues for
+// the declared Secrets.
+func Generate(name string, declared *recipe.Certificates, opts GenerateOptions) (*Generated, error) {
+	if err := declared.Validate(); err != nil {
+		return nil, err
+	}
+	ca, err := NewCA(name, opts)
+	if err != nil {
+		return nil, err
+	}
+	g := &Generated{Declared: declared, CA: ca, Secrets: make(map[string]*Pair)}
+	for _, s := range declared.Secrets {
+		if g.Secrets[s.Name], err = ca.Issue(s.Hosts); err != nil {
+			return nil, fmt.Errorf("failed to issue the certificate of %s: %w", s.Name, err)
+		}
+	}
+	return g, nil
+}
+
+// Manifests returns the YAML documents of the ConfigMap of the CA, if
+// declared, and of the Secrets, in namespace, the namespace of kubectl if
+// empty.
+func (g *Generated) Manifests(namespace string) ([]byte, error) {
+	metadata := func(name string) map[string]interface{} {
+		m := map[string]interface{}{"name": name}
+		if namespace != "" {
+			m["namespace"] = namespace
+		}
+		return m
+	}
+	var objects []map[string]interface{}
+	if g.Declared.CAConfigMap != "" {
+		objects = append(objects, map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   metadata(g.Declared.CAConfigMap),
+			"data":       map[string]interface{}{orDefault(g.Declared.CAKey, recipe.DefaultCAKey): string(g.CA.Bundle())},
+		})
+	}
+	for _, s := range g.Declared.Secrets {
+		data, err := g.secretData(s)
+		if err != nil {
+			return nil, err
+		}
+		encoded := make(map[string]interface{})
+		for key, value := range data {
+			encoded[key] = base64.StdEncoding.EncodeToString(value)
+		}
+		secretType := "Opaque"
+		if _, ok := data[recipe.DefaultCertKey]; ok && len(data) == 2 {
+			if _, ok := data[recipe.DefaultKeyKey]; ok {
+				secretType = "kubernetes.io/tls"
+			}
+		}
+		objects = append(objects, map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   metadata(s.Name),
+			"type":       secretType,
+			"data":       encoded,
+		})
+	}
+	var b bytes.Buffer
+	for i, o := range objects {
+		doc, err := sigsyaml.Marshal(o)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			b.WriteString("---\n")
+		}
+		b.Write(doc)
+	}
+	return b.Bytes(), nil
+}
+
+// secretData returns the content of the Secret s by key: the chain of its
+// certificate and its private key, concatenated if they have the same key.
+func (g *Generated) secretData(s recipe.CertificateSecret) (map[string][]byte, error) {
+	pair := g.Secrets[s.Name]
+	key, err := pair.KeyPEM()
+	if err != nil {
+		return nil, err
+	}
+	data := map[string][]byte{orDefault(s.CertKey, recipe.DefaultCertKey): g.CA.Chain(pair)}
+	keyKey := orDefault(s.KeyKey, recipe.DefaultKeyKey)
+	data[keyKey] = append(data[keyKey], key...)
+	return data, nil
+}
+
+// WriteFiles writes the generated material to dir as PEM files, for the
+// clients and the commands which don't read it from the cluster: the
+// certificates of the CA in the file named after the key of its ConfigMap,
+// and the files of each Secret named after the Secret and its keys, e.g.
+// fe-secret/tls.crt. It returns the paths of the files, sorted.
+func (g *Generated) WriteFiles(dir string) ([]string, error) {
+	files := map[string][]byte{
+		filepath.Join(dir, orDefault(g.Declared.CAKey, recipe.DefaultCAKey)): g.CA.Bundle(),
+	}
+	for _, s := range g.Declared.Secrets {
+		data, err := g.secretData(s)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range data {
+			files[filepath.Join(dir, s.Name, key)] = value
+		}
+	}
+	var paths []string
+	for path, data := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,183 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/manifest"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// verify verifies the certificate chain of a server for host at now, with
+// the certificates of the CA in bundle, as a client would.
+func verify(t *testing.T, bundle, chain []byte, host string, now time.Time) error {
+	t.Helper()
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(bundle) {
+		t.Fatalf("AppendCertsFromPEM(%s) = false, want true", bundle)
+	}
+	materials, findings := Find("chain.pem", chain)
+	if len(materials) != 2 || len(findings) != 0 {
+		t.Fatalf("Find(%s) = %+v, %v, want the leaf and intermediate certificates", chain, materials, findings)
+	}
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(materials[1].Cert)
+	_, err := materials[0].Cert.Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	return err
+}
+
+func TestCA(t *testing.T) {
+	for _, tc := range []struct {
+		keyType string
+		want    interface{}
+	}{
+		{KeyECDSAP256, &ecdsa.PrivateKey{}},
+		{KeyECDSAP384, &ecdsa.PrivateKey{}},
+		{KeyRSA2048, &rsa.PrivateKey{}},
+	} {
+		opts := GenerateOptions{KeyType: tc.keyType, Validity: 30 * 24 * time.Hour, Now: now}
+		ca, err := NewCA("grpc", opts)
+		if err != nil {
+			t.Fatalf("NewCA(%s) = %v, want nil", tc.keyType, err)
+		}
+		leaf, err := ca.Issue([]string{"grpc.domain.com", "10.0.0.1"})
+		if err != nil {
+			t.Fatalf("Issue(%s) = %v, want nil", tc.keyType, err)
+		}
+		if reflect.TypeOf(leaf.Key) != reflect.TypeOf(tc.want) {
+			t.Errorf("Issue(%s) key = %T, want %T", tc.keyType, leaf.Key, tc.want)
+		}
+		bundle, chain := ca.Bundle(), ca.Chain(leaf)
+		for _, host := range []string{"grpc.domain.com", "10.0.0.1"} {
+			if err := verify(t, bundle, chain, host, now.Add(time.Hour)); err != nil {
+				t.Errorf("%s: Verify(%s) = %v, want nil", tc.keyType, host, err)
+			}
+		}
+		if err := verify(t, bundle, chain, "http.domain.com", now.Add(time.Hour)); err == nil {
+			t.Errorf("%s: Verify(http.domain.com) = nil, want an error for another host", tc.keyType)
+		}
+		if err := verify(t, bundle, chain, "grpc.domain.com", now.Add(31*24*time.Hour)); err == nil {
+			t.Errorf("%s: Verify() = nil after the validity, want an error", tc.keyType)
+		}
+		materials := []Material{{Location: "ca", Cert: ca.Root.Cert}, {Location: "ca", Cert: ca.Intermediate.Cert}, {Location: "leaf", Group: "leaf", Cert: leaf.Cert}, {Location: "leaf", Group: "leaf", Key: leaf.Key}}
+		if findings := Check(materials, []string{"grpc.domain.com"}, Options{Now: now, ExpiryWindow: 7 * 24 * time.Hour}); len(findings) != 0 {
+			t.Errorf("%s: Check() = %v, want no findings for the generated certificates", tc.keyType, findings)
+		}
+	}
+
+	if _, err := NewCA("grpc", GenerateOptions{KeyType: "dsa-1024"}); err == nil {
+		t.Errorf("NewCA(dsa-1024) = nil, want an error for an unknown key type")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	declared := &recipe.Certificates{
+		CAConfigMap: "settings",
+		CAKey:       "CA_crt.pem",
+		Secrets: []recipe.CertificateSecret{
+			{Name: "fe-secret", Hosts: []string{"grpc.domain.com"}},
+			{Name: "hc-secret", Hosts: []string{"http.domain.com"}, CertKey: "http_server_crt.pem", KeyKey: "http_server_key.pem"},
+			{Name: "haproxy-cert", Hosts: []string{"haproxy.domain.com"}, CertKey: "mycert.pem", KeyKey: "mycert.pem"},
+		},
+	}
+	g, err := Generate("grpc", declared, GenerateOptions{Now: now})
+	if err != nil {
+		t.Fatalf("Generate() = %v, want nil", err)
+	}
+	b, err := g.Manifests("grpc")
+	if err != nil {
+		t.Fatalf("Manifests() = %v, want nil", err)
+	}
+	objects, err := manifest.Parse("certs.yaml", b)
+	if err != nil {
+		t.Fatalf("Parse(Manifests()) = %v, want nil", err)
+	}
+	var got []string
+	data := make(map[string]map[string]string)
+	for _, o := range objects {
+		typ, _, _ := unstructured.NestedString(o.Object, "type")
+		got = append(got, o.GetKind()+" "+o.GetNamespace()+"/"+o.GetName()+" "+typ)
+		data[o.GetName()], _, _ = unstructured.NestedStringMap(o.Object, "data")
+	}
+	want := []string{
+		"ConfigMap grpc/settings ",
+		"Secret grpc/fe-secret kubernetes.io/tls",
+		"Secret grpc/hc-secret Opaque",
+		"Secret grpc/haproxy-cert Opaque",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Manifests() = %q, want %q", got, want)
+	}
+
+	// The generated manifests pass the checks of the committed material.
+	materials, findings := Find("certs.yaml", b)
+	findings = append(findings, Check(materials, []string{"grpc.domain.com", "http.domain.com", "haproxy.domain.com"}, Options{Now: now, ExpiryWindow: DefaultExpiryWindow})...)
+	if len(materials) != 11 || len(findings) != 0 {
+		t.Errorf("Find(Manifests()) = %d materials, findings %v, want the 2 certificates of the bundle, 3 chains of 2 certificates and 3 keys, and no findings", len(materials), findings)
+	}
+
+	decode := func(secret, key string) []byte {
+		b, err := base64.StdEncoding.DecodeString(data[secret][key])
+		if err != nil {
+			t.Fatalf("%s %s: %v", secret, key, err)
+		}
+		return b
+	}
+	if _, err := tls.X509KeyPair(decode("fe-secret", "tls.crt"), decode("fe-secret", "tls.key")); err != nil {
+		t.Errorf("X509KeyPair(fe-secret) = %v, want nil", err)
+	}
+	combined := decode("haproxy-cert", "mycert.pem")
+	if _, err := tls.X509KeyPair(combined, combined); err != nil {
+		t.Errorf("X509KeyPair(haproxy-cert) = %v, want nil for the concatenated certificate and key", err)
+	}
+	if err := verify(t, []byte(data["settings"]["CA_crt.pem"]), decode("hc-secret", "http_server_crt.pem"), "http.domain.com", now); err != nil {
+		t.Errorf("Verify(hc-secret) = %v, want nil with the bundle of the ConfigMap", err)
+	}
+
+	dir := t.TempDir()
+	paths, err := g.WriteFiles(dir)
+	if err != nil {
+		t.Fatalf("WriteFiles() = %v, want nil", err)
+	}
+	var files []string
+	for _, p := range paths {
+		rel, _ := filepath.Rel(dir, p)
+		files = append(files, filepath.ToSlash(rel))
+	}
+	wantFiles := []string{"CA_crt.pem", "fe-secret/tls.crt", "fe-secret/tls.key", "haproxy-cert/mycert.pem", "hc-secret/http_server_crt.pem", "hc-secret/http_server_key.pem"}
+	if !reflect.DeepEqual(files, wantFiles) {
+		t.Errorf("WriteFiles() = %q, want %q", files, wantFiles)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "CA_crt.pem")); err != nil || string(b) != data["settings"]["CA_crt.pem"] {
+		t.Errorf("ReadFile(CA_crt.pem) = %v, want the bundle of the ConfigMap", err)
+	}
+}
@@ -19,7 +19,7 @@ set -o nounset;
 set -o pipefail;
 set -o xtrace;
 
-for cleanup_script in $(find . -name cleanup.sh); do
-  echo "Running cleanup script '${cleanup_script}'"
-  ./${cleanup_script}
-done
+# List every resource left behind by the recipe tests in the project.
+# Arguments are passed to the sweeper, e.g. --dry-run=false to delete them or
+# --older-than=3h.
+go run ./cmd/sweeper "$@"
@@ -0,0 +1,279 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cost estimates what the recipes cost to leave running, from the
+// GCE resources predicted for their load balancers, the GCP resources they
+// reference, and the clusters and VMs their test scripts create, priced with
+// the checked-in price table prices.yaml.
+package cost
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/plan"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// HoursPerMonth is the number of hours in a month used to convert hourly
+// prices to monthly ones.
+const HoursPerMonth = 730
+
+// Keys of the price table.
+const (
+	GKECluster         = "gkeCluster"
+	ForwardingRule     = "forwardingRule"
+	Address            = "address"
+	SecurityPolicy     = "securityPolicy"
+	ManagedCertificate = "managedCertificate"
+	// MachinePrefix prefixes the machine types, e.g. machine/e2-medium.
+	MachinePrefix = "machine/"
+	// DiskPrefix prefixes the persistent disk types, e.g. disk/pd-standard.
+	DiskPrefix = "disk/"
+)
+
+//go:embed prices.yaml
+var defaultPrices []byte
+
+// Price is the price of a resource, per hour or per month, and per Unit if
+// any, e.g. per GB for disks.
+type Price struct {
+	Hourly      float64 `json:"hourly,omitempty"`
+	Monthly     float64 `json:"monthly,omitempty"`
+	Unit        string  `json:"unit,omitempty"`
+	Description string  `json:"description"`
+}
+
+// PerHour returns the hourly price.
+func (p Price) PerHour() float64 {
+	return p.Hourly + p.Monthly/HoursPerMonth
+}
+
+// Prices is a versioned price table.
+type Prices struct {
+	Version  string           `json:"version"`
+	Currency string           `json:"currency"`
+	Prices   map[string]Price `json:"prices"`
+}
+
+// ParsePrices parses a price table.
+func ParsePrices(data []byte) (*Prices, error) {
+	var p Prices
+	if err := sigsyaml.UnmarshalStrict(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid price table: %w", err)
+	}
+	if p.Version == "" || p.Currency == "" {
+		return nil, fmt.Errorf("invalid price table: missing version or currency")
+	}
+	for key, price := range p.Prices {
+		if price.Hourly < 0 || price.Monthly < 0 || (price.Hourly > 0 && price.Monthly > 0) {
+			return nil, fmt.Errorf("invalid price table: price of %s must be either hourly or monthly", key)
+		}
+	}
+	return &p, nil
+}
+
+// LoadPrices loads the price table at path, or the checked-in one if path is
+// empty.
+func LoadPrices(path string) (*Prices, error) {
+	if path == "" {
+		return ParsePrices(defaultPrices)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrices(b)
+}
+
+// Item is a line of an estimate.
+type Item struct {
+	// Price is the key of the price table.
+	Price       string  `json:"price"`
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	Unit        string  `json:"unit,omitempty"`
+	// Hourly is the hourly cost of the quantity.
+	Hourly float64 `json:"hourly"`
+	// Sources tell where the resources come from, e.g. the object a
+	// forwarding rule is created for.
+	Sources []string `json:"sources"`
+}
+
+// Estimate is the estimated cost of a recipe.
+type Estimate struct {
+	Recipe        string `json:"recipe"`
+	PricesVersion string `json:"pricesVersion"`
+	Currency      string `json:"currency"`
+	Items         []Item `json:"items"`
+	// Unpriced are the resources which have no price in the price table, the
+	// estimate is a lower bound if there are any.
+	Unpriced []string `json:"unpriced,omitempty"`
+}
+
+// Hourly returns the estimated cost of the recipe per hour.
+func (e *Estimate) Hourly() float64 {
+	total := 0.0
+	for _, item := range e.Items {
+		total += item.Hourly
+	}
+	return total
+}
+
+// Monthly returns the estimated cost of the recipe per month.
+func (e *Estimate) Monthly() float64 {
+	return e.Hourly() * HoursPerMonth
+}
+
+// String returns the monthly cost, e.g. "$18.25/month", with a "+" if some
+// resources are not priced.
+func (e *Estimate) String() string {
+	s := fmt.Sprintf("%s/month", e.format(e.Monthly(), 2))
+	if len(e.Unpriced) > 0 {
+		s += "+"
+	}
+	return s
+}
+
+// format formats an amount in the currency of the estimate, with the given
+// number of decimals.
+func (e *Estimate) format(amount float64, decimals int) string {
+	if e.Currency == "USD" {
+		return fmt.Sprintf("$%.*f", decimals, amount)
+	}
+	return fmt.Sprintf("%.*f %s", decimals, amount, e.Currency)
+}
+
+// WriteTable writes the items of the estimate and its totals as a table.
+func (e *Estimate) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESOURCE\tQUANTITY\tHOURLY\tMONTHLY\tSOURCES")
+	for _, item := range e.Items {
+		quantity := fmt.Sprint(item.Quantity)
+		if item.Unit != "" {
+			quantity += " " + item.Unit
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", item.Description, quantity, e.format(item.Hourly, 4), e.format(item.Hourly*HoursPerMonth, 2), strings.Join(item.Sources, ", "))
+	}
+	fmt.Fprintf(tw, "TOTAL\t\t%s\t%s\t\n", e.format(e.Hourly(), 4), e.format(e.Monthly(), 2))
+	for _, u := range e.Unpriced {
+		fmt.Fprintf(tw, "UNPRICED\t%s\t\t\t\n", u)
+	}
+	fmt.Fprintf(tw, "\nPrices version %s, in %s, without usage-based charges.\n", e.PricesVersion, e.Currency)
+	return tw.Flush()
+}
+
+// estimator accumulates the quantities of an estimate by price.
+type estimator struct {
+	prices     *Prices
+	estimate   *Estimate
+	quantities map[string]float64
+	sources    map[string][]string
+}
+
+func (e *estimator) add(price string, quantity float64, source string) {
+	if _, ok := e.prices.Prices[price]; !ok {
+		e.estimate.Unpriced = append(e.estimate.Unpriced, fmt.Sprintf("%s (%s)", price, source))
+		return
+	}
+	e.quantities[price] += quantity
+	for _, s := range e.sources[price] {
+		if s == source {
+			return
+		}
+	}
+	e.sources[price] = append(e.sources[price], source)
+}
+
+// ForRecipe returns the estimated cost of the recipe described by d.
+func ForRecipe(d *recipe.Description, prices *Prices) (*Estimate, error) {
+	e := &estimator{
+		prices:     prices,
+		estimate:   &Estimate{Recipe: d.Recipe.Path, PricesVersion: prices.Version, Currency: prices.Currency, Items: []Item{}},
+		quantities: make(map[string]float64),
+		sources:    make(map[string][]string),
+	}
+
+	for _, r := range plan.ForRecipe(d).Resources {
+		switch {
+		case r.Type == plan.ForwardingRule:
+			e.add(ForwardingRule, 1, r.Object)
+		case r.Type == plan.SSLCertificate && strings.HasPrefix(r.Name, "mcrt-"):
+			e.add(ManagedCertificate, 1, r.Object)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, r := range d.Resources {
+		if seen[r.Type+"/"+r.Name] {
+			continue
+		}
+		seen[r.Type+"/"+r.Name] = true
+		switch r.Type {
+		case recipe.ResourceAddress:
+			e.add(Address, 1, r.Source)
+		case recipe.ResourceSecurityPolicy:
+			e.add(SecurityPolicy, 1, r.Source)
+		}
+	}
+
+	for _, c := range d.Recipe.Metadata.Clusters {
+		// The clusters declared by multi-cluster recipes are created with
+		// the defaults of gcloud, see package provision.
+		m := declaredClusterMachines(c)
+		source := filepath.Join(d.Recipe.Path, recipe.MetadataFile)
+		e.add(GKECluster, 1, source)
+		e.add(MachinePrefix+m.machineType, float64(m.count), source)
+		e.add(DiskPrefix+m.diskType, float64(m.count*m.diskSize), source)
+	}
+
+	for _, script := range d.Recipe.Scripts() {
+		b, err := os.ReadFile(script)
+		if err != nil {
+			return nil, err
+		}
+		source := filepath.Join(d.Recipe.Path, filepath.Base(script))
+		for _, m := range scriptMachines(string(b)) {
+			if m.cluster {
+				e.add(GKECluster, 1, source)
+			}
+			e.add(MachinePrefix+m.machineType, float64(m.count), source)
+			e.add(DiskPrefix+m.diskType, float64(m.count*m.diskSize), source)
+		}
+	}
+
+	keys := make([]string, 0, len(e.quantities))
+	for key := range e.quantities {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		price := prices.Prices[key]
+		e.estimate.Items = append(e.estimate.Items, Item{
+			Price:       key,
+			Description: price.Description,
+			Quantity:    e.quantities[key],
+			Unit:        price.Unit,
+			Hourly:      e.quantities[key] * price.PerHour(),
+			Sources:     e.sources[key],
+		})
+	}
+	return e.estimate, nil
+}
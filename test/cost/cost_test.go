@@ -0,0 +1,194 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cost
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe/recipetest"
+)
+
+// repoRoot is the root of the repository, relative to this package.
+const repoRoot = "../.."
+
+func TestParsePrices(t *testing.T) {
+	for _, tc := range []struct {
+		desc, data string
+	}{
+		{desc: "no version", data: "currency: USD\n"},
+		{desc: "unknown field", data: "version: v1\ncurrency: USD\nprices:\n  address:\n    yearly: 1\n"},
+		{desc: "hourly and monthly", data: "version: v1\ncurrency: USD\nprices:\n  address:\n    hourly: 1\n    monthly: 1\n"},
+		{desc: "negative", data: "version: v1\ncurrency: USD\nprices:\n  address:\n    hourly: -1\n"},
+	} {
+		if _, err := ParsePrices([]byte(tc.data)); err == nil {
+			t.Errorf("ParsePrices() with %s = nil, want an error", tc.desc)
+		}
+	}
+	prices, err := LoadPrices("")
+	if err != nil {
+		t.Fatalf("LoadPrices() = %v, want nil", err)
+	}
+	for _, key := range []string{GKECluster, ForwardingRule, Address, SecurityPolicy, ManagedCertificate,
+		MachinePrefix + defaultNodeMachineType, MachinePrefix + defaultInstanceMachineType,
+		DiskPrefix + defaultNodeDiskType, DiskPrefix + defaultInstanceDiskType} {
+		if _, ok := prices.Prices[key]; !ok {
+			t.Errorf("LoadPrices() has no price for %s", key)
+		}
+	}
+}
+
+func TestScriptMachines(t *testing.T) {
+	script := `
+source ./test/helper.sh
+# setup_gke_basic "${test_name}" "${ZONE}" "${REGION}"
+setup_gke_basic "${test_name}" "${ZONE}" "${REGION}"
+gcloud container clusters create "${cluster}" \
+    --region="${REGION}" \
+    --machine-type="e2-standard-4" \
+    --num-nodes=2 \
+    --labels="${labels}"
+gcloud compute instances create "${instance}" \
+    --machine-type "${MACHINE_TYPE}" \
+    --boot-disk-size=20
+`
+	want := []machines{
+		{cluster: true, machineType: "e2-medium", count: 3, diskType: "pd-balanced", diskSize: 100},
+		{machineType: "n1-standard-1", count: 1, diskType: "pd-standard", diskSize: 10},
+		{cluster: true, machineType: "e2-standard-4", count: 6, diskType: "pd-balanced", diskSize: 100},
+		{machineType: "${MACHINE_TYPE}", count: 1, diskType: "pd-standard", diskSize: 20},
+	}
+	if got := scriptMachines(script); !reflect.DeepEqual(got, want) {
+		t.Errorf("scriptMachines() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDeclaredClusterMachines(t *testing.T) {
+	for _, tc := range []struct {
+		cluster recipe.DeclaredCluster
+		want    int
+	}{
+		{recipe.DeclaredCluster{Name: "gke-1", Region: "us-west1", Zone: "us-west1-a"}, 3},
+		{recipe.DeclaredCluster{Name: "gke-2", Region: "us-east1"}, 9},
+	} {
+		if got := declaredClusterMachines(tc.cluster); !got.cluster || got.count != tc.want {
+			t.Errorf("declaredClusterMachines(%+v) = %+v, want a cluster of %d nodes", tc.cluster, got, tc.want)
+		}
+	}
+}
+
+func TestForRecipe(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "ingress", "my-recipe")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"README.md": "# My recipe\n",
+		"setup.sh":  "setup_gke_basic \"${test_name}\" \"${ZONE}\" \"${REGION}\"\ngcloud compute instances create vm --machine-type=m9-huge\n",
+		"ingress.yaml": `
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+  annotations:
+    kubernetes.io/ingress.global-static-ip-name: web-ip
+    networking.gke.io/managed-certificates: cert
+spec:
+  defaultBackend:
+    service:
+      name: web
+      port:
+        number: 80
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := recipe.Load(root, "ingress/my-recipe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := recipe.Describe(r)
+	if err != nil {
+		t.Fatalf("Describe() = %v, want nil", err)
+	}
+	prices := &Prices{Version: "v1", Currency: "USD", Prices: map[string]Price{
+		GKECluster:                      {Hourly: 0.1},
+		ForwardingRule:                  {Hourly: 0.025},
+		Address:                         {Hourly: 0.005},
+		ManagedCertificate:              {},
+		MachinePrefix + "e2-medium":     {Hourly: 0.03},
+		MachinePrefix + "n1-standard-1": {Hourly: 0.05},
+		DiskPrefix + "pd-standard":      {Monthly: 0.04, Unit: "GB"},
+		DiskPrefix + "pd-balanced":      {Monthly: 0.1, Unit: "GB"},
+	}}
+	e, err := ForRecipe(d, prices)
+	if err != nil {
+		t.Fatalf("ForRecipe() = %v, want nil", err)
+	}
+
+	quantities := make(map[string]float64)
+	for _, item := range e.Items {
+		quantities[item.Price] = item.Quantity
+	}
+	wantQuantities := map[string]float64{
+		GKECluster:                      1,
+		ForwardingRule:                  2,
+		Address:                         1,
+		ManagedCertificate:              1,
+		MachinePrefix + "e2-medium":     3,
+		MachinePrefix + "n1-standard-1": 1,
+		DiskPrefix + "pd-standard":      20,
+		DiskPrefix + "pd-balanced":      300,
+	}
+	if !reflect.DeepEqual(quantities, wantQuantities) {
+		t.Errorf("ForRecipe() = %v, want quantities %v", quantities, wantQuantities)
+	}
+	// 0.1 + 2*0.025 + 0.005 + 3*0.03 + 0.05 + (20*0.04 + 300*0.1)/730
+	if want := 0.295 + 30.8/HoursPerMonth; math.Abs(e.Hourly()-want) > 1e-9 {
+		t.Errorf("ForRecipe().Hourly() = %v, want %v", e.Hourly(), want)
+	}
+	if want := []string{"machine/m9-huge (ingress/my-recipe/setup.sh)"}; !reflect.DeepEqual(e.Unpriced, want) {
+		t.Errorf("ForRecipe().Unpriced = %v, want %v", e.Unpriced, want)
+	}
+	if got := e.String(); got[len(got)-1] != '+' {
+		t.Errorf("String() = %q, want a + for the unpriced resources", got)
+	}
+}
+
+// TestRecipes checks that the price table has the prices of every resource
+// of the recipes of the repository.
+func TestRecipes(t *testing.T) {
+	prices, err := LoadPrices("")
+	if err != nil {
+		t.Fatalf("LoadPrices() = %v, want nil", err)
+	}
+	recipetest.ForEachDescribed(t, repoRoot, func(t *testing.T, d *recipe.Description) {
+		e, err := ForRecipe(d, prices)
+		if err != nil {
+			t.Fatalf("ForRecipe(%s) = %v, want nil", d.Recipe.Path, err)
+		}
+		if len(e.Unpriced) > 0 {
+			t.Errorf("ForRecipe(%s) has unpriced resources %v, add them to prices.yaml", d.Recipe.Path, e.Unpriced)
+		}
+	})
+}
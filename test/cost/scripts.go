@@ -0,0 +1,132 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cost
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+)
+
+// The defaults of gcloud for the clusters and VMs created by the test
+// scripts, e.g. by setup_gke_basic.
+const (
+	defaultNodeMachineType     = "e2-medium"
+	defaultNodeCount           = 3
+	defaultNodeDiskType        = "pd-balanced"
+	defaultNodeDiskSize        = 100
+	defaultInstanceMachineType = "n1-standard-1"
+	defaultInstanceDiskType    = "pd-standard"
+	defaultInstanceDiskSize    = 10
+	// regionalClusterZones is the number of zones of the node pools of
+	// regional clusters.
+	regionalClusterZones = 3
+)
+
+// machines are VMs of the same type created by a test script, either the
+// nodes of a cluster or standalone instances.
+type machines struct {
+	cluster     bool
+	machineType string
+	count       int
+	diskType    string
+	// diskSize is the size of the boot disk of each VM, in GB.
+	diskSize int
+}
+
+// scriptMachines returns the clusters and VMs created by a test script, by
+// setup_gke_basic or by gcloud.
+func scriptMachines(script string) []machines {
+	var ms []machines
+	for _, cmd := range scriptCommands(script) {
+		switch {
+		case strings.HasPrefix(cmd, "setup_gke_basic "):
+			ms = append(ms,
+				machines{cluster: true, machineType: defaultNodeMachineType, count: defaultNodeCount, diskType: defaultNodeDiskType, diskSize: defaultNodeDiskSize},
+				machines{machineType: defaultInstanceMachineType, count: 1, diskType: defaultInstanceDiskType, diskSize: defaultInstanceDiskSize})
+		case strings.HasPrefix(cmd, "gcloud container clusters create "):
+			m := machines{
+				cluster:     true,
+				machineType: flagValue(cmd, "machine-type", defaultNodeMachineType),
+				count:       atoi(flagValue(cmd, "num-nodes", ""), defaultNodeCount),
+				diskType:    flagValue(cmd, "disk-type", defaultNodeDiskType),
+				diskSize:    atoi(flagValue(cmd, "disk-size", ""), defaultNodeDiskSize),
+			}
+			if flagValue(cmd, "region", "") != "" {
+				m.count *= regionalClusterZones
+			}
+			ms = append(ms, m)
+		case strings.HasPrefix(cmd, "gcloud compute instances create "):
+			ms = append(ms, machines{
+				machineType: flagValue(cmd, "machine-type", defaultInstanceMachineType),
+				count:       1,
+				diskType:    flagValue(cmd, "boot-disk-type", defaultInstanceDiskType),
+				diskSize:    atoi(flagValue(cmd, "boot-disk-size", ""), defaultInstanceDiskSize),
+			})
+		}
+	}
+	return ms
+}
+
+// declaredClusterMachines returns the nodes of a cluster declared in the
+// metadata of a recipe.
+func declaredClusterMachines(c recipe.DeclaredCluster) machines {
+	m := machines{cluster: true, machineType: defaultNodeMachineType, count: defaultNodeCount, diskType: defaultNodeDiskType, diskSize: defaultNodeDiskSize}
+	if c.Zone == "" {
+		m.count *= regionalClusterZones
+	}
+	return m
+}
+
+// scriptCommands returns the commands of a script, with their continuation
+// lines joined, without comments and indentation.
+func scriptCommands(script string) []string {
+	var cmds []string
+	var cmd strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") && cmd.Len() == 0 {
+			continue
+		}
+		if strings.HasSuffix(line, `\`) {
+			cmd.WriteString(strings.TrimSuffix(line, `\`))
+			continue
+		}
+		cmd.WriteString(line)
+		cmds = append(cmds, cmd.String())
+		cmd.Reset()
+	}
+	return cmds
+}
+
+// flagValue returns the value of the flag --name of a command, without
+// quotes, or def if the command doesn't have it.
+func flagValue(cmd, name, def string) string {
+	m := regexp.MustCompile(`--` + regexp.QuoteMeta(name) + `[= ]+("[^"]*"|'[^']*'|\S+)`).FindStringSubmatch(cmd)
+	if m == nil {
+		return def
+	}
+	return strings.Trim(m[1], `"'`)
+}
+
+// atoi returns s as an integer, or def if it is not one, e.g. a variable.
+func atoi(s string, def int) int {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	return def
+}
@@ -0,0 +1,264 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fakeboskos implements an in-memory boskos server that speaks the
+// same HTTP API as the real one, so that the Prow code path of the test
+// harness can be exercised without access to Prow.
+package fakeboskos
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/boskos/common"
+)
+
+// Config configures the lifecycle of the resources in the fake server.
+type Config struct {
+	// ReapTimeout is how long a busy resource can go without being updated
+	// before the reaper moves it to the dirty state. Zero disables the reaper.
+	ReapTimeout time.Duration
+	// CleanDelay is how long a dirty resource stays dirty before the janitor
+	// moves it back to the free state. Zero disables the janitor.
+	CleanDelay time.Duration
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Server is a fake boskos server. Resources move between the free, busy and
+// dirty states in the same way as in a boskos deployment with a reaper and a
+// janitor.
+type Server struct {
+	config Config
+
+	mu        sync.Mutex
+	resources map[string]*common.Resource
+}
+
+// NewServer returns a fake boskos server holding the given resources.
+// Resources without a state are free.
+func NewServer(config Config, resources []common.Resource) *Server {
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	s := &Server{
+		config:    config,
+		resources: make(map[string]*common.Resource),
+	}
+	for _, r := range resources {
+		r := common.NewResource(r.Name, r.Type, r.State, r.Owner, config.Now())
+		s.resources[r.Name] = &r
+	}
+	return s
+}
+
+// NewServerFromConfig returns a fake boskos server holding the static
+// resources declared in a boskos configuration.
+func NewServerFromConfig(config Config, bc *common.BoskosConfig) *Server {
+	var resources []common.Resource
+	for _, e := range bc.Resources {
+		resources = append(resources, common.NewResourcesFromConfig(e)...)
+	}
+	return NewServer(config, resources)
+}
+
+// Resources returns a snapshot of all the resources, sorted by name.
+func (s *Server) Resources() []common.Resource {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var resources []common.Resource
+	for _, r := range s.resources {
+		resources = append(resources, *r)
+	}
+	sort.Sort(common.ResourceByName(resources))
+	return resources
+}
+
+// Resource returns a snapshot of the named resource.
+func (s *Server) Resource(name string) (common.Resource, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.resources[name]
+	if !ok {
+		return common.Resource{}, false
+	}
+	return *r, true
+}
+
+// Reap runs one pass of the reaper and the janitor: busy resources that have
+// not been updated within ReapTimeout become dirty and lose their owner, and
+// dirty resources older than CleanDelay become free.
+func (s *Server) Reap() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.config.Now()
+	for _, r := range s.resources {
+		switch {
+		case r.State == common.Busy && s.config.ReapTimeout > 0 && now.Sub(r.LastUpdate) >= s.config.ReapTimeout:
+			klog.Infof("[fakeboskos] Reaping %s from %s", r.Name, r.Owner)
+			r.State = common.Dirty
+			r.Owner = ""
+			r.LastUpdate = now
+		case r.State == common.Dirty && s.config.CleanDelay > 0 && now.Sub(r.LastUpdate) >= s.config.CleanDelay:
+			klog.Infof("[fakeboskos] Cleaned %s", r.Name)
+			r.State = common.Free
+			r.LastUpdate = now
+		}
+	}
+}
+
+// Run calls Reap every interval until stop is closed.
+func (s *Server) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Reap()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// ServeHTTP implements the /acquire, /update and /release endpoints of the
+// boskos API.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, fmt.Sprintf("Method %v, %s only accepts POST.", req.Method, req.URL.Path), http.StatusMethodNotAllowed)
+		return
+	}
+	q := req.URL.Query()
+	switch req.URL.Path {
+	case "/acquire":
+		s.handleAcquire(w, q.Get("type"), q.Get("state"), q.Get("dest"), q.Get("owner"))
+	case "/update":
+		s.handleUpdate(w, req.Body, q.Get("name"), q.Get("state"), q.Get("owner"))
+	case "/release":
+		s.handleRelease(w, q.Get("name"), q.Get("dest"), q.Get("owner"))
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (s *Server) handleAcquire(w http.ResponseWriter, rtype, state, dest, owner string) {
+	if rtype == "" || state == "" || dest == "" || owner == "" {
+		http.Error(w, fmt.Sprintf("Type: %v, state: %v, dest: %v, owner: %v, all of them must be set in the request.", rtype, state, dest, owner), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var names []string
+	typeFound := false
+	for name, r := range s.resources {
+		if r.Type != rtype {
+			continue
+		}
+		typeFound = true
+		if r.State == state && r.Owner == "" {
+			names = append(names, name)
+		}
+	}
+	if !typeFound {
+		http.Error(w, common.ResourceTypeNotFoundMessage(rtype), http.StatusNotFound)
+		return
+	}
+	if len(names) == 0 {
+		http.Error(w, fmt.Sprintf("no available resource %s, try again later.", rtype), http.StatusNotFound)
+		return
+	}
+
+	// Hand out resources in a deterministic order.
+	sort.Strings(names)
+	r := s.resources[names[0]]
+	r.State = dest
+	r.Owner = owner
+	r.LastUpdate = s.config.Now()
+	klog.Infof("[fakeboskos] Leased %s to %s", r.Name, owner)
+
+	if err := json.NewEncoder(w).Encode(r); err != nil {
+		klog.Errorf("[fakeboskos] Failed to encode %s: %v", r.Name, err)
+	}
+}
+
+func (s *Server) handleUpdate(w http.ResponseWriter, body io.Reader, name, state, owner string) {
+	if name == "" || state == "" || owner == "" {
+		http.Error(w, fmt.Sprintf("Name: %v, owner: %v, state : %v, all of them must be set in the request.", name, owner, state), http.StatusBadRequest)
+		return
+	}
+	var userData common.UserData
+	if body != nil {
+		if err := json.NewDecoder(body).Decode(&userData); err != nil && err != io.EOF {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.resources[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("resource %s not found", name), http.StatusNotFound)
+		return
+	}
+	if r.Owner != owner {
+		http.Error(w, fmt.Sprintf("owner mismatch request by %s, currently owned by %s", owner, r.Owner), http.StatusUnauthorized)
+		return
+	}
+	if r.State != state {
+		http.Error(w, fmt.Sprintf("state mismatch - expected %v, current %v", state, r.State), http.StatusConflict)
+		return
+	}
+	if r.UserData == nil {
+		r.UserData = &common.UserData{}
+	}
+	r.UserData.Update(&userData)
+	r.LastUpdate = s.config.Now()
+}
+
+func (s *Server) handleRelease(w http.ResponseWriter, name, dest, owner string) {
+	if name == "" || dest == "" || owner == "" {
+		http.Error(w, fmt.Sprintf("Name: %v, dest: %v, owner: %v, all of them must be set in the request.", name, dest, owner), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.resources[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("resource %s not found", name), http.StatusNotFound)
+		return
+	}
+	if r.Owner != owner {
+		http.Error(w, fmt.Sprintf("owner mismatch request by %s, currently owned by %s", owner, r.Owner), http.StatusUnauthorized)
+		return
+	}
+	r.State = dest
+	r.Owner = ""
+	r.LastUpdate = s.config.Now()
+	klog.Infof("[fakeboskos] Released %s, set to state %s", name, dest)
+}
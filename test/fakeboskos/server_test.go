@@ -0,0 +1,161 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakeboskos
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	boskosclient "sigs.k8s.io/boskos/client"
+	"sigs.k8s.io/boskos/common"
+)
+
+// fakeClock is a manually advanced clock.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newTestServer(t *testing.T, config Config, resources ...common.Resource) (*Server, string) {
+	t.Helper()
+	sleep := boskosclient.SleepFunc
+	boskosclient.SleepFunc = func(time.Duration) {}
+	t.Cleanup(func() { boskosclient.SleepFunc = sleep })
+	s := NewServer(config, resources)
+	hs := httptest.NewServer(s)
+	t.Cleanup(hs.Close)
+	return s, hs.URL
+}
+
+func newTestClient(t *testing.T, owner, url string) *boskosclient.Client {
+	t.Helper()
+	c, err := boskosclient.NewClient(owner, url, "", "")
+	if err != nil {
+		t.Fatalf("NewClient(%q, %q) = %v, want nil", owner, url, err)
+	}
+	return c
+}
+
+func checkState(t *testing.T, s *Server, name, wantState, wantOwner string) {
+	t.Helper()
+	r, ok := s.Resource(name)
+	if !ok {
+		t.Fatalf("Resource(%q) not found", name)
+	}
+	if r.State != wantState || r.Owner != wantOwner {
+		t.Errorf("Resource(%q) = {state: %q, owner: %q}, want {state: %q, owner: %q}", name, r.State, r.Owner, wantState, wantOwner)
+	}
+}
+
+func TestAcquireUpdateRelease(t *testing.T) {
+	s, url := newTestServer(t, Config{},
+		common.Resource{Name: "project-b", Type: "gke-internal-project"},
+		common.Resource{Name: "project-a", Type: "gke-internal-project"},
+		common.Resource{Name: "dns-project", Type: "gke-dns-project"},
+	)
+	c := newTestClient(t, "job", url)
+
+	r, err := c.Acquire("gke-internal-project", common.Free, common.Busy)
+	if err != nil {
+		t.Fatalf("Acquire() = %v, want nil", err)
+	}
+	if r.Name != "project-a" {
+		t.Errorf("Acquire() = %q, want %q", r.Name, "project-a")
+	}
+	checkState(t, s, "project-a", common.Busy, "job")
+
+	if err := c.UpdateOne("project-a", common.Busy, nil); err != nil {
+		t.Errorf("UpdateOne() = %v, want nil", err)
+	}
+	if err := c.ReleaseOne("project-a", common.Dirty); err != nil {
+		t.Errorf("ReleaseOne() = %v, want nil", err)
+	}
+	checkState(t, s, "project-a", common.Dirty, "")
+	checkState(t, s, "project-b", common.Free, "")
+	checkState(t, s, "dns-project", common.Free, "")
+}
+
+func TestAcquireErrors(t *testing.T) {
+	_, url := newTestServer(t, Config{},
+		common.Resource{Name: "project-a", Type: "gke-internal-project"},
+	)
+	c := newTestClient(t, "job", url)
+
+	if _, err := c.Acquire("gke-internal-project", common.Free, common.Busy); err != nil {
+		t.Fatalf("Acquire() = %v, want nil", err)
+	}
+	if _, err := c.Acquire("gke-internal-project", common.Free, common.Busy); err != boskosclient.ErrNotFound {
+		t.Errorf("Acquire() with no free project = %v, want %v", err, boskosclient.ErrNotFound)
+	}
+
+	c.DistinguishNotFoundVsTypeNotFound = true
+	if _, err := c.Acquire("unknown-type", common.Free, common.Busy); err != boskosclient.ErrTypeNotFound {
+		t.Errorf("Acquire() with unknown type = %v, want %v", err, boskosclient.ErrTypeNotFound)
+	}
+}
+
+func TestOwnerMismatch(t *testing.T) {
+	s, url := newTestServer(t, Config{},
+		common.Resource{Name: "project-a", Type: "gke-internal-project"},
+	)
+	owner := newTestClient(t, "job", url)
+	other := newTestClient(t, "other-job", url)
+
+	if _, err := owner.Acquire("gke-internal-project", common.Free, common.Busy); err != nil {
+		t.Fatalf("Acquire() = %v, want nil", err)
+	}
+	if err := other.Update("project-a", common.Busy, nil); err == nil {
+		t.Errorf("Update() by another owner = nil, want error")
+	}
+	if err := other.Release("project-a", common.Free); err == nil {
+		t.Errorf("Release() by another owner = nil, want error")
+	}
+	checkState(t, s, "project-a", common.Busy, "job")
+}
+
+func TestReap(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s, url := newTestServer(t, Config{ReapTimeout: 10 * time.Minute, CleanDelay: time.Minute, Now: clock.Now},
+		common.Resource{Name: "project-a", Type: "gke-internal-project"},
+	)
+	c := newTestClient(t, "job", url)
+	if _, err := c.Acquire("gke-internal-project", common.Free, common.Busy); err != nil {
+		t.Fatalf("Acquire() = %v, want nil", err)
+	}
+
+	// An update within the timeout keeps the resource busy.
+	clock.now = clock.now.Add(9 * time.Minute)
+	if err := c.UpdateOne("project-a", common.Busy, nil); err != nil {
+		t.Fatalf("UpdateOne() = %v, want nil", err)
+	}
+	clock.now = clock.now.Add(9 * time.Minute)
+	s.Reap()
+	checkState(t, s, "project-a", common.Busy, "job")
+
+	// A stale resource is reaped and can no longer be updated by its owner.
+	clock.now = clock.now.Add(time.Minute)
+	s.Reap()
+	checkState(t, s, "project-a", common.Dirty, "")
+	if err := c.UpdateOne("project-a", common.Busy, nil); err == nil {
+		t.Errorf("UpdateOne() after reaping = nil, want error")
+	}
+
+	// The janitor eventually returns it to the pool.
+	clock.now = clock.now.Add(time.Minute)
+	s.Reap()
+	checkState(t, s, "project-a", common.Free, "")
+}
@@ -0,0 +1,486 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package graph builds the graph of the Kubernetes objects of a recipe, the
+// GCP resources they reference and the GCE resources the GKE controllers
+// create for them, and renders it as DOT or Mermaid.
+package graph
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/manifest"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/plan"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Types of nodes.
+const (
+	// Object is a Kubernetes object of the manifests of the recipe.
+	Object = "object"
+	// Missing is a Kubernetes object referenced by the manifests but not
+	// defined in them, e.g. created by a controller or by the test scripts.
+	Missing = "missing"
+	// GCP is a GCP resource referenced by name, which must exist.
+	GCP = "gcp"
+	// GCE is a GCE resource the GKE controllers create.
+	GCE = "gce"
+)
+
+// Node is a node of the graph.
+type Node struct {
+	// ID identifies the node, e.g. "Service/default/foo".
+	ID   string
+	Type string
+	// Kind is the kind of the object, or the type of the resource.
+	Kind string
+	Name string
+}
+
+// Label returns the label of the node in rendered graphs.
+func (n *Node) Label() string {
+	return n.Kind + "\n" + n.Name
+}
+
+// Edge is an edge of the graph, from the referencing node to the referenced
+// one.
+type Edge struct {
+	From, To string
+	// Label describes the reference, if it's not obvious.
+	Label string
+}
+
+// Graph is the graph of a recipe.
+type Graph struct {
+	Name  string
+	Nodes []*Node
+	Edges []Edge
+
+	nodes map[string]*Node
+	edges map[Edge]bool
+	// namespace is the namespace of the objects without one.
+	namespace string
+	// objects indexes the objects of the manifests by kind, namespace and
+	// name.
+	objects map[string]*manifest.Object
+}
+
+// Options configures Build.
+type Options struct {
+	// GCE adds the GCE resources predicted for the load balancers, see
+	// plan.ForRecipe.
+	GCE bool
+}
+
+// Build returns the graph of the recipe described by d.
+func Build(d *recipe.Description, opts Options) *Graph {
+	g := &Graph{
+		Name:      d.Recipe.Path,
+		nodes:     make(map[string]*Node),
+		edges:     make(map[Edge]bool),
+		namespace: d.Recipe.Name(),
+		objects:   make(map[string]*manifest.Object),
+	}
+	for _, o := range d.Objects {
+		g.objects[g.objectID(o.GetKind(), g.namespaceOf(o), o.GetName())] = o
+		g.addObject(o)
+	}
+	for _, o := range d.Objects {
+		g.addReferences(o)
+	}
+	// ServiceImports are created by the multi-cluster Services controller
+	// for the ServiceExports of the fleet, with the same namespace and name.
+	for _, n := range append([]*Node(nil), g.Nodes...) {
+		if n.Type == Missing && n.Kind == "ServiceImport" {
+			parts := strings.SplitN(n.ID, "/", 3)
+			g.addRef(n.ID, "ServiceExport", parts[1], parts[2], "")
+		}
+	}
+	for _, r := range d.Resources {
+		to := g.addNode(&Node{ID: r.Type + "/" + r.Name, Type: GCP, Kind: r.Type, Name: r.Name})
+		if r.Object != nil {
+			g.addEdge(g.objectID(r.Object.GetKind(), g.namespaceOf(r.Object), r.Object.GetName()), to, "")
+		}
+	}
+	if opts.GCE {
+		for _, r := range plan.ForRecipe(d).Resources {
+			from := r.Object
+			if r.Parent != "" {
+				from = "gce/" + r.Parent
+			}
+			g.addEdge(from, g.addNode(&Node{ID: "gce/" + r.ID(), Type: GCE, Kind: r.Type, Name: r.Name}), "")
+		}
+	}
+	sort.SliceStable(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.Label < b.Label
+	})
+	return g
+}
+
+// Node returns the node with the given ID, or nil.
+func (g *Graph) Node(id string) *Node {
+	return g.nodes[id]
+}
+
+// HasEdge returns true if the graph has an edge between the nodes with the
+// given IDs.
+func (g *Graph) HasEdge(from, to string) bool {
+	for _, e := range g.Edges {
+		if e.From == from && e.To == to {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Graph) namespaceOf(o *manifest.Object) string {
+	if ns := o.GetNamespace(); ns != "" {
+		return ns
+	}
+	return g.namespace
+}
+
+// objectID returns the ID of the node of an object.
+func (g *Graph) objectID(kind, namespace, name string) string {
+	if namespace == "" {
+		namespace = g.namespace
+	}
+	return kind + "/" + namespace + "/" + name
+}
+
+func (g *Graph) addNode(n *Node) string {
+	if _, ok := g.nodes[n.ID]; !ok {
+		g.nodes[n.ID] = n
+		g.Nodes = append(g.Nodes, n)
+	}
+	return n.ID
+}
+
+func (g *Graph) addObject(o *manifest.Object) string {
+	return g.addNode(&Node{ID: g.objectID(o.GetKind(), g.namespaceOf(o), o.GetName()), Type: Object, Kind: o.GetKind(), Name: o.GetName()})
+}
+
+// addRef adds an edge from the node with ID from to the object kind
+// namespace/name, adding a Missing node if the object isn't in the
+// manifests.
+func (g *Graph) addRef(from, kind, namespace, name, label string) {
+	if name == "" {
+		return
+	}
+	id := g.objectID(kind, namespace, name)
+	if _, ok := g.nodes[id]; !ok {
+		g.addNode(&Node{ID: id, Type: Missing, Kind: kind, Name: name})
+	}
+	g.addEdge(from, id, label)
+}
+
+func (g *Graph) addEdge(from, to, label string) {
+	e := Edge{From: from, To: to, Label: label}
+	if from == to || g.edges[e] {
+		return
+	}
+	g.edges[e] = true
+	g.Edges = append(g.Edges, e)
+}
+
+// addReferences adds the edges from an object to the objects it references.
+func (g *Graph) addReferences(o *manifest.Object) {
+	id := g.objectID(o.GetKind(), g.namespaceOf(o), o.GetName())
+	ns := g.namespaceOf(o)
+	annotations := o.GetAnnotations()
+
+	switch o.GetKind() {
+	case "Ingress":
+		for _, b := range ingressBackends(o.Object) {
+			g.addRef(id, "Service", ns, b.name, b.port)
+		}
+		for _, key := range []string{"networking.gke.io/v1beta1.FrontendConfig", "networking.gke.io/frontend-config"} {
+			g.addRef(id, "FrontendConfig", ns, annotations[key], "")
+		}
+		for _, cert := range splitList(annotations["networking.gke.io/managed-certificates"]) {
+			g.addRef(id, "ManagedCertificate", ns, cert, "")
+		}
+		tls, _, _ := unstructured.NestedSlice(o.Object, "spec", "tls")
+		for _, t := range tls {
+			if t, ok := t.(map[string]interface{}); ok {
+				g.addRef(id, "Secret", ns, manifest.FieldString(t["secretName"]), "tls")
+			}
+		}
+	case "MultiClusterIngress":
+		template, _, _ := unstructured.NestedMap(o.Object, "spec", "template")
+		for _, b := range ingressBackends(template) {
+			g.addRef(id, "MultiClusterService", ns, b.name, b.port)
+		}
+		g.addRef(id, "FrontendConfig", ns, annotations["networking.gke.io/frontend-config"], "")
+	case "Service", "MultiClusterService":
+		for _, key := range manifest.BackendConfigAnnotations {
+			// Malformed annotations are reported by test/healthcheck.
+			configs, _ := manifest.BackendConfigs(annotations[key])
+			var ports []string
+			for port := range configs {
+				ports = append(ports, port)
+			}
+			sort.Strings(ports)
+			for _, port := range ports {
+				g.addRef(id, "BackendConfig", ns, configs[port], port)
+			}
+		}
+		selector, _, _ := unstructured.NestedStringMap(o.Object, "spec", "selector")
+		if o.GetKind() == "MultiClusterService" {
+			selector, _, _ = unstructured.NestedStringMap(o.Object, "spec", "template", "spec", "selector")
+		}
+		g.addSelected(id, ns, selector)
+	case "BackendConfig":
+		secret, _, _ := unstructured.NestedString(o.Object, "spec", "iap", "oauthclientCredentials", "secretName")
+		g.addRef(id, "Secret", ns, secret, "iap")
+	case "Gateway":
+		listeners, _, _ := unstructured.NestedSlice(o.Object, "spec", "listeners")
+		for _, l := range listeners {
+			l, ok := l.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			// networking.x-k8s.io/v1alpha1 Gateways select their routes by
+			// label.
+			if kind, ok, _ := unstructured.NestedString(l, "routes", "kind"); ok {
+				selector, _, _ := unstructured.NestedStringMap(l, "routes", "selector", "matchLabels")
+				g.addSelectedRoutes(id, ns, kind, selector)
+			}
+			refs, _, _ := unstructured.NestedSlice(l, "tls", "certificateRefs")
+			for _, ref := range refs {
+				if ref, ok := ref.(map[string]interface{}); ok {
+					g.addRef(id, kindOr(ref, "Secret"), namespaceOr(ref, ns), manifest.FieldString(ref["name"]), "tls")
+				}
+			}
+		}
+	case "HTTPRoute", "GRPCRoute", "TCPRoute", "TLSRoute", "UDPRoute":
+		// Routes attach to their Gateways: the edges go from the Gateways to
+		// the routes, and from the routes to their backends.
+		parents, _, _ := unstructured.NestedSlice(o.Object, "spec", "parentRefs")
+		for _, p := range parents {
+			if p, ok := p.(map[string]interface{}); ok {
+				gw := g.objectID(kindOr(p, "Gateway"), namespaceOr(p, ns), manifest.FieldString(p["name"]))
+				if _, ok := g.nodes[gw]; !ok {
+					g.addNode(&Node{ID: gw, Type: Missing, Kind: kindOr(p, "Gateway"), Name: manifest.FieldString(p["name"])})
+				}
+				g.addEdge(gw, id, manifest.FieldString(p["sectionName"]))
+			}
+		}
+		rules, _, _ := unstructured.NestedSlice(o.Object, "spec", "rules")
+		for _, rule := range rules {
+			rule, ok := rule.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			refs, _, _ := unstructured.NestedSlice(rule, "backendRefs")
+			for _, ref := range refs {
+				if ref, ok := ref.(map[string]interface{}); ok {
+					g.addRef(id, kindOr(ref, "Service"), namespaceOr(ref, ns), manifest.FieldString(ref["name"]), manifest.FieldString(ref["port"]))
+				}
+			}
+			// networking.x-k8s.io/v1alpha1 routes forward to Services by name,
+			// or to other backends.
+			forwards, _, _ := unstructured.NestedSlice(rule, "forwardTo")
+			for _, f := range forwards {
+				f, ok := f.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if ref, ok, _ := unstructured.NestedMap(f, "backendRef"); ok {
+					g.addRef(id, kindOr(ref, "Service"), namespaceOr(ref, ns), manifest.FieldString(ref["name"]), manifest.FieldString(f["port"]))
+				}
+				g.addRef(id, "Service", ns, manifest.FieldString(f["serviceName"]), manifest.FieldString(f["port"]))
+			}
+			filters, _, _ := unstructured.NestedSlice(rule, "filters")
+			for _, f := range filters {
+				f, ok := f.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if ref, ok, _ := unstructured.NestedMap(f, "requestMirror", "backendRef"); ok {
+					g.addRef(id, kindOr(ref, "Service"), namespaceOr(ref, ns), manifest.FieldString(ref["name"]), "mirror")
+				}
+			}
+		}
+	case "ServiceImport":
+		g.addRef(id, "ServiceExport", ns, o.GetName(), "")
+	case "ServiceExport":
+		g.addRef(id, "Service", ns, o.GetName(), "")
+	case "GCPBackendPolicy", "GCPGatewayPolicy", "HealthCheckPolicy", "GCPRoutingExtension", "GCPTrafficExtension", "GCPAuthzPolicy":
+		var refs []interface{}
+		if ref, ok, _ := unstructured.NestedMap(o.Object, "spec", "targetRef"); ok {
+			refs = append(refs, ref)
+		}
+		targets, _, _ := unstructured.NestedSlice(o.Object, "spec", "targetRefs")
+		refs = append(refs, targets...)
+		for _, ref := range refs {
+			if ref, ok := ref.(map[string]interface{}); ok {
+				g.addRef(id, kindOr(ref, "Service"), namespaceOr(ref, ns), manifest.FieldString(ref["name"]), "target")
+			}
+		}
+	case "VirtualService":
+		gateways, _, _ := unstructured.NestedStringSlice(o.Object, "spec", "gateways")
+		for _, gw := range gateways {
+			gwNamespace, name := ns, gw
+			if i := strings.Index(gw, "/"); i >= 0 {
+				gwNamespace, name = gw[:i], gw[i+1:]
+			}
+			g.addRef(id, "Gateway", gwNamespace, name, "")
+		}
+		routes, _, _ := unstructured.NestedSlice(o.Object, "spec", "http")
+		for _, route := range routes {
+			route, ok := route.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			destinations, _, _ := unstructured.NestedSlice(route, "route")
+			for _, d := range destinations {
+				d, ok := d.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				host, _, _ := unstructured.NestedString(d, "destination", "host")
+				// Hosts are Service names, or their FQDNs.
+				parts := strings.Split(host, ".")
+				svcNamespace := ns
+				if len(parts) > 1 {
+					svcNamespace = parts[1]
+				}
+				g.addRef(id, "Service", svcNamespace, parts[0], "")
+			}
+		}
+	}
+}
+
+// addSelected adds edges from the node with ID from to the workloads in
+// namespace whose pods match selector.
+func (g *Graph) addSelected(from, namespace string, selector map[string]string) {
+	if len(selector) == 0 {
+		return
+	}
+	var ids []string
+	for id, o := range g.objects {
+		switch o.GetKind() {
+		case "Deployment", "StatefulSet", "DaemonSet":
+		default:
+			continue
+		}
+		if g.namespaceOf(o) != namespace {
+			continue
+		}
+		labels, _, _ := unstructured.NestedStringMap(o.Object, "spec", "template", "metadata", "labels")
+		if manifest.MatchLabels(labels, selector) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		g.addEdge(from, id, "selector")
+	}
+}
+
+// addSelectedRoutes adds edges from the node with ID from to the routes of
+// the given kind in namespace whose labels match selector.
+func (g *Graph) addSelectedRoutes(from, namespace, kind string, selector map[string]string) {
+	var ids []string
+	for id, o := range g.objects {
+		if o.GetKind() != kind || g.namespaceOf(o) != namespace {
+			continue
+		}
+		if manifest.MatchLabels(o.GetLabels(), selector) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		g.addEdge(from, id, "")
+	}
+}
+
+// backendPort is a Service and port used as a backend.
+type backendPort struct {
+	name, port string
+}
+
+// ingressBackends returns the backends of an Ingress spec, in the v1 or the
+// legacy v1beta1 format.
+func ingressBackends(obj map[string]interface{}) []backendPort {
+	var backends []map[string]interface{}
+	for _, field := range [][]string{{"spec", "defaultBackend"}, {"spec", "backend"}} {
+		if b, ok, _ := unstructured.NestedMap(obj, field...); ok {
+			backends = append(backends, b)
+		}
+	}
+	rules, _, _ := unstructured.NestedSlice(obj, "spec", "rules")
+	for _, rule := range rules {
+		rule, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		paths, _, _ := unstructured.NestedSlice(rule, "http", "paths")
+		for _, p := range paths {
+			if p, ok := p.(map[string]interface{}); ok {
+				if b, ok, _ := unstructured.NestedMap(p, "backend"); ok {
+					backends = append(backends, b)
+				}
+			}
+		}
+	}
+	var ports []backendPort
+	for _, b := range backends {
+		if svc, ok, _ := unstructured.NestedMap(b, "service"); ok {
+			port := manifest.FieldString(manifest.NestedField(svc, "port", "number"))
+			if port == "" {
+				port = manifest.FieldString(manifest.NestedField(svc, "port", "name"))
+			}
+			ports = append(ports, backendPort{name: manifest.FieldString(svc["name"]), port: port})
+			continue
+		}
+		ports = append(ports, backendPort{name: manifest.FieldString(b["serviceName"]), port: manifest.FieldString(b["servicePort"])})
+	}
+	return ports
+}
+
+func kindOr(ref map[string]interface{}, kind string) string {
+	if k := manifest.FieldString(ref["kind"]); k != "" {
+		return k
+	}
+	return kind
+}
+
+func namespaceOr(ref map[string]interface{}, namespace string) string {
+	if ns := manifest.FieldString(ref["namespace"]); ns != "" {
+		return ns
+	}
+	return namespace
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,255 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe/recipetest"
+)
+
+// repoRoot is the root of the repository, relative to this package.
+const repoRoot = "../.."
+
+const manifests = `
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+  annotations:
+    networking.gke.io/v1beta1.FrontendConfig: web
+spec:
+  defaultBackend:
+    service:
+      name: foo
+      port:
+        number: 80
+---
+apiVersion: networking.gke.io/v1beta1
+kind: FrontendConfig
+metadata:
+  name: web
+spec:
+  sslPolicy: web-ssl-policy
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: foo
+  annotations:
+    cloud.google.com/backend-config: '{"default": "foo"}'
+spec:
+  selector:
+    app: foo
+---
+apiVersion: cloud.google.com/v1
+kind: BackendConfig
+metadata:
+  name: foo
+spec:
+  securityPolicy:
+    name: foo-armor
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: foo
+spec:
+  template:
+    metadata:
+      labels:
+        app: foo
+        version: v1
+---
+apiVersion: gateway.networking.k8s.io/v1beta1
+kind: Gateway
+metadata:
+  name: gw
+spec:
+  gatewayClassName: gke-l7-rilb-mc
+---
+apiVersion: gateway.networking.k8s.io/v1beta1
+kind: HTTPRoute
+metadata:
+  name: route
+spec:
+  parentRefs:
+  - name: gw
+  rules:
+  - backendRefs:
+    - group: net.gke.io
+      kind: ServiceImport
+      name: foo
+      port: 80
+---
+apiVersion: net.gke.io/v1
+kind: ServiceExport
+metadata:
+  name: foo
+`
+
+func describe(t *testing.T) *recipe.Description {
+	t.Helper()
+	root := t.TempDir()
+	dir := filepath.Join(root, "ingress", "my-recipe")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "app.yaml"), []byte(manifests), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := recipe.Load(root, "ingress/my-recipe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := recipe.Describe(r)
+	if err != nil {
+		t.Fatalf("Describe() = %v, want nil", err)
+	}
+	return d
+}
+
+func TestBuild(t *testing.T) {
+	g := Build(describe(t), Options{})
+	for _, e := range [][2]string{
+		{"Ingress/my-recipe/web", "Service/my-recipe/foo"},
+		{"Ingress/my-recipe/web", "FrontendConfig/my-recipe/web"},
+		{"FrontendConfig/my-recipe/web", "sslPolicy/web-ssl-policy"},
+		{"Service/my-recipe/foo", "BackendConfig/my-recipe/foo"},
+		{"Service/my-recipe/foo", "Deployment/my-recipe/foo"},
+		{"BackendConfig/my-recipe/foo", "securityPolicy/foo-armor"},
+		{"Gateway/my-recipe/gw", "HTTPRoute/my-recipe/route"},
+		{"HTTPRoute/my-recipe/route", "ServiceImport/my-recipe/foo"},
+		{"ServiceImport/my-recipe/foo", "ServiceExport/my-recipe/foo"},
+		{"ServiceExport/my-recipe/foo", "Service/my-recipe/foo"},
+	} {
+		if !g.HasEdge(e[0], e[1]) {
+			t.Errorf("Build() has no edge %s -> %s, edges: %v", e[0], e[1], g.Edges)
+		}
+	}
+	for id, typ := range map[string]string{
+		"Ingress/my-recipe/web":       Object,
+		"ServiceImport/my-recipe/foo": Missing,
+		"securityPolicy/foo-armor":    GCP,
+	} {
+		if n := g.Node(id); n == nil || n.Type != typ {
+			t.Errorf("Node(%q) = %+v, want type %q", id, n, typ)
+		}
+	}
+	for _, n := range g.Nodes {
+		if n.Type == GCE {
+			t.Errorf("Build() = %+v, want no GCE resources without Options.GCE", n)
+		}
+	}
+}
+
+func TestBuildGCE(t *testing.T) {
+	g := Build(describe(t), Options{GCE: true})
+	fr := "gce/forwardingRule/k8s2-fr-uuuuuuuu-my-recipe-web-hhhhhhhh"
+	um := "gce/urlMap/k8s2-um-uuuuuuuu-my-recipe-web-hhhhhhhh"
+	bs := "gce/backendService/k8s1-uuuuuuuu-my-recipe-foo-80-hhhhhhhh"
+	if !g.HasEdge("Ingress/my-recipe/web", fr) || !g.HasEdge(um, bs) {
+		t.Errorf("Build() = %v, want the GCE resources of the Ingress", g.Edges)
+	}
+}
+
+func TestRender(t *testing.T) {
+	g := Build(describe(t), Options{})
+	dot := g.DOT()
+	for _, want := range []string{
+		`digraph "ingress/my-recipe" {`,
+		`n0 [label="Ingress\nweb", shape=box];`,
+		`n0 -> n2 [label="80"];`,
+		`shape=box, style=dashed];`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("DOT() = %s, want it to contain %q", dot, want)
+		}
+	}
+	mermaid := g.Mermaid()
+	for _, want := range []string{
+		"flowchart LR\n",
+		`  n0["Ingress<br/>web"]:::object`,
+		`  n0 -->|"80"| n2`,
+		`(["securityPolicy<br/>foo-armor"]):::gcp`,
+	} {
+		if !strings.Contains(mermaid, want) {
+			t.Errorf("Mermaid() = %s, want it to contain %q", mermaid, want)
+		}
+	}
+}
+
+// TestRecipes builds and renders the graphs of the recipes of the repository.
+func TestRecipes(t *testing.T) {
+	recipetest.ForEachDescribed(t, repoRoot, func(t *testing.T, d *recipe.Description) {
+		g := Build(d, Options{GCE: true})
+		if len(d.Objects) > 0 && len(g.Nodes) == 0 {
+			t.Errorf("Build() = empty graph, want the nodes of %d objects", len(d.Objects))
+		}
+		for _, e := range g.Edges {
+			if g.Node(e.From) == nil || g.Node(e.To) == nil {
+				t.Errorf("Build() has edge %s -> %s, want edges between its nodes", e.From, e.To)
+			}
+		}
+		objects := make(map[string]bool)
+		for _, n := range g.Nodes {
+			if n.Type == Object {
+				objects[n.Kind+"/"+n.Name] = true
+			}
+		}
+		for _, o := range d.Objects {
+			if !objects[o.GetKind()+"/"+o.GetName()] {
+				t.Errorf("Build() has no node for %s", o)
+			}
+		}
+		g.DOT()
+		g.Mermaid()
+	})
+}
+
+// TestCloudArmorRecipe checks the graph of a recipe of the repository, from
+// its Ingress to the security policy of its BackendConfig.
+func TestCloudArmorRecipe(t *testing.T) {
+	r := recipetest.Find(t, repoRoot, "ingress/single-cluster/ingress-cloudarmor")
+	d, err := recipe.Describe(r)
+	if err != nil {
+		t.Fatalf("Describe(%s) = %v, want nil", r.Path, err)
+	}
+	g := Build(d, Options{GCE: true})
+	for _, e := range [][2]string{
+		{"Ingress/ingress-cloudarmor/cloudarmor-test", "Service/ingress-cloudarmor/whereami"},
+		{"Service/ingress-cloudarmor/whereami", "BackendConfig/ingress-cloudarmor/cloudarmor-test"},
+		{"Service/ingress-cloudarmor/whereami", "Deployment/ingress-cloudarmor/whereami"},
+		{"BackendConfig/ingress-cloudarmor/cloudarmor-test", "securityPolicy/$POLICY_NAME"},
+		{"Ingress/ingress-cloudarmor/cloudarmor-test", "gce/forwardingRule/k8s2-fr-uuuuuuuu-ingress-cloudarmor-cloudarmor-test-hhhhhhhh"},
+		{"gce/urlMap/k8s2-um-uuuuuuuu-ingress-cloudarmor-cloudarmor-test-hhhhhhhh", "gce/backendService/k8s1-uuuuuuuu-ingress-cloudarmor-whereami-80-hhhhhhhh"},
+	} {
+		if !g.HasEdge(e[0], e[1]) {
+			t.Errorf("Build(%s) has no edge %s -> %s, edges: %v", r.Path, e[0], e[1], g.Edges)
+		}
+	}
+	for _, n := range g.Nodes {
+		if n.Type == Missing {
+			t.Errorf("Build(%s) = missing %s, want all the references of the recipe defined", r.Path, n.ID)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// dotStyles are the DOT attributes of the nodes of each type.
+var dotStyles = map[string]string{
+	Object:  `shape=box`,
+	Missing: `shape=box, style=dashed`,
+	GCP:     `shape=ellipse, style=filled, fillcolor="#e8f0fe"`,
+	GCE:     `shape=ellipse, style=dashed`,
+}
+
+// DOT renders the graph in the Graphviz DOT language.
+func (g *Graph) DOT() string {
+	ids := g.shortIDs()
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", strconv.Quote(g.Name))
+	b.WriteString("  rankdir=LR;\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "  %s [label=%s, %s];\n", ids[n.ID], strconv.Quote(n.Label()), dotStyles[n.Type])
+	}
+	for _, e := range g.Edges {
+		if e.Label != "" {
+			fmt.Fprintf(&b, "  %s -> %s [label=%s];\n", ids[e.From], ids[e.To], strconv.Quote(e.Label))
+			continue
+		}
+		fmt.Fprintf(&b, "  %s -> %s;\n", ids[e.From], ids[e.To])
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid renders the graph as a Mermaid flowchart, which GitHub renders in
+// markdown files in a mermaid code block.
+func (g *Graph) Mermaid() string {
+	ids := g.shortIDs()
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, n := range g.Nodes {
+		label := mermaidText(n.Kind) + "<br/>" + mermaidText(n.Name)
+		switch n.Type {
+		case GCP, GCE:
+			fmt.Fprintf(&b, "  %s([\"%s\"]):::%s\n", ids[n.ID], label, n.Type)
+		default:
+			fmt.Fprintf(&b, "  %s[\"%s\"]:::%s\n", ids[n.ID], label, n.Type)
+		}
+	}
+	for _, e := range g.Edges {
+		if e.Label != "" {
+			fmt.Fprintf(&b, "  %s -->|\"%s\"| %s\n", ids[e.From], mermaidText(e.Label), ids[e.To])
+			continue
+		}
+		fmt.Fprintf(&b, "  %s --> %s\n", ids[e.From], ids[e.To])
+	}
+	b.WriteString("  classDef object fill:#fff,stroke:#333\n")
+	b.WriteString("  classDef missing fill:#fff,stroke:#333,stroke-dasharray:4\n")
+	b.WriteString("  classDef gcp fill:#e8f0fe,stroke:#1a73e8\n")
+	b.WriteString("  classDef gce fill:#fff,stroke:#1a73e8,stroke-dasharray:4\n")
+	return b.String()
+}
+
+// shortIDs returns short identifiers for the nodes, n0, n1, ..., in the order
+// they were added, as the IDs of the nodes contain characters DOT and Mermaid
+// don't allow in identifiers.
+func (g *Graph) shortIDs() map[string]string {
+	ids := make(map[string]string, len(g.Nodes))
+	for i, n := range g.Nodes {
+		ids[n.ID] = fmt.Sprintf("n%d", i)
+	}
+	return ids
+}
+
+// mermaidText escapes s for a quoted Mermaid label.
+func mermaidText(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(s)
+}
@@ -0,0 +1,364 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package grpcprobe probes the gRPC services of the recipes, e.g. behind the
+// gRPC Gateway of gateway/grpc: it dials them with TLS, verifying their
+// certificate with the CA of the recipe, checks their health with the gRPC
+// health service, and calls their unary methods, found with the gRPC server
+// reflection service, to assert on the status and the metadata of the
+// responses.
+package grpcprobe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Options configure how the probe dials a server.
+type Options struct {
+	// Address is the address of the server, host:port, e.g. the address of
+	// a Gateway and 443.
+	Address string
+	// ServerName is the name sent in the SNI extension, the name the
+	// certificate of the server must be valid for, e.g. grpc.domain.com.
+	// It is the host of Address if empty.
+	ServerName string
+	// CA is the PEM encoded bundle of the certificates the certificate of
+	// the server is verified with, e.g. the CA_crt.pem of the recipe. The
+	// system roots are used if it is empty.
+	CA []byte
+	// Files are the descriptors of the services, used instead of the
+	// reflection service of the server, e.g. read from a protoset file.
+	Files *protoregistry.Files
+}
+
+// Probe is a connection to a gRPC server.
+type Probe struct {
+	conn  *grpc.ClientConn
+	files *protoregistry.Files
+}
+
+// Dial returns a probe connected to the server of opts. The connection is
+// established lazily, by the first call.
+func Dial(opts Options) (*Probe, error) {
+	config := &tls.Config{ServerName: opts.ServerName, MinVersion: tls.VersionTLS12}
+	if len(opts.CA) > 0 {
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(opts.CA) {
+			return nil, errors.New("the CA bundle has no PEM encoded certificate")
+		}
+	}
+	conn, err := grpc.Dial(opts.Address, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %w", opts.Address, err)
+	}
+	return &Probe{conn: conn, files: opts.Files}, nil
+}
+
+// Close closes the connection of the probe.
+func (p *Probe) Close() error {
+	return p.conn.Close()
+}
+
+// Health returns the serving status of service, or of the whole server if it
+// is empty, reported by the gRPC health service of the server.
+func (p *Probe) Health(ctx context.Context, service string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	resp, err := healthpb.NewHealthClient(p.conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return healthpb.HealthCheckResponse_UNKNOWN, fmt.Errorf("health check of service %q failed: %w", service, err)
+	}
+	return resp.GetStatus(), nil
+}
+
+// ignoredServices are the services of the infrastructure, skipped when
+// discovering the methods of the application.
+var ignoredServices = map[string]bool{
+	"grpc.health.v1.Health":                    true,
+	"grpc.reflection.v1alpha.ServerReflection": true,
+	"grpc.reflection.v1.ServerReflection":      true,
+	"grpc.channelz.v1.Channelz":                true,
+}
+
+// Methods returns the unary methods of the services of the application, as
+// service/method, e.g. echo.EchoServer/SayHelloUnary, sorted. The services
+// of the infrastructure, e.g. the health service, are ignored.
+func (p *Probe) Methods(ctx context.Context) ([]string, error) {
+	files, services, err := p.descriptors(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	var methods []string
+	for _, name := range services {
+		if ignoredServices[name] {
+			continue
+		}
+		d, err := files.FindDescriptorByName(protoreflect.FullName(name))
+		if err != nil {
+			return nil, fmt.Errorf("no descriptor for service %s: %w", name, err)
+		}
+		sd, ok := d.(protoreflect.ServiceDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a service", name)
+		}
+		for i := 0; i < sd.Methods().Len(); i++ {
+			if m := sd.Methods().Get(i); !m.IsStreamingClient() && !m.IsStreamingServer() {
+				methods = append(methods, name+"/"+string(m.Name()))
+			}
+		}
+	}
+	sort.Strings(methods)
+	return methods, nil
+}
+
+// Response is the response to a call.
+type Response struct {
+	// Code is the status code of the call, codes.OK if it succeeded, and
+	// Status the message of its status if it failed.
+	Code   codes.Code
+	Status string
+	// Message is the response message, in JSON, empty if the call failed.
+	Message string
+	// Header and Trailer are the metadata of the response.
+	Header  metadata.MD
+	Trailer metadata.MD
+}
+
+// Call calls the unary method, service/method, with the request message in
+// JSON, empty for the default message, and the metadata md. A call failing
+// with a status is a Response with its code, not an error.
+func (p *Probe) Call(ctx context.Context, method, request string, md metadata.MD) (*Response, error) {
+	service, name, ok := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+	if !ok {
+		return nil, fmt.Errorf("method %q is not service/method", method)
+	}
+	files, _, err := p.descriptors(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("no descriptor for service %s: %w", service, err)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	m := sd.Methods().ByName(protoreflect.Name(name))
+	if m == nil {
+		return nil, fmt.Errorf("service %s has no method %s", service, name)
+	}
+	if m.IsStreamingClient() || m.IsStreamingServer() {
+		return nil, fmt.Errorf("method %s is not unary", method)
+	}
+	in := dynamicpb.NewMessage(m.Input())
+	if request != "" {
+		if err := protojson.Unmarshal([]byte(request), in); err != nil {
+			return nil, fmt.Errorf("invalid request for %s: %w", method, err)
+		}
+	}
+	out := dynamicpb.NewMessage(m.Output())
+	resp := &Response{}
+	err = p.conn.Invoke(metadata.NewOutgoingContext(ctx, md), "/"+service+"/"+name, in, out, grpc.Header(&resp.Header), grpc.Trailer(&resp.Trailer))
+	if err != nil {
+		s, ok := status.FromError(err)
+		if !ok {
+			return nil, fmt.Errorf("call of %s failed: %w", method, err)
+		}
+		resp.Code, resp.Status = s.Code(), s.Message()
+		return resp, nil
+	}
+	b, err := protojson.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	resp.Message = string(b)
+	return resp, nil
+}
+
+// descriptors returns the descriptors of the services of the server, those
+// of service only if it is not empty, and the names of the services. They are
+// the Files of the probe if any, or are fetched from the reflection service
+// of the server.
+func (p *Probe) descriptors(ctx context.Context, service string) (*protoregistry.Files, []string, error) {
+	if p.files != nil {
+		var services []string
+		p.files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+			for i := 0; i < fd.Services().Len(); i++ {
+				services = append(services, string(fd.Services().Get(i).FullName()))
+			}
+			return true
+		})
+		sort.Strings(services)
+		return p.files, services, nil
+	}
+
+	stream, err := reflectionpb.NewServerReflectionClient(p.conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("no reflection service: %w", err)
+	}
+	defer stream.CloseSend()
+	ask := func(req *reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error) {
+		if err := stream.Send(req); err != nil {
+			return nil, fmt.Errorf("reflection request failed: %w", err)
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, fmt.Errorf("reflection request failed: %w", err)
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return nil, fmt.Errorf("reflection request failed: %s", e.GetErrorMessage())
+		}
+		return resp, nil
+	}
+
+	services := []string{service}
+	if service == "" {
+		resp, err := ask(&reflectionpb.ServerReflectionRequest{MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{}})
+		if err != nil {
+			return nil, nil, err
+		}
+		services = nil
+		for _, s := range resp.GetListServicesResponse().GetService() {
+			services = append(services, s.GetName())
+		}
+		sort.Strings(services)
+	}
+
+	protos := make(map[string]*descriptorpb.FileDescriptorProto)
+	add := func(resp *reflectionpb.ServerReflectionResponse) error {
+		for _, b := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(b, fd); err != nil {
+				return fmt.Errorf("invalid file descriptor: %w", err)
+			}
+			protos[fd.GetName()] = fd
+		}
+		return nil
+	}
+	for _, s := range services {
+		if ignoredServices[s] && service == "" {
+			continue
+		}
+		resp, err := ask(&reflectionpb.ServerReflectionRequest{MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: s}})
+		if err != nil {
+			return nil, nil, fmt.Errorf("service %s: %w", s, err)
+		}
+		if err := add(resp); err != nil {
+			return nil, nil, err
+		}
+	}
+	// Fetch the dependencies the server didn't send, falling back to the
+	// well-known types linked in the probe.
+	for missing := missingDependencies(protos); len(missing) > 0; missing = missingDependencies(protos) {
+		for _, name := range missing {
+			resp, err := ask(&reflectionpb.ServerReflectionRequest{MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: name}})
+			if err == nil {
+				err = add(resp)
+			}
+			if _, ok := protos[name]; ok {
+				continue
+			}
+			fd, globalErr := protoregistry.GlobalFiles.FindFileByPath(name)
+			if globalErr != nil {
+				return nil, nil, fmt.Errorf("no descriptor for %s: %v", name, err)
+			}
+			protos[name] = protodesc.ToFileDescriptorProto(fd)
+		}
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, fd := range protos {
+		set.File = append(set.File, fd)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid descriptors: %w", err)
+	}
+	return files, services, nil
+}
+
+// missingDependencies returns the dependencies of protos which are not in
+// protos.
+func missingDependencies(protos map[string]*descriptorpb.FileDescriptorProto) []string {
+	var missing []string
+	seen := make(map[string]bool)
+	for _, fd := range protos {
+		for _, dep := range fd.GetDependency() {
+			if _, ok := protos[dep]; !ok && !seen[dep] {
+				seen[dep] = true
+				missing = append(missing, dep)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// Expectation is what a response is asserted to be.
+type Expectation struct {
+	// Code is the status code of the call.
+	Code codes.Code
+	// Metadata are values the header or the trailer of the response must
+	// have, by key.
+	Metadata map[string]string
+	// Message is a substring of the response message, in JSON, if not
+	// empty.
+	Message string
+}
+
+// Check returns an error if resp doesn't meet the expectation.
+func Check(resp *Response, want Expectation) error {
+	var errs []error
+	if resp.Code != want.Code {
+		errs = append(errs, fmt.Errorf("status %s %q, want %s", resp.Code, resp.Status, want.Code))
+	}
+	keys := make([]string, 0, len(want.Metadata))
+	for k := range want.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		values := append(resp.Header.Get(k), resp.Trailer.Get(k)...)
+		found := false
+		for _, v := range values {
+			found = found || v == want.Metadata[k]
+		}
+		if !found {
+			errs = append(errs, fmt.Errorf("metadata %s = %q, want %q", k, values, want.Metadata[k]))
+		}
+	}
+	if want.Message != "" && !strings.Contains(resp.Message, want.Message) {
+		errs = append(errs, fmt.Errorf("message %s, want it to contain %q", resp.Message, want.Message))
+	}
+	return errors.Join(errs...)
+}
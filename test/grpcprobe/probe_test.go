@@ -0,0 +1,222 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcprobe
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/certs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const serverName = "grpc.domain.com"
+
+// testServer answers UnaryCall with the payload of the request, with the
+// hostname header of the request in the hostname header of the response, and
+// fails it with the code in the fail header of the request, if any.
+type testServer struct {
+	testpb.UnimplementedTestServiceServer
+}
+
+func (testServer) UnaryCall(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if fail := md.Get("fail"); len(fail) > 0 {
+		return nil, status.Error(codes.PermissionDenied, "failed on request")
+	}
+	grpc.SetHeader(ctx, metadata.Pairs("hostname", "fe-deployment-1"))
+	grpc.SetTrailer(ctx, metadata.Pairs("served-by", "grpc-app"))
+	return &testpb.SimpleResponse{Payload: req.GetPayload()}, nil
+}
+
+func (testServer) EmptyCall(context.Context, *testpb.Empty) (*testpb.Empty, error) {
+	return &testpb.Empty{}, nil
+}
+
+// startServer starts a TLS gRPC server with a certificate for serverName,
+// issued by a new CA, and returns its address, the CA bundle and its health
+// service.
+func startServer(t *testing.T, withReflection bool) (string, []byte, *health.Server) {
+	t.Helper()
+	ca, err := certs.NewCA("grpc", certs.GenerateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := ca.Issue([]string{serverName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := leaf.KeyPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(ca.Chain(leaf), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}})))
+	testpb.RegisterTestServiceServer(s, testServer{})
+	h := health.NewServer()
+	healthpb.RegisterHealthServer(s, h)
+	if withReflection {
+		reflection.Register(s)
+	}
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String(), ca.Bundle(), h
+}
+
+func dial(t *testing.T, opts Options) *Probe {
+	t.Helper()
+	p, err := Dial(opts)
+	if err != nil {
+		t.Fatalf("Dial() = %v, want nil", err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func TestProbe(t *testing.T) {
+	address, ca, h := startServer(t, true)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	p := dial(t, Options{Address: address, ServerName: serverName, CA: ca})
+
+	h.SetServingStatus("grpc.testing.TestService", healthpb.HealthCheckResponse_NOT_SERVING)
+	for service, want := range map[string]healthpb.HealthCheckResponse_ServingStatus{
+		"":                         healthpb.HealthCheckResponse_SERVING,
+		"grpc.testing.TestService": healthpb.HealthCheckResponse_NOT_SERVING,
+	} {
+		if got, err := p.Health(ctx, service); err != nil || got != want {
+			t.Errorf("Health(%q) = %v, %v, want %v", service, got, err, want)
+		}
+	}
+	if _, err := p.Health(ctx, "unknown.Service"); err == nil || !strings.Contains(err.Error(), "NotFound") {
+		t.Errorf("Health(%q) = %v, want NotFound", "unknown.Service", err)
+	}
+
+	methods, err := p.Methods(ctx)
+	if err != nil {
+		t.Fatalf("Methods() = %v, want nil", err)
+	}
+	want := []string{
+		"grpc.testing.TestService/CacheableUnaryCall",
+		"grpc.testing.TestService/EmptyCall",
+		"grpc.testing.TestService/UnaryCall",
+		"grpc.testing.TestService/UnimplementedCall",
+	}
+	if !reflect.DeepEqual(methods, want) {
+		t.Errorf("Methods() = %q, want the unary methods %q", methods, want)
+	}
+
+	resp, err := p.Call(ctx, "grpc.testing.TestService/UnaryCall", `{"payload": {"body": "aGVsbG8="}}`, metadata.Pairs("hostname", "ignored"))
+	if err != nil {
+		t.Fatalf("Call() = %v, want nil", err)
+	}
+	expected := Expectation{Code: codes.OK, Metadata: map[string]string{"hostname": "fe-deployment-1", "served-by": "grpc-app"}, Message: "aGVsbG8="}
+	if err := Check(resp, expected); err != nil {
+		t.Errorf("Check(%+v) = %v, want nil", resp, err)
+	}
+	if err := Check(resp, Expectation{Code: codes.OK, Metadata: map[string]string{"hostname": "fe-deployment-2"}}); err == nil {
+		t.Errorf("Check(%+v) = nil, want an error for the hostname", resp)
+	}
+
+	resp, err = p.Call(ctx, "grpc.testing.TestService/UnaryCall", "", metadata.Pairs("fail", "true"))
+	if err != nil {
+		t.Fatalf("Call() = %v, want a response with the status", err)
+	}
+	if err := Check(resp, Expectation{Code: codes.PermissionDenied}); err != nil {
+		t.Errorf("Check(%+v) = %v, want nil", resp, err)
+	}
+	if err := Check(resp, Expectation{Code: codes.OK}); err == nil || !strings.Contains(err.Error(), "failed on request") {
+		t.Errorf("Check(%+v) = %v, want the status of the failure", resp, err)
+	}
+
+	for _, method := range []string{"grpc.testing.TestService/Missing", "grpc.testing.TestService/StreamingOutputCall", "UnaryCall"} {
+		if _, err := p.Call(ctx, method, "", nil); err == nil {
+			t.Errorf("Call(%q) = nil, want an error", method)
+		}
+	}
+}
+
+func TestProbeFiles(t *testing.T) {
+	address, ca, _ := startServer(t, false)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	p := dial(t, Options{Address: address, ServerName: serverName, CA: ca})
+	if _, err := p.Methods(ctx); err == nil {
+		t.Errorf("Methods() = nil, want an error without the reflection service")
+	}
+
+	// The descriptors of a protoset file.
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, path := range []string{"grpc/testing/empty.proto", "grpc/testing/messages.proto", "grpc/testing/test.proto"} {
+		fd, err := protoregistry.GlobalFiles.FindFileByPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = dial(t, Options{Address: address, ServerName: serverName, CA: ca, Files: files})
+	resp, err := p.Call(ctx, "grpc.testing.TestService/EmptyCall", "", nil)
+	if err != nil || resp.Code != codes.OK {
+		t.Errorf("Call() = %+v, %v, want OK", resp, err)
+	}
+}
+
+func TestProbeTLS(t *testing.T) {
+	address, ca, _ := startServer(t, true)
+	_, otherCA, _ := startServer(t, true)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for desc, opts := range map[string]Options{
+		"another CA":          {Address: address, ServerName: serverName, CA: otherCA},
+		"another server name": {Address: address, ServerName: "http.domain.com", CA: ca},
+	} {
+		p := dial(t, opts)
+		if _, err := p.Health(ctx, ""); err == nil {
+			t.Errorf("Health() with %s = nil, want a TLS error", desc)
+		}
+	}
+	if _, err := Dial(Options{Address: address, CA: []byte("not a certificate")}); err == nil {
+		t.Errorf("Dial() with an invalid CA = nil, want an error")
+	}
+}
@@ -0,0 +1,400 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package healthcheck checks the health checks configured by the
+// BackendConfigs and HealthCheckPolicies of a recipe against the Services
+// they check and the pods of these Services, as declared in the manifests:
+// the checked port must be exposed by a container, the request path must be
+// the one of the readiness probe of the container, if it has one, and the
+// timeout must not be greater than the interval of the checks.
+//
+// The Services and pods which aren't in the manifests, e.g. installed with
+// Helm, are not checked.
+package healthcheck
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/manifest"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Problem is an inconsistency of a health check.
+type Problem struct {
+	// Object is the BackendConfig or HealthCheckPolicy configuring the health
+	// check, or the Service referencing a missing BackendConfig or with a
+	// malformed backend-config annotation.
+	Object  *manifest.Object
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s", p.Object, p.Message)
+}
+
+// backendConfigFields are the fields of the health check of a BackendConfig.
+var backendConfigFields = map[string]bool{
+	"checkIntervalSec":   true,
+	"timeoutSec":         true,
+	"healthyThreshold":   true,
+	"unhealthyThreshold": true,
+	"type":               true,
+	"port":               true,
+	"requestPath":        true,
+}
+
+// policyConfigs are the fields of the config of a HealthCheckPolicy for each
+// type of health check.
+var policyConfigs = map[string]string{
+	"HTTP":  "httpHealthCheck",
+	"HTTPS": "httpsHealthCheck",
+	"HTTP2": "http2HealthCheck",
+	"GRPC":  "grpcHealthCheck",
+	"TCP":   "tcpHealthCheck",
+}
+
+// defaultCheckIntervalSec is the interval of the health checks of Compute
+// Engine when checkIntervalSec is not set.
+const defaultCheckIntervalSec = 5
+
+// healthCheck is a health check configured by a BackendConfig or a
+// HealthCheckPolicy.
+type healthCheck struct {
+	object *manifest.Object
+	// typ is HTTP, HTTPS, HTTP2, GRPC or TCP.
+	typ string
+	// port is the fixed port of the check, 0 for the serving port of the
+	// Service.
+	port        int64
+	requestPath string
+	// interval and timeout are in seconds, 0 if not set.
+	interval, timeout int64
+}
+
+// http returns true if the check sends HTTP requests to requestPath.
+func (hc *healthCheck) http() bool {
+	return hc.typ == "HTTP" || hc.typ == "HTTPS" || hc.typ == "HTTP2"
+}
+
+// Check returns the problems of the health checks configured by the
+// BackendConfigs and HealthCheckPolicies of objects, the objects of a recipe.
+func Check(objects []*manifest.Object) []Problem {
+	var problems []Problem
+	configs := make(map[string]*healthCheck)
+	services := make(map[string]*manifest.Object)
+	for _, o := range objects {
+		switch o.GetKind() {
+		case "BackendConfig":
+			hc, p := backendConfigHealthCheck(o)
+			problems = append(problems, p...)
+			// A BackendConfig without a health check is still referenced.
+			configs[key(namespaceOf(o), o.GetName())] = hc
+		case "Service", "MultiClusterService":
+			services[key(namespaceOf(o), o.GetName())] = o
+		}
+	}
+	for _, o := range objects {
+		switch o.GetKind() {
+		case "Service", "MultiClusterService":
+			annotations := o.GetAnnotations()
+			for _, annotation := range manifest.BackendConfigAnnotations {
+				refs, err := manifest.BackendConfigs(annotations[annotation])
+				if err != nil {
+					problems = append(problems, Problem{Object: o, Message: fmt.Sprintf("malformed %s annotation: %v", annotation, err)})
+					continue
+				}
+				ports := make([]string, 0, len(refs))
+				for port := range refs {
+					ports = append(ports, port)
+				}
+				sort.Strings(ports)
+				for _, port := range ports {
+					hc, ok := configs[key(namespaceOf(o), refs[port])]
+					if !ok {
+						problems = append(problems, Problem{Object: o, Message: fmt.Sprintf("BackendConfig %s of port %s is not defined", refs[port], port)})
+						continue
+					}
+					if hc != nil {
+						problems = append(problems, check(hc, o, port, objects)...)
+					}
+				}
+			}
+		case "HealthCheckPolicy":
+			hc, p := policyHealthCheck(o)
+			problems = append(problems, p...)
+			ref, _, _ := unstructured.NestedStringMap(o.Object, "spec", "targetRef")
+			if ref["kind"] != "Service" {
+				continue
+			}
+			if svc, ok := services[key(namespaceOf(o), ref["name"])]; ok {
+				problems = append(problems, check(hc, svc, "default", objects)...)
+			}
+		}
+	}
+	return problems
+}
+
+// backendConfigHealthCheck returns the health check of a BackendConfig, nil
+// if it has none, and its problems.
+func backendConfigHealthCheck(o *manifest.Object) (*healthCheck, []Problem) {
+	spec, ok, _ := unstructured.NestedMap(o.Object, "spec", "healthCheck")
+	if !ok {
+		return nil, nil
+	}
+	var problems []Problem
+	fields := make([]string, 0, len(spec))
+	for field := range spec {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		if !backendConfigFields[field] {
+			problems = append(problems, Problem{Object: o, Message: fmt.Sprintf("unknown field healthCheck.%s", field)})
+		}
+	}
+	hc := &healthCheck{
+		object:      o,
+		typ:         "HTTP",
+		port:        integer(spec["port"]),
+		requestPath: manifest.FieldString(spec["requestPath"]),
+		interval:    integer(spec["checkIntervalSec"]),
+		timeout:     integer(spec["timeoutSec"]),
+	}
+	if typ := manifest.FieldString(spec["type"]); typ != "" {
+		hc.typ = typ
+	}
+	return hc, append(problems, hc.checkTimeout()...)
+}
+
+// policyHealthCheck returns the health check of a HealthCheckPolicy and its
+// problems.
+func policyHealthCheck(o *manifest.Object) (*healthCheck, []Problem) {
+	spec, _, _ := unstructured.NestedMap(o.Object, "spec", "default")
+	config, _, _ := unstructured.NestedMap(spec, "config")
+	hc := &healthCheck{
+		object:   o,
+		typ:      manifest.FieldString(config["type"]),
+		interval: integer(spec["checkIntervalSec"]),
+		timeout:  integer(spec["timeoutSec"]),
+	}
+	problems := hc.checkTimeout()
+	if _, ok := policyConfigs[hc.typ]; !ok {
+		return hc, append(problems, Problem{Object: o, Message: fmt.Sprintf("unknown config.type %q", hc.typ)})
+	}
+	var fields []string
+	for field := range config {
+		if field != "type" {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		if field != policyConfigs[hc.typ] {
+			problems = append(problems, Problem{Object: o, Message: fmt.Sprintf("config.%s is set for a health check of type %q, want config.%s", field, hc.typ, policyConfigs[hc.typ])})
+		}
+	}
+	typeConfig, _, _ := unstructured.NestedMap(config, policyConfigs[hc.typ])
+	hc.requestPath = manifest.FieldString(typeConfig["requestPath"])
+	switch spec := manifest.FieldString(typeConfig["portSpecification"]); spec {
+	case "USE_FIXED_PORT":
+		if hc.port = integer(typeConfig["port"]); hc.port == 0 {
+			problems = append(problems, Problem{Object: o, Message: "portSpecification USE_FIXED_PORT without a port"})
+		}
+	case "":
+		// The port implies a fixed port.
+		hc.port = integer(typeConfig["port"])
+	}
+	return hc, problems
+}
+
+func (hc *healthCheck) checkTimeout() []Problem {
+	interval := hc.interval
+	if interval == 0 {
+		interval = defaultCheckIntervalSec
+	}
+	if hc.timeout > interval {
+		return []Problem{{Object: hc.object, Message: fmt.Sprintf("timeoutSec %d is greater than checkIntervalSec %d", hc.timeout, interval)}}
+	}
+	return nil
+}
+
+// check returns the problems of hc with the pods of svc, the ones of the
+// workloads of objects it selects, for its port named or numbered port, or
+// all its ports for "default".
+func check(hc *healthCheck, svc *manifest.Object, port string, objects []*manifest.Object) []Problem {
+	spec, _, _ := unstructured.NestedMap(svc.Object, "spec")
+	if svc.GetKind() == "MultiClusterService" {
+		spec, _, _ = unstructured.NestedMap(svc.Object, "spec", "template", "spec")
+	}
+	selector, _, _ := unstructured.NestedStringMap(spec, "selector")
+	if len(selector) == 0 {
+		return nil
+	}
+	// The target ports of the checked ports of the Service, for the
+	// serving port.
+	var targetPorts []interface{}
+	servicePorts, _, _ := unstructured.NestedSlice(spec, "ports")
+	for _, p := range servicePorts {
+		p, ok := p.(map[string]interface{})
+		if !ok || (port != "default" && port != manifest.FieldString(p["name"]) && port != manifest.FieldString(p["port"])) {
+			continue
+		}
+		target := p["targetPort"]
+		if target == nil {
+			target = p["port"]
+		}
+		targetPorts = append(targetPorts, target)
+	}
+
+	var problems []Problem
+	for _, w := range objects {
+		pod, ok := podSpec(w)
+		if !ok || namespaceOf(w) != namespaceOf(svc) || !manifest.MatchLabels(podLabels(w), selector) {
+			continue
+		}
+		containers, _, _ := unstructured.NestedSlice(pod, "containers")
+		if injected(containers) {
+			continue
+		}
+		checked := targetPorts
+		if hc.port != 0 {
+			checked = []interface{}{hc.port}
+		}
+		for _, target := range checked {
+			found := false
+			for _, c := range containers {
+				c, ok := c.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				containerPort := resolvePort(c, target)
+				if containerPort == 0 {
+					continue
+				}
+				found = true
+				if !hc.http() {
+					continue
+				}
+				probe, ok, _ := unstructured.NestedMap(c, "readinessProbe", "httpGet")
+				if !ok || resolvePort(c, probe["port"]) != containerPort {
+					continue
+				}
+				if path, want := orRoot(manifest.FieldString(probe["path"])), orRoot(hc.requestPath); path != want {
+					problems = append(problems, Problem{Object: hc.object, Message: fmt.Sprintf("requestPath %s of the check of Service %s is not the path %s of the readiness probe of container %s of %s %s", want, svc.GetName(), path, manifest.FieldString(c["name"]), w.GetKind(), w.GetName())})
+				}
+			}
+			if !found {
+				checkedPort := fmt.Sprintf("port %d of the check", hc.port)
+				if hc.port == 0 {
+					checkedPort = fmt.Sprintf("targetPort %s of the serving port", manifest.FieldString(target))
+				}
+				problems = append(problems, Problem{Object: hc.object, Message: fmt.Sprintf("%s of Service %s is not exposed by any container of %s %s", checkedPort, svc.GetName(), w.GetKind(), w.GetName())})
+			}
+		}
+	}
+	return problems
+}
+
+// podSpec returns the spec of the pods of a Pod or of a workload.
+func podSpec(o *manifest.Object) (map[string]interface{}, bool) {
+	switch o.GetKind() {
+	case "Pod":
+		spec, ok, _ := unstructured.NestedMap(o.Object, "spec")
+		return spec, ok
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet":
+		spec, ok, _ := unstructured.NestedMap(o.Object, "spec", "template", "spec")
+		return spec, ok
+	}
+	return nil, false
+}
+
+// injected returns true if containers has a container with the image "auto",
+// whose ports and probes are set by the injector of the service mesh, e.g.
+// the gateway template of Anthos Service Mesh.
+func injected(containers []interface{}) bool {
+	for _, c := range containers {
+		if c, ok := c.(map[string]interface{}); ok && manifest.FieldString(c["image"]) == "auto" {
+			return true
+		}
+	}
+	return false
+}
+
+// podLabels returns the labels of the pods of a Pod or of a workload.
+func podLabels(o *manifest.Object) map[string]string {
+	if o.GetKind() == "Pod" {
+		return o.GetLabels()
+	}
+	labels, _, _ := unstructured.NestedStringMap(o.Object, "spec", "template", "metadata", "labels")
+	return labels
+}
+
+// resolvePort returns the number of the port of container c, given by number
+// or by name, or 0 if c doesn't expose it.
+func resolvePort(c map[string]interface{}, port interface{}) int64 {
+	ports, _, _ := unstructured.NestedSlice(c, "ports")
+	for _, p := range ports {
+		p, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		number := integer(p["containerPort"])
+		switch port := port.(type) {
+		case int64:
+			if number == port {
+				return number
+			}
+		case string:
+			if n, err := strconv.ParseInt(port, 10, 64); (err == nil && n == number) || port == manifest.FieldString(p["name"]) {
+				return number
+			}
+		}
+	}
+	return 0
+}
+
+// namespaceOf returns the namespace of an object, the objects without one
+// being applied to the same namespace.
+func namespaceOf(o *manifest.Object) string {
+	if ns := o.GetNamespace(); ns != "" {
+		return ns
+	}
+	return "default"
+}
+
+func key(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// integer returns an integer value, or a string holding one, 0 for anything
+// else.
+func integer(v interface{}) int64 {
+	switch v := v.(type) {
+	case int64:
+		return v
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return 0
+}
+
+func orRoot(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
@@ -0,0 +1,351 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthcheck
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/manifest"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe/recipetest"
+)
+
+// repoRoot is the root of the repository, relative to this package.
+const repoRoot = "../.."
+
+// workload is the Service and Deployment checked by the health checks of the
+// test cases, with an HTTP readiness probe on /ready of port http, 8080.
+const workload = `
+apiVersion: v1
+kind: Service
+metadata:
+  name: foo
+  annotations:
+    cloud.google.com/backend-config: '{"ports": {"http": "foo"}}'
+spec:
+  selector:
+    app: foo
+  ports:
+  - name: http
+    port: 80
+    targetPort: http
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: foo
+spec:
+  template:
+    metadata:
+      labels:
+        app: foo
+    spec:
+      containers:
+      - name: app
+        ports:
+        - name: http
+          containerPort: 8080
+        readinessProbe:
+          httpGet:
+            path: /ready
+            port: http
+      - name: metrics
+        ports:
+        - containerPort: 9090
+---
+`
+
+func TestCheck(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		config   string
+		problems []string
+	}{
+		{
+			desc: "consistent backend config",
+			config: `
+apiVersion: cloud.google.com/v1
+kind: BackendConfig
+metadata:
+  name: foo
+spec:
+  healthCheck:
+    checkIntervalSec: 10
+    timeoutSec: 5
+    type: HTTP
+    requestPath: /ready
+    port: 8080
+`,
+		},
+		{
+			desc: "backend config on the serving port",
+			config: `
+apiVersion: cloud.google.com/v1
+kind: BackendConfig
+metadata:
+  name: foo
+spec:
+  healthCheck:
+    requestPath: /healthz
+`,
+			problems: []string{"BackendConfig foo (test.yaml:40): requestPath /healthz of the check of Service foo is not the path /ready of the readiness probe of container app of Deployment foo"},
+		},
+		{
+			desc: "backend config on a port without readiness probe",
+			config: `
+apiVersion: cloud.google.com/v1
+kind: BackendConfig
+metadata:
+  name: foo
+spec:
+  healthCheck:
+    requestPath: /metrics
+    port: 9090
+`,
+		},
+		{
+			desc: "inconsistent backend config",
+			config: `
+apiVersion: cloud.google.com/v1
+kind: BackendConfig
+metadata:
+  name: foo
+spec:
+  healthCheck:
+    checkIntervalSec: 5
+    timeoutSec: 10
+    protocol: HTTP
+    port: 8081
+`,
+			problems: []string{
+				"BackendConfig foo (test.yaml:40): unknown field healthCheck.protocol",
+				"BackendConfig foo (test.yaml:40): timeoutSec 10 is greater than checkIntervalSec 5",
+				"BackendConfig foo (test.yaml:40): port 8081 of the check of Service foo is not exposed by any container of Deployment foo",
+			},
+		},
+		{
+			desc: "timeout greater than the default interval",
+			config: `
+apiVersion: cloud.google.com/v1
+kind: BackendConfig
+metadata:
+  name: foo
+spec:
+  healthCheck:
+    timeoutSec: 10
+    requestPath: /ready
+`,
+			problems: []string{"BackendConfig foo (test.yaml:40): timeoutSec 10 is greater than checkIntervalSec 5"},
+		},
+		{
+			desc: "serving ports not exposed",
+			config: `
+apiVersion: cloud.google.com/v1
+kind: BackendConfig
+metadata:
+  name: foo
+spec:
+  healthCheck:
+    type: TCP
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: bar
+  annotations:
+    cloud.google.com/backend-config: '{"default": "foo"}'
+spec:
+  selector:
+    app: foo
+  ports:
+  - name: grpc
+    port: 9000
+    targetPort: grpc
+  - name: admin
+    port: 8081
+`,
+			problems: []string{
+				"BackendConfig foo (test.yaml:40): targetPort grpc of the serving port of Service bar is not exposed by any container of Deployment foo",
+				"BackendConfig foo (test.yaml:40): targetPort 8081 of the serving port of Service bar is not exposed by any container of Deployment foo",
+			},
+		},
+		{
+			desc: "missing backend config",
+			config: `
+apiVersion: cloud.google.com/v1
+kind: BackendConfig
+metadata:
+  name: bar
+`,
+			problems: []string{"Service foo (test.yaml:2): BackendConfig foo of port http is not defined"},
+		},
+		{
+			desc: "malformed backend config annotation",
+			config: `
+apiVersion: cloud.google.com/v1
+kind: BackendConfig
+metadata:
+  name: foo
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: bar
+  annotations:
+    cloud.google.com/backend-config: '{"ports": {"http": "foo"}'
+`,
+			problems: []string{"Service bar (test.yaml:45): malformed cloud.google.com/backend-config annotation: unexpected end of JSON input"},
+		},
+		{
+			desc: "consistent policy",
+			config: `
+apiVersion: networking.gke.io/v1
+kind: HealthCheckPolicy
+metadata:
+  name: foo
+spec:
+  default:
+    checkIntervalSec: 5
+    timeoutSec: 5
+    config:
+      type: HTTP
+      httpHealthCheck:
+        portSpecification: USE_FIXED_PORT
+        port: 8080
+        requestPath: /ready
+  targetRef:
+    group: ""
+    kind: Service
+    name: foo
+---
+apiVersion: cloud.google.com/v1
+kind: BackendConfig
+metadata:
+  name: foo
+`,
+		},
+		{
+			desc: "gRPC policy",
+			config: `
+apiVersion: networking.gke.io/v1
+kind: HealthCheckPolicy
+metadata:
+  name: foo
+spec:
+  default:
+    config:
+      type: GRPC
+      grpcHealthCheck:
+        portSpecification: USE_FIXED_PORT
+        port: 9090
+  targetRef:
+    group: ""
+    kind: Service
+    name: foo
+---
+apiVersion: cloud.google.com/v1
+kind: BackendConfig
+metadata:
+  name: foo
+`,
+		},
+		{
+			desc: "inconsistent policy",
+			config: `
+apiVersion: networking.gke.io/v1
+kind: HealthCheckPolicy
+metadata:
+  name: foo
+spec:
+  default:
+    checkIntervalSec: 2
+    timeoutSec: 3
+    config:
+      type: GRPC
+      httpHealthCheck:
+        requestPath: /
+      grpcHealthCheck:
+        portSpecification: USE_FIXED_PORT
+        port: 9003
+  targetRef:
+    group: ""
+    kind: Service
+    name: foo
+---
+apiVersion: cloud.google.com/v1
+kind: BackendConfig
+metadata:
+  name: foo
+`,
+			problems: []string{
+				"HealthCheckPolicy foo (test.yaml:40): timeoutSec 3 is greater than checkIntervalSec 2",
+				`HealthCheckPolicy foo (test.yaml:40): config.httpHealthCheck is set for a health check of type "GRPC", want config.grpcHealthCheck`,
+				"HealthCheckPolicy foo (test.yaml:40): port 9003 of the check of Service foo is not exposed by any container of Deployment foo",
+			},
+		},
+		{
+			desc: "policy of a Service outside the manifests",
+			config: `
+apiVersion: networking.gke.io/v1
+kind: HealthCheckPolicy
+metadata:
+  name: bar
+spec:
+  default:
+    config:
+      type: GRPC
+      grpcHealthCheck:
+        portSpecification: USE_FIXED_PORT
+        port: 9003
+  targetRef:
+    group: ""
+    kind: Service
+    name: bar
+---
+apiVersion: cloud.google.com/v1
+kind: BackendConfig
+metadata:
+  name: foo
+`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			objects, err := manifest.Parse("test.yaml", []byte(workload+tc.config))
+			if err != nil {
+				t.Fatalf("Parse() = %v, want nil", err)
+			}
+			var problems []string
+			for _, p := range Check(objects) {
+				problems = append(problems, p.String())
+			}
+			if !reflect.DeepEqual(problems, tc.problems) {
+				t.Errorf("Check() = %q, want %q", problems, tc.problems)
+			}
+		})
+	}
+}
+
+func TestRecipes(t *testing.T) {
+	recipetest.ForEach(t, repoRoot, func(t *testing.T, r *recipe.Recipe) {
+		objects, _, err := r.Objects()
+		if err != nil {
+			t.Fatalf("Objects(%s) = %v, want nil", r.Path, err)
+		}
+		for _, p := range Check(objects) {
+			t.Error(p)
+		}
+	})
+}
@@ -14,9 +14,12 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 
+source ./test/helpers/gateway.sh
 source ./test/helpers/hash.sh
 source ./test/helpers/ingress.sh
 source ./test/helpers/managed_cert.sh
+source ./test/helpers/naming.sh
 source ./test/helpers/oAuth.sh
+source ./test/helpers/service.sh
 source ./test/helpers/setup.sh
 source ./test/helpers/validation.sh
@@ -0,0 +1,45 @@
+#!/bin/bash
+
+# Copyright 2023 Google LLC
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# Wait for the given gateway to be assigned an address.
+# Argument:
+#   Name of the gateway.
+#   Namespace of the gateway.
+#   The context where the resource resides.
+# Outputs:
+#   Writes the gateway IP to stdout.
+# Returns:
+#   0 if the gateway address is populated within 15 minutes, 1 if not.
+wait_for_gateway_ip() {
+    local gw ns context attempt
+    gw="$1"
+    ns="$2"
+    context="$3"
+
+    # 180*5s=15min
+    for attempt in $(seq 180); do
+        local vip
+        vip=$(kubectl --context "${context}" get gateway ${gw} \
+              -n ${ns} \
+              -o jsonpath="{.status.addresses[0].value}")
+        if [[ ! -z "$vip" ]]; then
+            echo "${vip}"
+            return 0
+        fi
+        sleep 5
+    done
+    return 1
+}
@@ -245,3 +245,33 @@ wait_for_ingress_ip() {
     done
     return 1
 }
+
+# Wait for the given multi-cluster ingress to be fully provisioned.
+# Argument:
+#   Name of the multi-cluster ingress.
+#   Namespace of the multi-cluster ingress.
+#   The context of the config cluster, where the resource resides.
+# Outputs:
+#   Writes the multi-cluster ingress VIP to stdout.
+# Returns:
+#   0 if the VIP is populated within 15 minutes, 1 if not.
+wait_for_multi_cluster_ingress_ip() {
+    local mci ns context attempt
+    mci="$1"
+    ns="$2"
+    context="$3"
+
+    # 180*5s=15min
+    for attempt in $(seq 180); do
+        local vip
+        vip=$(kubectl --context "${context}" get multiclusteringress ${mci} \
+              -n ${ns} \
+              -o jsonpath="{.status.VIP}")
+        if [[ ! -z "$vip" ]]; then
+            echo "${vip}"
+            return 0
+        fi
+        sleep 5
+    done
+    return 1
+}
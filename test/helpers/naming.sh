@@ -0,0 +1,124 @@
+#!/bin/bash
+
+# Copyright 2023 Google LLC
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+source ./test/helpers/hash.sh
+
+# Get the suffix identifying the resources of a test.
+# When run by the test framework, RESOURCE_SUFFIX is unique for each recipe in
+# each test run, so that runs sharing a project never collide. Otherwise the
+# suffix is derived from the test name.
+# Arguments:
+#   Name of the test.
+# Outputs:
+#   Writes the suffix to stdout.
+get_resource_suffix() {
+    local test_name
+    test_name="$1"
+    if [[ -n "${RESOURCE_SUFFIX-}" ]]; then
+        echo "${RESOURCE_SUFFIX}"
+        return
+    fi
+    get_hash "${test_name}"
+}
+
+# Turn a string into a name component, as done by test/naming: lower case
+# letters, digits and dashes, without dashes at both ends.
+# Arguments:
+#   The string.
+# Outputs:
+#   Writes the component to stdout.
+sanitize_name() {
+    printf '%s' "$1" | tr '[:upper:]' '[:lower:]' | sed -e 's/[^a-z0-9]\{1,\}/-/g' -e 's/^-//' -e 's/-$//'
+}
+
+# Get a valid label value from a string, as done by LabelValue of test/naming:
+# the sanitized string, of at most 63 characters.
+# Arguments:
+#   The string.
+# Outputs:
+#   Writes the label value to stdout.
+get_label_value() {
+    local value
+    value=$(sanitize_name "$1")
+    printf '%s' "${value:0:63}" | sed -e 's/-*$//'
+    echo
+}
+
+# Get the name of a resource of a test. The name starts with gke-net-recipes-
+# so that the sweeper can find it. It is the name generated by test/naming:
+# the component is sanitized, and names longer than 63 characters end with a
+# hash of the full name instead.
+# Arguments:
+#   Name of the test.
+#   (Optional)Component distinguishing the resource from the network, subnet,
+#             instance and cluster of the test, e.g. "ip".
+# Outputs:
+#   Writes the name to stdout.
+get_resource_name() {
+    local test_name component name h
+    test_name="$1"
+    component=$(sanitize_name "${2:-}")
+    name="gke-net-recipes-$(get_resource_suffix "${test_name}")"
+    if [[ -n "${component}" ]]; then
+        name="${name}-${component}"
+    fi
+    if (( ${#name} > 63 )); then
+        h=($(printf '%s' "${name}" | sha1sum))
+        name="$(printf '%s' "${name:0:54}" | sed -e 's/-*$//')-${h:0:8}"
+    fi
+    echo "${name}"
+}
+
+# Get the labels to attach to the resources of a test, in the key=value,...
+# format of the --labels flag of gcloud and kubectl label.
+# When run by the test framework, RESOURCE_LABELS also holds the run ID, the
+# owner and the expiration time of the resources.
+# Arguments:
+#   Name of the test.
+# Outputs:
+#   Writes the labels to stdout.
+get_resource_labels() {
+    local test_name
+    test_name="$1"
+    echo "${RESOURCE_LABELS:-recipe=$(get_label_value "${test_name}")}"
+}
+
+# Create the namespace of a test, with the labels of the test.
+# Arguments:
+#   The kubectl context of the test cluster.
+#   Name of the test, used as the namespace name.
+create_namespace() {
+    local context test_name
+    context="$1"
+    test_name="$2"
+    kubectl --context "${context}" create namespace "${test_name}"
+    kubectl --context "${context}" label namespace "${test_name}" \
+        $(get_resource_labels "${test_name}" | tr ',' ' ') --overwrite
+}
+
+# Label the Deployments, Services and Ingresses of a test, in its namespace,
+# with the labels of the test. Call it once the manifests of the test are
+# applied.
+# Arguments:
+#   The kubectl context of the test cluster.
+#   Name of the test, the namespace of the resources.
+label_resources() {
+    local context test_name
+    context="$1"
+    test_name="$2"
+    kubectl --context "${context}" label deployments,services,ingresses --all -n "${test_name}" \
+        $(get_resource_labels "${test_name}" | tr ',' ' ') --overwrite
+}
@@ -0,0 +1,45 @@
+#!/bin/bash
+
+# Copyright 2023 Google LLC
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# Wait for the given LoadBalancer service to be assigned an IP.
+# Argument:
+#   Name of the service.
+#   Namespace of the service.
+#   The context where the resource resides.
+# Outputs:
+#   Writes the service IP to stdout.
+# Returns:
+#   0 if the service IP is populated within 15 minutes, 1 if not.
+wait_for_service_ip() {
+    local svc ns context attempt
+    svc="$1"
+    ns="$2"
+    context="$3"
+
+    # 180*5s=15min
+    for attempt in $(seq 180); do
+        local vip
+        vip=$(kubectl --context "${context}" get service ${svc} \
+              -n ${ns} \
+              -o jsonpath="{.status.loadBalancer.ingress[0].ip}")
+        if [[ ! -z "$vip" ]]; then
+            echo "${vip}"
+            return 0
+        fi
+        sleep 5
+    done
+    return 1
+}
@@ -14,12 +14,13 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 
-source ./test/helpers/hash.sh
+source ./test/helpers/naming.sh
 
 # Basic setup that works for most recipe tests.
 # Create a network, and a subnet in the provided region.
 # Create an instance and a cluster in the given zone with the network and 
-# subnet created.
+# subnet created. The instance and the cluster are labeled with the labels of
+# the test.
 # Arguments:
 #   Name of the test. Used to generate suffix for resources.
 #   Zone of the cluster and vm instance.
@@ -29,9 +30,11 @@ setup_gke_basic() {
     test_name="$1"
     zone="$2"
     subnet_region="$3"
-    resource_suffix=$(get_hash "${test_name}")
+    resource_suffix=$(get_resource_suffix "${test_name}")
 
-    local resource_name="gke-net-recipes-${resource_suffix}"
+    local resource_name labels
+    resource_name=$(get_resource_name "${test_name}")
+    labels=$(get_resource_labels "${test_name}")
     local network="${resource_name}"
     local subnet="${resource_name}"
     local instance="${resource_name}"
@@ -48,11 +51,13 @@ setup_gke_basic() {
         --subnet="${subnet}" \
         --image-family="debian-11" \
         --image-project="debian-cloud" \
-        --tags="allow-ssh"
+        --tags="allow-ssh" \
+        --labels="${labels}"
     gcloud container clusters create "${cluster}" \
         --zone="${zone}" \
         --network="${network}" \
-        --subnetwork="${subnet}"
+        --subnetwork="${subnet}" \
+        --labels="${labels}"
     gcloud container clusters get-credentials "${cluster}" --zone="${zone}"
 }
 
@@ -67,9 +72,10 @@ cleanup_gke_basic() {
     test_name="$1"
     zone="$2"
     subnet_region="$3"
-    resource_suffix=$(get_hash "${test_name}")
-    
-    local resource_name="gke-net-recipes-${resource_suffix}"
+    resource_suffix=$(get_resource_suffix "${test_name}")
+
+    local resource_name
+    resource_name=$(get_resource_name "${test_name}")
     local network="${resource_name}"
     local subnet="${resource_name}"
     local instance="${resource_name}"
@@ -107,9 +113,10 @@ setup_ilb() {
     local test_name subnet_region resource_suffix
     test_name="$1"
     subnet_region="$2"
-    resource_suffix=$(get_hash "${test_name}")
+    resource_suffix=$(get_resource_suffix "${test_name}")
 
-    local network="gke-net-recipes-${resource_suffix}"
+    local network
+    network=$(get_resource_name "${test_name}")
     local proxy_only_subnet="proxy-only-${resource_suffix}"
     local allow_proxy_firewall="allow-proxy-${resource_suffix}"
     local proxy_only_subnet_range="10.129.0.0/23"
@@ -127,16 +134,17 @@ setup_ilb() {
 }
 
 # Get the kubectl context for a test based on the test name.
-# A kubectl context contains the cluster's name.
+# A kubectl context contains the cluster's name. The context is looked up in
+# the kubeconfig in KUBECONFIG, which the test framework sets to a file
+# dedicated to each recipe.
 # Arguments:
 #   Name of the test, used to genereate the cluster name.
 # Output:
 #   The context used in the given test.
 get_context() {
-    local test_name suffix cluster_name
+    local test_name cluster_name
     test_name="$1"
-    suffix=$(get_hash "${test_name}")
-    cluster_name="gke-net-recipes-${suffix}"
+    cluster_name=$(get_resource_name "${test_name}")
     context=$(kubectl config view -o json | jq -r ".contexts[] | select(.name | test(\"${cluster_name}\")).name" || true)
     echo "${context}"
 }
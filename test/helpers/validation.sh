@@ -14,7 +14,7 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 
-source ./test/helpers/hash.sh
+source ./test/helpers/naming.sh
 
 # Check that the given IP responds the expected HTTP status code.
 # Arguments:
@@ -43,8 +43,9 @@ check_http_status() {
         eval_cmd="curl -sI -o /dev/null -w \"%{http_code}\" -H \"${extra_header}\" ${url}"
     else
         local resource_suffix
-        resource_suffix=$(get_hash "${test_name}")
-        local resource_name="gke-net-recipes-${resource_suffix}"
+        resource_suffix=$(get_resource_suffix "${test_name}")
+        local resource_name
+        resource_name=$(get_resource_name "${test_name}")
         local network="${resource_name}"
         local instance="${resource_name}"
 
@@ -78,3 +79,36 @@ check_http_status() {
     done
     return 1
 }
+
+# Check the HTTP status code of a request sent from a pod of a cluster, to
+# reach internal load balancers from the network of the cluster.
+# Arguments:
+#   The context of the cluster to send the request from.
+#   Namespace of the pod sending the request.
+#   The URL for making HTTP request to.
+#   The expected HTTP status code in the reponse.
+#   (Optional)An extra header to include in the request.
+# Returns:
+#   0 if the recieved HTTP response code matches the expected one within 15 minutes, 1 if not.
+check_http_status_in_cluster() {
+    local context ns url expect_code extra_header
+    context="$1"
+    ns="$2"
+    url="$3"
+    expect_code="$4"
+    extra_header="${5:-}"
+
+    # 180*5s=15min
+    local attempt
+    for attempt in $(seq 180); do
+        local got_code
+        got_code=$(kubectl --context "${context}" run "curl-${attempt}" -n "${ns}" \
+                   --image=curlimages/curl --restart=Never --rm -i --quiet -- \
+                   curl -sI -o /dev/null -w "%{http_code}" -H "${extra_header}" "${url}" || true)
+        if [[ "${got_code}" == "${expect_code}" ]]; then
+            return 0
+        fi
+        sleep 5
+    done
+    return 1
+}
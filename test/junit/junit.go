@@ -0,0 +1,184 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package junit records the results of the recipe tests in the JUnit XML
+// format Prow and Testgrid read from the artifacts of a job, with the reason
+// recipes are skipped or fail.
+package junit
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ArtifactsFile returns the path of the JUnit file of the suite name in the
+// ARTIFACTS directory of the Prow job, or "" if ARTIFACTS is not set.
+func ArtifactsFile(name string) string {
+	dir := os.Getenv("ARTIFACTS")
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "junit_"+name+".xml")
+}
+
+// TestSuites is the root element of a JUnit file.
+type TestSuites struct {
+	XMLName xml.Name    `xml:"testsuites"`
+	Suites  []TestSuite `xml:"testsuite"`
+}
+
+// TestSuite is a suite of test cases.
+type TestSuite struct {
+	Name     string     `xml:"name,attr"`
+	Tests    int        `xml:"tests,attr"`
+	Failures int        `xml:"failures,attr"`
+	Skipped  int        `xml:"skipped,attr"`
+	Time     float64    `xml:"time,attr"`
+	Cases    []TestCase `xml:"testcase"`
+}
+
+// TestCase is the result of a test. It passed if it has neither a Failure
+// nor a Skipped element.
+type TestCase struct {
+	Name      string   `xml:"name,attr"`
+	Classname string   `xml:"classname,attr"`
+	Time      float64  `xml:"time,attr"`
+	Failure   *Message `xml:"failure,omitempty"`
+	Skipped   *Message `xml:"skipped,omitempty"`
+}
+
+// Message explains why a test failed or was skipped.
+type Message struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// Suite collects the results of the tests of a suite. It is safe for
+// concurrent use by parallel tests.
+type Suite struct {
+	name      string
+	classname string
+	mu        sync.Mutex
+	cases     []TestCase
+}
+
+// NewSuite returns an empty suite, whose test cases have classname, e.g. the
+// name of the top level Go test.
+func NewSuite(name, classname string) *Suite {
+	return &Suite{name: name, classname: classname}
+}
+
+// Result records the result of a test in a Suite. Its failure or skip message
+// is the one given to Fatalf or Skipf, or a generic one if the test failed or
+// was skipped through its testing.TB.
+type Result struct {
+	t       testing.TB
+	message string
+}
+
+// Start starts recording the result of the test t as the test case name. It
+// is added to the suite when t and its cleanups complete.
+func (s *Suite) Start(t testing.TB, name string) *Result {
+	r := &Result{t: t}
+	start := time.Now()
+	t.Cleanup(func() {
+		c := TestCase{Name: name, Classname: s.classname, Time: time.Since(start).Seconds()}
+		switch {
+		case t.Failed():
+			c.Failure = &Message{Message: r.messageOr("test failed, see its output")}
+		case t.Skipped():
+			c.Skipped = &Message{Message: r.messageOr("test skipped")}
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.cases = append(s.cases, c)
+	})
+	return r
+}
+
+func (r *Result) messageOr(def string) string {
+	if r.message == "" {
+		return def
+	}
+	return r.message
+}
+
+// Skipf skips the test with the message recorded in the suite.
+func (r *Result) Skipf(format string, args ...interface{}) {
+	r.t.Helper()
+	r.message = fmt.Sprintf(format, args...)
+	r.t.Skip(r.message)
+}
+
+// Fatalf fails the test with the message recorded in the suite.
+func (r *Result) Fatalf(format string, args ...interface{}) {
+	r.t.Helper()
+	r.message = fmt.Sprintf(format, args...)
+	r.t.Fatal(r.message)
+}
+
+// TestSuites returns the results recorded so far, sorted by test case name.
+func (s *Suite) TestSuites() TestSuites {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	suite := TestSuite{Name: s.name, Tests: len(s.cases), Cases: append([]TestCase(nil), s.cases...)}
+	sort.Slice(suite.Cases, func(i, j int) bool { return suite.Cases[i].Name < suite.Cases[j].Name })
+	for _, c := range suite.Cases {
+		suite.Time += c.Time
+		if c.Failure != nil {
+			suite.Failures++
+		}
+		if c.Skipped != nil {
+			suite.Skipped++
+		}
+	}
+	return TestSuites{Suites: []TestSuite{suite}}
+}
+
+// Write writes the results recorded so far as a JUnit XML document.
+func (s *Suite) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(s.TestSuites()); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteFile writes the results recorded so far to the JUnit file at path.
+func (s *Suite) WriteFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := s.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package junit
+
+import (
+	"bytes"
+	"encoding/xml"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeT is a testing.TB recording whether the test failed or was skipped,
+// whose cleanups are run by done.
+type fakeT struct {
+	testing.TB
+	failed, skipped bool
+	cleanups        []func()
+}
+
+func (f *fakeT) Helper()                       {}
+func (f *fakeT) Cleanup(fn func())             { f.cleanups = append(f.cleanups, fn) }
+func (f *fakeT) Failed() bool                  { return f.failed }
+func (f *fakeT) Skipped() bool                 { return f.skipped }
+func (f *fakeT) Errorf(string, ...interface{}) { f.failed = true }
+func (f *fakeT) Fatal(...interface{})          { f.failed = true }
+func (f *fakeT) Skip(...interface{})           { f.skipped = true }
+
+func (f *fakeT) done() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
+
+func TestSuiteResults(t *testing.T) {
+	s := NewSuite("recipes", "TestRecipe")
+
+	skipped := &fakeT{}
+	s.Start(skipped, "ingress/single-cluster/ingress-iap").Skipf("missing required environment variables: %s", "DNS_ZONE, SUPPORT_EMAIL")
+	skipped.done()
+	failed := &fakeT{}
+	s.Start(failed, "ingress/single-cluster/ingress-https").Fatalf("setup.sh failed")
+	failed.done()
+	failedThroughT := &fakeT{}
+	s.Start(failedThroughT, "gateway/single-cluster/regional-l7-ilb")
+	failedThroughT.Errorf("failed")
+	failedThroughT.done()
+	passed := &fakeT{}
+	s.Start(passed, "authz/authz-cr-validation")
+	passed.done()
+
+	suites := s.TestSuites()
+	if len(suites.Suites) != 1 {
+		t.Fatalf("TestSuites() = %+v, want one suite", suites)
+	}
+	suite := suites.Suites[0]
+	if suite.Name != "recipes" || suite.Tests != 4 || suite.Failures != 2 || suite.Skipped != 1 {
+		t.Errorf("TestSuites() = %+v, want 4 tests, 2 failures and 1 skipped", suite)
+	}
+	var results []string
+	for _, c := range suite.Cases {
+		result := c.Classname + " " + c.Name
+		if c.Failure != nil {
+			result += " failed: " + c.Failure.Message
+		}
+		if c.Skipped != nil {
+			result += " skipped: " + c.Skipped.Message
+		}
+		results = append(results, result)
+	}
+	want := []string{
+		"TestRecipe authz/authz-cr-validation",
+		"TestRecipe gateway/single-cluster/regional-l7-ilb failed: test failed, see its output",
+		"TestRecipe ingress/single-cluster/ingress-https failed: setup.sh failed",
+		"TestRecipe ingress/single-cluster/ingress-iap skipped: missing required environment variables: DNS_ZONE, SUPPORT_EMAIL",
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("TestSuites() = %q, want %q", results, want)
+	}
+
+	var b bytes.Buffer
+	if err := s.Write(&b); err != nil {
+		t.Fatalf("Write() = %v, want nil", err)
+	}
+	for _, want := range []string{
+		`<testsuite name="recipes" tests="4" failures="2" skipped="1"`,
+		`<skipped message="missing required environment variables: DNS_ZONE, SUPPORT_EMAIL"></skipped>`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("Write() = %s, want it to contain %s", b.String(), want)
+		}
+	}
+	var parsed TestSuites
+	if err := xml.Unmarshal(b.Bytes(), &parsed); err != nil || len(parsed.Suites[0].Cases) != 4 {
+		t.Errorf("xml.Unmarshal(Write()) = %+v, %v, want the 4 test cases", parsed, err)
+	}
+}
+
+func TestArtifactsFile(t *testing.T) {
+	t.Setenv("ARTIFACTS", "")
+	if got := ArtifactsFile("recipes"); got != "" {
+		t.Errorf("ArtifactsFile() = %q without ARTIFACTS, want \"\"", got)
+	}
+	dir := t.TempDir()
+	t.Setenv("ARTIFACTS", dir)
+	path := ArtifactsFile("recipes")
+	if want := filepath.Join(dir, "junit_recipes.xml"); path != want {
+		t.Errorf("ArtifactsFile() = %q, want %q", path, want)
+	}
+	if err := NewSuite("recipes", "TestRecipe").WriteFile(path); err != nil {
+		t.Errorf("WriteFile(%q) = %v, want nil", path, err)
+	}
+}
@@ -15,72 +15,162 @@
 package test
 
 import (
+	"context"
 	"flag"
 	"os"
-	"os/exec"
-	"strings"
 	"testing"
+	"time"
 
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/junit"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/naming"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/sweeper"
 	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/utils"
 	"k8s.io/klog/v2"
 )
 
 var (
+	// testEnv is the environment the test scripts run in.
+	testEnv *utils.Env
+	// runOwner and runExpiresAt are recorded in the labels of the resources
+	// created by the test scripts.
+	runOwner     string
+	runExpiresAt time.Time
+	// results are the results of the recipe tests, written to the JUnit
+	// file --junit.
+	results = junit.NewSuite("recipes", "TestRecipe")
+
 	flags struct {
 		boskosResourceType string
+		boskosLeases       string
+		boskosURL          string
+		boskosOwner        string
 		inProw             bool
+		runID              string
+		resourceTTL        time.Duration
+		skipPreflight      bool
+		requireAll         bool
+		junit              string
 	}
 )
 
 func init() {
 	flag.StringVar(&flags.boskosResourceType, "boskos-resource-type", "gke-internal-project", "name of the boskos resource type to reserve")
+	flag.StringVar(&flags.boskosLeases, "boskos-leases", "", "comma separated list of additional name=resourceType boskos leases, e.g. dns=gke-dns-project. The project of each lease is exposed as <NAME>_PROJECT")
+	flag.StringVar(&flags.boskosURL, "boskos-url", "http://boskos", "URL of the boskos server to lease projects from")
+	flag.StringVar(&flags.boskosOwner, "boskos-owner", "", "owner of the boskos leases, defaults to JOB_NAME")
 	flag.BoolVar(&flags.inProw, "run-in-prow", false, "is the test running in PROW")
+	flag.StringVar(&flags.runID, "run-id", "", "ID of the test run, used to name and label the resources created by the tests. Defaults to BUILD_ID, or a random ID")
+	flag.DurationVar(&flags.resourceTTL, "resource-ttl", 6*time.Hour, "how long the resources created by the tests are needed, recorded in their expires-at label")
+	flag.BoolVar(&flags.requireAll, "require-all", false, "fail the tests of the recipes whose required environment variables are not set, instead of skipping them, e.g. for release qualification runs")
+	flag.StringVar(&flags.junit, "junit", junit.ArtifactsFile("recipes"), "path of the JUnit file the results of the recipe tests are written to, defaults to junit_recipes.xml in ARTIFACTS if set")
+	flag.BoolVar(&flags.skipPreflight, "skip-preflight", false, "don't check the APIs, IAM roles and quotas of the recipes before running their tests")
 }
 
 func TestMain(m *testing.M) {
 	flag.Parse()
 	klog.Infof("Flags: %+v", flags)
 
-	// If running in Prow, then acquire and set up a project through Boskos.
+	var (
+		leases   []utils.Lease
+		projects map[string]string
+		// cleanups release the leases and the environment, in reverse
+		// order. klog.Fatalf exits without running the deferred calls, so
+		// fatalf runs them first.
+		cleanups []func()
+	)
+	cleanup := func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}
+	fatalf := func(format string, args ...interface{}) {
+		cleanup()
+		klog.Fatalf(format, args...)
+	}
+	defer cleanup()
+	// If running in Prow, then acquire and set up projects through Boskos.
 	if flags.inProw {
-		ph, err := utils.NewProjectHolder()
+		extraLeases, err := utils.ParseLeases(flags.boskosLeases)
 		if err != nil {
-			klog.Fatalf("NewProjectHolder()=%v, want nil", err)
+			klog.Fatalf("ParseLeases(%q)=%v, want nil", flags.boskosLeases, err)
 		}
-		project := ph.AcquireOrDie(flags.boskosResourceType)
-		defer func() {
-			out, err := exec.Command("bash", "test/cleanup-all.sh").CombinedOutput()
-			if err != nil {
-				// Fail now because we shouldn't continue testing if any step fails.
-				klog.Errorf("failed to run ./test/cleanup-all.sh: %q, err: %v", out, err)
-			}
-			ph.Release()
-		}()
-
-		if _, ok := os.LookupEnv("USER"); !ok {
-			if err := os.Setenv("USER", "prow"); err != nil {
-				klog.Fatalf("failed to set user in prow to prow: %v, want nil", err)
+		leases = []utils.Lease{{Name: utils.MainLease, ResourceType: flags.boskosResourceType}}
+		for _, l := range extraLeases {
+			if l.Name == utils.MainLease {
+				klog.Fatalf("--boskos-leases must not contain the %q lease, use --boskos-resource-type instead", utils.MainLease)
 			}
+			leases = append(leases, l)
 		}
 
-		output, err := exec.Command("gcloud", "config", "get-value", "project").CombinedOutput()
+		ph, err := utils.NewProjectHolder(flags.boskosURL, flags.boskosOwner)
 		if err != nil {
-			klog.Fatalf("failed to get gcloud project: %q: %v, want nil", string(output), err)
+			klog.Fatalf("NewProjectHolder(%q, %q)=%v, want nil", flags.boskosURL, flags.boskosOwner, err)
 		}
-		oldProject := strings.TrimSpace(string(output))
-		klog.Infof("Using project %s for testing. Restore to existing project %s after testing.", project, oldProject)
+		projects, err = ph.Acquire(leases)
+		if err != nil {
+			klog.Fatalf("Acquire(%+v)=%v, want nil", leases, err)
+		}
+		cleanups = append(cleanups, ph.Release)
+	} else {
+		project, err := utils.DefaultProject()
+		if err != nil {
+			klog.Warningf("DefaultProject()=%v, recipe tests will fail to create resources", err)
+		}
+		leases = []utils.Lease{{Name: utils.MainLease}}
+		projects = map[string]string{utils.MainLease: project}
+	}
 
-		if err := utils.SetEnvProject(project); err != nil {
-			klog.Fatalf("SetEnvProject(%q) failed: %v, want nil", project, err)
+	env, err := utils.NewEnv(projects[utils.MainLease])
+	if err != nil {
+		fatalf("NewEnv(%q)=%v, want nil", projects[utils.MainLease], err)
+	}
+	cleanups = append(cleanups, func() {
+		if err := env.Cleanup(); err != nil {
+			klog.Errorf("Cleanup() failed: %v", err)
+		}
+	})
+	if err := env.SetLeases(leases, projects); err != nil {
+		fatalf("SetLeases(%+v, %v) failed: %v, want nil", leases, projects, err)
+	}
+	if flags.inProw && env.Get("USER") == "" {
+		env.Set("USER", "prow")
+	}
+	if flags.runID == "" {
+		flags.runID = os.Getenv("BUILD_ID")
+	}
+	if flags.runID == "" {
+		flags.runID = naming.NewRunID(time.Now())
+	}
+	for _, owner := range []string{flags.boskosOwner, os.Getenv("JOB_NAME"), env.Get("USER")} {
+		if owner != "" {
+			runOwner = owner
+			break
 		}
+	}
+	runExpiresAt = time.Now().Add(flags.resourceTTL)
+	klog.Infof("Using project %s for testing with gcloud configuration in %s, run ID %s.", projects[utils.MainLease], env.Dir, flags.runID)
+	testEnv = env
 
-		// After the test, reset the project
-		defer func() {
-			if err := utils.SetEnvProject(oldProject); err != nil {
-				klog.Errorf("SetEnvProject(%q) failed: %v, want nil", oldProject, err)
+	if flags.inProw {
+		cleanups = append(cleanups, func() {
+			inventory := &sweeper.GcloudInventory{
+				Run:        sweeper.ExecRunner(env.Environ()),
+				Project:    env.Get("PROJECT"),
+				DNSProject: env.Get("DNS_PROJECT"),
+				DNSZone:    env.Get("DNS_ZONE"),
+			}
+			opts := sweeper.DefaultOptions()
+			opts.RunID = flags.runID
+			if _, err := sweeper.New(inventory, opts).Sweep(context.Background()); err != nil {
+				klog.Errorf("failed to sweep project %s: %v", env.Get("PROJECT"), err)
 			}
-		}()
+		})
 	}
 
 	m.Run()
+	if flags.junit != "" {
+		if err := results.WriteFile(flags.junit); err != nil {
+			klog.Errorf("failed to write the JUnit file %s: %v", flags.junit, err)
+		}
+	}
 }
@@ -0,0 +1,127 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// documentSeparator matches the lines starting a new YAML document.
+	documentSeparator = regexp.MustCompile(`^---(\s|$)`)
+	// errorLine matches the line of the errors of yaml.v3, e.g.
+	// "yaml: line 3: mapping values are not allowed in this context".
+	errorLine = regexp.MustCompile(`^yaml: line (\d+): `)
+)
+
+// Problem is a problem of a YAML file, at a line.
+type Problem struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+}
+
+// Lint returns the problems of the YAML documents in data, read from file:
+// syntax errors, duplicate keys, and tabs in indentation. Each document is
+// checked on its own, so that an error doesn't hide the problems of the next
+// documents.
+func Lint(file string, data []byte) []Problem {
+	var problems []Problem
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if strings.Contains(indent, "\t") {
+			problems = append(problems, Problem{File: file, Line: i + 1, Message: "tab in indentation"})
+		}
+	}
+
+	start := 0
+	for i := 0; i <= len(lines); i++ {
+		if i < len(lines) && (i == 0 || !documentSeparator.MatchString(lines[i])) {
+			continue
+		}
+		// The document starts after its separator, so that the lines of
+		// yaml.v3 are relative to the first line of the document.
+		first := start
+		if first < len(lines) && documentSeparator.MatchString(lines[first]) {
+			first++
+		}
+		if first < i {
+			problems = append(problems, lintDocument(file, first, strings.Join(lines[first:i], "\n"))...)
+		}
+		start = i
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+	return problems
+}
+
+// lintDocument returns the problems of a YAML document starting at the
+// 0-based line offset of file.
+func lintDocument(file string, offset int, doc string) []Problem {
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(doc), &node); err != nil {
+		msg := err.Error()
+		line := offset + 1
+		if m := errorLine.FindStringSubmatch(msg); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			line = offset + n
+			msg = strings.TrimPrefix(msg, m[0])
+		}
+		return []Problem{{File: file, Line: line, Message: strings.TrimPrefix(msg, "yaml: ")}}
+	}
+	var problems []Problem
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n.Kind == yaml.MappingNode {
+			keys := make(map[string]int)
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				key := n.Content[i]
+				if key.Kind != yaml.ScalarNode || key.Value == "<<" {
+					continue
+				}
+				if first, ok := keys[key.Value]; ok {
+					problems = append(problems, Problem{File: file, Line: offset + key.Line, Message: fmt.Sprintf("duplicate key %q, first defined at line %d", key.Value, offset+first)})
+					continue
+				}
+				keys[key.Value] = key.Line
+			}
+		}
+		for _, c := range n.Content {
+			walk(c)
+		}
+	}
+	walk(&node)
+	return problems
+}
+
+// LintFile returns the problems of the YAML file at path, see Lint.
+func LintFile(path string) ([]Problem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Lint(path, data), nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// repoRoot is the root of the repository, relative to this package.
+const repoRoot = "../.."
+
+func TestLint(t *testing.T) {
+	for _, tc := range []struct {
+		desc, data string
+		want       []string
+	}{
+		{
+			desc: "valid documents",
+			data: testManifest,
+		},
+		{
+			desc: "syntax errors in several documents",
+			data: `apiVersion: v1
+kind: Pod
+spec:
+  containers:
+  - name: proxy
+    ports:
+    - containerPort: 8080:
+---
+apiVersion: v1
+kind: ConfigMap
+data:
+  expression: ` + "`request.path == \"/\"`" + `
+---
+kind: Service
+  name: [foo
+`,
+			want: []string{
+				"test.yaml:7: mapping values are not allowed in this context",
+				"test.yaml:12: found character that cannot start any token",
+				"test.yaml:15: mapping values are not allowed in this context",
+			},
+		},
+		{
+			desc: "duplicate keys",
+			data: "---\nkind: Service\nmetadata:\n  name: foo\n  labels:\n    app: foo\n  name: bar\nkind: Service\n",
+			want: []string{
+				`test.yaml:7: duplicate key "name", first defined at line 4`,
+				`test.yaml:8: duplicate key "kind", first defined at line 2`,
+			},
+		},
+		{
+			desc: "tabs",
+			data: "kind: ConfigMap\ndata:\n\tkey: value\n",
+			want: []string{
+				"test.yaml:3: tab in indentation",
+				"test.yaml:3: found character that cannot start any token",
+			},
+		},
+	} {
+		var got []string
+		for _, p := range Lint("test.yaml", []byte(tc.data)) {
+			got = append(got, p.String())
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: Lint() = %q, want %q", tc.desc, got, tc.want)
+		}
+	}
+}
+
+// TestLintRepository checks that all the YAML files of the repository are
+// well-formed, so that broken manifests are caught at review time.
+func TestLintRepository(t *testing.T) {
+	err := filepath.WalkDir(repoRoot, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && (d.Name() == "vendor" || d.Name() == ".git") {
+			return filepath.SkipDir
+		}
+		if ext := filepath.Ext(path); d.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			return nil
+		}
+		problems, err := LintFile(path)
+		if err != nil {
+			return err
+		}
+		for _, p := range problems {
+			t.Error(p)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkDir(%q) = %v, want nil", repoRoot, err)
+	}
+}
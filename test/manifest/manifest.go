@@ -0,0 +1,194 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package manifest decodes the Kubernetes objects of the recipe manifests.
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// Object is a Kubernetes object decoded from a manifest.
+type Object struct {
+	unstructured.Unstructured
+	// File is the path of the manifest the object was decoded from.
+	File string
+	// Line is the line the document of the object starts at in File.
+	Line int
+}
+
+// String returns the kind and name of the object and where it is defined.
+func (o *Object) String() string {
+	return fmt.Sprintf("%s %s (%s:%d)", o.GetKind(), o.GetName(), o.File, o.Line)
+}
+
+// NestedField returns the value of the field of obj at the path fields, nil
+// if there is none.
+func NestedField(obj map[string]interface{}, fields ...string) interface{} {
+	v, _, _ := unstructured.NestedFieldNoCopy(obj, fields...)
+	return v
+}
+
+// FieldString returns a string or integer field value as a string, "" for
+// anything else.
+func FieldString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int64:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// MatchLabels returns true if labels has all the labels of selector.
+func MatchLabels(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// BackendConfigAnnotations are the annotations of a Service referencing its
+// BackendConfigs, see BackendConfigs.
+var BackendConfigAnnotations = []string{"cloud.google.com/backend-config", "beta.cloud.google.com/backend-config"}
+
+// BackendConfigs parses a backend-config annotation, returning the
+// BackendConfig by port, "default" for the default one.
+func BackendConfigs(annotation string) (map[string]string, error) {
+	if annotation == "" {
+		return nil, nil
+	}
+	var config struct {
+		Default string            `json:"default"`
+		Ports   map[string]string `json:"ports"`
+	}
+	if err := json.Unmarshal([]byte(annotation), &config); err != nil {
+		return nil, err
+	}
+	configs := make(map[string]string)
+	for port, name := range config.Ports {
+		configs[port] = name
+	}
+	if config.Default != "" {
+		configs["default"] = config.Default
+	}
+	return configs, nil
+}
+
+// Parse decodes the objects of the YAML documents in data, read from file.
+// Empty documents, and documents which aren't Kubernetes objects because they
+// have no kind, are skipped.
+func Parse(file string, data []byte) ([]*Object, error) {
+	var objects []*Object
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+		line := doc.Content[0].Line
+
+		// Go through JSON, so that the fields have the types expected by
+		// unstructured.Unstructured, e.g. int64 for integers.
+		b, err := yaml.Marshal(&doc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s:%d: %w", file, line, err)
+		}
+		j, err := sigsyaml.YAMLToJSON(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert %s:%d: %w", file, line, err)
+		}
+		fields := make(map[string]interface{})
+		if err := utiljson.Unmarshal(j, &fields); err != nil {
+			return nil, fmt.Errorf("failed to decode %s:%d: %w", file, line, err)
+		}
+		if _, ok := fields["kind"]; !ok {
+			continue
+		}
+		objects = append(objects, &Object{
+			Unstructured: unstructured.Unstructured{Object: fields},
+			File:         file,
+			Line:         line,
+		})
+	}
+}
+
+// Load decodes the objects of the manifest at path.
+func Load(path string) ([]*Object, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, data)
+}
+
+// Files returns the YAML files in dir and its subdirectories, sorted.
+func Files(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// LoadDir decodes the objects of all the manifests in dir and its
+// subdirectories.
+func LoadDir(dir string) ([]*Object, error) {
+	files, err := Files(dir)
+	if err != nil {
+		return nil, err
+	}
+	var objects []*Object
+	for _, file := range files {
+		objs, err := Load(file)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, objs...)
+	}
+	return objects, nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/testfiles"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const testManifest = `# A comment before the first document.
+apiVersion: v1
+kind: Service
+metadata:
+  name: foo
+spec:
+  ports:
+  - port: 8080
+---
+---
+not: a kubernetes object
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: foo
+  namespace: bar
+`
+
+func TestParse(t *testing.T) {
+	objects, err := Parse("test.yaml", []byte(testManifest))
+	if err != nil {
+		t.Fatalf("Parse() = %v, want nil", err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("Parse() returned %d objects, want 2", len(objects))
+	}
+
+	svc := objects[0]
+	if got, want := svc.String(), "Service foo (test.yaml:2)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	ports, _, err := unstructured.NestedSlice(svc.Object, "spec", "ports")
+	if err != nil || len(ports) != 1 {
+		t.Fatalf("NestedSlice(spec.ports) = %v, %v, want 1 port", ports, err)
+	}
+	if port, _, err := unstructured.NestedInt64(ports[0].(map[string]interface{}), "port"); err != nil || port != 8080 {
+		t.Errorf("NestedInt64(port) = %d, %v, want 8080", port, err)
+	}
+
+	ing := objects[1]
+	if ing.GetKind() != "Ingress" || ing.GetNamespace() != "bar" || ing.Line != 13 {
+		t.Errorf("Parse() = %v in namespace %q, want Ingress foo in namespace bar at line 13", ing, ing.GetNamespace())
+	}
+}
+
+func TestParseError(t *testing.T) {
+	if _, err := Parse("bad.yaml", []byte("kind: Service\n  name: [foo\n")); err == nil {
+		t.Errorf("Parse() = nil, want error")
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	testfiles.Write(t, dir, map[string]string{
+		"b.yaml":           "kind: ConfigMap\nmetadata:\n  name: b\n",
+		"sub/a.yml":        "kind: ConfigMap\nmetadata:\n  name: a\n",
+		"README.md":        "kind: ConfigMap\n",
+		"sub/ignored.json": "{}",
+	})
+
+	objects, err := LoadDir(dir)
+	if err != nil {
+		t.Fatalf("LoadDir() = %v, want nil", err)
+	}
+	var names []string
+	for _, o := range objects {
+		names = append(names, o.GetName())
+	}
+	if len(names) != 2 || names[0] != "b" || names[1] != "a" {
+		t.Errorf("LoadDir() = %v, want [b a]", names)
+	}
+}
+
+func TestFields(t *testing.T) {
+	objects, err := Parse("test.yaml", []byte(testManifest))
+	if err != nil {
+		t.Fatalf("Parse() = %v, want nil", err)
+	}
+	ports, _, _ := unstructured.NestedSlice(objects[0].Object, "spec", "ports")
+	if got := FieldString(NestedField(ports[0].(map[string]interface{}), "port")); got != "8080" {
+		t.Errorf("FieldString(port) = %q, want %q", got, "8080")
+	}
+	if got := FieldString(NestedField(objects[0].Object, "spec", "ports")); got != "" {
+		t.Errorf("FieldString(spec.ports) = %q, want \"\"", got)
+	}
+
+	labels := map[string]string{"app": "foo", "tier": "web"}
+	if !MatchLabels(labels, map[string]string{"app": "foo"}) || MatchLabels(labels, map[string]string{"app": "bar"}) {
+		t.Errorf("MatchLabels(%v) doesn't match the selectors with a subset of its labels only", labels)
+	}
+}
+
+func TestBackendConfigs(t *testing.T) {
+	got, err := BackendConfigs(`{"default": "a", "ports": {"http": "b", "8080": "c"}}`)
+	if want := map[string]string{"default": "a", "http": "b", "8080": "c"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("BackendConfigs() = %v, %v, want %v, nil", got, err, want)
+	}
+	if got, err := BackendConfigs(""); err != nil || got != nil {
+		t.Errorf("BackendConfigs(\"\") = %v, %v, want nil, nil", got, err)
+	}
+	if _, err := BackendConfigs(`{"ports": "b"}`); err == nil {
+		t.Errorf("BackendConfigs() of a malformed annotation = nil, want error")
+	}
+}
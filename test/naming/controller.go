@@ -0,0 +1,135 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package naming
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The names derived by the GKE ingress and gateway controllers, following
+// the naming schemes of ingress-gce. The cluster UID and the hash suffix are
+// not known statically, placeholders of the right length are used instead.
+const (
+	// controllerUID is a placeholder for the 8 characters of the cluster UID
+	// in controller-derived names.
+	controllerUID = "uuuuuuuu"
+	// controllerHash is a placeholder for the 8 characters hash ending
+	// controller-derived names.
+	controllerHash = "hhhhhhhh"
+
+	// maxNEGFieldsLength is the maximum combined length of the namespace,
+	// service name and port in a NEG name:
+	// 63 - 5 ("k8s1-") - 8 (cluster UID) - 8 (hash) - 4 (dashes).
+	maxNEGFieldsLength = 38
+	// maxFrontendFieldsLength is the maximum combined length of the
+	// namespace and ingress name in the name of a load balancer resource:
+	// 63 - 5 ("k8s2-") - 2 (resource prefix) - 8 (cluster UID) - 8 (hash)
+	// - 4 (dashes).
+	maxFrontendFieldsLength = 36
+
+	// gatewayUID is a placeholder for the 4 characters of the cluster UID in
+	// the names derived by the gateway controller.
+	gatewayUID = "uuuu"
+	// gatewayHash is a placeholder for the 12 characters hash ending the
+	// names derived by the gateway controller.
+	gatewayHash = "hhhhhhhhhhhh"
+	// maxGatewayLength is the maximum combined length of the fields and the
+	// dashes separating them in a name derived by the gateway controller:
+	// 63 - 7 ("gkegw1-") - 4 (cluster UID) - 12 (hash) - 2 (dashes).
+	maxGatewayLength = 38
+
+	// mciHash is a placeholder for the 6 characters hash of the names derived
+	// by the Multi Cluster Ingress controller.
+	mciHash = "hhhhhh"
+	// maxMCILength is the maximum combined length of the fields and the
+	// dashes separating them in a name derived by the Multi Cluster Ingress
+	// controller: 63 - 4 ("mci-") - 6 (hash) - 1 (dash).
+	maxMCILength = 52
+)
+
+// FrontendResources are the prefixes of the load balancer resources the
+// ingress controller creates for an Ingress: URL map, target HTTP and HTTPS
+// proxies, HTTP and HTTPS forwarding rules, and SSL certificates.
+var FrontendResources = []string{"um", "tp", "ts", "fr", "fs", "cr"}
+
+// NEGName returns the name of the NEG created for port of the Service
+// namespace/name, which is also the name of the backend service and health
+// check using the NEG. truncated is true if the namespace, name and port are
+// shortened to fit in MaxNameLength.
+func NEGName(namespace, name string, port string) (string, bool) {
+	fields, truncated := trimFieldsEvenly(maxNEGFieldsLength, namespace, name, port)
+	return fmt.Sprintf("k8s1-%s-%s-%s-%s-%s", controllerUID, fields[0], fields[1], fields[2], controllerHash), truncated
+}
+
+// FrontendName returns the name of the load balancer resource of the Ingress
+// namespace/name with the given prefix, one of FrontendResources. truncated
+// is true if the namespace and name are shortened to fit in MaxNameLength.
+func FrontendName(resource, namespace, name string) (string, bool) {
+	fields, truncated := trimFieldsEvenly(maxFrontendFieldsLength, namespace, name)
+	return fmt.Sprintf("k8s2-%s-%s-%s-%s-%s", resource, controllerUID, fields[0], fields[1], controllerHash), truncated
+}
+
+// GatewayName returns the name of a resource the gateway controller creates
+// for a Gateway or for a backend of its routes, e.g. GatewayName(namespace,
+// gateway) for its URL map and GatewayName(namespace, service, port) for a
+// backend service. truncated is true if the fields are shortened to fit in
+// MaxNameLength.
+func GatewayName(fields ...string) (string, bool) {
+	fields, truncated := trimFieldsEvenly(maxGatewayLength-(len(fields)-1), fields...)
+	return fmt.Sprintf("gkegw1-%s-%s-%s", gatewayUID, strings.Join(fields, "-"), gatewayHash), truncated
+}
+
+// MCIName returns the name of a resource the Multi Cluster Ingress controller
+// creates, e.g. MCIName("um", namespace, ingress) for the URL map of a
+// MultiClusterIngress and MCIName(port, namespace, service) for the backend
+// service of a MultiClusterService. truncated is true if the fields are
+// shortened to fit in MaxNameLength.
+func MCIName(fields ...string) (string, bool) {
+	fields, truncated := trimFieldsEvenly(maxMCILength-(len(fields)-1), fields...)
+	return fmt.Sprintf("mci-%s-%s", mciHash, strings.Join(fields, "-")), truncated
+}
+
+// trimFieldsEvenly shortens fields so that their combined length is at most
+// max, shortening longer fields more, like the controllers do.
+func trimFieldsEvenly(max int, fields ...string) ([]string, bool) {
+	total := 0
+	for _, f := range fields {
+		total += len(f)
+	}
+	if total <= max {
+		return fields, false
+	}
+	excess := total - max
+	remaining := max
+	lengths := make([]int, len(fields))
+	for i, f := range fields {
+		if lengths[i] = len(f) - len(f)*excess/total - 1; lengths[i] < 0 {
+			lengths[i] = 0
+		}
+		remaining -= lengths[i]
+	}
+	for i := 0; remaining > 0; i = (i + 1) % len(fields) {
+		if lengths[i] < len(fields[i]) {
+			lengths[i]++
+			remaining--
+		}
+	}
+	trimmed := make([]string, len(fields))
+	for i, f := range fields {
+		trimmed[i] = f[:lengths[i]]
+	}
+	return trimmed, true
+}
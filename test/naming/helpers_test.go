@@ -0,0 +1,69 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package naming_test
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/naming"
+)
+
+// runHelper runs a function of test/helpers/naming.sh, from the root of the
+// repository like the test scripts, with only PATH and env set, and returns
+// its output.
+func runHelper(t *testing.T, env []string, function string, args ...string) string {
+	t.Helper()
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not installed")
+	}
+	cmd := exec.Command(bash, append([]string{"-c", `source ./test/helpers/naming.sh; "$@"`, "bash", function}, args...)...)
+	cmd.Dir = repoRoot
+	cmd.Env = append([]string{"PATH=" + os.Getenv("PATH")}, env...)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%s %q = %v, want nil", function, args, err)
+	}
+	return strings.TrimSuffix(string(out), "\n")
+}
+
+// TestHelpers checks that the test helpers name and label the resources like
+// package naming.
+func TestHelpers(t *testing.T) {
+	suffix := strings.Repeat("0", naming.SuffixLength)
+	env := []string{"RESOURCE_SUFFIX=" + suffix}
+	for _, component := range []string{
+		"",
+		"ip",
+		"My Policy_1",
+		"a-component-name-that-is-much-too-long-for-a-gce-resource-name",
+		"a-component-name-of-the-right-length-to-end-w-",
+	} {
+		got := runHelper(t, env, "get_resource_name", "test", component)
+		if want := naming.Name(suffix, component); got != want {
+			t.Errorf("get_resource_name test %q = %q, want %q", component, got, want)
+		}
+	}
+
+	for _, testName := range []string{"ingress-https", "My_Recipe", strings.Repeat("a-long-name-", 10)} {
+		got := runHelper(t, nil, "get_resource_labels", testName)
+		if want := naming.LabelRecipe + "=" + naming.LabelValue(testName); got != want {
+			t.Errorf("get_resource_labels %q = %q, want %q", testName, got, want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package naming derives the names and labels of the resources created by the
+// recipe tests. Names are unique per (run ID, recipe), so that runs sharing a
+// project never collide, and labels record who created a resource and until
+// when it is needed, so that the sweeper can find it.
+package naming
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Prefix is the prefix of the names of all the resources created by the
+	// recipe tests.
+	Prefix = "gke-net-recipes-"
+	// SuffixLength is the length of the hash identifying a (run ID, recipe)
+	// pair in resource names.
+	SuffixLength = 20
+	// MaxNameLength is the maximum length of a GCE resource name, and of a
+	// label value.
+	MaxNameLength = 63
+
+	// LabelRecipe is the key of the label holding the name of the recipe.
+	LabelRecipe = "recipe"
+	// LabelRunID is the key of the label holding the ID of the test run.
+	LabelRunID = "run-id"
+	// LabelOwner is the key of the label holding the owner of the test run,
+	// e.g. the Prow job name.
+	LabelOwner = "owner"
+	// LabelExpiresAt is the key of the label holding the Unix time after
+	// which the resource can be deleted. Label values can't hold ":", so
+	// RFC 3339 timestamps can't be used.
+	LabelExpiresAt = "expires-at"
+)
+
+// Namer derives the names and labels of the resources of a recipe in a test
+// run.
+type Namer struct {
+	// RunID identifies the test run.
+	RunID string
+	// Recipe is the path of the recipe, e.g. "ingress/single-cluster/ingress-https".
+	Recipe string
+	// Owner is who started the test run.
+	Owner string
+	// ExpiresAt is when the resources can be deleted, if they still exist.
+	ExpiresAt time.Time
+}
+
+// New returns a Namer for the resources of recipe in the run runID.
+func New(runID, recipe, owner string, expiresAt time.Time) *Namer {
+	return &Namer{
+		RunID:     runID,
+		Recipe:    strings.Trim(recipe, "/"),
+		Owner:     owner,
+		ExpiresAt: expiresAt,
+	}
+}
+
+// NewRunID returns a random run ID, starting with the current time so that
+// run IDs sort in creation order.
+func NewRunID(now time.Time) string {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return fmt.Sprintf("%s-%s", now.UTC().Format("20060102-150405"), hex.EncodeToString(b))
+}
+
+// Suffix returns the hash identifying the (run ID, recipe) pair of n.
+func (n *Namer) Suffix() string {
+	return hash(n.RunID + "/" + n.Recipe)[:SuffixLength]
+}
+
+// Name returns the name of a resource of the recipe. Without components, it
+// is the name shared by the network, subnet, instance and cluster of the
+// recipe. Components distinguish the other resources, e.g. Name("ip"). The
+// name is a valid RFC 1035 label of at most MaxNameLength characters.
+func (n *Namer) Name(components ...string) string {
+	return Name(n.Suffix(), components...)
+}
+
+// Name returns the name of a resource identified by suffix and components.
+// See Namer.Name.
+func Name(suffix string, components ...string) string {
+	parts := []string{strings.TrimSuffix(Prefix, "-"), suffix}
+	for _, c := range components {
+		if c = sanitize(c); c != "" {
+			parts = append(parts, c)
+		}
+	}
+	name := strings.Join(parts, "-")
+	if len(name) <= MaxNameLength {
+		return name
+	}
+	// Keep the name unique by replacing the end of the components with a hash
+	// of the full name.
+	h := hash(name)[:8]
+	name = strings.TrimRight(name[:MaxNameLength-len(h)-1], "-")
+	return name + "-" + h
+}
+
+// Labels returns the labels to attach to the resources of the recipe.
+func (n *Namer) Labels() map[string]string {
+	labels := map[string]string{
+		LabelRecipe: LabelValue(path.Base(n.Recipe)),
+		LabelRunID:  LabelValue(n.RunID),
+	}
+	if owner := LabelValue(n.Owner); owner != "" {
+		labels[LabelOwner] = owner
+	}
+	if !n.ExpiresAt.IsZero() {
+		labels[LabelExpiresAt] = strconv.FormatInt(n.ExpiresAt.Unix(), 10)
+	}
+	return labels
+}
+
+// LabelsFlag returns the labels of the recipe in the "key=value,..." format
+// of the --labels flag of gcloud and of kubectl label.
+func (n *Namer) LabelsFlag() string {
+	return FormatLabels(n.Labels())
+}
+
+// FormatLabels formats labels as "key=value,...", sorted by key.
+func FormatLabels(labels map[string]string) string {
+	var pairs []string
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Expired returns true if labels hold an expires-at label in the past of now.
+// The second return value is false if there is no valid expires-at label.
+func Expired(labels map[string]string, now time.Time) (bool, bool) {
+	value, ok := labels[LabelExpiresAt]
+	if !ok {
+		return false, false
+	}
+	sec, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false, false
+	}
+	return !now.Before(time.Unix(sec, 0)), true
+}
+
+// LabelValue turns s into a valid GCE and Kubernetes label value: lower case
+// letters, digits and dashes, at most MaxNameLength characters.
+func LabelValue(s string) string {
+	v := sanitize(s)
+	if len(v) > MaxNameLength {
+		v = strings.TrimRight(v[:MaxNameLength], "-")
+	}
+	return v
+}
+
+// sanitize lower cases s, replaces the characters not allowed in names with
+// dashes, and trims the dashes at both ends.
+func sanitize(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+func hash(s string) string {
+	h := sha1.Sum([]byte(s))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,136 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package naming
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var rfc1035 = regexp.MustCompile(`^[a-z]([-a-z0-9]*[a-z0-9])?$`)
+
+func TestNameUnique(t *testing.T) {
+	expiresAt := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	names := make(map[string]string)
+	for _, runID := range []string{"1", "2"} {
+		for _, recipe := range []string{"ingress/single-cluster/ingress-https", "ingress/single-cluster/ingress-iap"} {
+			n := New(runID, recipe, "me", expiresAt)
+			for _, name := range []string{n.Name(), n.Name("ip")} {
+				if other, ok := names[name]; ok {
+					t.Errorf("Name() = %q for %s/%s and %s", name, runID, recipe, other)
+				}
+				names[name] = runID + "/" + recipe
+			}
+		}
+	}
+
+	n := New("1", "ingress/single-cluster/ingress-https", "me", expiresAt)
+	if got, want := n.Name(), Prefix+n.Suffix(); got != want {
+		t.Errorf("Name() = %q, want %q", got, want)
+	}
+	if got, want := len(n.Suffix()), SuffixLength; got != want {
+		t.Errorf("len(Suffix()) = %d, want %d", got, want)
+	}
+	if got, want := New("1", "/ingress/single-cluster/ingress-https/", "", time.Time{}).Name(), n.Name(); got != want {
+		t.Errorf("Name() with slashes = %q, want %q", got, want)
+	}
+}
+
+func TestNameValid(t *testing.T) {
+	suffix := strings.Repeat("a", SuffixLength)
+	for _, tc := range []struct {
+		components []string
+		want       string
+	}{
+		{want: "gke-net-recipes-" + suffix},
+		{components: []string{"ip"}, want: "gke-net-recipes-" + suffix + "-ip"},
+		{components: []string{"SSL_Policy", ""}, want: "gke-net-recipes-" + suffix + "-ssl-policy"},
+		{components: []string{"--a", "b--"}, want: "gke-net-recipes-" + suffix + "-a-b"},
+	} {
+		if got := Name(suffix, tc.components...); got != tc.want {
+			t.Errorf("Name(%q, %q) = %q, want %q", suffix, tc.components, got, tc.want)
+		}
+	}
+
+	long1 := Name(suffix, strings.Repeat("x", 40), "one")
+	long2 := Name(suffix, strings.Repeat("x", 40), "two")
+	for _, name := range []string{long1, long2} {
+		if len(name) > MaxNameLength || !rfc1035.MatchString(name) {
+			t.Errorf("Name() = %q (%d characters), want a valid name of at most %d characters", name, len(name), MaxNameLength)
+		}
+	}
+	if long1 == long2 {
+		t.Errorf("Name() = %q for different components, want different names", long1)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	expiresAt := time.Unix(1685620800, 0)
+	n := New("20230601-120000-abcdef", "ingress/single-cluster/ingress-https", "ci-gke-networking-recipes@example.com", expiresAt)
+	want := map[string]string{
+		LabelRecipe:    "ingress-https",
+		LabelRunID:     "20230601-120000-abcdef",
+		LabelOwner:     "ci-gke-networking-recipes-example-com",
+		LabelExpiresAt: "1685620800",
+	}
+	if got := n.Labels(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Labels() = %v, want %v", got, want)
+	}
+	wantFlag := "expires-at=1685620800,owner=ci-gke-networking-recipes-example-com,recipe=ingress-https,run-id=20230601-120000-abcdef"
+	if got := n.LabelsFlag(); got != wantFlag {
+		t.Errorf("LabelsFlag() = %q, want %q", got, wantFlag)
+	}
+
+	expired, ok := Expired(want, expiresAt.Add(-time.Second))
+	if expired || !ok {
+		t.Errorf("Expired(%v, before) = %v, %v, want false, true", want, expired, ok)
+	}
+	expired, ok = Expired(want, expiresAt)
+	if !expired || !ok {
+		t.Errorf("Expired(%v, at) = %v, %v, want true, true", want, expired, ok)
+	}
+	if _, ok := Expired(map[string]string{LabelExpiresAt: "tomorrow"}, expiresAt); ok {
+		t.Errorf("Expired() with an invalid label = _, true, want false")
+	}
+}
+
+func TestLabelValue(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"ingress-https", "ingress-https"},
+		{"Prow Job/42", "prow-job-42"},
+		{strings.Repeat("a", 62) + "-b", strings.Repeat("a", 62)},
+		{"", ""},
+	} {
+		if got := LabelValue(tc.in); got != tc.want {
+			t.Errorf("LabelValue(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestNewRunID(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	a, b := NewRunID(now), NewRunID(now)
+	if a == b {
+		t.Errorf("NewRunID() = %q twice, want different IDs", a)
+	}
+	if !strings.HasPrefix(a, "20230601-120000-") || LabelValue(a) != a {
+		t.Errorf("NewRunID() = %q, want a valid label value starting with the time", a)
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The recipes are discovered with package recipe, which imports package
+// naming, so this test is in an external test package.
+package naming_test
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/naming"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe/recipetest"
+)
+
+// repoRoot is the root of the repository, relative to this package.
+const repoRoot = "../.."
+
+// TestRecipes validates the names produced by the recipes of the repository.
+func TestRecipes(t *testing.T) {
+	recipetest.ForEach(t, repoRoot, func(t *testing.T, r *recipe.Recipe) {
+		names, err := naming.RecipeNames(r.Dir)
+		if err != nil {
+			t.Fatalf("RecipeNames(%q) = %v, want nil", r.Path, err)
+		}
+		for _, name := range names {
+			if err := name.Validate(); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+}
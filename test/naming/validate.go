@@ -0,0 +1,386 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package naming
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/manifest"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var (
+	// rfc1035Label matches the names GCE accepts, ignoring the length.
+	rfc1035Label = regexp.MustCompile(`^[a-z]([-a-z0-9]*[a-z0-9])?$`)
+	// resourceNameCall matches the calls to get_resource_name in the test
+	// scripts, capturing the component.
+	resourceNameCall = regexp.MustCompile(`get_resource_name\s+"\$\{?test_name\}?"\s+"([^"$]+)"`)
+	// testNameAssignment matches the assignment of test_name in the test
+	// scripts, capturing the name of the test, which is also the namespace
+	// of the recipe, see create_namespace.
+	testNameAssignment = regexp.MustCompile(`(?m)^test_name="([^"$]+)"`)
+	// helperPrefixes are the prefixes of the names the test helpers derive
+	// from the resource suffix, see setup_ilb and check_http_status.
+	helperPrefixes = []string{"proxy-only-", "allow-proxy-", "allow-ssh-"}
+)
+
+// GeneratedName is a name a recipe produces.
+type GeneratedName struct {
+	// Name is the full name, before any truncation.
+	Name string
+	// Source describes what produces the name.
+	Source string
+	// Kubernetes is true if the name is the name of a Kubernetes namespace
+	// rather than of a GCE resource.
+	Kubernetes bool
+	// Truncated is true if the producer of the name shortens parts of it to
+	// fit in MaxNameLength.
+	Truncated bool
+}
+
+// Validate returns an error if the name is invalid, or is truncated by its
+// producer.
+func (g GeneratedName) Validate() error {
+	if g.Truncated {
+		return fmt.Errorf("%s: name %q is truncated to fit in %d characters", g.Source, g.Name, MaxNameLength)
+	}
+	if g.Kubernetes {
+		if errs := validation.IsDNS1123Label(g.Name); len(errs) > 0 {
+			return fmt.Errorf("%s: invalid name %q: %s", g.Source, g.Name, strings.Join(errs, ", "))
+		}
+		return nil
+	}
+	if err := ValidateName(g.Name); err != nil {
+		return fmt.Errorf("%s: %w", g.Source, err)
+	}
+	return nil
+}
+
+// ValidateName returns an error if name is not a valid GCE resource name: a
+// RFC 1035 label of at most MaxNameLength characters.
+func ValidateName(name string) error {
+	if len(name) > MaxNameLength {
+		return fmt.Errorf("name %q is %d characters long, more than %d", name, len(name), MaxNameLength)
+	}
+	if !rfc1035Label.MatchString(name) {
+		return fmt.Errorf("name %q must start with a lower case letter, followed by lower case letters, digits or dashes, and not end with a dash", name)
+	}
+	return nil
+}
+
+// ValidateRecipe returns an error for every name produced by the recipe in
+// dir that is invalid or truncated. See RecipeNames.
+func ValidateRecipe(dir string) ([]error, error) {
+	names, err := RecipeNames(dir)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, name := range names {
+		if err := name.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs, nil
+}
+
+// RecipeNames returns the names produced by the recipe in dir when it is run
+// by the test framework:
+//   - the names of the resources created by its test scripts, with a suffix
+//     of SuffixLength characters,
+//   - its namespace, named after the test_name of its setup.sh, or after dir
+//     if it has none,
+//   - the names the GKE controllers derive for the NEGs, backend services and
+//     load balancer resources of the Ingresses, Services and routes of its
+//     manifests.
+func RecipeNames(dir string) ([]GeneratedName, error) {
+	scripts, err := filepath.Glob(filepath.Join(dir, "*.sh"))
+	if err != nil {
+		return nil, err
+	}
+	namespace, err := recipeNamespace(dir)
+	if err != nil {
+		return nil, err
+	}
+	suffix := strings.Repeat("0", SuffixLength)
+	names := []GeneratedName{{Name: namespace, Source: "namespace of " + dir, Kubernetes: true}}
+
+	if len(scripts) > 0 {
+		names = append(names, GeneratedName{Name: Prefix + suffix, Source: "test helpers"})
+		for _, prefix := range helperPrefixes {
+			names = append(names, GeneratedName{Name: prefix + suffix, Source: "test helpers"})
+		}
+	}
+	for _, script := range scripts {
+		b, err := os.ReadFile(script)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range resourceNameCall.FindAllStringSubmatch(string(b), -1) {
+			names = append(names, GeneratedName{Name: Prefix + suffix + "-" + m[1], Source: script})
+		}
+	}
+
+	files, err := manifest.Files(dir)
+	if err != nil {
+		return nil, err
+	}
+	var objects []*manifest.Object
+	for _, file := range files {
+		objs, err := manifest.Load(file)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, objs...)
+	}
+	names = append(names, controllerNames(objects, namespace)...)
+
+	// Several objects can produce the same name, e.g. two Ingresses using the
+	// same Service.
+	seen := make(map[string]bool)
+	var unique []GeneratedName
+	for _, name := range names {
+		if !seen[name.Name] {
+			seen[name.Name] = true
+			unique = append(unique, name)
+		}
+	}
+	return unique, nil
+}
+
+// recipeNamespace returns the namespace the test scripts of the recipe in dir
+// create: the test_name of its setup.sh, or the name of dir.
+func recipeNamespace(dir string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(dir, "setup.sh"))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if m := testNameAssignment.FindSubmatch(b); m != nil {
+		return string(m[1]), nil
+	}
+	return filepath.Base(filepath.Clean(dir)), nil
+}
+
+// servicePort is a port of a Service used as a backend.
+type servicePort struct {
+	namespace, name string
+	// port is the number or the name of the port.
+	port string
+}
+
+// controllerNames returns the names the GKE controllers derive from objects.
+// Objects without a namespace are deployed in namespace.
+func controllerNames(objects []*manifest.Object, namespace string) []GeneratedName {
+	namespaceOf := func(o *manifest.Object) string {
+		if ns := o.GetNamespace(); ns != "" {
+			return ns
+		}
+		return namespace
+	}
+
+	var names []GeneratedName
+	addNEG := func(o *manifest.Object, sp servicePort) {
+		port := resolvePort(objects, namespace, sp)
+		name, truncated := NEGName(sp.namespace, sp.name, port)
+		names = append(names, GeneratedName{
+			Name:      name,
+			Source:    fmt.Sprintf("NEG and backend service of Service %s/%s port %s used by %s", sp.namespace, sp.name, port, o),
+			Truncated: truncated,
+		})
+	}
+
+	for _, o := range objects {
+		ns := namespaceOf(o)
+		switch o.GetKind() {
+		case "Ingress":
+			if !isGCEIngress(o) {
+				continue
+			}
+			for _, resource := range FrontendResources {
+				name, truncated := FrontendName(resource, ns, o.GetName())
+				names = append(names, GeneratedName{Name: name, Source: "load balancer of " + o.String(), Truncated: truncated})
+			}
+			for _, sp := range ingressBackends(o) {
+				sp.namespace = ns
+				addNEG(o, sp)
+			}
+		case "HTTPRoute", "GRPCRoute":
+			for _, sp := range routeBackends(o) {
+				if sp.namespace == "" {
+					sp.namespace = ns
+				}
+				addNEG(o, sp)
+			}
+		case "Service":
+			annotation, ok := o.GetAnnotations()["cloud.google.com/neg"]
+			if !ok {
+				continue
+			}
+			var neg struct {
+				ExposedPorts map[string]struct {
+					Name string `json:"name"`
+				} `json:"exposed_ports"`
+			}
+			if err := json.Unmarshal([]byte(annotation), &neg); err != nil {
+				names = append(names, GeneratedName{Name: annotation, Source: fmt.Sprintf("invalid cloud.google.com/neg annotation of %s: %v", o, err)})
+				continue
+			}
+			var ports []string
+			for port := range neg.ExposedPorts {
+				ports = append(ports, port)
+			}
+			sort.Strings(ports)
+			for _, port := range ports {
+				if exposed := neg.ExposedPorts[port]; exposed.Name != "" {
+					names = append(names, GeneratedName{Name: exposed.Name, Source: fmt.Sprintf("custom NEG name of %s port %s", o, port)})
+					continue
+				}
+				addNEG(o, servicePort{namespace: ns, name: o.GetName(), port: port})
+			}
+		}
+	}
+	return names
+}
+
+// isGCEIngress returns true if the Ingress is handled by the GKE ingress
+// controller.
+func isGCEIngress(o *manifest.Object) bool {
+	class := o.GetAnnotations()["kubernetes.io/ingress.class"]
+	if class == "" {
+		class, _, _ = unstructured.NestedString(o.Object, "spec", "ingressClassName")
+	}
+	return class == "" || class == "gce" || class == "gce-internal"
+}
+
+// ingressBackends returns the Service ports used by an Ingress, in the
+// networking.k8s.io/v1 or the legacy v1beta1 format.
+func ingressBackends(o *manifest.Object) []servicePort {
+	var backends []map[string]interface{}
+	for _, field := range [][]string{{"spec", "defaultBackend"}, {"spec", "backend"}} {
+		if b, ok, _ := unstructured.NestedMap(o.Object, field...); ok {
+			backends = append(backends, b)
+		}
+	}
+	rules, _, _ := unstructured.NestedSlice(o.Object, "spec", "rules")
+	for _, rule := range rules {
+		rule, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		paths, _, _ := unstructured.NestedSlice(rule, "http", "paths")
+		for _, path := range paths {
+			path, ok := path.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if b, ok, _ := unstructured.NestedMap(path, "backend"); ok {
+				backends = append(backends, b)
+			}
+		}
+	}
+
+	var ports []servicePort
+	for _, b := range backends {
+		if name, ok, _ := unstructured.NestedString(b, "service", "name"); ok {
+			port := fieldString(b, "service", "port", "number")
+			if port == "" {
+				port = fieldString(b, "service", "port", "name")
+			}
+			ports = append(ports, servicePort{name: name, port: port})
+			continue
+		}
+		if name, ok, _ := unstructured.NestedString(b, "serviceName"); ok {
+			ports = append(ports, servicePort{name: name, port: fieldString(b, "servicePort")})
+		}
+	}
+	return ports
+}
+
+// routeBackends returns the Service ports used by a Gateway API route.
+func routeBackends(o *manifest.Object) []servicePort {
+	var ports []servicePort
+	rules, _, _ := unstructured.NestedSlice(o.Object, "spec", "rules")
+	for _, rule := range rules {
+		rule, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		refs, _, _ := unstructured.NestedSlice(rule, "backendRefs")
+		for _, ref := range refs {
+			ref, ok := ref.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if kind := fieldString(ref, "kind"); kind != "" && kind != "Service" {
+				continue
+			}
+			ports = append(ports, servicePort{
+				namespace: fieldString(ref, "namespace"),
+				name:      fieldString(ref, "name"),
+				port:      fieldString(ref, "port"),
+			})
+		}
+	}
+	return ports
+}
+
+// resolvePort returns the number of the port of a Service, looking up named
+// ports in the Services of objects. Unresolved port names are returned as is.
+func resolvePort(objects []*manifest.Object, namespace string, sp servicePort) string {
+	if _, err := strconv.Atoi(sp.port); err == nil {
+		return sp.port
+	}
+	for _, o := range objects {
+		ns := o.GetNamespace()
+		if ns == "" {
+			ns = namespace
+		}
+		if o.GetKind() != "Service" || o.GetName() != sp.name || ns != sp.namespace {
+			continue
+		}
+		ports, _, _ := unstructured.NestedSlice(o.Object, "spec", "ports")
+		for _, p := range ports {
+			p, ok := p.(map[string]interface{})
+			if ok && fieldString(p, "name") == sp.port {
+				return fieldString(p, "port")
+			}
+		}
+	}
+	return sp.port
+}
+
+// fieldString returns the string or integer field of obj at path as a
+// string, or "" if there is none.
+func fieldString(obj map[string]interface{}, path ...string) string {
+	v, ok, _ := unstructured.NestedFieldNoCopy(obj, path...)
+	if !ok {
+		return ""
+	}
+	switch v := v.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+	return fmt.Sprint(v)
+}
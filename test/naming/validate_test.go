@@ -0,0 +1,261 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package naming
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/testfiles"
+)
+
+func TestValidateName(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "gke-net-recipes-0123456789abcdef0123"},
+		{name: "a"},
+		{name: strings.Repeat("a", MaxNameLength)},
+		{name: strings.Repeat("a", MaxNameLength+1), wantErr: true},
+		{name: "1abc", wantErr: true},
+		{name: "abc-", wantErr: true},
+		{name: "Abc", wantErr: true},
+		{name: "a_b", wantErr: true},
+		{name: "", wantErr: true},
+	} {
+		if err := ValidateName(tc.name); (err != nil) != tc.wantErr {
+			t.Errorf("ValidateName(%q) = %v, want error: %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestNEGName(t *testing.T) {
+	name, truncated := NEGName("ns", "foo", "80")
+	if want := "k8s1-uuuuuuuu-ns-foo-80-hhhhhhhh"; name != want || truncated {
+		t.Errorf("NEGName() = %q, %v, want %q, false", name, truncated, want)
+	}
+
+	name, truncated = NEGName(strings.Repeat("n", 30), strings.Repeat("s", 20), "80")
+	if len(name) != MaxNameLength || !truncated {
+		t.Errorf("NEGName() = %q (%d characters), %v, want %d characters, true", name, len(name), truncated, MaxNameLength)
+	}
+	// Longer fields are shortened more.
+	if !strings.Contains(name, "-"+strings.Repeat("n", 22)+"-"+strings.Repeat("s", 15)+"-8-") {
+		t.Errorf("NEGName() = %q, want fields shortened evenly", name)
+	}
+}
+
+func TestFrontendName(t *testing.T) {
+	name, truncated := FrontendName("um", "ns", "ing")
+	if want := "k8s2-um-uuuuuuuu-ns-ing-hhhhhhhh"; name != want || truncated {
+		t.Errorf("FrontendName() = %q, %v, want %q, false", name, truncated, want)
+	}
+	name, truncated = FrontendName("um", strings.Repeat("n", 40), "ing")
+	if len(name) != MaxNameLength || !truncated {
+		t.Errorf("FrontendName() = %q (%d characters), %v, want %d characters, true", name, len(name), truncated, MaxNameLength)
+	}
+}
+
+func TestGatewayName(t *testing.T) {
+	name, truncated := GatewayName("ns", "store", "8080")
+	if want := "gkegw1-uuuu-ns-store-8080-hhhhhhhhhhhh"; name != want || truncated {
+		t.Errorf("GatewayName() = %q, %v, want %q, false", name, truncated, want)
+	}
+	name, truncated = GatewayName(strings.Repeat("n", 40), "gw")
+	if len(name) != MaxNameLength || !truncated {
+		t.Errorf("GatewayName() = %q (%d characters), %v, want %d characters, true", name, len(name), truncated, MaxNameLength)
+	}
+}
+
+func TestMCIName(t *testing.T) {
+	name, truncated := MCIName("um", "ns", "ing")
+	if want := "mci-hhhhhh-um-ns-ing"; name != want || truncated {
+		t.Errorf("MCIName() = %q, %v, want %q, false", name, truncated, want)
+	}
+	name, truncated = MCIName("8080", strings.Repeat("n", 40), strings.Repeat("s", 20))
+	if len(name) != MaxNameLength || !truncated {
+		t.Errorf("MCIName() = %q (%d characters), %v, want %d characters, true", name, len(name), truncated, MaxNameLength)
+	}
+}
+
+func TestRecipeNames(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "my-recipe")
+	testfiles.Write(t, dir, map[string]string{
+		"setup.sh": `policy=$(get_resource_name "${test_name}" "policy")`,
+		"app.yaml": `
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+spec:
+  defaultBackend:
+    service:
+      name: foo
+      port:
+        name: http
+  rules:
+  - http:
+      paths:
+      - path: /
+        backend:
+          service:
+            name: foo
+            port:
+              number: 8080
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: foo
+  annotations:
+    cloud.google.com/neg: '{"exposed_ports": {"9000": {"name": "custom-neg"}}}'
+spec:
+  ports:
+  - name: http
+    port: 8080
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: nginx
+  annotations:
+    kubernetes.io/ingress.class: nginx
+spec:
+  defaultBackend:
+    service:
+      name: bar
+      port:
+        number: 80
+---
+apiVersion: gateway.networking.k8s.io/v1beta1
+kind: HTTPRoute
+metadata:
+  name: route
+spec:
+  rules:
+  - backendRefs:
+    - name: store
+      namespace: other
+      port: 8080
+`,
+	})
+
+	names, err := RecipeNames(dir)
+	if err != nil {
+		t.Fatalf("RecipeNames() = %v, want nil", err)
+	}
+	got := make(map[string]bool)
+	for _, name := range names {
+		got[name.Name] = true
+		if err := name.Validate(); err != nil {
+			t.Errorf("Validate() = %v, want nil", err)
+		}
+	}
+	suffix := strings.Repeat("0", SuffixLength)
+	for _, want := range []string{
+		"my-recipe",
+		"gke-net-recipes-" + suffix,
+		"gke-net-recipes-" + suffix + "-policy",
+		"proxy-only-" + suffix,
+		"allow-ssh-" + suffix,
+		"k8s2-um-uuuuuuuu-my-recipe-web-hhhhhhhh",
+		"k8s2-fs-uuuuuuuu-my-recipe-web-hhhhhhhh",
+		// The named port is resolved to the same NEG.
+		"k8s1-uuuuuuuu-my-recipe-foo-8080-hhhhhhhh",
+		"custom-neg",
+		"k8s1-uuuuuuuu-other-store-8080-hhhhhhhh",
+	} {
+		if !got[want] {
+			t.Errorf("RecipeNames() = %v, want %q", got, want)
+		}
+	}
+	for name := range got {
+		if strings.Contains(name, "nginx") || strings.Contains(name, "-bar-") {
+			t.Errorf("RecipeNames() = %q, want no names for Ingresses of other classes", name)
+		}
+	}
+}
+
+func TestRecipeNamesTestName(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "a-recipe-with-a-rather-long-name-for-its-namespace")
+	testfiles.Write(t, dir, map[string]string{
+		"setup.sh": "test_name=\"short\"\ncreate_namespace \"${context}\" \"${test_name}\"\n",
+		"app.yaml": `
+apiVersion: networking.k8s.io/v1beta1
+kind: Ingress
+metadata:
+  name: web
+spec:
+  backend:
+    serviceName: foo
+    servicePort: 80
+`,
+	})
+
+	names, err := RecipeNames(dir)
+	if err != nil {
+		t.Fatalf("RecipeNames() = %v, want nil", err)
+	}
+	got := make(map[string]bool)
+	for _, name := range names {
+		got[name.Name] = true
+		if err := name.Validate(); err != nil {
+			t.Errorf("Validate() = %v, want nil", err)
+		}
+	}
+	for _, want := range []string{"short", "k8s2-um-uuuuuuuu-short-web-hhhhhhhh", "k8s1-uuuuuuuu-short-foo-80-hhhhhhhh"} {
+		if !got[want] {
+			t.Errorf("RecipeNames() = %v, want %q", got, want)
+		}
+	}
+}
+
+func TestValidateRecipe(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "a-recipe-with-a-rather-long-name-for-its-namespace")
+	testfiles.Write(t, dir, map[string]string{
+		"setup.sh": `get_resource_name "${test_name}" "a-component-name-that-is-much-too-long"`,
+		"app.yaml": `
+apiVersion: networking.k8s.io/v1beta1
+kind: Ingress
+metadata:
+  name: web
+spec:
+  backend:
+    serviceName: foo
+    servicePort: 80
+`,
+	})
+
+	errs, err := ValidateRecipe(dir)
+	if err != nil {
+		t.Fatalf("ValidateRecipe() = %v, want nil", err)
+	}
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	all := strings.Join(messages, "\n")
+	for _, want := range []string{
+		"more than 63",
+		`"k8s2-um-uuuuuuuu-a-recipe-with-a-rather-long-name-f-we-hhhhhhhh" is truncated`,
+		"NEG and backend service of Service a-recipe-with-a-rather-long-name-for-its-namespace/foo port 80",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("ValidateRecipe() = %s, want an error containing %q", all, want)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package placement applies the manifests of the multi-cluster recipes to the
+// clusters they declare, following the placement declared in their metadata,
+// see recipe.DeclaredPlacement, and checks that the objects are placed on
+// clusters where they work: a ServiceExport with its Service, and the
+// multi-cluster load balancers on the config cluster.
+package placement
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/manifest"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/utils"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// envVarRef matches the references to environment variables in manifests,
+// ${VAR}.
+var envVarRef = regexp.MustCompile(`\$\{([A-Z][A-Z0-9_]*)\}`)
+
+// Kubectl runs kubectl with the given arguments and returns its standard
+// output.
+type Kubectl func(ctx context.Context, args ...string) ([]byte, error)
+
+// ExecKubectl returns a Kubectl executing the kubectl binary in env, in the
+// form "key=value". A nil env uses the environment of the current process.
+func ExecKubectl(env []string) Kubectl {
+	return func(ctx context.Context, args ...string) ([]byte, error) {
+		cmd := exec.CommandContext(ctx, "kubectl", args...)
+		cmd.Env = env
+		out, err := cmd.Output()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return out, fmt.Errorf("kubectl %v: %w: %s", args, err, exitErr.Stderr)
+		}
+		return out, err
+	}
+}
+
+// Step is the application of manifest files to a cluster.
+type Step struct {
+	// Cluster is the name of the declared cluster.
+	Cluster string
+	// Files are the paths of the manifest files.
+	Files []string
+}
+
+// Steps returns the steps applying the manifests of r, in the order of its
+// placement, with the glob patterns expanded.
+func Steps(r *recipe.Recipe) ([]Step, error) {
+	if len(r.Metadata.Placement) == 0 {
+		return nil, fmt.Errorf("recipe %s declares no placement in its %s", r.Path, recipe.MetadataFile)
+	}
+	var steps []Step
+	for _, p := range r.Metadata.Placement {
+		var files []string
+		for _, pattern := range p.Files {
+			matches, err := filepath.Glob(filepath.Join(r.Dir, filepath.FromSlash(pattern)))
+			if err != nil {
+				return nil, err
+			}
+			sort.Strings(matches)
+			files = append(files, matches...)
+		}
+		for _, c := range p.Clusters {
+			steps = append(steps, Step{Cluster: c, Files: files})
+		}
+	}
+	return steps, nil
+}
+
+// Objects returns the objects of the manifests of r placed on each cluster,
+// by cluster name.
+func Objects(r *recipe.Recipe) (map[string][]*manifest.Object, error) {
+	steps, err := Steps(r)
+	if err != nil {
+		return nil, err
+	}
+	objects := make(map[string][]*manifest.Object)
+	for _, s := range steps {
+		for _, file := range s.Files {
+			objs, err := manifest.Load(file)
+			if err != nil {
+				return nil, err
+			}
+			objects[s.Cluster] = append(objects[s.Cluster], objs...)
+		}
+	}
+	return objects, nil
+}
+
+// Validate returns the objects of r placed on clusters where they don't work:
+// ServiceExports without their Service in the same cluster, which export
+// nothing, and MultiClusterIngresses, MultiClusterServices and multi-cluster
+// Gateways outside of the config cluster, which the controllers ignore.
+func Validate(r *recipe.Recipe) ([]error, error) {
+	objects, err := Objects(r)
+	if err != nil {
+		return nil, err
+	}
+	config := r.Metadata.ConfigCluster
+	var errs []error
+	for _, c := range r.Metadata.Clusters {
+		services := make(map[string]bool)
+		for _, o := range objects[c.Name] {
+			if o.GetKind() == "Service" {
+				services[o.GetNamespace()+"/"+o.GetName()] = true
+			}
+		}
+		for _, o := range objects[c.Name] {
+			switch {
+			case o.GetKind() == "ServiceExport" && !services[o.GetNamespace()+"/"+o.GetName()]:
+				errs = append(errs, fmt.Errorf("%s is placed on cluster %s, which has no Service %s to export", o, c.Name, o.GetName()))
+			case c.Name != config && configClusterOnly(o):
+				errs = append(errs, fmt.Errorf("%s is placed on cluster %s, but only the config cluster %s configures multi-cluster load balancers", o, c.Name, config))
+			}
+		}
+	}
+	return errs, nil
+}
+
+// configClusterOnly returns true if the object configures a multi-cluster
+// load balancer, which is only read from the config cluster.
+func configClusterOnly(o *manifest.Object) bool {
+	switch o.GetKind() {
+	case "MultiClusterIngress", "MultiClusterService":
+		return true
+	case "Gateway":
+		className, _, _ := unstructured.NestedString(o.Object, "spec", "gatewayClassName")
+		return strings.HasSuffix(className, "-mc")
+	}
+	return false
+}
+
+// Apply applies the manifests of r to the clusters they are placed on, in
+// order, with kubectl apply. The references of the manifests to the
+// environment variables required by r, ${VAR}, are replaced by their values
+// according to getenv, which must all be set.
+func Apply(ctx context.Context, kubectl Kubectl, clusters map[string]*utils.Cluster, r *recipe.Recipe, getenv func(string) string) error {
+	if missing := r.MissingEnv(getenv); len(missing) > 0 {
+		return fmt.Errorf("recipe %s requires the environment variables %s", r.Path, strings.Join(missing, ", "))
+	}
+	steps, cleanup, err := expand(r, getenv)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	for _, s := range steps {
+		if err := run(ctx, kubectl, clusters, s, "apply"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete deletes the objects of the manifests of r from the clusters they are
+// placed on, in the reverse order. Objects which don't exist are ignored. The
+// references to the environment variables are replaced as by Apply, but may
+// be unset.
+func Delete(ctx context.Context, kubectl Kubectl, clusters map[string]*utils.Cluster, r *recipe.Recipe, getenv func(string) string) error {
+	steps, cleanup, err := expand(r, getenv)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	for i := len(steps) - 1; i >= 0; i-- {
+		if err := run(ctx, kubectl, clusters, steps[i], "delete", "--ignore-not-found"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expand returns the steps of r, where the files referencing the environment
+// variables required by r which are set according to getenv are replaced by
+// expanded copies, in a temporary directory removed by the returned function.
+func expand(r *recipe.Recipe, getenv func(string) string) ([]Step, func(), error) {
+	steps, err := Steps(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	required := make(map[string]bool)
+	for _, v := range r.Metadata.RequiredEnv {
+		required[v] = true
+	}
+	var dir string
+	cleanup := func() {
+		if dir != "" {
+			os.RemoveAll(dir)
+		}
+	}
+	copies := make(map[string]string)
+	for i, s := range steps {
+		files := make([]string, len(s.Files))
+		for j, file := range s.Files {
+			if c, ok := copies[file]; ok {
+				files[j] = c
+				continue
+			}
+			b, err := os.ReadFile(file)
+			if err != nil {
+				cleanup()
+				return nil, nil, err
+			}
+			expanded := envVarRef.ReplaceAllStringFunc(string(b), func(ref string) string {
+				name := envVarRef.FindStringSubmatch(ref)[1]
+				if v := getenv(name); required[name] && v != "" {
+					return v
+				}
+				return ref
+			})
+			copies[file] = file
+			if expanded != string(b) {
+				if dir == "" {
+					if dir, err = os.MkdirTemp("", "placement-"); err != nil {
+						return nil, nil, err
+					}
+				}
+				rel, err := filepath.Rel(r.Dir, file)
+				if err != nil {
+					cleanup()
+					return nil, nil, err
+				}
+				c := filepath.Join(dir, rel)
+				if err := os.MkdirAll(filepath.Dir(c), 0755); err != nil {
+					cleanup()
+					return nil, nil, err
+				}
+				if err := os.WriteFile(c, []byte(expanded), 0644); err != nil {
+					cleanup()
+					return nil, nil, err
+				}
+				copies[file] = c
+			}
+			files[j] = copies[file]
+		}
+		steps[i] = Step{Cluster: s.Cluster, Files: files}
+	}
+	return steps, cleanup, nil
+}
+
+// run runs a kubectl command on the files of a step, in its cluster.
+func run(ctx context.Context, kubectl Kubectl, clusters map[string]*utils.Cluster, s Step, command ...string) error {
+	cluster, ok := clusters[s.Cluster]
+	if !ok {
+		return fmt.Errorf("no cluster %s to place %q on", s.Cluster, s.Files)
+	}
+	args := append([]string{"--kubeconfig=" + cluster.Kubeconfig, "--context=" + cluster.Context}, command...)
+	for _, file := range s.Files {
+		args = append(args, "-f", file)
+	}
+	if _, err := kubectl(ctx, args...); err != nil {
+		return fmt.Errorf("failed to %s %q on cluster %s: %w", command[0], s.Files, s.Cluster, err)
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package placement
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe/recipetest"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/testfiles"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/utils"
+)
+
+// repoRoot is the root of the repository, relative to this package.
+const repoRoot = "../.."
+
+const (
+	app = `
+apiVersion: v1
+kind: Service
+metadata:
+  name: store
+  namespace: store
+---
+apiVersion: net.gke.io/v1
+kind: ServiceExport
+metadata:
+  name: store
+  namespace: store
+`
+	export = `
+apiVersion: net.gke.io/v1
+kind: ServiceExport
+metadata:
+  name: store
+  namespace: store
+`
+	gateway = `
+apiVersion: gateway.networking.k8s.io/v1beta1
+kind: Gateway
+metadata:
+  name: internal
+  namespace: store
+spec:
+  gatewayClassName: gke-l7-rilb-mc
+---
+apiVersion: gateway.networking.k8s.io/v1beta1
+kind: Gateway
+metadata:
+  name: single-cluster
+  namespace: store
+spec:
+  gatewayClassName: gke-l7-rilb
+`
+	ingress = `
+apiVersion: networking.gke.io/v1
+kind: MultiClusterIngress
+metadata:
+  name: store
+  namespace: store
+`
+)
+
+// loadRecipe writes the files of a recipe and loads it.
+func loadRecipe(t *testing.T, files map[string]string) *recipe.Recipe {
+	t.Helper()
+	root := t.TempDir()
+	testfiles.Write(t, filepath.Join(root, "gateway", "mcg"), files)
+	r, err := recipe.Load(root, "gateway/mcg")
+	if err != nil {
+		t.Fatalf("Load() = %v, want nil", err)
+	}
+	return r
+}
+
+const clusters = `
+clusters:
+- name: gke-1
+  region: us-west1
+- name: gke-2
+  region: us-east1
+`
+
+func TestSteps(t *testing.T) {
+	r := loadRecipe(t, map[string]string{
+		"recipe.yaml": clusters + `
+placement:
+- files: [gke-2/*.yaml]
+  clusters: [gke-2]
+- files: [app.yaml, gateway.yaml]
+  clusters: [gke-1, gke-2]
+`,
+		"app.yaml":           app,
+		"gateway.yaml":       gateway,
+		"gke-2/b.yaml":       app,
+		"gke-2/a.yaml":       app,
+		"gke-2/ignored.json": "{}",
+	})
+	steps, err := Steps(r)
+	if err != nil {
+		t.Fatalf("Steps() = %v, want nil", err)
+	}
+	var got []string
+	for _, s := range steps {
+		var files []string
+		for _, f := range s.Files {
+			rel, _ := filepath.Rel(r.Dir, f)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		got = append(got, s.Cluster+": "+strings.Join(files, " "))
+	}
+	want := []string{
+		"gke-2: gke-2/a.yaml gke-2/b.yaml",
+		"gke-1: app.yaml gateway.yaml",
+		"gke-2: app.yaml gateway.yaml",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Steps() = %q, want %q", got, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	r := loadRecipe(t, map[string]string{
+		"recipe.yaml": clusters + `
+placement:
+- files: [app.yaml]
+  clusters: [gke-1]
+- files: [export.yaml, gateway.yaml, ingress.yaml]
+  clusters: [gke-2]
+`,
+		"app.yaml":     app,
+		"export.yaml":  export,
+		"gateway.yaml": gateway,
+		"ingress.yaml": ingress,
+	})
+	errs, err := Validate(r)
+	if err != nil {
+		t.Fatalf("Validate() = %v, want nil", err)
+	}
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+	want := []string{
+		"ServiceExport store (" + filepath.Join(r.Dir, "export.yaml") + ":2) is placed on cluster gke-2, which has no Service store to export",
+		"Gateway internal (" + filepath.Join(r.Dir, "gateway.yaml") + ":2) is placed on cluster gke-2, but only the config cluster gke-1 configures multi-cluster load balancers",
+		"MultiClusterIngress store (" + filepath.Join(r.Dir, "ingress.yaml") + ":2) is placed on cluster gke-2, but only the config cluster gke-1 configures multi-cluster load balancers",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Validate() = %q, want %q", got, want)
+	}
+}
+
+func noEnv(string) string { return "" }
+
+func TestApply(t *testing.T) {
+	r := loadRecipe(t, map[string]string{
+		"recipe.yaml": clusters + `
+placement:
+- files: [app.yaml]
+  clusters: [gke-1, gke-2]
+- files: [ingress.yaml]
+  clusters: [gke-1]
+`,
+		"app.yaml":     app,
+		"ingress.yaml": ingress,
+	})
+	handles := map[string]*utils.Cluster{
+		"gke-1": {Context: "gke-1", Kubeconfig: "kubeconfig"},
+		"gke-2": {Context: "gke-2", Kubeconfig: "kubeconfig"},
+	}
+	var commands []string
+	kubectl := func(_ context.Context, args ...string) ([]byte, error) {
+		cmd := strings.ReplaceAll(strings.Join(args, " "), r.Dir+string(filepath.Separator), "")
+		commands = append(commands, cmd)
+		return nil, nil
+	}
+
+	if err := Apply(context.Background(), kubectl, handles, r, noEnv); err != nil {
+		t.Fatalf("Apply() = %v, want nil", err)
+	}
+	if err := Delete(context.Background(), kubectl, handles, r, noEnv); err != nil {
+		t.Fatalf("Delete() = %v, want nil", err)
+	}
+	want := []string{
+		"--kubeconfig=kubeconfig --context=gke-1 apply -f app.yaml",
+		"--kubeconfig=kubeconfig --context=gke-2 apply -f app.yaml",
+		"--kubeconfig=kubeconfig --context=gke-1 apply -f ingress.yaml",
+		"--kubeconfig=kubeconfig --context=gke-1 delete --ignore-not-found -f ingress.yaml",
+		"--kubeconfig=kubeconfig --context=gke-2 delete --ignore-not-found -f app.yaml",
+		"--kubeconfig=kubeconfig --context=gke-1 delete --ignore-not-found -f app.yaml",
+	}
+	if !reflect.DeepEqual(commands, want) {
+		t.Errorf("kubectl commands = %q, want %q", commands, want)
+	}
+
+	failing := func(context.Context, ...string) ([]byte, error) { return nil, errors.New("connection refused") }
+	if err := Apply(context.Background(), failing, handles, r, noEnv); err == nil || !strings.Contains(err.Error(), "cluster gke-1: connection refused") {
+		t.Errorf("Apply() = %v, want the error of kubectl", err)
+	}
+	delete(handles, "gke-2")
+	commands = nil
+	if err := Apply(context.Background(), kubectl, handles, r, noEnv); err == nil || len(commands) != 1 {
+		t.Errorf("Apply() = %v after %q, want an error for the missing cluster gke-2", err, commands)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	r := loadRecipe(t, map[string]string{
+		"recipe.yaml": clusters + `
+requiredEnv: [BACKEND_IMAGE]
+placement:
+- files: [app.yaml]
+  clusters: [gke-1, gke-2]
+`,
+		"app.yaml": "image: ${BACKEND_IMAGE}\nother: ${OTHER_IMAGE}\n",
+	})
+	handles := map[string]*utils.Cluster{
+		"gke-1": {Context: "gke-1", Kubeconfig: "kubeconfig"},
+		"gke-2": {Context: "gke-2", Kubeconfig: "kubeconfig"},
+	}
+	var applied []string
+	kubectl := func(_ context.Context, args ...string) ([]byte, error) {
+		b, err := os.ReadFile(args[len(args)-1])
+		if err != nil {
+			return nil, err
+		}
+		applied = append(applied, string(b))
+		return nil, nil
+	}
+
+	if err := Apply(context.Background(), kubectl, handles, r, noEnv); err == nil || !strings.Contains(err.Error(), "BACKEND_IMAGE") {
+		t.Errorf("Apply() without BACKEND_IMAGE = %v, want an error for the missing variable", err)
+	}
+	getenv := func(key string) string {
+		return map[string]string{"BACKEND_IMAGE": "backend:v1", "OTHER_IMAGE": "other:v1"}[key]
+	}
+	if err := Apply(context.Background(), kubectl, handles, r, getenv); err != nil {
+		t.Fatalf("Apply() = %v, want nil", err)
+	}
+	// Only the variables required by the recipe are replaced.
+	want := "image: backend:v1\nother: ${OTHER_IMAGE}\n"
+	if !reflect.DeepEqual(applied, []string{want, want}) {
+		t.Errorf("applied manifests = %q, want %q on each cluster", applied, want)
+	}
+	if b, err := os.ReadFile(filepath.Join(r.Dir, "app.yaml")); err != nil || strings.Contains(string(b), "backend:v1") {
+		t.Errorf("app.yaml = %q, %v after Apply(), want it unchanged", b, err)
+	}
+
+	applied = nil
+	if err := Delete(context.Background(), kubectl, handles, r, noEnv); err != nil {
+		t.Fatalf("Delete() without BACKEND_IMAGE = %v, want nil", err)
+	}
+	if want := "image: ${BACKEND_IMAGE}\nother: ${OTHER_IMAGE}\n"; !reflect.DeepEqual(applied, []string{want, want}) {
+		t.Errorf("deleted manifests = %q, want %q on each cluster", applied, want)
+	}
+}
+
+// TestRecipes checks the placement of the manifests of the multi-cluster
+// recipes of the repository.
+func TestRecipes(t *testing.T) {
+	recipetest.ForEach(t, repoRoot, func(t *testing.T, r *recipe.Recipe) {
+		if len(r.Metadata.Placement) == 0 {
+			return
+		}
+		errs, err := Validate(r)
+		if err != nil {
+			t.Fatalf("Validate(%s) = %v, want nil", r.Path, err)
+		}
+		for _, err := range errs {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,153 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/manifest"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// backend is a port of a Service, or of a ServiceImport, used as a backend.
+type backend struct {
+	namespace, name string
+	// port is the number or the name of the port.
+	port string
+}
+
+// hasDefaultBackend returns true if an Ingress has a default backend, in the
+// v1 or the legacy v1beta1 format.
+func hasDefaultBackend(o *manifest.Object) bool {
+	for _, field := range [][]string{{"spec", "defaultBackend"}, {"spec", "backend"}} {
+		if _, ok, _ := unstructured.NestedMap(o.Object, field...); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ingressBackends returns the Service ports used by an Ingress, in the v1 or
+// the legacy v1beta1 format.
+func ingressBackends(o *manifest.Object) []backend {
+	var backends []map[string]interface{}
+	for _, field := range [][]string{{"spec", "defaultBackend"}, {"spec", "backend"}} {
+		if b, ok, _ := unstructured.NestedMap(o.Object, field...); ok {
+			backends = append(backends, b)
+		}
+	}
+	rules, _, _ := unstructured.NestedSlice(o.Object, "spec", "rules")
+	for _, rule := range rules {
+		rule, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		paths, _, _ := unstructured.NestedSlice(rule, "http", "paths")
+		for _, path := range paths {
+			if path, ok := path.(map[string]interface{}); ok {
+				if b, ok, _ := unstructured.NestedMap(path, "backend"); ok {
+					backends = append(backends, b)
+				}
+			}
+		}
+	}
+
+	var ports []backend
+	for _, b := range backends {
+		if svc, ok, _ := unstructured.NestedMap(b, "service"); ok {
+			port := manifest.FieldString(manifest.NestedField(svc, "port", "number"))
+			if port == "" {
+				port = manifest.FieldString(manifest.NestedField(svc, "port", "name"))
+			}
+			ports = append(ports, backend{name: manifest.FieldString(svc["name"]), port: port})
+			continue
+		}
+		if name := manifest.FieldString(b["serviceName"]); name != "" {
+			ports = append(ports, backend{name: name, port: manifest.FieldString(b["servicePort"])})
+		}
+	}
+	return ports
+}
+
+// routeBackends returns the Service and ServiceImport ports used by a Gateway
+// API route: its backendRefs, the backends its requests are mirrored to, and
+// the forwardTo of the v1alpha1 API.
+func routeBackends(o *manifest.Object) []backend {
+	var refs []map[string]interface{}
+	rules, _, _ := unstructured.NestedSlice(o.Object, "spec", "rules")
+	for _, rule := range rules {
+		rule, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var filters []interface{}
+		ruleFilters, _, _ := unstructured.NestedSlice(rule, "filters")
+		filters = append(filters, ruleFilters...)
+		for _, field := range []string{"backendRefs", "forwardTo"} {
+			backendRefs, _, _ := unstructured.NestedSlice(rule, field)
+			for _, ref := range backendRefs {
+				ref, ok := ref.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				refs = append(refs, ref)
+				refFilters, _, _ := unstructured.NestedSlice(ref, "filters")
+				filters = append(filters, refFilters...)
+			}
+		}
+		for _, filter := range filters {
+			if filter, ok := filter.(map[string]interface{}); ok {
+				if ref, ok, _ := unstructured.NestedMap(filter, "requestMirror", "backendRef"); ok {
+					refs = append(refs, ref)
+				}
+			}
+		}
+	}
+
+	var backends []backend
+	for _, ref := range refs {
+		if name := manifest.FieldString(ref["serviceName"]); name != "" {
+			backends = append(backends, backend{name: name, port: manifest.FieldString(ref["port"])})
+			continue
+		}
+		if backendRef, ok, _ := unstructured.NestedMap(ref, "backendRef"); ok {
+			// A v1alpha1 forwardTo with the port outside of its backendRef.
+			backendRef["port"] = ref["port"]
+			ref = backendRef
+		}
+		if kind := manifest.FieldString(ref["kind"]); kind != "" && kind != "Service" && kind != "ServiceImport" {
+			continue
+		}
+		backends = append(backends, backend{namespace: manifest.FieldString(ref["namespace"]), name: manifest.FieldString(ref["name"]), port: manifest.FieldString(ref["port"])})
+	}
+	return backends
+}
+
+func namespaceOr(ref map[string]interface{}, namespace string) string {
+	if ns := manifest.FieldString(ref["namespace"]); ns != "" {
+		return ns
+	}
+	return namespace
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
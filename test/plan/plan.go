@@ -0,0 +1,556 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plan predicts the GCE resources the GKE controllers create for the
+// load balancers of a recipe: its Ingresses, MultiClusterIngresses, Gateways
+// and LoadBalancer Services. The names follow the naming schemes of the
+// controllers, with placeholders for the cluster UIDs and hashes, see
+// test/naming.
+package plan
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/manifest"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/naming"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Types of GCE resources.
+const (
+	ForwardingRule   = "forwardingRule"
+	TargetHTTPProxy  = "targetHttpProxy"
+	TargetHTTPSProxy = "targetHttpsProxy"
+	TargetPool       = "targetPool"
+	URLMap           = "urlMap"
+	BackendService   = "backendService"
+	HealthCheck      = "healthCheck"
+	NEG              = "networkEndpointGroup"
+	InstanceGroup    = "instanceGroup"
+	SSLCertificate   = "sslCertificate"
+)
+
+// Scopes of GCE resources.
+const (
+	Global   = "global"
+	Regional = "regional"
+	Zonal    = "zonal"
+)
+
+// ProxyOnlySubnet is the requirement of the Envoy-based load balancers for a
+// proxy-only subnet.
+const ProxyOnlySubnet = "proxy-only subnet"
+
+// Placeholders for the names derived from the UIDs of the cluster and of the
+// Services.
+var (
+	// nodeHealthCheck is the health check of the nodes, shared by the
+	// LoadBalancer Services of the cluster.
+	nodeHealthCheck = "k8s-" + strings.Repeat("u", 16) + "-node"
+	// instanceGroup is the instance group of the nodes of a zone, used by
+	// the default backend of Ingresses and by internal LoadBalancer
+	// Services.
+	instanceGroup = "k8s-ig--" + strings.Repeat("u", 16)
+)
+
+// Resource is a GCE resource created by a GKE controller.
+type Resource struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Scope string `json:"scope"`
+	// Object is the object the resource is created for, Kind/namespace/name.
+	Object string `json:"object"`
+	// Parent is the ID of the resource using it, e.g. the URL map of a
+	// backend service, or "" for forwarding rules.
+	Parent string `json:"parent,omitempty"`
+	// Note tells e.g. that there is one resource per zone.
+	Note string `json:"note,omitempty"`
+}
+
+// ID returns the ID of the resource, Type/Name.
+func (r Resource) ID() string {
+	return r.Type + "/" + r.Name
+}
+
+// Requirement is something the load balancers of a recipe need, which the
+// controllers don't create.
+type Requirement struct {
+	Name   string `json:"name"`
+	Scope  string `json:"scope"`
+	Object string `json:"object"`
+	// Reason explains why the object needs it.
+	Reason string `json:"reason"`
+}
+
+// Plan is the list of the GCE resources created for a recipe.
+type Plan struct {
+	Recipe       string        `json:"recipe"`
+	Resources    []Resource    `json:"resources"`
+	Requirements []Requirement `json:"requirements,omitempty"`
+}
+
+// ForRecipe returns the plan of the recipe described by d.
+func ForRecipe(d *recipe.Description) *Plan {
+	return New(d.Recipe.Path, d.Recipe.Name(), d.Objects)
+}
+
+// New returns the plan of a recipe with the given objects. Objects without a
+// namespace are deployed in namespace.
+func New(name, namespace string, objects []*manifest.Object) *Plan {
+	p := &planner{
+		plan:      &Plan{Recipe: name, Resources: []Resource{}},
+		namespace: namespace,
+		objects:   objects,
+		seen:      make(map[string]bool),
+	}
+	for _, o := range objects {
+		switch o.GetKind() {
+		case "Ingress":
+			p.addIngress(o)
+		case "MultiClusterIngress":
+			p.addMultiClusterIngress(o)
+		case "Gateway":
+			p.addGateway(o)
+		case "Service":
+			p.addService(o)
+		}
+	}
+	return p.plan
+}
+
+// Count returns the number of resources of the given type.
+func (p *Plan) Count(typ string) int {
+	n := 0
+	for _, r := range p.Resources {
+		if r.Type == typ {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteTable writes the resources and the requirements of the plan as tables.
+func (p *Plan) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tNAME\tSCOPE\tOBJECT\tNOTE")
+	for _, r := range p.Resources {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Type, r.Name, r.Scope, r.Object, r.Note)
+	}
+	if len(p.Requirements) > 0 {
+		fmt.Fprintln(tw, "\nREQUIREMENT\tSCOPE\tOBJECT\tREASON\t")
+		for _, r := range p.Requirements {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t\n", r.Name, r.Scope, r.Object, r.Reason)
+		}
+	}
+	return tw.Flush()
+}
+
+type planner struct {
+	plan      *Plan
+	namespace string
+	objects   []*manifest.Object
+	seen      map[string]bool
+}
+
+// add adds r to the plan, unless a resource with the same ID was already
+// added, and returns its ID.
+func (p *planner) add(r Resource) string {
+	if !p.seen[r.ID()] {
+		p.seen[r.ID()] = true
+		p.plan.Resources = append(p.plan.Resources, r)
+	}
+	return r.ID()
+}
+
+func (p *planner) require(name, scope, object, reason string) {
+	for _, r := range p.plan.Requirements {
+		if r.Name == name && r.Object == object {
+			return
+		}
+	}
+	p.plan.Requirements = append(p.plan.Requirements, Requirement{Name: name, Scope: scope, Object: object, Reason: reason})
+}
+
+func (p *planner) namespaceOf(o *manifest.Object) string {
+	if ns := o.GetNamespace(); ns != "" {
+		return ns
+	}
+	return p.namespace
+}
+
+// object returns the object kind namespace/name of the manifests, or nil.
+func (p *planner) object(kind, namespace, name string) *manifest.Object {
+	for _, o := range p.objects {
+		if o.GetKind() == kind && p.namespaceOf(o) == namespace && o.GetName() == name {
+			return o
+		}
+	}
+	return nil
+}
+
+// addBackend adds the backend service, health check and NEGs of port of the
+// Service namespace/name, named by bsName, and returns the ID of the backend
+// service.
+func (p *planner) addBackend(obj, parent, scope, bsName, namespace, name, port, negNote string) string {
+	bs := p.add(Resource{Type: BackendService, Name: bsName, Scope: scope, Object: obj, Parent: parent})
+	p.add(Resource{Type: HealthCheck, Name: bsName, Scope: scope, Object: obj, Parent: bs})
+	neg, _ := naming.NEGName(namespace, name, port)
+	p.add(Resource{Type: NEG, Name: neg, Scope: Zonal, Object: obj, Parent: bs, Note: negNote})
+	return bs
+}
+
+// addIngress adds the resources of an Ingress handled by the GKE ingress
+// controller.
+func (p *planner) addIngress(o *manifest.Object) {
+	class := recipe.IngressClass(o)
+	if class != "" && class != "gce" && class != "gce-internal" {
+		return
+	}
+	ns := p.namespaceOf(o)
+	obj := objectID(o, ns)
+	scope := Global
+	if class == "gce-internal" {
+		scope = Regional
+		p.require(ProxyOnlySubnet, Regional, obj, "internal Ingresses are served by Envoy proxies in the proxy-only subnet of the region")
+	}
+	name := func(resource string) string {
+		n, _ := naming.FrontendName(resource, ns, o.GetName())
+		return n
+	}
+
+	annotations := o.GetAnnotations()
+	tls, _, _ := unstructured.NestedSlice(o.Object, "spec", "tls")
+	managed := splitList(annotations["networking.gke.io/managed-certificates"])
+	https := len(tls) > 0 || len(managed) > 0 || annotations["ingress.gcp.kubernetes.io/pre-shared-cert"] != ""
+	redirect := false
+	if fc := p.object("FrontendConfig", ns, annotations["networking.gke.io/v1beta1.FrontendConfig"]); fc != nil {
+		redirect, _, _ = unstructured.NestedBool(fc.Object, "spec", "redirectToHttps", "enabled")
+	}
+
+	um := URLMap + "/" + name("um")
+	if annotations["kubernetes.io/ingress.allow-http"] != "false" {
+		fr := p.add(Resource{Type: ForwardingRule, Name: name("fr"), Scope: scope, Object: obj})
+		tp := p.add(Resource{Type: TargetHTTPProxy, Name: name("tp"), Scope: scope, Object: obj, Parent: fr})
+		if redirect && https {
+			p.add(Resource{Type: URLMap, Name: name("rm"), Scope: scope, Object: obj, Parent: tp, Note: "redirects to HTTPS"})
+		} else {
+			p.add(Resource{Type: URLMap, Name: name("um"), Scope: scope, Object: obj, Parent: tp})
+		}
+	}
+	if https {
+		fs := p.add(Resource{Type: ForwardingRule, Name: name("fs"), Scope: scope, Object: obj})
+		ts := p.add(Resource{Type: TargetHTTPSProxy, Name: name("ts"), Scope: scope, Object: obj, Parent: fs})
+		p.add(Resource{Type: URLMap, Name: name("um"), Scope: scope, Object: obj, Parent: ts})
+		if len(tls) > 0 {
+			p.add(Resource{Type: SSLCertificate, Name: name("cr"), Scope: scope, Object: obj, Parent: ts, Note: "one per TLS Secret"})
+		}
+		for _, cert := range managed {
+			p.add(Resource{
+				Type:   SSLCertificate,
+				Name:   fmt.Sprintf("mcrt-<uid of %s/%s>", ns, cert),
+				Scope:  Global,
+				Object: "ManagedCertificate/" + ns + "/" + cert,
+				Parent: ts,
+				Note:   "Google-managed certificate",
+			})
+		}
+	}
+
+	backends := ingressBackends(o)
+	if !hasDefaultBackend(o) {
+		// Ingresses without a default backend use the default backend of
+		// the cluster, served by the instance groups of the nodes.
+		bsName, _ := naming.NEGName("kube-system", "default-http-backend", "80")
+		bs := p.add(Resource{Type: BackendService, Name: bsName, Scope: scope, Object: obj, Parent: um, Note: "default backend of the cluster"})
+		p.add(Resource{Type: HealthCheck, Name: bsName, Scope: scope, Object: obj, Parent: bs})
+		p.add(Resource{Type: InstanceGroup, Name: instanceGroup, Scope: Zonal, Object: obj, Parent: bs, Note: "one per zone of the cluster"})
+	}
+	for _, b := range backends {
+		port := p.resolvePort("Service", ns, b.name, b.port)
+		bsName, _ := naming.NEGName(ns, b.name, port)
+		p.addBackend(obj, um, scope, bsName, ns, b.name, port, "one per zone of the cluster")
+	}
+}
+
+// addMultiClusterIngress adds the resources of a MultiClusterIngress, which
+// are global and external.
+func (p *planner) addMultiClusterIngress(o *manifest.Object) {
+	ns := p.namespaceOf(o)
+	obj := objectID(o, ns)
+	name := func(resource string) string {
+		n, _ := naming.MCIName(resource, ns, o.GetName())
+		return n
+	}
+	tls, _, _ := unstructured.NestedSlice(o.Object, "spec", "template", "spec", "tls")
+	https := len(tls) > 0 || o.GetAnnotations()["networking.gke.io/pre-shared-certs"] != ""
+
+	fw := p.add(Resource{Type: ForwardingRule, Name: name("fw"), Scope: Global, Object: obj})
+	tp := p.add(Resource{Type: TargetHTTPProxy, Name: name("tp"), Scope: Global, Object: obj, Parent: fw})
+	um := p.add(Resource{Type: URLMap, Name: name("um"), Scope: Global, Object: obj, Parent: tp})
+	if https {
+		fws := p.add(Resource{Type: ForwardingRule, Name: name("fws"), Scope: Global, Object: obj})
+		tps := p.add(Resource{Type: TargetHTTPSProxy, Name: name("tps"), Scope: Global, Object: obj, Parent: fws})
+		p.add(Resource{Type: URLMap, Name: name("um"), Scope: Global, Object: obj, Parent: tps})
+		if len(tls) > 0 {
+			p.add(Resource{Type: SSLCertificate, Name: name("cr"), Scope: Global, Object: obj, Parent: tps, Note: "one per TLS Secret"})
+		}
+	}
+
+	var backends []map[string]interface{}
+	if b, ok, _ := unstructured.NestedMap(o.Object, "spec", "template", "spec", "backend"); ok {
+		backends = append(backends, b)
+	}
+	rules, _, _ := unstructured.NestedSlice(o.Object, "spec", "template", "spec", "rules")
+	for _, rule := range rules {
+		rule, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		paths, _, _ := unstructured.NestedSlice(rule, "http", "paths")
+		for _, path := range paths {
+			if path, ok := path.(map[string]interface{}); ok {
+				if b, ok, _ := unstructured.NestedMap(path, "backend"); ok {
+					backends = append(backends, b)
+				}
+			}
+		}
+	}
+	for _, b := range backends {
+		mcs := manifest.FieldString(b["serviceName"])
+		port := p.resolvePort("MultiClusterService", ns, mcs, manifest.FieldString(b["servicePort"]))
+		bsName, _ := naming.MCIName(port, ns, mcs)
+		p.addBackend(obj, um, Global, bsName, ns, mcs, port, "one per zone of each cluster of the MultiClusterService")
+	}
+}
+
+// gatewayClass is a GatewayClass of GKE.
+type gatewayClass struct {
+	scope string
+	// subnet is the scope of the proxy-only subnet the class needs, or "".
+	subnet string
+	reason string
+}
+
+// gatewayClasses are the GatewayClasses of GKE, without the -mc suffix of
+// their multi-cluster variants.
+var gatewayClasses = map[string]gatewayClass{
+	"gke-l7-gxlb":                            {scope: Global},
+	"gke-l7-global-external-managed":         {scope: Global},
+	"gke-l7-rilb":                            {scope: Regional, subnet: Regional, reason: "internal Gateways are served by Envoy proxies in the proxy-only subnet of the region"},
+	"gke-l7-regional-external-managed":       {scope: Regional, subnet: Regional, reason: "regional external Gateways are served by Envoy proxies in the proxy-only subnet of the region"},
+	"gke-l7-cross-regional-internal-managed": {scope: Global, subnet: Global, reason: "cross-regional internal Gateways need a proxy-only subnet with the GLOBAL_MANAGED_PROXY purpose in each region"},
+}
+
+// addGateway adds the resources of a Gateway of a GKE GatewayClass, and of
+// the backends of the routes attached to it.
+func (p *planner) addGateway(o *manifest.Object) {
+	if !recipe.IsGatewayAPI(o) {
+		return
+	}
+	className, _, _ := unstructured.NestedString(o.Object, "spec", "gatewayClassName")
+	multiCluster := strings.HasSuffix(className, "-mc")
+	class, ok := gatewayClasses[strings.TrimSuffix(className, "-mc")]
+	if !ok {
+		return
+	}
+	ns := p.namespaceOf(o)
+	obj := objectID(o, ns)
+	if class.subnet != "" {
+		p.require(ProxyOnlySubnet, class.subnet, obj, class.reason)
+	}
+
+	umName, _ := naming.GatewayName(ns, o.GetName())
+	um := URLMap + "/" + umName
+	listeners, _, _ := unstructured.NestedSlice(o.Object, "spec", "listeners")
+	for _, l := range listeners {
+		l, ok := l.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		// The names of the forwarding rules and target proxies only differ
+		// by their hash, the port of the listener tells them apart.
+		port := manifest.FieldString(l["port"])
+		frName, _ := naming.GatewayName(ns, o.GetName(), port)
+		fr := p.add(Resource{Type: ForwardingRule, Name: frName, Scope: class.scope, Object: obj})
+		proxyType := TargetHTTPProxy
+		if manifest.FieldString(l["protocol"]) == "HTTPS" {
+			proxyType = TargetHTTPSProxy
+		}
+		tp := p.add(Resource{Type: proxyType, Name: frName, Scope: class.scope, Object: obj, Parent: fr})
+		p.add(Resource{Type: URLMap, Name: umName, Scope: class.scope, Object: obj, Parent: tp})
+		refs, _, _ := unstructured.NestedSlice(l, "tls", "certificateRefs")
+		for _, ref := range refs {
+			ref, ok := ref.(map[string]interface{})
+			if !ok || (manifest.FieldString(ref["kind"]) != "" && manifest.FieldString(ref["kind"]) != "Secret") {
+				continue
+			}
+			certName, _ := naming.GatewayName(namespaceOr(ref, ns), manifest.FieldString(ref["name"]))
+			p.add(Resource{Type: SSLCertificate, Name: certName, Scope: class.scope, Object: obj, Parent: tp})
+		}
+	}
+
+	for _, route := range p.routes(o, ns) {
+		routeNS := p.namespaceOf(route)
+		for _, b := range routeBackends(route) {
+			backendNS := b.namespace
+			if backendNS == "" {
+				backendNS = routeNS
+			}
+			port := p.resolvePort("Service", backendNS, b.name, b.port)
+			bsName, _ := naming.GatewayName(backendNS, b.name, port)
+			note := "one per zone of the cluster"
+			if multiCluster {
+				note = "one per zone of each cluster exporting the Service"
+			}
+			p.addBackend(objectID(route, routeNS), um, class.scope, bsName, backendNS, b.name, port, note)
+		}
+	}
+}
+
+// routes returns the HTTPRoutes and GRPCRoutes attached to a Gateway, by
+// their parentRefs or, in the v1alpha1 API, selected by its listeners and
+// allowing it. A Gateway without a namespace in its manifest is referenced
+// from any namespace, as the namespace it is deployed in is not known.
+func (p *planner) routes(gw *manifest.Object, ns string) []*manifest.Object {
+	isGateway := func(ref map[string]interface{}, routeNS string) bool {
+		if kind := manifest.FieldString(ref["kind"]); kind != "" && kind != "Gateway" {
+			return false
+		}
+		return manifest.FieldString(ref["name"]) == gw.GetName() && (gw.GetNamespace() == "" || namespaceOr(ref, routeNS) == ns)
+	}
+	var listeners []map[string]interface{}
+	specListeners, _, _ := unstructured.NestedSlice(gw.Object, "spec", "listeners")
+	for _, l := range specListeners {
+		if l, ok := l.(map[string]interface{}); ok {
+			if routes, ok, _ := unstructured.NestedMap(l, "routes"); ok {
+				listeners = append(listeners, routes)
+			}
+		}
+	}
+
+	var routes []*manifest.Object
+	for _, o := range p.objects {
+		if (o.GetKind() != "HTTPRoute" && o.GetKind() != "GRPCRoute") || !recipe.IsGatewayAPI(o) {
+			continue
+		}
+		routeNS := p.namespaceOf(o)
+		attached := false
+		parents, _, _ := unstructured.NestedSlice(o.Object, "spec", "parentRefs")
+		for _, ref := range parents {
+			if ref, ok := ref.(map[string]interface{}); ok && isGateway(ref, routeNS) {
+				attached = true
+			}
+		}
+		if p.allowsGateway(o, isGateway) {
+			for _, l := range listeners {
+				if kind := manifest.FieldString(l["kind"]); kind != "" && kind != o.GetKind() {
+					continue
+				}
+				labels, _, _ := unstructured.NestedStringMap(l, "selector", "matchLabels")
+				from, _, _ := unstructured.NestedString(l, "namespaces", "from")
+				if (from == "All" || routeNS == ns || gw.GetNamespace() == "") && manifest.MatchLabels(o.GetLabels(), labels) {
+					attached = true
+				}
+			}
+		}
+		if attached {
+			routes = append(routes, o)
+		}
+	}
+	return routes
+}
+
+// allowsGateway returns true if a v1alpha1 route allows the Gateways for which
+// isGateway returns true, by its spec.gateways.
+func (p *planner) allowsGateway(route *manifest.Object, isGateway func(ref map[string]interface{}, routeNS string) bool) bool {
+	if _, ok, _ := unstructured.NestedFieldNoCopy(route.Object, "spec", "parentRefs"); ok {
+		return false
+	}
+	allow, _, _ := unstructured.NestedString(route.Object, "spec", "gateways", "allow")
+	if allow != "FromList" {
+		return true
+	}
+	refs, _, _ := unstructured.NestedSlice(route.Object, "spec", "gateways", "gatewayRefs")
+	for _, ref := range refs {
+		if ref, ok := ref.(map[string]interface{}); ok && isGateway(ref, p.namespaceOf(route)) {
+			return true
+		}
+	}
+	return false
+}
+
+// addService adds the resources of a LoadBalancer Service, an internal or
+// external passthrough Network Load Balancer. Their names are derived from
+// the UID of the Service.
+func (p *planner) addService(o *manifest.Object) {
+	if typ, _, _ := unstructured.NestedString(o.Object, "spec", "type"); typ != "LoadBalancer" {
+		return
+	}
+	ns := p.namespaceOf(o)
+	obj := objectID(o, ns)
+	name := fmt.Sprintf("a<uid of %s/%s>", ns, o.GetName())
+	healthCheck, note := nodeHealthCheck, "shared by the LoadBalancer Services of the cluster"
+	if policy, _, _ := unstructured.NestedString(o.Object, "spec", "externalTrafficPolicy"); policy == "Local" {
+		healthCheck, note = name, ""
+	}
+
+	fr := p.add(Resource{Type: ForwardingRule, Name: name, Scope: Regional, Object: obj})
+	annotations := o.GetAnnotations()
+	if annotations["networking.gke.io/load-balancer-type"] == "Internal" || annotations["cloud.google.com/load-balancer-type"] == "Internal" {
+		bs := p.add(Resource{Type: BackendService, Name: name, Scope: Regional, Object: obj, Parent: fr})
+		p.add(Resource{Type: HealthCheck, Name: healthCheck, Scope: Global, Object: obj, Parent: bs, Note: note})
+		p.add(Resource{Type: InstanceGroup, Name: instanceGroup, Scope: Zonal, Object: obj, Parent: bs, Note: "one per zone of the cluster"})
+		return
+	}
+	tp := p.add(Resource{Type: TargetPool, Name: name, Scope: Regional, Object: obj, Parent: fr})
+	if note != "" {
+		note += ", "
+	}
+	p.add(Resource{Type: HealthCheck, Name: healthCheck, Scope: Global, Object: obj, Parent: tp, Note: note + "legacy HTTP health check"})
+}
+
+// resolvePort returns the number of the port of the Service or
+// MultiClusterService kind namespace/name, looking up named ports in the
+// manifests. Unresolved port names are returned as is.
+func (p *planner) resolvePort(kind, namespace, name, port string) string {
+	if _, err := strconv.Atoi(port); err == nil {
+		return port
+	}
+	svc := p.object(kind, namespace, name)
+	if svc == nil {
+		return port
+	}
+	field := []string{"spec", "ports"}
+	if kind == "MultiClusterService" {
+		field = []string{"spec", "template", "spec", "ports"}
+	}
+	ports, _, _ := unstructured.NestedSlice(svc.Object, field...)
+	for _, sp := range ports {
+		if sp, ok := sp.(map[string]interface{}); ok && manifest.FieldString(sp["name"]) == port {
+			return manifest.FieldString(sp["port"])
+		}
+	}
+	return port
+}
+
+// objectID returns the ID of an object deployed in namespace,
+// Kind/namespace/name.
+func objectID(o *manifest.Object, namespace string) string {
+	return o.GetKind() + "/" + namespace + "/" + o.GetName()
+}
@@ -0,0 +1,337 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/manifest"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe/recipetest"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// repoRoot is the root of the repository, relative to this package.
+const repoRoot = "../.."
+
+func newPlan(t *testing.T, manifests string) *Plan {
+	t.Helper()
+	objects, err := manifest.Parse("test.yaml", []byte(manifests))
+	if err != nil {
+		t.Fatalf("Parse() = %v, want nil", err)
+	}
+	return New("ingress/my-recipe", "my-recipe", objects)
+}
+
+// resources returns the IDs of the resources of p, with their parent.
+func resources(p *Plan) map[string]string {
+	ids := make(map[string]string)
+	for _, r := range p.Resources {
+		ids[r.ID()] = r.Parent
+	}
+	return ids
+}
+
+func TestIngress(t *testing.T) {
+	p := newPlan(t, `
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+  annotations:
+    networking.gke.io/managed-certificates: cert
+    networking.gke.io/v1beta1.FrontendConfig: redirect
+spec:
+  defaultBackend:
+    service:
+      name: foo
+      port:
+        name: http
+---
+apiVersion: networking.gke.io/v1beta1
+kind: FrontendConfig
+metadata:
+  name: redirect
+spec:
+  redirectToHttps:
+    enabled: true
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: foo
+spec:
+  ports:
+  - name: http
+    port: 8080
+`)
+	want := map[string]string{
+		"forwardingRule/k8s2-fr-uuuuuuuu-my-recipe-web-hhhhhhhh":         "",
+		"targetHttpProxy/k8s2-tp-uuuuuuuu-my-recipe-web-hhhhhhhh":        "forwardingRule/k8s2-fr-uuuuuuuu-my-recipe-web-hhhhhhhh",
+		"urlMap/k8s2-rm-uuuuuuuu-my-recipe-web-hhhhhhhh":                 "targetHttpProxy/k8s2-tp-uuuuuuuu-my-recipe-web-hhhhhhhh",
+		"forwardingRule/k8s2-fs-uuuuuuuu-my-recipe-web-hhhhhhhh":         "",
+		"targetHttpsProxy/k8s2-ts-uuuuuuuu-my-recipe-web-hhhhhhhh":       "forwardingRule/k8s2-fs-uuuuuuuu-my-recipe-web-hhhhhhhh",
+		"urlMap/k8s2-um-uuuuuuuu-my-recipe-web-hhhhhhhh":                 "targetHttpsProxy/k8s2-ts-uuuuuuuu-my-recipe-web-hhhhhhhh",
+		"sslCertificate/mcrt-<uid of my-recipe/cert>":                    "targetHttpsProxy/k8s2-ts-uuuuuuuu-my-recipe-web-hhhhhhhh",
+		"backendService/k8s1-uuuuuuuu-my-recipe-foo-8080-hhhhhhhh":       "urlMap/k8s2-um-uuuuuuuu-my-recipe-web-hhhhhhhh",
+		"healthCheck/k8s1-uuuuuuuu-my-recipe-foo-8080-hhhhhhhh":          "backendService/k8s1-uuuuuuuu-my-recipe-foo-8080-hhhhhhhh",
+		"networkEndpointGroup/k8s1-uuuuuuuu-my-recipe-foo-8080-hhhhhhhh": "backendService/k8s1-uuuuuuuu-my-recipe-foo-8080-hhhhhhhh",
+	}
+	got := resources(p)
+	for id, parent := range want {
+		if gotParent, ok := got[id]; !ok || gotParent != parent {
+			t.Errorf("New() has %s with parent %q (%v), want parent %q", id, gotParent, ok, parent)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("New() = %v, want %d resources", got, len(want))
+	}
+	if len(p.Requirements) != 0 {
+		t.Errorf("New() = %v, want no requirements", p.Requirements)
+	}
+}
+
+func TestInternalIngress(t *testing.T) {
+	p := newPlan(t, `
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+  annotations:
+    kubernetes.io/ingress.class: "gce-internal"
+spec:
+  rules:
+  - http:
+      paths:
+      - path: /
+        pathType: Prefix
+        backend:
+          service:
+            name: foo
+            port:
+              number: 80
+`)
+	if got := p.Count(BackendService); got != 2 {
+		t.Errorf("Count(%s) = %d, want 2, the default backend and foo", BackendService, got)
+	}
+	if got := p.Count(InstanceGroup); got != 1 {
+		t.Errorf("Count(%s) = %d, want 1 for the default backend", InstanceGroup, got)
+	}
+	for _, r := range p.Resources {
+		if r.Scope == Global {
+			t.Errorf("New() = %+v, want no global resources", r)
+		}
+	}
+	if len(p.Requirements) != 1 || p.Requirements[0].Name != ProxyOnlySubnet || p.Requirements[0].Scope != Regional {
+		t.Errorf("New() = %v, want a regional proxy-only subnet", p.Requirements)
+	}
+}
+
+func TestIgnoredIngress(t *testing.T) {
+	p := newPlan(t, `
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+spec:
+  ingressClassName: nginx
+`)
+	if len(p.Resources) != 0 {
+		t.Errorf("New() = %v, want no resources for an nginx Ingress", p.Resources)
+	}
+}
+
+func TestGateway(t *testing.T) {
+	p := newPlan(t, `
+apiVersion: gateway.networking.k8s.io/v1beta1
+kind: Gateway
+metadata:
+  name: gw
+spec:
+  gatewayClassName: gke-l7-rilb-mc
+  listeners:
+  - name: http
+    protocol: HTTP
+    port: 80
+  - name: https
+    protocol: HTTPS
+    port: 443
+    tls:
+      certificateRefs:
+      - name: cert
+---
+apiVersion: gateway.networking.k8s.io/v1beta1
+kind: HTTPRoute
+metadata:
+  name: route
+spec:
+  parentRefs:
+  - name: gw
+  rules:
+  - backendRefs:
+    - group: net.gke.io
+      kind: ServiceImport
+      name: store
+      port: 8080
+    filters:
+    - type: RequestMirror
+      requestMirror:
+        backendRef:
+          name: shadow
+          port: 8080
+---
+apiVersion: gateway.networking.k8s.io/v1beta1
+kind: HTTPRoute
+metadata:
+  name: other
+spec:
+  parentRefs:
+  - name: other-gw
+  rules:
+  - backendRefs:
+    - name: unused
+      port: 80
+`)
+	got := resources(p)
+	for id, parent := range map[string]string{
+		"forwardingRule/gkegw1-uuuu-my-recipe-gw-80-hhhhhhhhhhhh":          "",
+		"targetHttpProxy/gkegw1-uuuu-my-recipe-gw-80-hhhhhhhhhhhh":         "forwardingRule/gkegw1-uuuu-my-recipe-gw-80-hhhhhhhhhhhh",
+		"targetHttpsProxy/gkegw1-uuuu-my-recipe-gw-443-hhhhhhhhhhhh":       "forwardingRule/gkegw1-uuuu-my-recipe-gw-443-hhhhhhhhhhhh",
+		"sslCertificate/gkegw1-uuuu-my-recipe-cert-hhhhhhhhhhhh":           "targetHttpsProxy/gkegw1-uuuu-my-recipe-gw-443-hhhhhhhhhhhh",
+		"urlMap/gkegw1-uuuu-my-recipe-gw-hhhhhhhhhhhh":                     "targetHttpProxy/gkegw1-uuuu-my-recipe-gw-80-hhhhhhhhhhhh",
+		"backendService/gkegw1-uuuu-my-recipe-store-8080-hhhhhhhhhhhh":     "urlMap/gkegw1-uuuu-my-recipe-gw-hhhhhhhhhhhh",
+		"backendService/gkegw1-uuuu-my-recipe-shadow-8080-hhhhhhhhhhhh":    "urlMap/gkegw1-uuuu-my-recipe-gw-hhhhhhhhhhhh",
+		"networkEndpointGroup/k8s1-uuuuuuuu-my-recipe-store-8080-hhhhhhhh": "backendService/gkegw1-uuuu-my-recipe-store-8080-hhhhhhhhhhhh",
+	} {
+		if gotParent, ok := got[id]; !ok || gotParent != parent {
+			t.Errorf("New() has %s with parent %q (%v), want parent %q", id, gotParent, ok, parent)
+		}
+	}
+	for id := range got {
+		if strings.Contains(id, "unused") {
+			t.Errorf("New() has %s, want no backends of routes attached to other Gateways", id)
+		}
+	}
+	for _, r := range p.Resources {
+		if r.Scope == Global {
+			t.Errorf("New() = %+v, want no global resources", r)
+		}
+	}
+	if len(p.Requirements) != 1 || p.Requirements[0].Name != ProxyOnlySubnet {
+		t.Errorf("New() = %v, want a proxy-only subnet", p.Requirements)
+	}
+}
+
+func TestService(t *testing.T) {
+	p := newPlan(t, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: ilb
+  annotations:
+    networking.gke.io/load-balancer-type: "Internal"
+spec:
+  type: LoadBalancer
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: nlb
+spec:
+  type: LoadBalancer
+  externalTrafficPolicy: Local
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: cluster-ip
+`)
+	got := resources(p)
+	for id, parent := range map[string]string{
+		"forwardingRule/a<uid of my-recipe/ilb>": "",
+		"backendService/a<uid of my-recipe/ilb>": "forwardingRule/a<uid of my-recipe/ilb>",
+		"healthCheck/" + nodeHealthCheck:         "backendService/a<uid of my-recipe/ilb>",
+		"forwardingRule/a<uid of my-recipe/nlb>": "",
+		"targetPool/a<uid of my-recipe/nlb>":     "forwardingRule/a<uid of my-recipe/nlb>",
+		"healthCheck/a<uid of my-recipe/nlb>":    "targetPool/a<uid of my-recipe/nlb>",
+	} {
+		if gotParent, ok := got[id]; !ok || gotParent != parent {
+			t.Errorf("New() has %s with parent %q (%v), want parent %q", id, gotParent, ok, parent)
+		}
+	}
+	if got := p.Count(ForwardingRule); got != 2 {
+		t.Errorf("Count(%s) = %d, want 2", ForwardingRule, got)
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	p := newPlan(t, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: foo
+  annotations:
+    networking.gke.io/load-balancer-type: "Internal"
+spec:
+  type: LoadBalancer
+`)
+	var b bytes.Buffer
+	if err := p.WriteTable(&b); err != nil {
+		t.Fatalf("WriteTable() = %v, want nil", err)
+	}
+	for _, want := range []string{"TYPE ", "forwardingRule  ", "a<uid of my-recipe/foo>", "Service/my-recipe/foo"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("WriteTable() = %s, want it to contain %q", b.String(), want)
+		}
+	}
+}
+
+// TestRecipes checks the plans of the recipes of the repository: the
+// Gateways of the GKE GatewayClasses and the GCE Ingresses have forwarding
+// rules, and the backend services are named after their Service.
+func TestRecipes(t *testing.T) {
+	recipetest.ForEachDescribed(t, repoRoot, func(t *testing.T, d *recipe.Description) {
+		p := ForRecipe(d)
+		frontends := make(map[string]bool)
+		for _, res := range p.Resources {
+			if res.Type == ForwardingRule {
+				frontends[res.Object] = true
+			}
+			if res.Type == BackendService && strings.Contains(res.Name, "--") {
+				t.Errorf("ForRecipe() has %s, want a backend service named after its Service", res.ID())
+			}
+		}
+		for _, o := range d.Objects {
+			var gce bool
+			switch o.GetKind() {
+			case "Ingress":
+				class := recipe.IngressClass(o)
+				gce = class == "" || strings.HasPrefix(class, "gce")
+			case "Gateway":
+				class, _, _ := unstructured.NestedString(o.Object, "spec", "gatewayClassName")
+				gce = recipe.IsGatewayAPI(o) && strings.HasPrefix(class, "gke-l7-")
+			}
+			ns := o.GetNamespace()
+			if ns == "" {
+				ns = d.Recipe.Name()
+			}
+			if gce && !frontends[objectID(o, ns)] {
+				t.Errorf("ForRecipe() has no forwarding rule for %s", o)
+			}
+		}
+	})
+}
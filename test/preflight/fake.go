@@ -0,0 +1,116 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// FakeProject is an in-memory Project.
+type FakeProject struct {
+	mu sync.Mutex
+	// Project is the ID of the project.
+	Project string
+	// APIs are the enabled APIs.
+	APIs []string
+	// Roles are the permissions of each known role.
+	Roles map[string][]string
+	// Permissions are the permissions granted to the caller.
+	Permissions []string
+	// RegionQuotas are the quotas by region, "" for the project.
+	RegionQuotas map[string][]Quota
+	// Errors makes the methods of the Project interface with the given
+	// names fail, e.g. "GrantedPermissions".
+	Errors map[string]error
+	// Calls counts the calls of the methods of the Project interface by
+	// name.
+	Calls map[string]int
+}
+
+// NewFakeProject returns a FakeProject with the given ID, without any API,
+// role or quota.
+func NewFakeProject(id string) *FakeProject {
+	return &FakeProject{
+		Project:      id,
+		Roles:        make(map[string][]string),
+		RegionQuotas: make(map[string][]Quota),
+		Errors:       make(map[string]error),
+		Calls:        make(map[string]int),
+	}
+}
+
+func (f *FakeProject) call(method string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Calls[method]++
+	return f.Errors[method]
+}
+
+// ID implements Project.
+func (f *FakeProject) ID() string {
+	return f.Project
+}
+
+// EnabledAPIs implements Project.
+func (f *FakeProject) EnabledAPIs(context.Context) ([]string, error) {
+	if err := f.call("EnabledAPIs"); err != nil {
+		return nil, err
+	}
+	return f.APIs, nil
+}
+
+// Grant grants the permissions of roles to the caller.
+func (f *FakeProject) Grant(roles ...string) {
+	for _, role := range roles {
+		f.Permissions = append(f.Permissions, f.Roles[role]...)
+	}
+}
+
+// RolePermissions implements Project.
+func (f *FakeProject) RolePermissions(_ context.Context, role string) ([]string, error) {
+	if err := f.call("RolePermissions"); err != nil {
+		return nil, err
+	}
+	permissions, ok := f.Roles[role]
+	if !ok {
+		return nil, fmt.Errorf("role %s not found", role)
+	}
+	return permissions, nil
+}
+
+// GrantedPermissions implements Project.
+func (f *FakeProject) GrantedPermissions(_ context.Context, permissions []string) ([]string, error) {
+	if err := f.call("GrantedPermissions"); err != nil {
+		return nil, err
+	}
+	granted := toSet(f.Permissions)
+	var result []string
+	for _, permission := range permissions {
+		if granted[permission] {
+			result = append(result, permission)
+		}
+	}
+	return result, nil
+}
+
+// Quotas implements Project.
+func (f *FakeProject) Quotas(_ context.Context, region string) ([]Quota, error) {
+	if err := f.call("Quotas"); err != nil {
+		return nil, err
+	}
+	return f.RegionQuotas[region], nil
+}
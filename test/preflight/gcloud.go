@@ -0,0 +1,175 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package preflight
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/sweeper"
+)
+
+// GcloudProject is a Project backed by gcloud.
+type GcloudProject struct {
+	// Run runs gcloud.
+	Run sweeper.Runner
+	// Project is the ID of the project.
+	Project string
+	// Client sends the requests to the Resource Manager API. Nil uses
+	// http.DefaultClient.
+	Client *http.Client
+	// Endpoint is the URL of the Resource Manager API. Empty uses
+	// resourceManagerEndpoint.
+	Endpoint string
+}
+
+// resourceManagerEndpoint is the URL of the Resource Manager API, whose
+// testIamPermissions method tells the permissions the caller has on a
+// project, there being no gcloud command for it.
+const resourceManagerEndpoint = "https://cloudresourcemanager.googleapis.com"
+
+// GcloudProjects returns the projects the prerequisites of the recipe
+// described by d apply to, backed by gcloud, keyed by the environment
+// variables holding them, whose values are looked up with getenv. The
+// projects whose variable is empty are left out.
+func GcloudProjects(run sweeper.Runner, getenv func(string) string, d *recipe.Description) map[string]Project {
+	projects := make(map[string]Project)
+	for _, p := range d.Prerequisites {
+		projectVar := p.Project
+		if projectVar == "" {
+			projectVar = DefaultProject
+		}
+		if id := getenv(projectVar); id != "" {
+			projects[projectVar] = &GcloudProject{Run: run, Project: id}
+		}
+	}
+	return projects
+}
+
+// ID implements Project.
+func (g *GcloudProject) ID() string {
+	return g.Project
+}
+
+// EnabledAPIs implements Project.
+func (g *GcloudProject) EnabledAPIs(ctx context.Context) ([]string, error) {
+	out, err := g.Run(ctx, "services", "list", "--enabled", "--project="+g.Project, "--format=value(config.name)")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// RolePermissions implements Project.
+func (g *GcloudProject) RolePermissions(ctx context.Context, role string) ([]string, error) {
+	out, err := g.Run(ctx, "iam", "roles", "describe", role, "--format=json(includedPermissions)")
+	if err != nil {
+		return nil, err
+	}
+	var r struct {
+		IncludedPermissions []string `json:"includedPermissions"`
+	}
+	if err := json.Unmarshal(out, &r); err != nil {
+		return nil, fmt.Errorf("failed to parse role %s: %w", role, err)
+	}
+	return r.IncludedPermissions, nil
+}
+
+// maxTestedPermissions is the maximum number of permissions tested by a
+// single testIamPermissions call.
+const maxTestedPermissions = 100
+
+// GrantedPermissions implements Project, calling the testIamPermissions
+// method of the project with the access token of the active gcloud account.
+func (g *GcloudProject) GrantedPermissions(ctx context.Context, permissions []string) ([]string, error) {
+	out, err := g.Run(ctx, "auth", "print-access-token")
+	if err != nil {
+		return nil, err
+	}
+	token := strings.TrimSpace(string(out))
+	endpoint := g.Endpoint
+	if endpoint == "" {
+		endpoint = resourceManagerEndpoint
+	}
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var granted []string
+	for len(permissions) > 0 {
+		batch := permissions
+		if len(batch) > maxTestedPermissions {
+			batch = batch[:maxTestedPermissions]
+		}
+		permissions = permissions[len(batch):]
+
+		body, err := json.Marshal(map[string][]string{"permissions": batch})
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/v1/projects/"+g.Project+":testIamPermissions", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("testIamPermissions on project %s: %s: %s", g.Project, resp.Status, respBody)
+		}
+		var result struct {
+			Permissions []string `json:"permissions"`
+		}
+		if err := json.Unmarshal(respBody, &result); err != nil {
+			return nil, fmt.Errorf("failed to parse the permissions of project %s: %w", g.Project, err)
+		}
+		granted = append(granted, result.Permissions...)
+	}
+	return granted, nil
+}
+
+// Quotas implements Project.
+func (g *GcloudProject) Quotas(ctx context.Context, region string) ([]Quota, error) {
+	args := []string{"compute", "project-info", "describe"}
+	if region != "" {
+		args = []string{"compute", "regions", "describe", region}
+	}
+	out, err := g.Run(ctx, append(args, "--project="+g.Project, "--format=json(quotas)")...)
+	if err != nil {
+		return nil, err
+	}
+	var info struct {
+		Quotas []Quota `json:"quotas"`
+	}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse the quotas of project %s: %w", g.Project, err)
+	}
+	return info.Quotas, nil
+}
@@ -0,0 +1,239 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package preflight checks the prerequisites of a recipe, the APIs, IAM roles
+// and quotas it needs, before its test scripts create anything, so that all
+// the missing ones are reported at once instead of failing deep into setup.
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+)
+
+// DefaultProject is the environment variable holding the project of the
+// prerequisites which don't name one.
+const DefaultProject = "PROJECT"
+
+// Quota is a Compute Engine quota of a project or region.
+type Quota struct {
+	Metric string  `json:"metric"`
+	Limit  float64 `json:"limit"`
+	Usage  float64 `json:"usage"`
+}
+
+// Project is a project the prerequisites of recipes are checked in.
+type Project interface {
+	// ID returns the ID of the project.
+	ID() string
+	// EnabledAPIs returns the names of the APIs enabled in the project, e.g.
+	// iap.googleapis.com.
+	EnabledAPIs(ctx context.Context) ([]string, error)
+	// RolePermissions returns the permissions included in the IAM role, e.g.
+	// roles/iap.admin.
+	RolePermissions(ctx context.Context, role string) ([]string, error)
+	// GrantedPermissions returns the permissions among permissions the
+	// caller has on the project, whether they are granted to the caller, to
+	// one of its groups, or inherited from a folder or the organization.
+	GrantedPermissions(ctx context.Context, permissions []string) ([]string, error)
+	// Quotas returns the Compute Engine quotas of region, or of the
+	// project if region is empty.
+	Quotas(ctx context.Context, region string) ([]Quota, error)
+}
+
+// Missing is a prerequisite of a recipe which is not met.
+type Missing struct {
+	Prerequisite recipe.Prerequisite
+	// Project is the ID of the project it was checked in.
+	Project string
+	// Detail tells what is missing, e.g. "not enabled".
+	Detail string
+}
+
+func (m Missing) String() string {
+	return fmt.Sprintf("%s %s %s in project %s: %s", m.Prerequisite.Kind, m.Prerequisite.Name, m.Detail, m.Project, m.Prerequisite.Reason)
+}
+
+// Report is the result of the check of the prerequisites of a recipe.
+type Report struct {
+	Recipe string
+	// Missing are the prerequisites which are not met.
+	Missing []Missing
+	// Skipped are the prerequisites which are not checked: environment
+	// variables, features, and the prerequisites of projects which are not
+	// given.
+	Skipped []recipe.Prerequisite
+	// Errors are the errors of the projects, whose prerequisites could be
+	// neither confirmed nor reported missing.
+	Errors []error
+}
+
+// Err returns an error listing all the missing prerequisites, or nil if there
+// are none.
+func (r *Report) Err() error {
+	if len(r.Missing) == 0 {
+		return nil
+	}
+	lines := make([]string, len(r.Missing))
+	for i, m := range r.Missing {
+		lines[i] = "\n  " + m.String()
+	}
+	return fmt.Errorf("recipe %s is missing %d prerequisites:%s", r.Recipe, len(r.Missing), strings.Join(lines, ""))
+}
+
+// Check checks the APIs, IAM roles and quotas needed by the recipe described
+// by d in projects, keyed by the environment variable holding them, e.g.
+// PROJECT and DNS_PROJECT. Regional quotas are checked in region. All the
+// prerequisites are checked, even when some are missing or fail to be
+// checked.
+func Check(ctx context.Context, projects map[string]Project, region string, d *recipe.Description) *Report {
+	report := &Report{Recipe: d.Recipe.Path}
+	checkers := make(map[Project]*checker)
+	for _, p := range d.Prerequisites {
+		projectVar := p.Project
+		if projectVar == "" {
+			projectVar = DefaultProject
+		}
+		project, ok := projects[projectVar]
+		if !ok || (p.Kind != recipe.PrerequisiteAPI && p.Kind != recipe.PrerequisiteRole && p.Kind != recipe.PrerequisiteQuota) {
+			report.Skipped = append(report.Skipped, p)
+			continue
+		}
+		c, ok := checkers[project]
+		if !ok {
+			c = &checker{project: project, granted: make(map[string]bool), quotas: make(map[string]map[string]Quota), quotaErrs: make(map[string]error)}
+			checkers[project] = c
+		}
+		detail, err := c.check(ctx, p, region)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("failed to check %s %s in project %s: %w", p.Kind, p.Name, project.ID(), err))
+			continue
+		}
+		if detail != "" {
+			report.Missing = append(report.Missing, Missing{Prerequisite: p, Project: project.ID(), Detail: detail})
+		}
+	}
+	return report
+}
+
+// checker checks the prerequisites of a project, listing its APIs and quotas
+// once, even if it fails, and testing each permission once.
+type checker struct {
+	project Project
+	apis    map[string]bool
+	apisErr error
+	// granted tells whether each tested permission is granted to the caller.
+	granted map[string]bool
+	// quotas are the quotas by region, "" for the project, and by metric.
+	quotas    map[string]map[string]Quota
+	quotaErrs map[string]error
+}
+
+// check returns what is missing for the prerequisite p, or "" if it is met.
+func (c *checker) check(ctx context.Context, p recipe.Prerequisite, region string) (string, error) {
+	switch p.Kind {
+	case recipe.PrerequisiteAPI:
+		if c.apis == nil {
+			var apis []string
+			apis, c.apisErr = c.project.EnabledAPIs(ctx)
+			c.apis = toSet(apis)
+		}
+		if c.apisErr != nil {
+			return "", c.apisErr
+		}
+		if !c.apis[p.Name] {
+			return "is not enabled", nil
+		}
+	case recipe.PrerequisiteRole:
+		permissions, err := c.project.RolePermissions(ctx, p.Name)
+		if err != nil {
+			return "", err
+		}
+		missing, err := c.missingPermissions(ctx, permissions)
+		if err != nil {
+			return "", err
+		}
+		if len(missing) > 0 {
+			return fmt.Sprintf("is not granted (missing %d of its %d permissions, e.g. %s)", len(missing), len(permissions), missing[0]), nil
+		}
+	case recipe.PrerequisiteQuota:
+		if !p.Regional {
+			region = ""
+		} else if region == "" {
+			return "", fmt.Errorf("no region to check the regional quota in")
+		}
+		if _, ok := c.quotas[region]; !ok {
+			list, err := c.project.Quotas(ctx, region)
+			c.quotas[region] = make(map[string]Quota)
+			c.quotaErrs[region] = err
+			for _, q := range list {
+				c.quotas[region][q.Metric] = q
+			}
+		}
+		if err := c.quotaErrs[region]; err != nil {
+			return "", err
+		}
+		scope := "the project"
+		if region != "" {
+			scope = "region " + region
+		}
+		q, ok := c.quotas[region][p.Name]
+		if !ok {
+			return fmt.Sprintf("is not a quota of %s", scope), nil
+		}
+		if available := q.Limit - q.Usage; available < p.Amount {
+			return fmt.Sprintf("has %g available in %s (%g of %g used), %g needed", available, scope, q.Usage, q.Limit, p.Amount), nil
+		}
+	}
+	return "", nil
+}
+
+// missingPermissions returns the permissions among permissions which are not
+// granted to the caller, testing only the ones not tested yet.
+func (c *checker) missingPermissions(ctx context.Context, permissions []string) ([]string, error) {
+	var untested []string
+	for _, permission := range permissions {
+		if _, ok := c.granted[permission]; !ok {
+			untested = append(untested, permission)
+		}
+	}
+	if len(untested) > 0 {
+		granted, err := c.project.GrantedPermissions(ctx, untested)
+		if err != nil {
+			return nil, err
+		}
+		set := toSet(granted)
+		for _, permission := range untested {
+			c.granted[permission] = set[permission]
+		}
+	}
+	var missing []string
+	for _, permission := range permissions {
+		if !c.granted[permission] {
+			missing = append(missing, permission)
+		}
+	}
+	return missing, nil
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
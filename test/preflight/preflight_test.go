@@ -0,0 +1,277 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package preflight
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe/recipetest"
+)
+
+// repoRoot is the root of the repository, relative to this package.
+const repoRoot = "../.."
+
+// testDescription returns the description of a recipe with prerequisites of
+// every kind, in the main project and in the DNS project.
+func testDescription() *recipe.Description {
+	return &recipe.Description{
+		Recipe: &recipe.Recipe{Path: "ingress/single-cluster/ingress-iap"},
+		Prerequisites: []recipe.Prerequisite{
+			{Kind: recipe.PrerequisiteAPI, Name: "compute.googleapis.com", Reason: "load balancers"},
+			{Kind: recipe.PrerequisiteAPI, Name: "iap.googleapis.com", Reason: "Identity-Aware Proxy"},
+			{Kind: recipe.PrerequisiteAPI, Name: "dns.googleapis.com", Project: "DNS_PROJECT", Reason: "DNS records"},
+			{Kind: recipe.PrerequisiteEnv, Name: "DNS_ZONE", Reason: "used by the test scripts"},
+			{Kind: recipe.PrerequisiteFeature, Name: "DNS record", Reason: "managed certificates"},
+			{Kind: recipe.PrerequisiteRole, Name: "roles/oauthconfig.editor", Reason: "OAuth client"},
+			{Kind: recipe.PrerequisiteRole, Name: "roles/dns.admin", Project: "DNS_PROJECT", Reason: "DNS records"},
+			{Kind: recipe.PrerequisiteQuota, Name: "CPUS", Amount: 7, Regional: true, Reason: "cluster"},
+			{Kind: recipe.PrerequisiteQuota, Name: "NETWORKS", Amount: 1, Reason: "network"},
+		},
+	}
+}
+
+// testRoles are the permissions of the roles of testDescription.
+var testRoles = map[string][]string{
+	"roles/oauthconfig.editor": {"clientauthconfig.brands.create", "clientauthconfig.clients.create"},
+	"roles/dns.admin":          {"dns.changes.create", "dns.resourceRecordSets.update"},
+}
+
+func TestCheck(t *testing.T) {
+	project := NewFakeProject("test-project")
+	project.APIs = []string{"compute.googleapis.com"}
+	project.Roles = testRoles
+	// Only some of the permissions of the role, e.g. through another role.
+	project.Permissions = []string{"clientauthconfig.clients.create"}
+	project.RegionQuotas["us-central1"] = []Quota{{Metric: "CPUS", Limit: 24, Usage: 20}}
+	project.RegionQuotas[""] = []Quota{{Metric: "NETWORKS", Limit: 5, Usage: 4}}
+	dnsProject := NewFakeProject("dns-project")
+	dnsProject.APIs = []string{"dns.googleapis.com"}
+	dnsProject.Roles = testRoles
+	dnsProject.Grant("roles/dns.admin")
+
+	report := Check(context.Background(), map[string]Project{"PROJECT": project, "DNS_PROJECT": dnsProject}, "us-central1", testDescription())
+	var missing []string
+	for _, m := range report.Missing {
+		missing = append(missing, m.String())
+	}
+	want := []string{
+		"api iap.googleapis.com is not enabled in project test-project: Identity-Aware Proxy",
+		"role roles/oauthconfig.editor is not granted (missing 1 of its 2 permissions, e.g. clientauthconfig.brands.create) in project test-project: OAuth client",
+		"quota CPUS has 4 available in region us-central1 (20 of 24 used), 7 needed in project test-project: cluster",
+	}
+	if !reflect.DeepEqual(missing, want) {
+		t.Errorf("Check() missing = %q, want %q", missing, want)
+	}
+	if len(report.Skipped) != 2 || len(report.Errors) != 0 {
+		t.Errorf("Check() skipped %v, errors %v, want the env and feature prerequisites skipped and no errors", report.Skipped, report.Errors)
+	}
+	if err := report.Err(); err == nil || !strings.Contains(err.Error(), "is missing 3 prerequisites") {
+		t.Errorf("Err() = %v, want the 3 missing prerequisites", err)
+	}
+	if project.Calls["EnabledAPIs"] != 1 || project.Calls["Quotas"] != 2 {
+		t.Errorf("Calls = %v, want the APIs listed once and the quotas once per region", project.Calls)
+	}
+}
+
+func TestCheckSatisfied(t *testing.T) {
+	project := NewFakeProject("test-project")
+	project.APIs = []string{"compute.googleapis.com", "iap.googleapis.com"}
+	project.Roles = testRoles
+	project.Grant("roles/oauthconfig.editor")
+	project.RegionQuotas["us-central1"] = []Quota{{Metric: "CPUS", Limit: 24, Usage: 17}}
+	project.RegionQuotas[""] = []Quota{{Metric: "NETWORKS", Limit: 5}}
+
+	// The prerequisites of DNS_PROJECT are skipped without the project.
+	report := Check(context.Background(), map[string]Project{"PROJECT": project}, "us-central1", testDescription())
+	if err := report.Err(); err != nil || len(report.Errors) != 0 {
+		t.Errorf("Check() = %v, errors %v, want nil", err, report.Errors)
+	}
+	if len(report.Skipped) != 4 {
+		t.Errorf("Check() skipped %v, want the env, feature and DNS_PROJECT prerequisites", report.Skipped)
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	project := NewFakeProject("test-project")
+	project.APIs = []string{"compute.googleapis.com"}
+	project.Roles = testRoles
+	project.Errors["GrantedPermissions"] = errors.New("permission denied")
+
+	// Without a region, the regional quota can't be checked either.
+	report := Check(context.Background(), map[string]Project{"PROJECT": project}, "", testDescription())
+	if len(report.Missing) != 2 || len(report.Errors) != 2 {
+		t.Errorf("Check() = missing %v, errors %v, want the API and the project quota missing, and 2 errors", report.Missing, report.Errors)
+	}
+	if project.Calls["GrantedPermissions"] != 1 {
+		t.Errorf("Calls = %v, want the failing GrantedPermissions called once", project.Calls)
+	}
+}
+
+func TestGcloudProject(t *testing.T) {
+	var calls []string
+	outputs := map[string]string{
+		"services list":                 "compute.googleapis.com\ncontainer.googleapis.com\n",
+		"iam roles describe":            `{"includedPermissions": ["iap.web.getIamPolicy", "iap.web.setIamPolicy"]}`,
+		"auth print-access-token":       "token\n",
+		"compute regions describe":      `{"quotas": [{"metric": "CPUS", "limit": 24.0, "usage": 8.0}]}`,
+		"compute project-info describe": `{"quotas": [{"metric": "NETWORKS", "limit": 5.0, "usage": 1.0}]}`,
+	}
+	// The caller is granted the permissions ending with "getIamPolicy".
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Permissions []string `json:"permissions"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, fmt.Sprintf("%s %s %s %d", r.Method, r.URL.Path, r.Header.Get("Authorization"), len(req.Permissions)))
+		var granted []string
+		for _, permission := range req.Permissions {
+			if strings.HasSuffix(permission, "getIamPolicy") {
+				granted = append(granted, permission)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string][]string{"permissions": granted})
+	}))
+	defer server.Close()
+	project := &GcloudProject{
+		Project:  "test-project",
+		Endpoint: server.URL,
+		Run: func(_ context.Context, args ...string) ([]byte, error) {
+			calls = append(calls, strings.Join(args, " "))
+			for prefix, out := range outputs {
+				if strings.HasPrefix(strings.Join(args, " "), prefix) {
+					return []byte(out), nil
+				}
+			}
+			return nil, errors.New("unexpected command")
+		},
+	}
+	ctx := context.Background()
+
+	apis, err := project.EnabledAPIs(ctx)
+	if want := []string{"compute.googleapis.com", "container.googleapis.com"}; err != nil || !reflect.DeepEqual(apis, want) {
+		t.Errorf("EnabledAPIs() = %q, %v, want %q, nil", apis, err, want)
+	}
+	permissions, err := project.RolePermissions(ctx, "roles/iap.admin")
+	if want := []string{"iap.web.getIamPolicy", "iap.web.setIamPolicy"}; err != nil || !reflect.DeepEqual(permissions, want) {
+		t.Errorf("RolePermissions(%q) = %q, %v, want %q, nil", "roles/iap.admin", permissions, err, want)
+	}
+	granted, err := project.GrantedPermissions(ctx, permissions)
+	if want := []string{"iap.web.getIamPolicy"}; err != nil || !reflect.DeepEqual(granted, want) {
+		t.Errorf("GrantedPermissions(%q) = %q, %v, want %q, nil", permissions, granted, err, want)
+	}
+	// The permissions are tested by batches.
+	many := make([]string, maxTestedPermissions+1)
+	for i := range many {
+		many[i] = fmt.Sprintf("service%d.resources.getIamPolicy", i)
+	}
+	if granted, err := project.GrantedPermissions(ctx, many); err != nil || !reflect.DeepEqual(granted, many) {
+		t.Errorf("GrantedPermissions(%d permissions) = %d permissions, %v, want all of them, nil", len(many), len(granted), err)
+	}
+	quotas, err := project.Quotas(ctx, "us-central1")
+	if want := []Quota{{Metric: "CPUS", Limit: 24, Usage: 8}}; err != nil || !reflect.DeepEqual(quotas, want) {
+		t.Errorf("Quotas(%q) = %+v, %v, want %+v, nil", "us-central1", quotas, err, want)
+	}
+	quotas, err = project.Quotas(ctx, "")
+	if want := []Quota{{Metric: "NETWORKS", Limit: 5, Usage: 1}}; err != nil || !reflect.DeepEqual(quotas, want) {
+		t.Errorf("Quotas(%q) = %+v, %v, want %+v, nil", "", quotas, err, want)
+	}
+
+	wantCalls := []string{
+		"services list --enabled --project=test-project --format=value(config.name)",
+		"iam roles describe roles/iap.admin --format=json(includedPermissions)",
+		"auth print-access-token",
+		"auth print-access-token",
+		"compute regions describe us-central1 --project=test-project --format=json(quotas)",
+		"compute project-info describe --project=test-project --format=json(quotas)",
+	}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("gcloud calls = %q, want %q", calls, wantCalls)
+	}
+	wantRequests := []string{
+		"POST /v1/projects/test-project:testIamPermissions Bearer token 2",
+		"POST /v1/projects/test-project:testIamPermissions Bearer token 100",
+		"POST /v1/projects/test-project:testIamPermissions Bearer token 1",
+	}
+	if !reflect.DeepEqual(requests, wantRequests) {
+		t.Errorf("testIamPermissions requests = %q, want %q", requests, wantRequests)
+	}
+}
+
+func TestGcloudProjects(t *testing.T) {
+	env := map[string]string{"PROJECT": "test-project"}
+	projects := GcloudProjects(nil, func(key string) string { return env[key] }, testDescription())
+	if len(projects) != 1 || projects["PROJECT"].ID() != "test-project" {
+		t.Errorf("GcloudProjects() = %v, want only PROJECT, DNS_PROJECT is not set", projects)
+	}
+}
+
+// TestRecipes checks that the prerequisites of the recipes of the repository
+// can be checked: they name APIs, roles and quotas in the expected format,
+// and are met by a project with all of them.
+func TestRecipes(t *testing.T) {
+	recipetest.ForEachDescribed(t, repoRoot, func(t *testing.T, d *recipe.Description) {
+		projects := make(map[string]Project)
+		for _, p := range d.Prerequisites {
+			projectVar := p.Project
+			if projectVar == "" {
+				projectVar = DefaultProject
+			}
+			project, ok := projects[projectVar].(*FakeProject)
+			if !ok {
+				project = NewFakeProject(strings.ToLower(projectVar))
+				projects[projectVar] = project
+			}
+			switch p.Kind {
+			case recipe.PrerequisiteAPI:
+				if !strings.HasSuffix(p.Name, ".googleapis.com") {
+					t.Errorf("API %q, want a service name, e.g. iap.googleapis.com", p.Name)
+				}
+				project.APIs = append(project.APIs, p.Name)
+			case recipe.PrerequisiteRole:
+				if !strings.HasPrefix(p.Name, "roles/") {
+					t.Errorf("role %q, want a role name, e.g. roles/iap.admin", p.Name)
+				}
+				project.Roles[p.Name] = []string{strings.TrimPrefix(p.Name, "roles/") + ".use"}
+				project.Grant(p.Name)
+			case recipe.PrerequisiteQuota:
+				if p.Name != strings.ToUpper(p.Name) {
+					t.Errorf("quota %q, want a Compute Engine quota metric, e.g. CPUS", p.Name)
+				}
+				region := ""
+				if p.Regional {
+					region = "us-central1"
+				}
+				project.RegionQuotas[region] = append(project.RegionQuotas[region], Quota{Metric: p.Name, Limit: p.Amount})
+			}
+		}
+		report := Check(context.Background(), projects, "us-central1", d)
+		if err := report.Err(); err != nil || len(report.Errors) != 0 {
+			t.Errorf("Check() = %v, errors %v, want nil", err, report.Errors)
+		}
+	})
+}
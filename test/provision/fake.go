@@ -0,0 +1,182 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provision
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FakeCA is the CA certificate of the clusters of FakeCloud.
+const FakeCA = "-----BEGIN CERTIFICATE-----\nZmFrZQ==\n-----END CERTIFICATE-----\n"
+
+// FakeCloud is an in-memory Cloud. Like GCP, it refuses to create a resource
+// before the resources it depends on, to delete one while other resources
+// still depend on it, and to enable Multi Cluster Ingress with a config
+// membership while it is enabled with another one.
+type FakeCloud struct {
+	mu        sync.Mutex
+	resources map[string]Resource
+	// Created and Deleted list the created and deleted resources, in order.
+	Created []Resource
+	Deleted []Resource
+	// CreateErrors makes the creation of the named resources fail.
+	CreateErrors map[string]error
+	// endpoints are the endpoints of the clusters, by key.
+	endpoints map[string]string
+}
+
+// NewFakeCloud returns a FakeCloud holding resources, e.g. the features
+// already enabled in the project.
+func NewFakeCloud(resources ...Resource) *FakeCloud {
+	f := &FakeCloud{
+		resources:    make(map[string]Resource),
+		CreateErrors: make(map[string]error),
+		endpoints:    make(map[string]string),
+	}
+	for _, r := range resources {
+		f.resources[key(r)] = r
+	}
+	return f
+}
+
+// key identifies a resource in a FakeCloud.
+func key(r Resource) string {
+	return string(r.Kind) + "/" + r.Location + "/" + r.Name
+}
+
+// Create implements Cloud.
+func (f *FakeCloud) Create(_ context.Context, r Resource) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.CreateErrors[r.Name]; err != nil {
+		return err
+	}
+	if existing, ok := f.resources[key(r)]; ok {
+		switch {
+		case r.Shared:
+			return nil
+		case existing.ConfigMembership != "" && existing.ConfigMembership != r.ConfigMembership:
+			return fmt.Errorf("%s is already enabled with config membership %s", r, existing.ConfigMembership)
+		}
+		return fmt.Errorf("%s already exists", r)
+	}
+	var missing []string
+	switch r.Kind {
+	case Subnet:
+		missing = f.missing(Resource{Kind: Network, Name: r.Network})
+	case Cluster:
+		missing = f.missing(Resource{Kind: Network, Name: r.Network}, Resource{Kind: Subnet, Name: r.Subnet, Location: region(r.Location)})
+	case Membership:
+		location, name, _ := strings.Cut(r.Cluster, "/")
+		missing = f.missing(Resource{Kind: Cluster, Name: name, Location: location})
+	case Feature:
+		if r.ConfigMembership != "" {
+			missing = f.missing(Resource{Kind: Membership, Name: r.ConfigMembership})
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("can't create %s before %s", r, strings.Join(missing, ", "))
+	}
+	f.resources[key(r)] = r
+	f.Created = append(f.Created, r)
+	if r.Kind == Cluster {
+		f.endpoints[key(r)] = fmt.Sprintf("https://10.0.0.%d", len(f.endpoints)+1)
+	}
+	return nil
+}
+
+// missing returns the resources among resources which don't exist.
+func (f *FakeCloud) missing(resources ...Resource) []string {
+	var missing []string
+	for _, r := range resources {
+		if _, ok := f.resources[key(r)]; !ok {
+			missing = append(missing, r.String())
+		}
+	}
+	return missing
+}
+
+// Delete implements Cloud.
+func (f *FakeCloud) Delete(_ context.Context, r Resource) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.resources[key(r)]; !ok {
+		return fmt.Errorf("%s: %w", r, ErrNotFound)
+	}
+	for _, other := range f.resources {
+		if dependsOn(other, r) {
+			return fmt.Errorf("%s is still used by %s", r, other)
+		}
+	}
+	delete(f.resources, key(r))
+	delete(f.endpoints, key(r))
+	f.Deleted = append(f.Deleted, r)
+	return nil
+}
+
+// dependsOn returns true if r can't exist without dep.
+func dependsOn(r, dep Resource) bool {
+	switch dep.Kind {
+	case Network:
+		return (r.Kind == Subnet || r.Kind == Cluster) && r.Network == dep.Name
+	case Subnet:
+		return r.Kind == Cluster && r.Subnet == dep.Name && region(r.Location) == dep.Location
+	case Cluster:
+		return r.Kind == Membership && r.Cluster == dep.Location+"/"+dep.Name
+	case Membership:
+		return r.Kind == Feature && r.ConfigMembership == dep.Name
+	}
+	return false
+}
+
+// Endpoint implements Cloud.
+func (f *FakeCloud) Endpoint(_ context.Context, cluster Resource) (string, []byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	endpoint, ok := f.endpoints[key(cluster)]
+	if !ok {
+		return "", nil, fmt.Errorf("%s: %w", cluster, ErrNotFound)
+	}
+	return endpoint, []byte(FakeCA), nil
+}
+
+// Resources returns the resources of the cloud, sorted by kind, location and
+// name.
+func (f *FakeCloud) Resources() []Resource {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var resources []Resource
+	for _, r := range f.resources {
+		resources = append(resources, r)
+	}
+	sort.Slice(resources, func(i, j int) bool { return key(resources[i]) < key(resources[j]) })
+	return resources
+}
+
+// region returns the region of a location, a zone or a region.
+func region(location string) string {
+	if i := strings.LastIndex(location, "-"); i >= 0 && len(location)-i == 2 {
+		return location[:i]
+	}
+	return location
+}
@@ -0,0 +1,190 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provision
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/naming"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/sweeper"
+)
+
+// GcloudCloud is a Cloud backed by gcloud.
+type GcloudCloud struct {
+	// Run runs gcloud.
+	Run sweeper.Runner
+	// Project is the project of the environments, which must be set: the
+	// clusters use its workload identity pool, and the memberships are
+	// referred to by their full name.
+	Project string
+}
+
+// Create implements Cloud.
+func (g *GcloudCloud) Create(ctx context.Context, r Resource) error {
+	var args []string
+	switch r.Kind {
+	case Network:
+		args = []string{"compute", "networks", "create", r.Name, "--subnet-mode=custom"}
+	case Subnet:
+		args = []string{"compute", "networks", "subnets", "create", r.Name, "--network=" + r.Network, "--region=" + r.Location, "--range=" + r.Range}
+	case Cluster:
+		args = []string{"container", "clusters", "create", r.Name,
+			"--location=" + r.Location,
+			"--network=" + r.Network,
+			"--subnetwork=" + r.Subnet,
+			"--enable-ip-alias",
+			"--workload-pool=" + g.Project + ".svc.id.goog",
+			"--labels=" + naming.FormatLabels(r.Labels),
+		}
+	case Membership:
+		args = []string{"container", "fleet", "memberships", "register", r.Name, "--gke-cluster=" + r.Cluster, "--enable-workload-identity"}
+	case Feature:
+		feature, err := featureCommand(r.Name)
+		if err != nil {
+			return err
+		}
+		args = append(feature, "enable")
+		if r.ConfigMembership != "" {
+			args = append(args, "--config-membership="+g.membership(r.ConfigMembership))
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", r.Kind)
+	}
+	_, err := g.Run(ctx, append(args, "--project="+g.Project, "--quiet")...)
+	if err != nil && r.Shared && isAlreadyExists(err) {
+		return nil
+	}
+	if err != nil && r.Kind == Feature && r.ConfigMembership != "" && isAlreadyExists(err) {
+		// Left enabled by a run which failed before being deprovisioned.
+		return g.updateConfigMembership(ctx, r)
+	}
+	return err
+}
+
+// updateConfigMembership points an enabled fleet feature to the config
+// membership of r.
+func (g *GcloudCloud) updateConfigMembership(ctx context.Context, r Resource) error {
+	feature, err := featureCommand(r.Name)
+	if err != nil {
+		return err
+	}
+	args := append(feature, "update", "--config-membership="+g.membership(r.ConfigMembership))
+	_, err = g.Run(ctx, append(args, "--project="+g.Project, "--quiet")...)
+	return err
+}
+
+// Delete implements Cloud. The firewall rules of a network, e.g. those
+// created by the Ingress controllers, are deleted with it.
+func (g *GcloudCloud) Delete(ctx context.Context, r Resource) error {
+	var args []string
+	switch r.Kind {
+	case Network:
+		if err := g.deleteFirewalls(ctx, r.Name); err != nil {
+			return err
+		}
+		args = []string{"compute", "networks", "delete", r.Name}
+	case Subnet:
+		args = []string{"compute", "networks", "subnets", "delete", r.Name, "--region=" + r.Location}
+	case Cluster:
+		args = []string{"container", "clusters", "delete", r.Name, "--location=" + r.Location}
+	case Membership:
+		args = []string{"container", "fleet", "memberships", "unregister", r.Name, "--gke-cluster=" + r.Cluster}
+	case Feature:
+		feature, err := featureCommand(r.Name)
+		if err != nil {
+			return err
+		}
+		args = append(feature, "disable")
+	default:
+		return fmt.Errorf("unknown kind %q", r.Kind)
+	}
+	_, err := g.Run(ctx, append(args, "--project="+g.Project, "--quiet")...)
+	if err != nil && isNotFound(err) {
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	return err
+}
+
+// deleteFirewalls deletes the firewall rules of a network, like
+// cleanup_gke_basic in test/helpers/setup.sh.
+func (g *GcloudCloud) deleteFirewalls(ctx context.Context, network string) error {
+	out, err := g.Run(ctx, "compute", "firewall-rules", "list", "--filter=network=\""+network+"\"", "--format=value(name)", "--project="+g.Project)
+	if err != nil {
+		return err
+	}
+	for _, name := range strings.Fields(string(out)) {
+		if _, err := g.Run(ctx, "compute", "firewall-rules", "delete", name, "--project="+g.Project, "--quiet"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Endpoint implements Cloud.
+func (g *GcloudCloud) Endpoint(ctx context.Context, cluster Resource) (string, []byte, error) {
+	out, err := g.Run(ctx, "container", "clusters", "describe", cluster.Name, "--location="+cluster.Location, "--format=json", "--project="+g.Project)
+	if err != nil {
+		return "", nil, err
+	}
+	var described struct {
+		Endpoint   string `json:"endpoint"`
+		MasterAuth struct {
+			ClusterCACertificate string `json:"clusterCaCertificate"`
+		} `json:"masterAuth"`
+	}
+	if err := json.Unmarshal(out, &described); err != nil {
+		return "", nil, fmt.Errorf("failed to parse the description of cluster %s: %w", cluster.Name, err)
+	}
+	if described.Endpoint == "" {
+		return "", nil, fmt.Errorf("cluster %s has no endpoint", cluster.Name)
+	}
+	ca, err := base64.StdEncoding.DecodeString(described.MasterAuth.ClusterCACertificate)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid CA certificate of cluster %s: %w", cluster.Name, err)
+	}
+	return "https://" + described.Endpoint, ca, nil
+}
+
+// membership returns the full name of a membership of the project.
+func (g *GcloudCloud) membership(name string) string {
+	return fmt.Sprintf("projects/%s/locations/global/memberships/%s", g.Project, name)
+}
+
+// featureCommand returns the gcloud command group of a fleet feature.
+func featureCommand(feature string) ([]string, error) {
+	switch feature {
+	case MultiClusterServices:
+		return []string{"container", "fleet", "multi-cluster-services"}, nil
+	case MultiClusterIngress:
+		return []string{"container", "fleet", "ingress"}, nil
+	}
+	return nil, fmt.Errorf("unknown fleet feature %q", feature)
+}
+
+// isNotFound returns true if gcloud failed because a resource doesn't exist.
+func isNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound) || strings.Contains(err.Error(), "was not found") || strings.Contains(err.Error(), "NOT_FOUND")
+}
+
+// isAlreadyExists returns true if gcloud failed because a resource already
+// exists.
+func isAlreadyExists(err error) bool {
+	return strings.Contains(err.Error(), "already exists") || strings.Contains(err.Error(), "ALREADY_EXISTS") || strings.Contains(err.Error(), "already enabled")
+}
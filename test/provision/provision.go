@@ -0,0 +1,341 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package provision creates the environment of the multi-cluster recipes:
+// the clusters they declare in their metadata, see recipe.DeclaredCluster,
+// in one network with a subnet in each of their regions, registered to the
+// fleet of the project, with the config cluster enabled for Multi Cluster
+// Ingress and multi-cluster Gateways. The test scripts of a recipe reach each
+// cluster through a kubeconfig context named after it, e.g. gke-1.
+package provision
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/naming"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/utils"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/klog/v2"
+)
+
+// MaxClusterNameLength is the maximum length of the name of a GKE cluster.
+const MaxClusterNameLength = 40
+
+// Kind is a kind of resource of a multi-cluster environment.
+type Kind string
+
+const (
+	Network    Kind = "network"
+	Subnet     Kind = "subnet"
+	Cluster    Kind = "cluster"
+	Membership Kind = "membership"
+	Feature    Kind = "feature"
+)
+
+// Fleet features enabled for the multi-cluster recipes.
+const (
+	// MultiClusterServices is the fleet feature of multi-cluster Services,
+	// which multi-cluster Gateways route to.
+	MultiClusterServices = "multiclusterservicediscovery"
+	// MultiClusterIngress is the fleet feature of Multi Cluster Ingress and
+	// multi-cluster Gateways, enabled with a config membership. It is one
+	// per project, so the recipes with a config cluster must not run
+	// concurrently in a project: each one points it to its own config
+	// cluster, and disables it when it is deprovisioned.
+	MultiClusterIngress = "multiclusteringress"
+)
+
+// ErrNotFound is returned by Cloud.Delete when the resource doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// Resource is a resource of a multi-cluster environment.
+type Resource struct {
+	Kind Kind
+	Name string
+	// Location is the region of a subnet, the zone or region of a cluster,
+	// and empty for the other resources.
+	Location string
+	// Network is the network of a subnet or a cluster, and Subnet the subnet
+	// of a cluster.
+	Network string
+	Subnet  string
+	// Range is the primary IP range of a subnet.
+	Range string
+	// Cluster is the cluster of a membership, in the location/name format.
+	Cluster string
+	// ConfigMembership is the config membership of a feature, if it has one.
+	ConfigMembership string
+	// Labels are the labels of a cluster.
+	Labels map[string]string
+	// Shared is true for a resource shared by all the runs in the project,
+	// e.g. a fleet feature without configuration: it is created if it
+	// doesn't exist, and never deleted.
+	Shared bool
+}
+
+func (r Resource) String() string {
+	if r.Location == "" {
+		return fmt.Sprintf("%s %s", r.Kind, r.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", r.Kind, r.Location, r.Name)
+}
+
+// Cloud creates and deletes the resources of multi-cluster environments.
+type Cloud interface {
+	// Create creates a resource, once the resources it depends on are
+	// created. Creating a Shared resource which already exists succeeds.
+	Create(ctx context.Context, r Resource) error
+	// Delete deletes a resource, once the resources depending on it are
+	// deleted. It returns an error wrapping ErrNotFound if the resource
+	// doesn't exist.
+	Delete(ctx context.Context, r Resource) error
+	// Endpoint returns the URL of the control plane of a cluster, and its
+	// CA certificate, PEM encoded.
+	Endpoint(ctx context.Context, cluster Resource) (string, []byte, error)
+}
+
+// Plan returns the resources of the clusters declared by r, in creation
+// order, named by namer: the network of the recipe, a subnet in each region
+// of the clusters, the clusters and their memberships, and the fleet
+// features.
+func Plan(r *recipe.Recipe, namer *naming.Namer) ([]Resource, error) {
+	declared := r.Metadata.Clusters
+	if len(declared) == 0 {
+		return nil, fmt.Errorf("recipe %s declares no clusters in its %s", r.Path, recipe.MetadataFile)
+	}
+	network := namer.Name()
+	resources := []Resource{{Kind: Network, Name: network}}
+	subnets := make(map[string]string)
+	for _, c := range declared {
+		if _, ok := subnets[c.Region]; ok {
+			continue
+		}
+		subnets[c.Region] = namer.Name(c.Region)
+		resources = append(resources, Resource{
+			Kind:     Subnet,
+			Name:     subnets[c.Region],
+			Location: c.Region,
+			Network:  network,
+			Range:    fmt.Sprintf("10.%d.0.0/20", len(subnets)),
+		})
+	}
+	var memberships []Resource
+	for i, c := range declared {
+		cluster := clusterName(namer, i)
+		if len(cluster) > MaxClusterNameLength {
+			return nil, fmt.Errorf("cluster name %s is longer than %d characters", cluster, MaxClusterNameLength)
+		}
+		resources = append(resources, Resource{
+			Kind:     Cluster,
+			Name:     cluster,
+			Location: c.Location(),
+			Network:  network,
+			Subnet:   subnets[c.Region],
+			Labels:   namer.Labels(),
+		})
+		memberships = append(memberships, Resource{
+			Kind:    Membership,
+			Name:    cluster,
+			Cluster: c.Location() + "/" + cluster,
+		})
+	}
+	resources = append(resources, memberships...)
+	for i, c := range declared {
+		if c.Name == r.Metadata.ConfigCluster {
+			resources = append(resources,
+				Resource{Kind: Feature, Name: MultiClusterServices, Shared: true},
+				Resource{Kind: Feature, Name: MultiClusterIngress, ConfigMembership: clusterName(namer, i)})
+		}
+	}
+	return resources, nil
+}
+
+// clusterName returns the name of the i-th cluster declared by a recipe.
+// Cluster names are too short to hold the names of the declared clusters.
+func clusterName(namer *naming.Namer, i int) string {
+	return fmt.Sprintf("%s-%d", namer.Name(), i+1)
+}
+
+// Provisioner provisions the clusters declared by recipes with a Cloud. It
+// implements recipe.ClusterProvisioner.
+type Provisioner struct {
+	cloud Cloud
+}
+
+// New returns a Provisioner creating the resources with cloud.
+func New(cloud Cloud) *Provisioner {
+	return &Provisioner{cloud: cloud}
+}
+
+// Provision implements recipe.ClusterProvisioner. The resources of the same
+// kind are created concurrently. If one can't be created, the resources
+// already created are deleted.
+func (p *Provisioner) Provision(ctx context.Context, env *utils.Env, r *recipe.Recipe, namer *naming.Namer) (map[string]*utils.Cluster, error) {
+	resources, err := Plan(r, namer)
+	if err != nil {
+		return nil, err
+	}
+	var created []Resource
+	for _, stage := range stages(resources) {
+		done, err := p.apply(ctx, stage, p.cloud.Create)
+		created = append(created, done...)
+		if err != nil {
+			klog.Errorf("Failed to provision the clusters of recipe %s, deleting the %d resources created", r.Path, len(created))
+			if err := p.delete(ctx, created); err != nil {
+				klog.Errorf("Failed to delete the resources created: %v", err)
+			}
+			return nil, err
+		}
+		for _, res := range done {
+			klog.Infof("Created %s", res)
+		}
+	}
+	return p.Connect(ctx, env, r, namer)
+}
+
+// Connect implements recipe.ClusterProvisioner. Besides the contexts, it
+// sets CLUSTER_<NAME> and LOCATION_<NAME> to the name and location of each
+// cluster, e.g. CLUSTER_GKE_1 for gke-1, for the gcloud commands of the test
+// scripts, and CONFIG_CLUSTER to the name of the config cluster. The current
+// context is the one of the config cluster.
+func (p *Provisioner) Connect(ctx context.Context, env *utils.Env, r *recipe.Recipe, namer *naming.Namer) (map[string]*utils.Cluster, error) {
+	if len(r.Metadata.Clusters) == 0 {
+		return nil, fmt.Errorf("recipe %s declares no clusters in its %s", r.Path, recipe.MetadataFile)
+	}
+	path := env.Get("KUBECONFIG")
+	config, err := clientcmd.LoadFromFile(path)
+	if os.IsNotExist(err) {
+		config, err = clientcmdapi.NewConfig(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig %q: %w", path, err)
+	}
+
+	var contexts []string
+	for i, c := range r.Metadata.Clusters {
+		cluster := Resource{Kind: Cluster, Name: clusterName(namer, i), Location: c.Location()}
+		server, ca, err := p.cloud.Endpoint(ctx, cluster)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the endpoint of cluster %s: %w", c.Name, err)
+		}
+		config.Clusters[c.Name] = &clientcmdapi.Cluster{Server: server, CertificateAuthorityData: ca}
+		config.AuthInfos[c.Name] = &clientcmdapi.AuthInfo{Exec: &clientcmdapi.ExecConfig{
+			APIVersion:         "client.authentication.k8s.io/v1beta1",
+			Command:            "gke-gcloud-auth-plugin",
+			InstallHint:        "Install gke-gcloud-auth-plugin for use with kubectl by following https://cloud.google.com/kubernetes-engine/docs/how-to/cluster-access-for-kubectl#install_plugin",
+			ProvideClusterInfo: true,
+			InteractiveMode:    clientcmdapi.IfAvailableExecInteractiveMode,
+		}}
+		config.Contexts[c.Name] = &clientcmdapi.Context{Cluster: c.Name, AuthInfo: c.Name}
+		contexts = append(contexts, c.Name)
+
+		env.Set("CLUSTER_"+envSuffix(c.Name), cluster.Name)
+		env.Set("LOCATION_"+envSuffix(c.Name), cluster.Location)
+	}
+	config.CurrentContext = r.Metadata.ConfigCluster
+	env.Set("CONFIG_CLUSTER", r.Metadata.ConfigCluster)
+	if err := clientcmd.WriteToFile(*config, path); err != nil {
+		return nil, fmt.Errorf("failed to write kubeconfig %q: %w", path, err)
+	}
+	return utils.LoadClusters(path, contexts...)
+}
+
+// Deprovision implements recipe.ClusterProvisioner. The resources are deleted
+// in the reverse creation order, those of the same kind concurrently. It
+// deletes as many resources as possible, ignoring the ones which don't exist,
+// so that it can clean up after a failed run.
+func (p *Provisioner) Deprovision(ctx context.Context, r *recipe.Recipe, namer *naming.Namer) error {
+	resources, err := Plan(r, namer)
+	if err != nil {
+		return err
+	}
+	return p.delete(ctx, resources)
+}
+
+// delete deletes the resources in the reverse creation order, but the Shared
+// ones, and returns the errors of the ones which couldn't be deleted.
+func (p *Provisioner) delete(ctx context.Context, resources []Resource) error {
+	var owned []Resource
+	for i := len(resources) - 1; i >= 0; i-- {
+		if !resources[i].Shared {
+			owned = append(owned, resources[i])
+		}
+	}
+	var errs []error
+	for _, stage := range stages(owned) {
+		deleted, err := p.apply(ctx, stage, func(ctx context.Context, r Resource) error {
+			if err := p.cloud.Delete(ctx, r); err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+			return nil
+		})
+		for _, res := range deleted {
+			klog.Infof("Deleted %s", res)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// apply applies f to the resources concurrently, and returns the resources
+// it succeeded for, in order, and the errors of the others.
+func (p *Provisioner) apply(ctx context.Context, resources []Resource, f func(context.Context, Resource) error) ([]Resource, error) {
+	errs := make([]error, len(resources))
+	var wg sync.WaitGroup
+	for i, r := range resources {
+		wg.Add(1)
+		go func(i int, r Resource) {
+			defer wg.Done()
+			if err := f(ctx, r); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", r, err)
+			}
+		}(i, r)
+	}
+	wg.Wait()
+	var done []Resource
+	for i, r := range resources {
+		if errs[i] == nil {
+			done = append(done, r)
+		}
+	}
+	return done, errors.Join(errs...)
+}
+
+// stages splits the resources in runs of resources of the same kind, which
+// don't depend on each other.
+func stages(resources []Resource) [][]Resource {
+	var stages [][]Resource
+	for i, r := range resources {
+		if i == 0 || r.Kind != resources[i-1].Kind {
+			stages = append(stages, nil)
+		}
+		stages[len(stages)-1] = append(stages[len(stages)-1], r)
+	}
+	return stages
+}
+
+// envSuffix returns the suffix of the environment variables of a declared
+// cluster, e.g. GKE_1 for gke-1.
+func envSuffix(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
@@ -0,0 +1,319 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provision
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/naming"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe/recipetest"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/utils"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// repoRoot is the root of the repository, relative to this package.
+const repoRoot = "../.."
+
+// testRecipe returns a recipe declaring two clusters in us-west1 and one in
+// us-east1, the second one being the config cluster.
+func testRecipe(t *testing.T) *recipe.Recipe {
+	t.Helper()
+	root := t.TempDir()
+	dir := filepath.Join(root, "ingress", "mci")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	metadata := `
+clusters:
+- name: gke-1
+  region: us-west1
+  zone: us-west1-a
+- name: gke-2
+  region: us-east1
+- name: gke-3
+  region: us-west1
+  zone: us-west1-b
+configCluster: gke-2
+`
+	if err := os.WriteFile(filepath.Join(dir, recipe.MetadataFile), []byte(metadata), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := recipe.Load(root, "ingress/mci")
+	if err != nil {
+		t.Fatalf("Load() = %v, want nil", err)
+	}
+	return r
+}
+
+func testEnv(t *testing.T) *utils.Env {
+	t.Helper()
+	t.Setenv("CLOUDSDK_CONFIG", t.TempDir())
+	t.Setenv("CLOUDSDK_CORE_ACCOUNT", "")
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+	env, err := utils.NewEnv("test-project")
+	if err != nil {
+		t.Fatalf("NewEnv() = %v, want nil", err)
+	}
+	t.Cleanup(func() { env.Cleanup() })
+	return env
+}
+
+// summary returns the kind, location and name of the resources.
+func summary(resources []Resource) []string {
+	var s []string
+	for _, r := range resources {
+		s = append(s, r.String())
+	}
+	return s
+}
+
+func TestPlan(t *testing.T) {
+	namer := naming.New("run", "ingress/mci", "me", time.Unix(1700000000, 0))
+	resources, err := Plan(testRecipe(t), namer)
+	if err != nil {
+		t.Fatalf("Plan() = %v, want nil", err)
+	}
+	name := namer.Name()
+	want := []string{
+		"network " + name,
+		"subnet us-west1/" + name + "-us-west1",
+		"subnet us-east1/" + name + "-us-east1",
+		"cluster us-west1-a/" + name + "-1",
+		"cluster us-east1/" + name + "-2",
+		"cluster us-west1-b/" + name + "-3",
+		"membership " + name + "-1",
+		"membership " + name + "-2",
+		"membership " + name + "-3",
+		"feature " + MultiClusterServices,
+		"feature " + MultiClusterIngress,
+	}
+	if got := summary(resources); !reflect.DeepEqual(got, want) {
+		t.Errorf("Plan() = %q, want %q", got, want)
+	}
+	if subnet := resources[2]; subnet.Range != "10.2.0.0/20" || subnet.Network != name {
+		t.Errorf("Plan() subnet = %+v, want the second range in network %s", subnet, name)
+	}
+	if cluster := resources[5]; cluster.Subnet != name+"-us-west1" || !reflect.DeepEqual(cluster.Labels, namer.Labels()) {
+		t.Errorf("Plan() cluster = %+v, want the subnet of us-west1 and the labels of the run", cluster)
+	}
+	if m := resources[7]; m.Cluster != "us-east1/"+name+"-2" {
+		t.Errorf("Plan() membership cluster = %q, want %q", m.Cluster, "us-east1/"+name+"-2")
+	}
+	if f := resources[10]; f.ConfigMembership != name+"-2" || f.Shared || !resources[9].Shared {
+		t.Errorf("Plan() features = %+v, want the config membership of gke-2, and multi-cluster services shared", resources[9:])
+	}
+
+	if _, err := Plan(&recipe.Recipe{Path: "ingress/single"}, namer); err == nil {
+		t.Errorf("Plan() = nil, want an error for a recipe without clusters")
+	}
+}
+
+func TestProvision(t *testing.T) {
+	ctx := context.Background()
+	env := testEnv(t)
+	r := testRecipe(t)
+	namer := naming.New("run", r.Path, "me", time.Now())
+	shared := Resource{Kind: Feature, Name: MultiClusterServices, Shared: true}
+	cloud := NewFakeCloud(shared)
+	p := New(cloud)
+
+	clusters, err := p.Provision(ctx, env, r, namer)
+	if err != nil {
+		t.Fatalf("Provision() = %v, want nil", err)
+	}
+	kubeconfig := env.Get("KUBECONFIG")
+	want := map[string]*utils.Cluster{
+		"gke-1": {Context: "gke-1", Kubeconfig: kubeconfig},
+		"gke-2": {Context: "gke-2", Kubeconfig: kubeconfig},
+		"gke-3": {Context: "gke-3", Kubeconfig: kubeconfig},
+	}
+	if !reflect.DeepEqual(clusters, want) {
+		t.Errorf("Provision() = %+v, want %+v", clusters, want)
+	}
+	if len(cloud.Created) != 10 {
+		t.Errorf("Provision() created %q, want the 10 resources of the plan but the shared feature", summary(cloud.Created))
+	}
+
+	config, err := clientcmd.LoadFromFile(kubeconfig)
+	if err != nil {
+		t.Fatalf("LoadFromFile() = %v, want nil", err)
+	}
+	if config.CurrentContext != "gke-2" {
+		t.Errorf("current context = %q, want the config cluster gke-2", config.CurrentContext)
+	}
+	servers := make(map[string]bool)
+	for _, name := range []string{"gke-1", "gke-2", "gke-3"} {
+		c := config.Clusters[config.Contexts[name].Cluster]
+		if c == nil || string(c.CertificateAuthorityData) != FakeCA || servers[c.Server] {
+			t.Errorf("cluster of context %s = %+v, want its own endpoint and CA", name, c)
+			continue
+		}
+		servers[c.Server] = true
+		if user := config.AuthInfos[config.Contexts[name].AuthInfo]; user == nil || user.Exec == nil || user.Exec.Command != "gke-gcloud-auth-plugin" {
+			t.Errorf("user of context %s = %+v, want gke-gcloud-auth-plugin", name, user)
+		}
+	}
+	for key, want := range map[string]string{
+		"CLUSTER_GKE_1":  namer.Name() + "-1",
+		"LOCATION_GKE_1": "us-west1-a",
+		"LOCATION_GKE_2": "us-east1",
+		"CONFIG_CLUSTER": "gke-2",
+	} {
+		if got := env.Get(key); got != want {
+			t.Errorf("Get(%s) = %q, want %q", key, got, want)
+		}
+	}
+
+	// Another run can't take over the config membership of the project.
+	other := naming.New("other", r.Path, "me", time.Now())
+	if _, err := p.Provision(ctx, testEnv(t), r, other); err == nil || !strings.Contains(err.Error(), "already enabled with config membership") {
+		t.Errorf("Provision() = %v, want an error for the config membership of the first run", err)
+	}
+	for _, res := range cloud.Resources() {
+		if strings.Contains(res.Name, other.Suffix()) {
+			t.Errorf("Provision() left %s, want the resources of the failed run deleted", res)
+		}
+	}
+
+	if err := p.Deprovision(ctx, r, namer); err != nil {
+		t.Fatalf("Deprovision() = %v, want nil", err)
+	}
+	if got := summary(cloud.Resources()); !reflect.DeepEqual(got, []string{shared.String()}) {
+		t.Errorf("Deprovision() left %q, want only the shared feature", got)
+	}
+	// Deprovision cleans up after failed runs, whatever they created.
+	if err := p.Deprovision(ctx, r, namer); err != nil {
+		t.Errorf("Deprovision() = %v, want nil when the resources don't exist", err)
+	}
+}
+
+func TestProvisionFailure(t *testing.T) {
+	ctx := context.Background()
+	r := testRecipe(t)
+	namer := naming.New("run", r.Path, "me", time.Now())
+	cloud := NewFakeCloud()
+	cloud.CreateErrors[namer.Name()+"-3"] = errors.New("quota exceeded")
+
+	_, err := New(cloud).Provision(ctx, testEnv(t), r, namer)
+	if err == nil || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Fatalf("Provision() = %v, want the error of cluster gke-3", err)
+	}
+	if got := summary(cloud.Resources()); len(got) != 0 {
+		t.Errorf("Provision() left %q, want the resources created before the failure deleted", got)
+	}
+	// The clusters created concurrently with the failing one are deleted.
+	if got := summary(cloud.Deleted); len(got) != 5 || got[len(got)-1] != "network "+namer.Name() {
+		t.Errorf("Provision() deleted %q, want 2 clusters, 2 subnets and the network, last", got)
+	}
+}
+
+// stubGcloud returns a Runner recording the commands it runs, and returning
+// the output, or the error, of the first prefix of outputs they start with.
+func stubGcloud(commands *[]string, outputs map[string]interface{}) func(context.Context, ...string) ([]byte, error) {
+	return func(_ context.Context, args ...string) ([]byte, error) {
+		cmd := strings.Join(args, " ")
+		*commands = append(*commands, cmd)
+		for prefix, out := range outputs {
+			if strings.HasPrefix(cmd, prefix) {
+				if err, ok := out.(error); ok {
+					return nil, err
+				}
+				return []byte(out.(string)), nil
+			}
+		}
+		return nil, nil
+	}
+}
+
+func TestGcloudCloud(t *testing.T) {
+	ctx := context.Background()
+	var commands []string
+	g := &GcloudCloud{Project: "test-project", Run: stubGcloud(&commands, map[string]interface{}{
+		"compute firewall-rules list":            "fw-1\nfw-2\n",
+		"container clusters describe":            `{"endpoint": "10.0.0.1", "masterAuth": {"clusterCaCertificate": "ZmFrZQ=="}}`,
+		"container fleet multi-cluster-services": errors.New("gcloud: Feature already enabled"),
+		"container fleet ingress enable --config-membership=projects/test-project/locations/global/memberships/c-2": errors.New("gcloud: Feature already enabled"),
+		"container fleet memberships unregister gone":                                                               errors.New("gcloud: NOT_FOUND: membership gone"),
+	})}
+
+	for _, r := range []Resource{
+		{Kind: Cluster, Name: "c-1", Location: "us-west1-a", Network: "n", Subnet: "s", Labels: map[string]string{"run-id": "run"}},
+		{Kind: Membership, Name: "c-1", Cluster: "us-west1-a/c-1"},
+		{Kind: Feature, Name: MultiClusterServices, Shared: true},
+		{Kind: Feature, Name: MultiClusterIngress, ConfigMembership: "c-1"},
+		{Kind: Feature, Name: MultiClusterIngress, ConfigMembership: "c-2"},
+	} {
+		if err := g.Create(ctx, r); err != nil {
+			t.Errorf("Create(%s) = %v, want nil", r, err)
+		}
+	}
+	if err := g.Delete(ctx, Resource{Kind: Network, Name: "n"}); err != nil {
+		t.Errorf("Delete(network) = %v, want nil", err)
+	}
+	if err := g.Delete(ctx, Resource{Kind: Membership, Name: "gone"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete(gone) = %v, want ErrNotFound", err)
+	}
+	want := []string{
+		"container clusters create c-1 --location=us-west1-a --network=n --subnetwork=s --enable-ip-alias --workload-pool=test-project.svc.id.goog --labels=run-id=run --project=test-project --quiet",
+		"container fleet memberships register c-1 --gke-cluster=us-west1-a/c-1 --enable-workload-identity --project=test-project --quiet",
+		"container fleet multi-cluster-services enable --project=test-project --quiet",
+		"container fleet ingress enable --config-membership=projects/test-project/locations/global/memberships/c-1 --project=test-project --quiet",
+		"container fleet ingress enable --config-membership=projects/test-project/locations/global/memberships/c-2 --project=test-project --quiet",
+		"container fleet ingress update --config-membership=projects/test-project/locations/global/memberships/c-2 --project=test-project --quiet",
+		`compute firewall-rules list --filter=network="n" --format=value(name) --project=test-project`,
+		"compute firewall-rules delete fw-1 --project=test-project --quiet",
+		"compute firewall-rules delete fw-2 --project=test-project --quiet",
+		"compute networks delete n --project=test-project --quiet",
+		"container fleet memberships unregister gone --gke-cluster= --project=test-project --quiet",
+	}
+	if !reflect.DeepEqual(commands, want) {
+		t.Errorf("gcloud commands = %q, want %q", commands, want)
+	}
+
+	endpoint, ca, err := g.Endpoint(ctx, Resource{Kind: Cluster, Name: "c-1", Location: "us-west1-a"})
+	if err != nil || endpoint != "https://10.0.0.1" || string(ca) != "fake" {
+		t.Errorf("Endpoint() = %q, %q, %v, want %q, %q, nil", endpoint, ca, err, "https://10.0.0.1", "fake")
+	}
+}
+
+// TestRecipes checks that the environments of the multi-cluster recipes of
+// the repository can be provisioned, on a fake cloud.
+func TestRecipes(t *testing.T) {
+	recipetest.ForEach(t, repoRoot, func(t *testing.T, r *recipe.Recipe) {
+		if len(r.Metadata.Clusters) == 0 {
+			return
+		}
+		namer := naming.New(naming.NewRunID(time.Now()), r.Path, "me", time.Now())
+		p := New(NewFakeCloud())
+		clusters, err := p.Provision(context.Background(), testEnv(t), r, namer)
+		if err != nil {
+			t.Fatalf("Provision(%s) = %v, want nil", r.Path, err)
+		}
+		if len(clusters) != len(r.Metadata.Clusters) {
+			t.Errorf("Provision(%s) = %d clusters, want %d", r.Path, len(clusters), len(r.Metadata.Clusters))
+		}
+		if err := p.Deprovision(context.Background(), r, namer); err != nil {
+			t.Errorf("Deprovision(%s) = %v, want nil", r.Path, err)
+		}
+	})
+}
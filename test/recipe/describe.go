@@ -0,0 +1,413 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recipe
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/manifest"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Types of the GCP resources referenced by recipes.
+const (
+	ResourceAddress        = "address"
+	ResourceSSLCertificate = "sslCertificate"
+	ResourceSSLPolicy      = "sslPolicy"
+	ResourceSecurityPolicy = "securityPolicy"
+	ResourceCertificateMap = "certificateMap"
+)
+
+// GCPResource is a GCP resource referenced by name in the manifests of a
+// recipe, which must exist before they are applied.
+type GCPResource struct {
+	Type string
+	Name string
+	// Source is the object referencing the resource.
+	Source string
+	// Object is the object referencing the resource.
+	Object *manifest.Object
+}
+
+func (g GCPResource) String() string {
+	return fmt.Sprintf("%s %s, used by %s", g.Type, g.Name, g.Source)
+}
+
+// Kinds of prerequisites.
+const (
+	PrerequisiteEnv     = "env"
+	PrerequisiteAPI     = "api"
+	PrerequisiteFeature = "feature"
+	PrerequisiteRole    = "role"
+	PrerequisiteQuota   = "quota"
+)
+
+// Prerequisite is something a recipe needs to be deployed: an environment
+// variable, an enabled API, a feature of the project or cluster, an IAM role
+// of the caller, or an amount of quota.
+type Prerequisite struct {
+	Kind string
+	Name string
+	// Reason explains why the recipe needs it.
+	Reason string
+	// Project is the environment variable holding the project it applies
+	// to, PROJECT if empty.
+	Project string
+	// Amount is the amount of a quota needed, per region if Regional.
+	Amount   float64
+	Regional bool
+}
+
+func (p Prerequisite) String() string {
+	name := p.Name
+	if p.Kind == PrerequisiteQuota {
+		name = fmt.Sprintf("%g %s", p.Amount, p.Name)
+		if p.Regional {
+			name += " in the region"
+		}
+	}
+	if p.Project != "" {
+		name += " in $" + p.Project
+	}
+	return fmt.Sprintf("%s %s: %s", p.Kind, name, p.Reason)
+}
+
+// Description is the static description of a recipe.
+type Description struct {
+	Recipe        *Recipe
+	Objects       []*manifest.Object
+	EnvVars       []string
+	Resources     []GCPResource
+	Prerequisites []Prerequisite
+	// Errors are the errors of the manifests which could not be parsed. Their
+	// objects are missing from Objects.
+	Errors []error
+}
+
+// ManifestFiles returns the paths of the manifests of the recipe, excluding
+// the ones of the recipes nested in its directory.
+func (r *Recipe) ManifestFiles() ([]string, error) {
+	files, err := manifest.Files(r.Dir)
+	if err != nil {
+		return nil, err
+	}
+	return r.own(files), nil
+}
+
+// Files returns the paths of all the files of the recipe, sorted, excluding
+// the ones of the recipes nested in its directory.
+func (r *Recipe) Files() ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(r.Dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return r.own(files), nil
+}
+
+// own returns the files which are not in the directory of a recipe nested in
+// the one of r.
+func (r *Recipe) own(files []string) []string {
+	var own []string
+	for _, file := range files {
+		nested := false
+		for dir := filepath.Dir(file); dir != filepath.Clean(r.Dir) && len(dir) > len(filepath.Clean(r.Dir)); dir = filepath.Dir(dir) {
+			nested = nested || isRecipeDir(dir)
+		}
+		if !nested {
+			own = append(own, file)
+		}
+	}
+	return own
+}
+
+// Objects returns the objects of the manifests of the recipe. The errors of
+// the manifests which can't be parsed are returned separately.
+func (r *Recipe) Objects() ([]*manifest.Object, []error, error) {
+	files, err := r.ManifestFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+	var objects []*manifest.Object
+	var errs []error
+	for _, file := range files {
+		objs, err := manifest.Load(file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		objects = append(objects, objs...)
+	}
+	return objects, errs, nil
+}
+
+// Describe returns the description of the recipe, from its manifests and
+// test scripts.
+func Describe(r *Recipe) (*Description, error) {
+	objects, errs, err := r.Objects()
+	if err != nil {
+		return nil, err
+	}
+	envVars, err := r.EnvVars()
+	if err != nil {
+		return nil, err
+	}
+	var scripts strings.Builder
+	for _, script := range r.Scripts() {
+		b, err := os.ReadFile(script)
+		if err != nil {
+			return nil, err
+		}
+		scripts.Write(b)
+	}
+	return &Description{
+		Recipe:        r,
+		Objects:       objects,
+		EnvVars:       envVars,
+		Resources:     gcpResources(objects),
+		Prerequisites: prerequisites(objects, envVars, scripts.String(), r.Metadata),
+		Errors:        errs,
+	}, nil
+}
+
+// gcpResources returns the GCP resources referenced by objects.
+func gcpResources(objects []*manifest.Object) []GCPResource {
+	var resources []GCPResource
+	add := func(o *manifest.Object, typ, names string) {
+		for _, name := range strings.Split(names, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				resources = append(resources, GCPResource{Type: typ, Name: name, Source: o.String(), Object: o})
+			}
+		}
+	}
+	for _, o := range objects {
+		annotations := o.GetAnnotations()
+		add(o, ResourceAddress, annotations["kubernetes.io/ingress.global-static-ip-name"])
+		add(o, ResourceAddress, annotations["kubernetes.io/ingress.regional-static-ip-name"])
+		add(o, ResourceSSLCertificate, annotations["ingress.gcp.kubernetes.io/pre-shared-cert"])
+		add(o, ResourceSSLCertificate, annotations["networking.gke.io/pre-shared-certs"])
+		add(o, ResourceCertificateMap, annotations["networking.gke.io/certmap"])
+
+		switch o.GetKind() {
+		case "Gateway":
+			if !IsGatewayAPI(o) {
+				continue
+			}
+			addresses, _, _ := unstructured.NestedSlice(o.Object, "spec", "addresses")
+			for _, a := range addresses {
+				a, ok := a.(map[string]interface{})
+				if ok && a["type"] == "NamedAddress" {
+					add(o, ResourceAddress, fmt.Sprint(a["value"]))
+				}
+			}
+			listeners, _, _ := unstructured.NestedSlice(o.Object, "spec", "listeners")
+			for _, l := range listeners {
+				l, ok := l.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				certs, _, _ := unstructured.NestedString(l, "tls", "options", "networking.gke.io/pre-shared-certs")
+				add(o, ResourceSSLCertificate, certs)
+			}
+		case "FrontendConfig":
+			policy, _, _ := unstructured.NestedString(o.Object, "spec", "sslPolicy")
+			add(o, ResourceSSLPolicy, policy)
+		case "BackendConfig":
+			policy, _, _ := unstructured.NestedString(o.Object, "spec", "securityPolicy", "name")
+			add(o, ResourceSecurityPolicy, policy)
+		case "GCPGatewayPolicy":
+			policy, _, _ := unstructured.NestedString(o.Object, "spec", "default", "sslPolicy")
+			add(o, ResourceSSLPolicy, policy)
+		case "GCPBackendPolicy":
+			policy, _, _ := unstructured.NestedString(o.Object, "spec", "default", "securityPolicy")
+			add(o, ResourceSecurityPolicy, policy)
+		}
+	}
+	return resources
+}
+
+// prerequisites returns the prerequisites of a recipe with the given objects,
+// environment variables, test scripts and metadata, followed by the declared
+// ones.
+func prerequisites(objects []*manifest.Object, envVars []string, scripts string, metadata Metadata) []Prerequisite {
+	var prereqs []Prerequisite
+	seen := make(map[string]bool)
+	addPrereq := func(p Prerequisite) {
+		if key := p.Kind + "/" + p.Name + "/" + p.Project; !seen[key] {
+			seen[key] = true
+			prereqs = append(prereqs, p)
+		}
+	}
+	add := func(kind, name, reason string) {
+		addPrereq(Prerequisite{Kind: kind, Name: name, Reason: reason})
+	}
+
+	for _, v := range metadata.RequiredEnv {
+		add(PrerequisiteEnv, v, "required, the test of the recipe is skipped without it")
+	}
+	for _, v := range envVars {
+		add(PrerequisiteEnv, v, "used by the test scripts")
+	}
+	if len(objects) > 0 || strings.Contains(scripts, "setup_gke_basic") {
+		add(PrerequisiteAPI, "container.googleapis.com", "the recipe is deployed to a GKE cluster")
+		add(PrerequisiteAPI, "compute.googleapis.com", "the recipe creates load balancers")
+	}
+	if len(metadata.Clusters) > 0 {
+		add(PrerequisiteAPI, "container.googleapis.com", "the recipe is deployed to GKE clusters")
+		add(PrerequisiteAPI, "compute.googleapis.com", "the recipe creates load balancers")
+		add(PrerequisiteAPI, "gkehub.googleapis.com", "the declared clusters are registered to a fleet")
+		add(PrerequisiteAPI, "multiclusteringress.googleapis.com", "the config cluster of the declared clusters is enabled")
+		add(PrerequisiteAPI, "multiclusterservicediscovery.googleapis.com", "multi-cluster Services are enabled in the fleet of the declared clusters")
+	}
+	if strings.Contains(scripts, "gcloud dns") {
+		p := Prerequisite{Kind: PrerequisiteAPI, Name: "dns.googleapis.com", Reason: "the test scripts create DNS records"}
+		if strings.Contains(scripts, "DNS_PROJECT") {
+			p.Project = "DNS_PROJECT"
+		}
+		addPrereq(p)
+	}
+	if strings.Contains(scripts, "get_or_create_oauth_brand") {
+		add(PrerequisiteAPI, "iap.googleapis.com", "the test scripts create an OAuth client")
+	}
+	if strings.Contains(scripts, "istioctl") {
+		add(PrerequisiteAPI, "mesh.googleapis.com", "the test scripts install a service mesh")
+	}
+	if strings.Contains(scripts, "setup_ilb") {
+		add(PrerequisiteFeature, "proxy-only subnet", "the test scripts create a proxy-only subnet for internal load balancers")
+	}
+
+	for _, o := range objects {
+		source := "used by " + o.String()
+		switch o.GetKind() {
+		case "Ingress":
+			if IngressClass(o) == "gce-internal" {
+				add(PrerequisiteFeature, "proxy-only subnet", "internal Ingresses need a proxy-only subnet in the region, "+source)
+			}
+		case "Gateway":
+			if !IsGatewayAPI(o) {
+				continue
+			}
+			add(PrerequisiteFeature, "Gateway API", "the Gateway API must be enabled on the cluster, "+source)
+			class, _, _ := unstructured.NestedString(o.Object, "spec", "gatewayClassName")
+			if strings.Contains(class, "rilb") || strings.Contains(class, "regional") {
+				add(PrerequisiteFeature, "proxy-only subnet", "regional Gateways need a proxy-only subnet in the region, "+source)
+			}
+			if strings.Contains(class, "-mc") {
+				add(PrerequisiteAPI, "multiclusteringress.googleapis.com", "multi-cluster Gateways, "+source)
+				add(PrerequisiteAPI, "gkehub.googleapis.com", "the clusters must be registered to a fleet, "+source)
+			}
+		case "MultiClusterIngress", "MultiClusterService":
+			add(PrerequisiteAPI, "multiclusteringress.googleapis.com", "Multi Cluster Ingress, "+source)
+			add(PrerequisiteAPI, "gkehub.googleapis.com", "the clusters must be registered to a fleet, "+source)
+		case "ServiceExport":
+			add(PrerequisiteAPI, "multiclusterservicediscovery.googleapis.com", "multi-cluster Services, "+source)
+			add(PrerequisiteAPI, "gkehub.googleapis.com", "the clusters must be registered to a fleet, "+source)
+		case "ServiceDirectoryRegistrationPolicy":
+			add(PrerequisiteAPI, "servicedirectory.googleapis.com", "Services are registered in Service Directory, "+source)
+		case "BackendConfig":
+			if enabled, _, _ := unstructured.NestedBool(o.Object, "spec", "iap", "enabled"); enabled {
+				add(PrerequisiteAPI, "iap.googleapis.com", "Identity-Aware Proxy, "+source)
+			}
+		case "ManagedCertificate":
+			add(PrerequisiteFeature, "DNS record", "the domains of the certificate must resolve to the load balancer, "+source)
+		}
+		if _, ok := o.GetAnnotations()["networking.gke.io/certmap"]; ok {
+			add(PrerequisiteAPI, "certificatemanager.googleapis.com", "certificate map, "+source)
+		}
+	}
+	for _, d := range metadata.Prerequisites {
+		// Load validates the declared prerequisites.
+		if p, err := d.Prerequisite(); err == nil {
+			addPrereq(p)
+		}
+	}
+	sort.SliceStable(prereqs, func(i, j int) bool { return prereqs[i].Kind < prereqs[j].Kind })
+	return prereqs
+}
+
+// IngressClass returns the class of an Ingress, from its annotation or its
+// spec.
+func IngressClass(o *manifest.Object) string {
+	if class, ok := o.GetAnnotations()["kubernetes.io/ingress.class"]; ok {
+		return class
+	}
+	class, _, _ := unstructured.NestedString(o.Object, "spec", "ingressClassName")
+	return class
+}
+
+// Tags returns the tags declared in the metadata of the recipe, or tags
+// inferred from its objects if it declares none: the kinds of load balancers
+// it uses, "multi-cluster", and "ilb" for internal load balancers.
+func (d *Description) Tags() []string {
+	if len(d.Recipe.Metadata.Tags) > 0 {
+		return d.Recipe.Metadata.Tags
+	}
+	tags := make(map[string]bool)
+	for _, o := range d.Objects {
+		switch o.GetKind() {
+		case "Ingress":
+			if class := IngressClass(o); class == "" || strings.HasPrefix(class, "gce") {
+				tags[string(Ingress)] = true
+				tags["ilb"] = tags["ilb"] || class == "gce-internal"
+			}
+		case "MultiClusterIngress":
+			tags[string(Ingress)] = true
+			tags["multi-cluster"] = true
+		case "Gateway":
+			if !IsGatewayAPI(o) {
+				continue
+			}
+			tags[string(Gateway)] = true
+			class, _, _ := unstructured.NestedString(o.Object, "spec", "gatewayClassName")
+			tags["ilb"] = tags["ilb"] || strings.Contains(class, "rilb")
+			tags["multi-cluster"] = tags["multi-cluster"] || strings.Contains(class, "-mc")
+		case "Service":
+			if typ, _, _ := unstructured.NestedString(o.Object, "spec", "type"); typ == "LoadBalancer" {
+				tags[string(Service)] = true
+				annotations := o.GetAnnotations()
+				tags["ilb"] = tags["ilb"] || annotations["networking.gke.io/load-balancer-type"] == "Internal" || annotations["cloud.google.com/load-balancer-type"] == "Internal"
+			}
+		case "ServiceExport", "MultiClusterService":
+			tags["multi-cluster"] = true
+		}
+	}
+	var sorted []string
+	for tag, ok := range tags {
+		if ok {
+			sorted = append(sorted, tag)
+		}
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// IsGatewayAPI returns true if the object is a resource of the Gateway API,
+// or of its networking.x-k8s.io alpha, rather than e.g. an Istio Gateway.
+func IsGatewayAPI(o *manifest.Object) bool {
+	return strings.HasPrefix(o.GetAPIVersion(), "gateway.networking.k8s.io/") || strings.HasPrefix(o.GetAPIVersion(), "networking.x-k8s.io/")
+}
@@ -0,0 +1,223 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recipe
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/testfiles"
+)
+
+func TestEnvVars(t *testing.T) {
+	root := t.TempDir()
+	testfiles.Write(t, root, map[string]string{
+		"ingress/foo/setup.sh": `
+# ${IN_A_COMMENT} is ignored.
+setup_gke_basic "${test_name}" "${ZONE}" "${REGION}"
+echo "$DNS_NAME ${RESOURCE_SUFFIX}"
+sed -i "s/\$DOMAIN/foo/g" foo.yaml
+export LOCAL_VAR=1
+echo "${LOCAL_VAR}"
+`,
+		"ingress/foo/run-test.sh": `echo "${ZONE}" "${CLOUDSDK_CORE_PROJECT}" "${PROJECT}"`,
+	})
+	r, err := Load(root, "ingress/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.EnvVars()
+	if err != nil {
+		t.Fatalf("EnvVars() = %v, want nil", err)
+	}
+	if want := []string{"DNS_NAME", "REGION", "ZONE"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("EnvVars() = %q, want %q", got, want)
+	}
+}
+
+func TestMissingEnv(t *testing.T) {
+	r := &Recipe{Metadata: Metadata{RequiredEnv: []string{"DNS_PROJECT", "DNS_ZONE", "SUPPORT_EMAIL"}}}
+	env := map[string]string{"DNS_PROJECT": "dns-project", "SUPPORT_EMAIL": ""}
+	if got, want := r.MissingEnv(func(key string) string { return env[key] }), []string{"DNS_ZONE", "SUPPORT_EMAIL"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("MissingEnv() = %q, want %q", got, want)
+	}
+}
+
+// requiredEnvGuard matches the guards of the test scripts checking that an
+// environment variable is set, e.g. [[ -z "${DNS_ZONE-}" ]].
+var requiredEnvGuard = regexp.MustCompile(`-z "\$\{([A-Z][A-Z0-9_]*)-\}"`)
+
+// TestRequiredEnvRepository checks that the recipes of the repository whose
+// test scripts can't run without an environment variable declare it in their
+// requiredEnv, so that their test is skipped instead of failing.
+func TestRequiredEnvRepository(t *testing.T) {
+	recipes, err := Discover(repoRoot)
+	if err != nil {
+		t.Fatalf("Discover(%q) = %v, want nil", repoRoot, err)
+	}
+	for _, r := range recipes {
+		for _, script := range r.Scripts() {
+			b, err := os.ReadFile(script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range requiredEnvGuard.FindAllStringSubmatch(string(b), -1) {
+				if !contains(r.Metadata.RequiredEnv, m[1]) {
+					t.Errorf("%s checks %s, want it in the requiredEnv of %s, got %q", script, m[1], MetadataFile, r.Metadata.RequiredEnv)
+				}
+			}
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	root := t.TempDir()
+	testfiles.Write(t, root, map[string]string{
+		"ingress/foo/setup.sh":    `setup_ilb "${test_name}" "${REGION}"; gcloud dns --project="${DNS_PROJECT}" record-sets create foo`,
+		"ingress/foo/run-test.sh": "",
+		"ingress/foo/recipe.yaml": `
+prerequisites:
+- role: roles/dns.admin
+  project: DNS_PROJECT
+  reason: the test scripts create DNS records
+- quota: CPUS
+  amount: 7
+  regional: true
+  reason: setup_gke_basic creates a cluster and a VM
+- api: iap.googleapis.com
+  reason: declared twice
+`,
+		"ingress/foo/foo.yaml": `
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: foo
+  annotations:
+    kubernetes.io/ingress.class: gce-internal
+    kubernetes.io/ingress.regional-static-ip-name: foo-ip
+    ingress.gcp.kubernetes.io/pre-shared-cert: "cert-a, cert-b"
+---
+apiVersion: networking.gke.io/v1beta1
+kind: FrontendConfig
+metadata:
+  name: foo
+spec:
+  sslPolicy: foo-ssl-policy
+---
+apiVersion: cloud.google.com/v1
+kind: BackendConfig
+metadata:
+  name: foo
+spec:
+  securityPolicy:
+    name: foo-armor
+  iap:
+    enabled: true
+---
+apiVersion: gateway.networking.k8s.io/v1beta1
+kind: Gateway
+metadata:
+  name: gw
+spec:
+  gatewayClassName: gke-l7-rilb
+  addresses:
+  - type: NamedAddress
+    value: gw-ip
+---
+apiVersion: networking.istio.io/v1beta1
+kind: Gateway
+metadata:
+  name: istio
+`,
+		// The manifests of nested recipes are not part of the recipe.
+		"ingress/foo/nested/README.md": "",
+		"ingress/foo/nested/bar.yaml":  "apiVersion: v1\nkind: Service\nmetadata:\n  name: bar\n",
+		"ingress/foo/broken.yaml":      "kind: [",
+	})
+	r, err := Load(root, "ingress/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := Describe(r)
+	if err != nil {
+		t.Fatalf("Describe() = %v, want nil", err)
+	}
+	if len(d.Objects) != 5 || len(d.Errors) != 1 {
+		t.Errorf("Describe() = %d objects, errors %v, want 5 objects and 1 error", len(d.Objects), d.Errors)
+	}
+	files, err := r.Files()
+	var names []string
+	for _, file := range files {
+		names = append(names, filepath.Base(file))
+	}
+	if want := []string{"broken.yaml", "foo.yaml", "recipe.yaml", "run-test.sh", "setup.sh"}; err != nil || !reflect.DeepEqual(names, want) {
+		t.Errorf("Files() = %q, %v, want %q, nil", names, err, want)
+	}
+
+	var resources []string
+	for _, res := range d.Resources {
+		resources = append(resources, res.Type+" "+res.Name)
+	}
+	wantResources := []string{
+		"address foo-ip",
+		"sslCertificate cert-a",
+		"sslCertificate cert-b",
+		"sslPolicy foo-ssl-policy",
+		"securityPolicy foo-armor",
+		"address gw-ip",
+	}
+	if !reflect.DeepEqual(resources, wantResources) {
+		t.Errorf("Resources = %q, want %q", resources, wantResources)
+	}
+
+	prereqs := make(map[string]bool)
+	for _, p := range d.Prerequisites {
+		prereqs[p.Kind+" "+p.Name+" "+p.Project] = true
+	}
+	for _, want := range []string{
+		"env REGION ",
+		"api container.googleapis.com ",
+		"api dns.googleapis.com DNS_PROJECT",
+		"api iap.googleapis.com ",
+		"feature proxy-only subnet ",
+		"feature Gateway API ",
+		"role roles/dns.admin DNS_PROJECT",
+		"quota CPUS ",
+	} {
+		if !prereqs[want] {
+			t.Errorf("Prerequisites = %v, want %q", prereqs, want)
+		}
+	}
+	if n := len(prereqs); n != len(d.Prerequisites) {
+		t.Errorf("Prerequisites = %v, want no duplicates", d.Prerequisites)
+	}
+	for _, p := range d.Prerequisites {
+		if want := "quota 7 CPUS in the region: setup_gke_basic creates a cluster and a VM"; p.Kind == PrerequisiteQuota && p.String() != want {
+			t.Errorf("String() = %q, want %q", p.String(), want)
+		}
+	}
+
+	if got, want := strings.Join(d.Tags(), ","), "gateway,ilb,ingress"; got != want {
+		t.Errorf("Tags() = %q, want %q", got, want)
+	}
+	r.Metadata.Tags = []string{"declared"}
+	if got := d.Tags(); !reflect.DeepEqual(got, []string{"declared"}) {
+		t.Errorf("Tags() = %q, want the declared tags", got)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recipe
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// envVarRef matches the references to environment variables in the test
+	// scripts, $VAR or ${VAR}, but not the escaped ones, \$VAR, which are
+	// placeholders in manifests.
+	envVarRef = regexp.MustCompile(`(?:^|[^\\])\$\{?([A-Z][A-Z0-9_]*)`)
+	// envVarAssignment matches the environment variables set by the test
+	// scripts themselves.
+	envVarAssignment = regexp.MustCompile(`(?m)^\s*(?:export\s+)?([A-Z][A-Z0-9_]*)=`)
+	// envVarName matches the names of the environment variables recipes
+	// can require.
+	envVarName = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+)
+
+// FrameworkEnvVars are the environment variables set by the test framework
+// or the shell, which recipes don't need to be given.
+var FrameworkEnvVars = map[string]bool{
+	"HOME":            true,
+	"KUBECONFIG":      true,
+	"PATH":            true,
+	"PROJECT":         true,
+	"PWD":             true,
+	"RESOURCE_LABELS": true,
+	"RESOURCE_SUFFIX": true,
+	"RUN_ID":          true,
+	"USER":            true,
+}
+
+// EnvVars returns the environment variables the test scripts of the recipe
+// require, e.g. ZONE and REGION, sorted. The variables set by the test
+// framework are not included, see FrameworkEnvVars.
+func (r *Recipe) EnvVars() ([]string, error) {
+	refs := make(map[string]bool)
+	assigned := make(map[string]bool)
+	for _, script := range r.Scripts() {
+		b, err := os.ReadFile(script)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "#") {
+				continue
+			}
+			for _, m := range envVarRef.FindAllStringSubmatch(line, -1) {
+				refs[m[1]] = true
+			}
+		}
+		for _, m := range envVarAssignment.FindAllStringSubmatch(string(b), -1) {
+			assigned[m[1]] = true
+		}
+	}
+	var vars []string
+	for v := range refs {
+		if !assigned[v] && !FrameworkEnvVars[v] && !strings.HasPrefix(v, "CLOUDSDK_") {
+			vars = append(vars, v)
+		}
+	}
+	sort.Strings(vars)
+	return vars, nil
+}
+
+// MissingEnv returns the environment variables required by the recipe, see
+// Metadata.RequiredEnv, which are empty according to getenv.
+func (r *Recipe) MissingEnv(getenv func(string) string) []string {
+	var missing []string
+	for _, v := range r.Metadata.RequiredEnv {
+		if getenv(v) == "" {
+			missing = append(missing, v)
+		}
+	}
+	return missing
+}
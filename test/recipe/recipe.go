@@ -0,0 +1,686 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package recipe discovers the recipes of the repository and their metadata.
+package recipe
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// MetadataFile is the name of the optional file declaring the metadata of a
+// recipe, in its directory. Recipes whose README applies all the manifests of
+// their directory, with kubectl apply -f ., can't have one.
+const MetadataFile = "recipe.yaml"
+
+// ExampleDir is the name of the optional directory of a recipe holding an
+// end-to-end example of the recipe. It is part of the recipe, not a recipe
+// of its own.
+const ExampleDir = "example"
+
+// Categories are the top level directories holding recipes.
+var Categories = []string{"authz", "gateway", "ingress", "service-directory", "services"}
+
+// Test scripts run by the test framework, in order. A recipe is tested if it
+// has a run-test.sh, setup.sh and cleanup.sh are optional.
+const (
+	SetupScript   = "setup.sh"
+	RunTestScript = "run-test.sh"
+	CleanupScript = "cleanup.sh"
+)
+
+// Scripts lists the test scripts in the order they are run.
+var Scripts = []string{SetupScript, RunTestScript, CleanupScript}
+
+// Metadata is the content of the MetadataFile of a recipe.
+type Metadata struct {
+	// Title is the title of the recipe in the catalog, the title of its
+	// README.md by default.
+	Title string `json:"title,omitempty"`
+	// Description is a one line description of the recipe.
+	Description string `json:"description,omitempty"`
+	// Tags classify the recipe, e.g. "ingress" or "ilb".
+	Tags []string `json:"tags,omitempty"`
+	// RequiredEnv are the environment variables the recipe can't be tested
+	// without, e.g. DNS_ZONE. The test framework skips the recipe when one
+	// of them is not set, see MissingEnv.
+	RequiredEnv []string `json:"requiredEnv,omitempty"`
+	// Prerequisites are the prerequisites of the recipe which can't be
+	// inferred from its manifests and test scripts, e.g. the IAM roles its
+	// test scripts need.
+	Prerequisites []DeclaredPrerequisite `json:"prerequisites,omitempty"`
+	// Certificates declares the TLS certificates of the recipe, generated
+	// when it is applied instead of being committed, see package certs.
+	Certificates *Certificates `json:"certificates,omitempty"`
+	// Clusters are the GKE clusters of a multi-cluster recipe, created by
+	// the test framework before its setup.sh and deleted after its
+	// cleanup.sh, see package provision. Single-cluster recipes create their
+	// cluster in setup.sh instead.
+	Clusters []DeclaredCluster `json:"clusters,omitempty"`
+	// ConfigCluster is the name of the cluster whose fleet membership is the
+	// config membership of Multi Cluster Ingress and multi-cluster Gateways,
+	// the cluster the recipe applies them to. It is the first cluster by
+	// default.
+	ConfigCluster string `json:"configCluster,omitempty"`
+	// Placement declares the clusters the manifests of a multi-cluster
+	// recipe are applied to, in order, see package placement.
+	Placement []DeclaredPlacement `json:"placement,omitempty"`
+	// Rollout declares the steps of a recipe rolling out a new version of
+	// its application, e.g. from a blue to a green cluster, see package
+	// rollout.
+	Rollout *Rollout `json:"rollout,omitempty"`
+}
+
+// DeclaredPlacement places manifest files of a recipe on declared clusters.
+type DeclaredPlacement struct {
+	// Files are the manifest files, relative to the recipe directory, or
+	// glob patterns, e.g. gke-1/*.yaml.
+	Files []string `json:"files"`
+	// Clusters are the names of the declared clusters the files are applied
+	// to, e.g. the config cluster for a MultiClusterIngress.
+	Clusters []string `json:"clusters"`
+}
+
+// clusterName matches the names of the clusters declared by recipes, which
+// are also the names of their kubeconfig contexts, e.g. gke-1.
+var clusterName = regexp.MustCompile(`^[a-z]([a-z0-9-]{0,18}[a-z0-9])?$`)
+
+// region matches the names of GCP regions, e.g. us-west1.
+var region = regexp.MustCompile(`^[a-z]+-[a-z]+[0-9]+$`)
+
+// DeclaredCluster is a cluster declared in the MetadataFile of a recipe.
+type DeclaredCluster struct {
+	// Name is the name of the cluster in the recipe, the name of its
+	// kubeconfig context, e.g. gke-1 for kubectl --context=gke-1.
+	Name string `json:"name"`
+	// Region is the region of the cluster. The clusters share one network,
+	// with a subnet in each of their regions.
+	Region string `json:"region"`
+	// Zone is the zone of the cluster, in Region. The cluster is regional if
+	// it is empty.
+	Zone string `json:"zone,omitempty"`
+}
+
+// Location returns the zone of the cluster, or its region if it is regional.
+func (c DeclaredCluster) Location() string {
+	if c.Zone != "" {
+		return c.Zone
+	}
+	return c.Region
+}
+
+// validateClusters returns an error if the clusters of m are not fully
+// declared, and defaults the config cluster to the first one.
+func (m *Metadata) validateClusters() error {
+	if len(m.Clusters) == 0 {
+		if m.ConfigCluster != "" {
+			return fmt.Errorf("config cluster %s is not a declared cluster", m.ConfigCluster)
+		}
+		return nil
+	}
+	names := make(map[string]bool)
+	for _, c := range m.Clusters {
+		switch {
+		case !clusterName.MatchString(c.Name):
+			return fmt.Errorf("cluster %q: name must be a DNS label of at most 20 characters", c.Name)
+		case names[c.Name]:
+			return fmt.Errorf("cluster %s is declared twice", c.Name)
+		case !region.MatchString(c.Region):
+			return fmt.Errorf("cluster %s: %q is not a region", c.Name, c.Region)
+		case c.Zone != "" && !strings.HasPrefix(c.Zone, c.Region+"-"):
+			return fmt.Errorf("cluster %s: zone %q is not in region %s", c.Name, c.Zone, c.Region)
+		}
+		names[c.Name] = true
+	}
+	if m.ConfigCluster == "" {
+		m.ConfigCluster = m.Clusters[0].Name
+	}
+	if !names[m.ConfigCluster] {
+		return fmt.Errorf("config cluster %s is not a declared cluster", m.ConfigCluster)
+	}
+	return nil
+}
+
+// validatePlacement returns an error if the placement of the recipe in dir
+// refers to clusters it doesn't declare, or to files it doesn't have.
+func (m *Metadata) validatePlacement(dir string) error {
+	names := make(map[string]bool)
+	for _, c := range m.Clusters {
+		names[c.Name] = true
+	}
+	for _, p := range m.Placement {
+		if len(p.Files) == 0 || len(p.Clusters) == 0 {
+			return fmt.Errorf("placement %+v must have files and clusters", p)
+		}
+		for _, c := range p.Clusters {
+			if !names[c] {
+				return fmt.Errorf("placement of %q: cluster %s is not a declared cluster", p.Files, c)
+			}
+		}
+		for _, pattern := range p.Files {
+			matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+			if err != nil {
+				return fmt.Errorf("placement of %q: %w", pattern, err)
+			}
+			if len(matches) == 0 {
+				return fmt.Errorf("placement of %q: no such file", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// Defaults of the rollouts.
+const (
+	DefaultRolloutWait      = time.Minute
+	DefaultRolloutTimeout   = 10 * time.Minute
+	DefaultAssertedRequests = 100
+	DefaultTolerance        = 10
+)
+
+// RolloutTargetKinds are the kinds of the objects rollouts can send their
+// requests to, with the JSONPath of their address.
+var RolloutTargetKinds = map[string]string{
+	"Gateway":             "{.status.addresses[0].value}",
+	"Ingress":             "{.status.loadBalancer.ingress[0].ip}",
+	"MultiClusterIngress": "{.status.VIP}",
+	"Service":             "{.status.loadBalancer.ingress[0].ip}",
+}
+
+// Rollout is a sequence of steps applying manifests, each followed by
+// assertions on the traffic the load balancer of the recipe sends to the
+// versions of its application.
+type Rollout struct {
+	// Target is the object whose address the assertions send their
+	// requests to.
+	Target RolloutTarget `json:"target"`
+	// Cluster is the declared cluster the steps are applied to, the config
+	// cluster by default. Single-cluster recipes apply them to their
+	// cluster.
+	Cluster string `json:"cluster,omitempty"`
+	// Wait is how long to wait after applying a step before checking its
+	// assertions, e.g. 30s, DefaultRolloutWait by default.
+	Wait string `json:"wait,omitempty"`
+	// Timeout is how long the assertions of a step are retried for, the
+	// load balancer taking minutes to apply a new configuration,
+	// DefaultRolloutTimeout by default.
+	Timeout string `json:"timeout,omitempty"`
+	// Steps are the steps, in order.
+	Steps []RolloutStep `json:"steps"`
+}
+
+// RolloutTarget is the object the requests of a rollout are sent to, e.g.
+// a Gateway, one of RolloutTargetKinds.
+type RolloutTarget struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// Port is the port of the address, 80 by default.
+	Port int `json:"port,omitempty"`
+}
+
+// RolloutStep is a step of a rollout.
+type RolloutStep struct {
+	// Name names the step in the reports, e.g. canary.
+	Name string `json:"name"`
+	// Files are the manifest files applied by the step, relative to the
+	// recipe directory.
+	Files []string `json:"files"`
+	// Assertions are checked once the files are applied.
+	Assertions []Assertion `json:"assertions,omitempty"`
+}
+
+// Assertion is an assertion on the backends answering the requests sent to
+// the target of a rollout. The backends are identified by the metadata field
+// of the responses of whereami, or by the responses themselves for its
+// /metadata path.
+type Assertion struct {
+	// Path, Host and Headers make the requests, e.g. /metadata and
+	// {cluster: cluster-green} for header routing.
+	Path    string            `json:"path,omitempty"`
+	Host    string            `json:"host,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Requests is the number of requests sent, DefaultAssertedRequests by
+	// default.
+	Requests int `json:"requests,omitempty"`
+	// Backends are the percentages of the requests each backend must
+	// answer, e.g. {sample-app-blue: 90, sample-app-green: 10} for a canary.
+	// They add up to 100.
+	Backends map[string]int `json:"backends"`
+	// Tolerance is the difference in percentage points allowed between the
+	// actual and the declared percentages, DefaultTolerance by default.
+	// Backends declared with 0 or 100 percent must not, or must always,
+	// answer, whatever the tolerance.
+	Tolerance int `json:"tolerance,omitempty"`
+	// Mirror is the backend receiving the copies of the requests made by a
+	// RequestMirror filter, if any: it must receive a copy of each request.
+	Mirror *Mirror `json:"mirror,omitempty"`
+}
+
+// Mirror is the backend a RequestMirror filter copies requests to. Its pods
+// must run the test backend, which records the requests it receives, see
+// package backend.
+type Mirror struct {
+	// Cluster is the declared cluster of the pods, the cluster of the
+	// rollout by default.
+	Cluster   string `json:"cluster,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// Selector is the label selector of the pods, e.g.
+	// app=sample-app,version=v2.
+	Selector string `json:"selector"`
+	// Port is the port of the test backend, 8080 by default.
+	Port int `json:"port,omitempty"`
+}
+
+// validateRollout returns an error if the rollout of the recipe in dir is
+// not fully declared, and defaults its cluster and assertions.
+func (m *Metadata) validateRollout(dir string) error {
+	ro := m.Rollout
+	if ro == nil {
+		return nil
+	}
+	if _, ok := RolloutTargetKinds[ro.Target.Kind]; !ok || ro.Target.Name == "" {
+		return fmt.Errorf("rollout target %+v must have a name and a kind among Gateway, Ingress, MultiClusterIngress and Service", ro.Target)
+	}
+	if ro.Target.Port == 0 {
+		ro.Target.Port = 80
+	}
+	if ro.Cluster == "" {
+		ro.Cluster = m.ConfigCluster
+	}
+	if ro.Cluster != "" && !contains(m.clusterNames(), ro.Cluster) {
+		return fmt.Errorf("rollout cluster %s is not a declared cluster", ro.Cluster)
+	}
+	for _, d := range []struct{ name, value string }{{"wait", ro.Wait}, {"timeout", ro.Timeout}} {
+		if _, err := parseDuration(d.value, 0); err != nil {
+			return fmt.Errorf("rollout %s: %w", d.name, err)
+		}
+	}
+	if len(ro.Steps) == 0 {
+		return errors.New("rollout has no steps")
+	}
+	names := make(map[string]bool)
+	for i := range ro.Steps {
+		s := &ro.Steps[i]
+		switch {
+		case s.Name == "":
+			return fmt.Errorf("rollout step %d has no name", i+1)
+		case names[s.Name]:
+			return fmt.Errorf("rollout step %s is declared twice", s.Name)
+		case len(s.Files) == 0:
+			return fmt.Errorf("rollout step %s has no files", s.Name)
+		}
+		names[s.Name] = true
+		for _, file := range s.Files {
+			if !fileExists(filepath.Join(dir, filepath.FromSlash(file))) {
+				return fmt.Errorf("rollout step %s: %s: no such file", s.Name, file)
+			}
+		}
+		for j := range s.Assertions {
+			a := &s.Assertions[j]
+			if a.Requests == 0 {
+				a.Requests = DefaultAssertedRequests
+			}
+			if a.Tolerance == 0 {
+				a.Tolerance = DefaultTolerance
+			}
+			total := 0
+			for _, percent := range a.Backends {
+				total += percent
+			}
+			switch {
+			case a.Requests < 0 || a.Tolerance < 0:
+				return fmt.Errorf("rollout step %s: assertion %d has a negative number of requests or tolerance", s.Name, j+1)
+			case total != 100:
+				return fmt.Errorf("rollout step %s: the backends of assertion %d add up to %d%%, want 100%%", s.Name, j+1, total)
+			}
+			if mirror := a.Mirror; mirror != nil {
+				if mirror.Cluster == "" {
+					mirror.Cluster = ro.Cluster
+				}
+				if mirror.Port == 0 {
+					mirror.Port = 8080
+				}
+				switch {
+				case mirror.Selector == "":
+					return fmt.Errorf("rollout step %s: the mirror of assertion %d has no selector", s.Name, j+1)
+				case mirror.Cluster != ro.Cluster && !contains(m.clusterNames(), mirror.Cluster):
+					return fmt.Errorf("rollout step %s: the mirror of assertion %d is on cluster %s, which is not a declared cluster", s.Name, j+1, mirror.Cluster)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Durations returns the wait and the timeout of the steps of the rollout.
+func (ro *Rollout) Durations() (wait, timeout time.Duration) {
+	wait, _ = parseDuration(ro.Wait, DefaultRolloutWait)
+	timeout, _ = parseDuration(ro.Timeout, DefaultRolloutTimeout)
+	return wait, timeout
+}
+
+// parseDuration parses a non negative duration, def if it is empty.
+func parseDuration(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %s", s)
+	}
+	return d, nil
+}
+
+// clusterNames returns the names of the declared clusters.
+func (m *Metadata) clusterNames() []string {
+	var names []string
+	for _, c := range m.Clusters {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// Default keys of the certificates in their Secret and ConfigMap.
+const (
+	DefaultCertKey = "tls.crt"
+	DefaultKeyKey  = "tls.key"
+	DefaultCAKey   = "ca.crt"
+)
+
+// hostName matches the DNS names certificates can be issued for, possibly
+// wildcards, e.g. *.domain.com.
+var hostName = regexp.MustCompile(`^(\*\.)?([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// Certificates declares the certificates of a recipe: certificates issued
+// for its hosts by a private CA, in Secrets, and the certificates of the CA
+// the clients and backends verify them with, in a ConfigMap.
+type Certificates struct {
+	// CAConfigMap is the name of the ConfigMap holding the root and
+	// intermediate certificates of the CA under CAKey, DefaultCAKey by
+	// default. There is no ConfigMap if it is empty.
+	CAConfigMap string `json:"caConfigMap,omitempty"`
+	CAKey       string `json:"caKey,omitempty"`
+	// Secrets are the Secrets holding the certificates issued by the CA.
+	Secrets []CertificateSecret `json:"secrets"`
+}
+
+// CertificateSecret is a Secret holding a certificate, with the intermediate
+// certificate of its CA, and its private key.
+type CertificateSecret struct {
+	Name string `json:"name"`
+	// Hosts are the DNS names the certificate is valid for, e.g.
+	// grpc.domain.com.
+	Hosts []string `json:"hosts"`
+	// CertKey and KeyKey are the keys of the certificate and of the private
+	// key in the Secret, DefaultCertKey and DefaultKeyKey by default, which
+	// make it a kubernetes.io/tls Secret. The certificate and the private
+	// key are concatenated if they have the same key, e.g. for HAProxy.
+	CertKey string `json:"certKey,omitempty"`
+	KeyKey  string `json:"keyKey,omitempty"`
+}
+
+// Validate returns an error if the certificates are not fully declared.
+func (c *Certificates) Validate() error {
+	if len(c.Secrets) == 0 {
+		return errors.New("certificates declare no secrets")
+	}
+	names := make(map[string]bool)
+	for _, s := range c.Secrets {
+		switch {
+		case s.Name == "":
+			return fmt.Errorf("certificate secret with hosts %q has no name", s.Hosts)
+		case names[s.Name]:
+			return fmt.Errorf("certificate secret %s is declared twice", s.Name)
+		case len(s.Hosts) == 0:
+			return fmt.Errorf("certificate secret %s has no hosts", s.Name)
+		}
+		names[s.Name] = true
+		for _, host := range s.Hosts {
+			if !hostName.MatchString(host) {
+				return fmt.Errorf("certificate secret %s: %q is not a DNS name", s.Name, host)
+			}
+		}
+	}
+	return nil
+}
+
+// DeclaredPrerequisite is a prerequisite declared in the MetadataFile of a
+// recipe: exactly one of an API, an IAM role of the caller, or an amount of
+// quota.
+type DeclaredPrerequisite struct {
+	// API is the name of an API which must be enabled, e.g.
+	// iap.googleapis.com.
+	API string `json:"api,omitempty"`
+	// Role is an IAM role the caller must be granted on the project, e.g.
+	// roles/iap.admin.
+	Role string `json:"role,omitempty"`
+	// Quota is the metric of a Compute Engine quota, e.g. CPUS, of which
+	// Amount must be available, in the region of the recipe if Regional.
+	Quota    string  `json:"quota,omitempty"`
+	Amount   float64 `json:"amount,omitempty"`
+	Regional bool    `json:"regional,omitempty"`
+	// Project is the environment variable holding the project the
+	// prerequisite applies to, PROJECT if empty, e.g. DNS_PROJECT.
+	Project string `json:"project,omitempty"`
+	// Reason explains why the recipe needs it.
+	Reason string `json:"reason"`
+}
+
+// Prerequisite returns the declared prerequisite as a Prerequisite.
+func (p DeclaredPrerequisite) Prerequisite() (Prerequisite, error) {
+	prereq := Prerequisite{Reason: p.Reason, Project: p.Project}
+	n := 0
+	for _, field := range []struct{ kind, name string }{
+		{PrerequisiteAPI, p.API},
+		{PrerequisiteRole, p.Role},
+		{PrerequisiteQuota, p.Quota},
+	} {
+		if field.name != "" {
+			prereq.Kind, prereq.Name = field.kind, field.name
+			n++
+		}
+	}
+	switch {
+	case n != 1:
+		return prereq, fmt.Errorf("prerequisite %+v must have exactly one of api, role and quota", p)
+	case p.Reason == "":
+		return prereq, fmt.Errorf("prerequisite %s has no reason", prereq.Name)
+	case p.Quota == "" && (p.Amount != 0 || p.Regional):
+		return prereq, fmt.Errorf("prerequisite %s is not a quota, it can't have an amount or be regional", prereq.Name)
+	case p.Quota != "" && p.Amount <= 0:
+		return prereq, fmt.Errorf("quota %s must have a positive amount", p.Quota)
+	}
+	prereq.Amount, prereq.Regional = p.Amount, p.Regional
+	return prereq, nil
+}
+
+// Recipe is a recipe of the repository.
+type Recipe struct {
+	// Path is the path of the recipe directory relative to the root of the
+	// repository, with slashes, e.g. "ingress/single-cluster/ingress-https".
+	Path string
+	// Root is the root of the repository, the directory the test scripts are
+	// run from.
+	Root string
+	// Dir is the path of the recipe directory.
+	Dir string
+	// Metadata is the metadata declared in the MetadataFile of the recipe,
+	// if any.
+	Metadata Metadata
+	// HasMetadata is true if the recipe has a MetadataFile.
+	HasMetadata bool
+}
+
+// Name returns the name of the recipe, the name of its directory. The test
+// framework uses it as the namespace of the recipe.
+func (r *Recipe) Name() string {
+	return path.Base(r.Path)
+}
+
+// Scripts returns the paths of the test scripts of the recipe, in the order
+// they are run.
+func (r *Recipe) Scripts() []string {
+	var scripts []string
+	for _, name := range Scripts {
+		p := filepath.Join(r.Dir, name)
+		if _, err := os.Stat(p); err == nil {
+			scripts = append(scripts, p)
+		}
+	}
+	return scripts
+}
+
+// Tested returns true if the recipe is run by the test framework.
+func (r *Recipe) Tested() bool {
+	_, err := os.Stat(filepath.Join(r.Dir, RunTestScript))
+	return err == nil
+}
+
+// Load returns the recipe in the directory at path, relative to root.
+func Load(root, p string) (*Recipe, error) {
+	p = path.Clean(filepath.ToSlash(p))
+	r := &Recipe{Path: p, Root: root, Dir: filepath.Join(root, filepath.FromSlash(p))}
+	b, err := os.ReadFile(filepath.Join(r.Dir, MetadataFile))
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := sigsyaml.UnmarshalStrict(b, &r.Metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filepath.Join(r.Dir, MetadataFile), err)
+	}
+	for _, v := range r.Metadata.RequiredEnv {
+		if !envVarName.MatchString(v) || FrameworkEnvVars[v] {
+			return nil, fmt.Errorf("invalid %s: %q is not an environment variable the recipe can require", filepath.Join(r.Dir, MetadataFile), v)
+		}
+	}
+	for _, p := range r.Metadata.Prerequisites {
+		if _, err := p.Prerequisite(); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", filepath.Join(r.Dir, MetadataFile), err)
+		}
+	}
+	if c := r.Metadata.Certificates; c != nil {
+		if err := c.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", filepath.Join(r.Dir, MetadataFile), err)
+		}
+	}
+	if err := r.Metadata.validateClusters(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", filepath.Join(r.Dir, MetadataFile), err)
+	}
+	if err := r.Metadata.validatePlacement(r.Dir); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", filepath.Join(r.Dir, MetadataFile), err)
+	}
+	if err := r.Metadata.validateRollout(r.Dir); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", filepath.Join(r.Dir, MetadataFile), err)
+	}
+	r.HasMetadata = true
+	return r, nil
+}
+
+// Discover returns the recipes of the repository at root, sorted by path.
+// A directory of a category is a recipe if it has a MetadataFile, test
+// scripts, or a README.md and manifests, possibly in subdirectories without
+// a README.md. The example directory of a recipe belongs to the recipe, even
+// if it has a MetadataFile, e.g. to declare the certificates of the example.
+func Discover(root string) ([]*Recipe, error) {
+	var recipes []*Recipe
+	for _, category := range Categories {
+		err := filepath.WalkDir(filepath.Join(root, category), func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if !d.IsDir() || !isRecipeDir(p) {
+				return nil
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			r, err := Load(root, rel)
+			if err != nil {
+				return err
+			}
+			recipes = append(recipes, r)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(recipes, func(i, j int) bool { return recipes[i].Path < recipes[j].Path })
+	return recipes, nil
+}
+
+func isRecipeDir(dir string) bool {
+	if filepath.Base(dir) == ExampleDir && isRecipeDir(filepath.Dir(dir)) {
+		return false
+	}
+	exists := func(pattern string) bool {
+		matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+		return len(matches) > 0
+	}
+	if exists(MetadataFile) {
+		return true
+	}
+	for _, script := range Scripts {
+		if exists(script) {
+			return true
+		}
+	}
+	if !exists("README.md") {
+		return false
+	}
+	if exists("*.yaml") || exists("*.yml") {
+		return true
+	}
+	// Multi-cluster recipes may keep the manifests of each cluster in a
+	// subdirectory, e.g. gke-1/.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		sub := filepath.Join(dir, e.Name())
+		if !e.IsDir() || fileExists(filepath.Join(sub, "README.md")) {
+			continue
+		}
+		if yaml, _ := filepath.Glob(filepath.Join(sub, "*.yaml")); len(yaml) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
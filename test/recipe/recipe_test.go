@@ -0,0 +1,168 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recipe
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/testfiles"
+)
+
+// repoRoot is the root of the repository, relative to this package.
+const repoRoot = "../.."
+
+func TestDiscover(t *testing.T) {
+	root := t.TempDir()
+	testfiles.Write(t, root, map[string]string{
+		"ingress/single-cluster/tested/run-test.sh":   "",
+		"ingress/single-cluster/tested/setup.sh":      "",
+		"ingress/single-cluster/documented/README.md": "",
+		"ingress/single-cluster/documented/app.yaml":  "",
+		// The example of a recipe is part of it, even with a recipe.yaml.
+		"ingress/single-cluster/documented/example/recipe.yaml": "",
+		"ingress/single-cluster/documented/example/app.yaml":    "",
+		"ingress/single-cluster/readme-only/README.md":          "",
+		"gateway/with-metadata/recipe.yaml":                     "description: A recipe.\ntags: [gateway, ilb]\n",
+		"gateway/with-metadata/nested/setup.sh":                 "",
+		"docs/not-a-category/run-test.sh":                       "",
+	})
+
+	recipes, err := Discover(root)
+	if err != nil {
+		t.Fatalf("Discover() = %v, want nil", err)
+	}
+	var paths []string
+	for _, r := range recipes {
+		paths = append(paths, r.Path)
+	}
+	want := []string{
+		"gateway/with-metadata",
+		"gateway/with-metadata/nested",
+		"ingress/single-cluster/documented",
+		"ingress/single-cluster/tested",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("Discover() = %q, want %q", paths, want)
+	}
+
+	r := recipes[0]
+	if wantMetadata := (Metadata{Description: "A recipe.", Tags: []string{"gateway", "ilb"}}); !r.HasMetadata || !reflect.DeepEqual(r.Metadata, wantMetadata) {
+		t.Errorf("Metadata = %+v, %v, want %+v, true", r.Metadata, r.HasMetadata, wantMetadata)
+	}
+	if r.Tested() {
+		t.Errorf("%s: Tested() = true, want false", r.Path)
+	}
+	r = recipes[3]
+	if r.Name() != "tested" || !r.Tested() {
+		t.Errorf("Name(), Tested() = %q, %v, want %q, true", r.Name(), r.Tested(), "tested")
+	}
+	wantScripts := []string{filepath.Join(r.Dir, SetupScript), filepath.Join(r.Dir, RunTestScript)}
+	if got := r.Scripts(); !reflect.DeepEqual(got, wantScripts) {
+		t.Errorf("Scripts() = %q, want %q", got, wantScripts)
+	}
+}
+
+func TestLoadInvalidMetadata(t *testing.T) {
+	for _, tc := range []struct {
+		desc, metadata string
+	}{
+		{"unknown field", "unknown: field\n"},
+		{"invalid required environment variable", "requiredEnv: [dns-zone]\n"},
+		{"required environment variable set by the framework", "requiredEnv: [PROJECT]\n"},
+		{"prerequisite without kind", "prerequisites:\n- reason: why\n"},
+		{"prerequisite with two kinds", "prerequisites:\n- api: iap.googleapis.com\n  role: roles/iap.admin\n  reason: why\n"},
+		{"prerequisite without reason", "prerequisites:\n- api: iap.googleapis.com\n"},
+		{"quota without amount", "prerequisites:\n- quota: CPUS\n  reason: why\n"},
+		{"regional role", "prerequisites:\n- role: roles/iap.admin\n  regional: true\n  reason: why\n"},
+		{"certificates without secrets", "certificates:\n  caConfigMap: settings\n"},
+		{"certificate secret without hosts", "certificates:\n  secrets:\n  - name: fe-secret\n"},
+		{"certificate secret declared twice", "certificates:\n  secrets:\n  - name: fe-secret\n    hosts: [a.domain.com]\n  - name: fe-secret\n    hosts: [b.domain.com]\n"},
+		{"cluster without region", "clusters:\n- name: gke-1\n"},
+		{"cluster declared twice", "clusters:\n- name: gke-1\n  region: us-west1\n- name: gke-1\n  region: us-east1\n"},
+		{"cluster in a zone of another region", "clusters:\n- name: gke-1\n  region: us-west1\n  zone: us-east1-b\n"},
+		{"cluster with an invalid name", "clusters:\n- name: GKE_1\n  region: us-west1\n"},
+		{"placement on an undeclared cluster", "clusters:\n- name: gke-1\n  region: us-west1\nplacement:\n- files: [app.yaml]\n  clusters: [gke-2]\n"},
+		{"placement of a missing file", "clusters:\n- name: gke-1\n  region: us-west1\nplacement:\n- files: [missing.yaml]\n  clusters: [gke-1]\n"},
+		{"placement without clusters", "clusters:\n- name: gke-1\n  region: us-west1\nplacement:\n- files: [app.yaml]\n"},
+		{"undeclared config cluster", "clusters:\n- name: gke-1\n  region: us-west1\nconfigCluster: gke-2\n"},
+		{"rollout without steps", "rollout:\n  target:\n    kind: Gateway\n    name: gw\n  steps: []\n"},
+		{"rollout target of an unknown kind", "rollout:\n  target:\n    kind: Pod\n    name: gw\n  steps:\n  - name: blue\n    files: [app.yaml]\n"},
+		{"rollout on an undeclared cluster", "rollout:\n  target:\n    kind: Gateway\n    name: gw\n  cluster: gke-1\n  steps:\n  - name: blue\n    files: [app.yaml]\n"},
+		{"rollout step of a missing file", "rollout:\n  target:\n    kind: Gateway\n    name: gw\n  steps:\n  - name: blue\n    files: [missing.yaml]\n"},
+		{"rollout with an invalid wait", "rollout:\n  target:\n    kind: Gateway\n    name: gw\n  wait: 1 minute\n  steps:\n  - name: blue\n    files: [app.yaml]\n"},
+		{"rollout assertion not adding up to 100%", "rollout:\n  target:\n    kind: Gateway\n    name: gw\n  steps:\n  - name: canary\n    files: [app.yaml]\n    assertions:\n    - backends: {blue: 90, green: 20}\n"},
+		{"rollout mirror without selector", "rollout:\n  target:\n    kind: Gateway\n    name: gw\n  steps:\n  - name: mirroring\n    files: [app.yaml]\n    assertions:\n    - backends: {blue: 100}\n      mirror:\n        namespace: bg\n"},
+		{"certificate for a URL", "certificates:\n  secrets:\n  - name: fe-secret\n    hosts: [\"https://grpc.domain.com\"]\n"},
+	} {
+		root := t.TempDir()
+		testfiles.Write(t, root, map[string]string{"ingress/foo/recipe.yaml": tc.metadata, "ingress/foo/app.yaml": ""})
+		if _, err := Load(root, "ingress/foo"); err == nil {
+			t.Errorf("Load() = nil, want an error for a %s", tc.desc)
+		}
+	}
+}
+
+func TestLoadClusters(t *testing.T) {
+	root := t.TempDir()
+	testfiles.Write(t, root, map[string]string{"ingress/mci/recipe.yaml": `
+clusters:
+- name: gke-1
+  region: us-west1
+  zone: us-west1-a
+- name: gke-2
+  region: us-east1
+`})
+	r, err := Load(root, "ingress/mci")
+	if err != nil {
+		t.Fatalf("Load() = %v, want nil", err)
+	}
+	if r.Metadata.ConfigCluster != "gke-1" {
+		t.Errorf("ConfigCluster = %q, want the first cluster gke-1", r.Metadata.ConfigCluster)
+	}
+	var locations []string
+	for _, c := range r.Metadata.Clusters {
+		locations = append(locations, c.Location())
+	}
+	if want := []string{"us-west1-a", "us-east1"}; !reflect.DeepEqual(locations, want) {
+		t.Errorf("Location() = %q, want %q", locations, want)
+	}
+}
+
+// TestDiscoverRepository checks that the metadata of the recipes of the
+// repository is valid, and that the recipes tested until now are still
+// discovered.
+func TestDiscoverRepository(t *testing.T) {
+	recipes, err := Discover(repoRoot)
+	if err != nil {
+		t.Fatalf("Discover(%q) = %v, want nil", repoRoot, err)
+	}
+	tested := make(map[string]bool)
+	for _, r := range recipes {
+		if r.Tested() {
+			tested[r.Path] = true
+		}
+	}
+	for _, want := range []string{
+		"authz/authz-cr-validation",
+		"ingress/single-cluster/ingress-external-basic",
+		"ingress/single-cluster/ingress-https",
+	} {
+		if !tested[want] {
+			t.Errorf("Discover(%q) = %v, want %q tested", repoRoot, tested, want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package recipetest runs the checks of the packages analyzing the recipes
+// against every recipe of the repository, in their tests.
+package recipetest
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+)
+
+// ForEach runs fn in a subtest named after the path of each recipe of the
+// repository at root, see recipe.Discover.
+func ForEach(t *testing.T, root string, fn func(t *testing.T, r *recipe.Recipe)) {
+	t.Helper()
+	recipes, err := recipe.Discover(root)
+	if err != nil {
+		t.Fatalf("Discover(%q) = %v, want nil", root, err)
+	}
+	if len(recipes) == 0 {
+		t.Fatalf("Discover(%q) = no recipes, want the recipes of the repository", root)
+	}
+	for _, r := range recipes {
+		r := r
+		t.Run(r.Path, func(t *testing.T) { fn(t, r) })
+	}
+}
+
+// ForEachDescribed is ForEach for the descriptions of the recipes, see
+// recipe.Describe.
+func ForEachDescribed(t *testing.T, root string, fn func(t *testing.T, d *recipe.Description)) {
+	t.Helper()
+	ForEach(t, root, func(t *testing.T, r *recipe.Recipe) {
+		d, err := recipe.Describe(r)
+		if err != nil {
+			t.Fatalf("Describe(%s) = %v, want nil", r.Path, err)
+		}
+		fn(t, d)
+	})
+}
+
+// Find returns the recipe at path of the repository at root, failing the
+// test if there is none.
+func Find(t *testing.T, root, path string) *recipe.Recipe {
+	t.Helper()
+	r, err := recipe.Load(root, path)
+	if err != nil {
+		t.Fatalf("Load(%q, %q) = %v, want nil", root, path, err)
+	}
+	return r
+}
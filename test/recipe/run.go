@@ -0,0 +1,184 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recipe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/naming"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/utils"
+	"k8s.io/klog/v2"
+)
+
+// RunOptions configures Run.
+type RunOptions struct {
+	// Phases are the test scripts to run, in order, e.g. SetupScript. All the
+	// test scripts of the recipe are run if empty.
+	Phases []string
+	// RunID, Owner and ExpiresAt name and label the resources created by
+	// the test scripts, see naming.Namer.
+	RunID     string
+	Owner     string
+	ExpiresAt time.Time
+	// Output receives the output of the test scripts. It is discarded if
+	// nil.
+	Output io.Writer
+	// Clusters provisions the clusters the recipe declares, see
+	// Metadata.Clusters. Recipes declaring clusters can't run without it.
+	Clusters ClusterProvisioner
+	// OnClusters, if set, is called with the handles of the clusters the
+	// recipe declares, by name, e.g. gke-1, once they are provisioned or
+	// connected to, before the test scripts run. The handles are only valid
+	// until Run returns. An error fails the run.
+	OnClusters func(clusters map[string]*utils.Cluster) error
+}
+
+// ClusterProvisioner creates and deletes the clusters declared by recipes,
+// see package provision. The clusters and the resources they depend on are
+// named by the Namer of the run.
+type ClusterProvisioner interface {
+	// Provision creates the clusters of r, and connects env to them.
+	Provision(ctx context.Context, env *utils.Env, r *Recipe, namer *naming.Namer) (map[string]*utils.Cluster, error)
+	// Connect adds the contexts of the clusters of r, named after them, to
+	// the kubeconfig of env, and sets the variables the test scripts find
+	// them with. It returns the handles of the clusters by name.
+	Connect(ctx context.Context, env *utils.Env, r *Recipe, namer *naming.Namer) (map[string]*utils.Cluster, error)
+	// Deprovision deletes the clusters of r, and the resources they depend
+	// on.
+	Deprovision(ctx context.Context, r *Recipe, namer *naming.Namer) error
+}
+
+// Run runs the test scripts of the recipe like the test framework does in
+// Prow: from the root of the repository, in an environment derived from env
+// with its own kubeconfig, and with the resource names and labels derived for
+// the run. It stops at the first failing script, without running the next
+// ones, cleanup.sh included.
+// The clusters the recipe declares are provisioned before the setup phase,
+// and deleted after the cleanup phase. They are also deleted when a run
+// provisioning them fails, since its cleanup.sh doesn't run.
+func Run(env *utils.Env, r *Recipe, opts RunOptions) (err error) {
+	phases := opts.Phases
+	if len(phases) == 0 {
+		phases = Scripts
+	}
+	var scripts []string
+	for _, phase := range phases {
+		found := false
+		for _, script := range r.Scripts() {
+			if filepath.Base(script) == phase {
+				scripts = append(scripts, script)
+				found = true
+			}
+		}
+		if !found && len(opts.Phases) > 0 {
+			return fmt.Errorf("recipe %s has no %s", r.Path, phase)
+		}
+	}
+	if opts.Output == nil {
+		opts.Output = io.Discard
+	}
+	multiCluster := len(r.Metadata.Clusters) > 0
+	if multiCluster && opts.Clusters == nil {
+		return fmt.Errorf("recipe %s declares clusters, but nothing provisions them", r.Path)
+	}
+
+	recipeEnv, err := env.ForRecipe(r.Path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := recipeEnv.Cleanup(); err != nil {
+			klog.Errorf("Cleanup() = %v", err)
+		}
+	}()
+	namer := naming.New(opts.RunID, r.Path, opts.Owner, opts.ExpiresAt)
+	recipeEnv.SetNamer(namer)
+	klog.Infof("Recipe %s names its resources %s", r.Path, namer.Name())
+
+	if multiCluster {
+		ctx := context.Background()
+		provisions := contains(phases, SetupScript)
+		defer func() {
+			if !contains(phases, CleanupScript) && (!provisions || err == nil) {
+				return
+			}
+			if derr := opts.Clusters.Deprovision(ctx, r, namer); derr != nil {
+				err = errors.Join(err, fmt.Errorf("recipe %s failed to delete its clusters: %w", r.Path, derr))
+			}
+		}()
+
+		var clusters map[string]*utils.Cluster
+		switch {
+		case provisions:
+			clusters, err = opts.Clusters.Provision(ctx, recipeEnv, r, namer)
+		case contains(phases, RunTestScript):
+			clusters, err = opts.Clusters.Connect(ctx, recipeEnv, r, namer)
+		default:
+			// The clusters may be partially deleted already, cleanup.sh
+			// must cope with it.
+			if clusters, err = opts.Clusters.Connect(ctx, recipeEnv, r, namer); err != nil {
+				klog.Warningf("Recipe %s can't connect to its clusters: %v", r.Path, err)
+				err = nil
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("recipe %s: %w", r.Path, err)
+		}
+		for _, c := range r.Metadata.Clusters {
+			if cluster, ok := clusters[c.Name]; ok {
+				klog.Infof("Recipe %s uses context %q", r.Path, cluster.Context)
+			}
+		}
+		if opts.OnClusters != nil && clusters != nil {
+			if err := opts.OnClusters(clusters); err != nil {
+				return fmt.Errorf("recipe %s: %w", r.Path, err)
+			}
+		}
+	}
+
+	for _, script := range scripts {
+		rel, err := filepath.Rel(r.Root, script)
+		if err != nil {
+			return err
+		}
+		cmd := recipeEnv.Command("bash", rel)
+		cmd.Dir = r.Root
+		cmd.Stdout = opts.Output
+		cmd.Stderr = opts.Output
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("recipe %s failed when running %q: %w", r.Path, rel, err)
+		}
+		if filepath.Base(script) == SetupScript && !multiCluster {
+			if cluster, err := recipeEnv.Cluster(); err == nil {
+				klog.Infof("Recipe %s uses context %q", r.Path, cluster.Context)
+			}
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,198 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recipe
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/naming"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/testfiles"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/utils"
+)
+
+func newTestEnv(t *testing.T) *utils.Env {
+	t.Helper()
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+	t.Setenv("CLOUDSDK_CONFIG", t.TempDir())
+	t.Setenv("CLOUDSDK_CORE_ACCOUNT", "")
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+	env, err := utils.NewEnv("test-project")
+	if err != nil {
+		t.Fatalf("NewEnv() = %v, want nil", err)
+	}
+	t.Cleanup(func() { env.Cleanup() })
+	return env
+}
+
+func TestRun(t *testing.T) {
+	env := newTestEnv(t)
+	root := t.TempDir()
+	testfiles.Write(t, root, map[string]string{
+		// Scripts are run from the root of the repository.
+		"test/helper.sh":             "helper=loaded",
+		"ingress/foo/setup.sh":       `source ./test/helper.sh; echo "setup ${helper} ${PROJECT} ${RESOURCE_SUFFIX}"`,
+		"ingress/foo/run-test.sh":    `echo "run-test ${RESOURCE_LABELS}"`,
+		"ingress/foo/cleanup.sh":     `echo cleanup`,
+		"ingress/failing/setup.sh":   `exit 1`,
+		"ingress/failing/cleanup.sh": `echo cleanup`,
+	})
+	r, err := Load(root, "ingress/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := RunOptions{RunID: "run", Owner: "me", ExpiresAt: time.Unix(1700000000, 0)}
+
+	var out bytes.Buffer
+	opts.Output = &out
+	if err := Run(env, r, opts); err != nil {
+		t.Fatalf("Run() = %v, want nil", err)
+	}
+	suffix := naming.New("run", "ingress/foo", "", time.Time{}).Suffix()
+	for _, want := range []string{
+		"setup loaded test-project " + suffix + "\n",
+		"run-test expires-at=1700000000,owner=me,recipe=foo,run-id=run\n",
+		"cleanup\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Run() output = %q, want %q", out.String(), want)
+		}
+	}
+
+	out.Reset()
+	opts.Phases = []string{CleanupScript}
+	if err := Run(env, r, opts); err != nil || out.String() != "cleanup\n" {
+		t.Errorf("Run(%q) = %v, output %q, want nil, %q", opts.Phases, err, out.String(), "cleanup\n")
+	}
+
+	failing, err := Load(root, "ingress/failing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	opts.Phases = nil
+	if err := Run(env, failing, opts); err == nil || strings.Contains(out.String(), "cleanup") {
+		t.Errorf("Run() = %v, output %q, want an error and cleanup.sh not run", err, out.String())
+	}
+	opts.Phases = []string{RunTestScript}
+	if err := Run(env, failing, opts); err == nil {
+		t.Errorf("Run(%q) = nil, want an error for a missing script", opts.Phases)
+	}
+}
+
+// stubProvisioner is a ClusterProvisioner recording the calls made to it in
+// the output of the test scripts.
+type stubProvisioner struct {
+	out *bytes.Buffer
+}
+
+func (s *stubProvisioner) connect(call string, env *utils.Env) (map[string]*utils.Cluster, error) {
+	s.out.WriteString(call + "\n")
+	env.Set("CLUSTER_GKE_1", "cluster-1")
+	return map[string]*utils.Cluster{"gke-1": {Context: "gke-1"}}, nil
+}
+
+func (s *stubProvisioner) Provision(_ context.Context, env *utils.Env, _ *Recipe, _ *naming.Namer) (map[string]*utils.Cluster, error) {
+	return s.connect("provision", env)
+}
+
+func (s *stubProvisioner) Connect(_ context.Context, env *utils.Env, _ *Recipe, _ *naming.Namer) (map[string]*utils.Cluster, error) {
+	return s.connect("connect", env)
+}
+
+func (s *stubProvisioner) Deprovision(context.Context, *Recipe, *naming.Namer) error {
+	s.out.WriteString("deprovision\n")
+	return nil
+}
+
+func TestRunMultiCluster(t *testing.T) {
+	env := newTestEnv(t)
+	root := t.TempDir()
+	testfiles.Write(t, root, map[string]string{
+		"ingress/mci/recipe.yaml":         "clusters:\n- name: gke-1\n  region: us-west1\n",
+		"ingress/mci/setup.sh":            `echo "setup ${CLUSTER_GKE_1}"`,
+		"ingress/mci/run-test.sh":         `echo "run-test ${CLUSTER_GKE_1}"`,
+		"ingress/mci/cleanup.sh":          `echo cleanup`,
+		"ingress/failing-mci/recipe.yaml": "clusters:\n- name: gke-1\n  region: us-west1\n",
+		"ingress/failing-mci/setup.sh":    `exit 1`,
+		"ingress/failing-mci/cleanup.sh":  `echo cleanup`,
+	})
+	r, err := Load(root, "ingress/mci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing, err := Load(root, "ingress/failing-mci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	opts := RunOptions{RunID: "run", Output: &out}
+	if err := Run(env, r, opts); err == nil {
+		t.Errorf("Run() = nil, want an error without a ClusterProvisioner")
+	}
+
+	opts.Clusters = &stubProvisioner{out: &out}
+	var handles map[string]*utils.Cluster
+	opts.OnClusters = func(clusters map[string]*utils.Cluster) error {
+		handles = clusters
+		return nil
+	}
+	for _, tc := range []struct {
+		phases []string
+		want   string
+	}{
+		{nil, "provision\nsetup cluster-1\nrun-test cluster-1\ncleanup\ndeprovision\n"},
+		// The clusters are kept for the next phases.
+		{[]string{SetupScript}, "provision\nsetup cluster-1\n"},
+		{[]string{RunTestScript}, "connect\nrun-test cluster-1\n"},
+		{[]string{CleanupScript}, "connect\ncleanup\ndeprovision\n"},
+	} {
+		out.Reset()
+		handles = nil
+		opts.Phases = tc.phases
+		if err := Run(env, r, opts); err != nil || out.String() != tc.want {
+			t.Errorf("Run(%q) = %v, output %q, want nil, %q", tc.phases, err, out.String(), tc.want)
+		}
+		if handles["gke-1"] == nil || handles["gke-1"].Context != "gke-1" {
+			t.Errorf("Run(%q) passed the clusters %v to OnClusters, want gke-1", tc.phases, handles)
+		}
+	}
+
+	// A run provisioning the clusters deletes them when it fails, cleanup.sh
+	// not being run.
+	for _, tc := range []struct {
+		desc       string
+		r          *Recipe
+		onClusters func(map[string]*utils.Cluster) error
+		want       string
+	}{
+		{"failing setup.sh", failing, nil, "provision\ndeprovision\n"},
+		{"failing OnClusters", r, func(map[string]*utils.Cluster) error { return errors.New("unreachable") }, "provision\ndeprovision\n"},
+	} {
+		out.Reset()
+		opts.Phases = nil
+		opts.OnClusters = tc.onClusters
+		if err := Run(env, tc.r, opts); err == nil || out.String() != tc.want {
+			t.Errorf("Run() with %s = %v, output %q, want an error, %q", tc.desc, err, out.String(), tc.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recipe
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Kind is the kind of load balancing a scaffolded recipe demonstrates.
+type Kind string
+
+const (
+	Ingress Kind = "ingress"
+	Gateway Kind = "gateway"
+	Service Kind = "service"
+)
+
+// Kinds lists the supported kinds.
+var Kinds = []Kind{Ingress, Gateway, Service}
+
+//go:embed templates/*.tmpl
+var templates embed.FS
+
+// ScaffoldOptions configures the recipe generated by Scaffold.
+type ScaffoldOptions struct {
+	Kind Kind
+	// ILB makes the recipe use an internal load balancer.
+	ILB bool
+	// Now returns the current time, used for the copyright year. Defaults
+	// to time.Now.
+	Now func() time.Time
+}
+
+// scaffoldData is the data the templates are executed with.
+type scaffoldData struct {
+	Name     string
+	Title    string
+	Path     string
+	Manifest string
+	Kind     Kind
+	ILB      bool
+	Tags     []string
+	Year     int
+}
+
+// scaffoldFile is a file generated by Scaffold.
+type scaffoldFile struct {
+	name     string
+	template string
+	mode     os.FileMode
+}
+
+// Scaffold generates the recipe at path, relative to root: a manifest, a
+// README skeleton, a MetadataFile registering it for discovery, and test
+// scripts using the test helpers. It returns the paths of the generated
+// files. Nothing is written if any of the files already exists.
+func Scaffold(root, p string, opts ScaffoldOptions) ([]string, error) {
+	p = path.Clean(filepath.ToSlash(p))
+	if err := validatePath(p); err != nil {
+		return nil, err
+	}
+	if !isKind(opts.Kind) {
+		return nil, fmt.Errorf("unknown kind %q, want one of %v", opts.Kind, Kinds)
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	name := path.Base(p)
+	data := scaffoldData{
+		Name:     name,
+		Title:    Title(name),
+		Path:     p,
+		Manifest: name + ".yaml",
+		Kind:     opts.Kind,
+		ILB:      opts.ILB,
+		Tags:     []string{string(opts.Kind)},
+		Year:     opts.Now().Year(),
+	}
+	if opts.ILB {
+		data.Tags = append(data.Tags, "ilb")
+	}
+	files := []scaffoldFile{
+		{name: "README.md", template: "README.md.tmpl", mode: 0644},
+		{name: MetadataFile, template: "recipe.yaml.tmpl", mode: 0644},
+		{name: data.Manifest, template: string(opts.Kind) + ".yaml.tmpl", mode: 0644},
+		{name: SetupScript, template: "setup.sh.tmpl", mode: 0755},
+		{name: RunTestScript, template: "run-test.sh.tmpl", mode: 0755},
+		{name: CleanupScript, template: "cleanup.sh.tmpl", mode: 0755},
+	}
+
+	// Render everything first, so that nothing is written on error.
+	dir := filepath.Join(root, filepath.FromSlash(p))
+	contents := make([][]byte, len(files))
+	var existing []string
+	for i, f := range files {
+		tmpl, err := template.ParseFS(templates, "templates/"+f.template)
+		if err != nil {
+			return nil, err
+		}
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, data); err != nil {
+			return nil, fmt.Errorf("failed to render %s: %w", f.name, err)
+		}
+		contents[i] = b.Bytes()
+		if _, err := os.Lstat(filepath.Join(dir, f.name)); err == nil {
+			existing = append(existing, filepath.Join(dir, f.name))
+		}
+	}
+	if len(existing) > 0 {
+		return nil, fmt.Errorf("refusing to overwrite existing files: %s", strings.Join(existing, ", "))
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var written []string
+	for i, f := range files {
+		target := filepath.Join(dir, f.name)
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, f.mode)
+		if err != nil {
+			return written, err
+		}
+		if _, err := out.Write(contents[i]); err != nil {
+			out.Close()
+			return written, err
+		}
+		if err := out.Close(); err != nil {
+			return written, err
+		}
+		written = append(written, target)
+	}
+	return written, nil
+}
+
+// validatePath returns an error if p can't be the path of a new recipe: it
+// must be in a category, and its name must be a valid namespace name.
+func validatePath(p string) error {
+	if path.IsAbs(p) || strings.HasPrefix(p, "../") {
+		return fmt.Errorf("recipe path %q must be relative to the root of the repository", p)
+	}
+	parts := strings.Split(p, "/")
+	category := parts[0]
+	found := false
+	for _, c := range Categories {
+		found = found || c == category
+	}
+	if !found || len(parts) < 2 {
+		return fmt.Errorf("recipe path %q must be in one of %v", p, Categories)
+	}
+	name := parts[len(parts)-1]
+	if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+		return fmt.Errorf("recipe name %q is used as a namespace name: %s", name, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+func isKind(k Kind) bool {
+	for _, kind := range Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Title turns the name of a recipe into a README title, e.g.
+// "ingress-external-basic" into "Ingress External Basic".
+func Title(name string) string {
+	words := strings.Split(name, "-")
+	for i, w := range words {
+		if w != "" {
+			words[i] = strings.ToUpper(w[:1]) + w[1:]
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,154 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recipe
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/manifest"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/naming"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/testfiles"
+)
+
+func TestScaffold(t *testing.T) {
+	now := func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }
+	for _, tc := range []struct {
+		kind     Kind
+		ilb      bool
+		wantKind string
+		want     string
+	}{
+		{kind: Ingress, wantKind: "Ingress", want: `kubernetes.io/ingress.class: "gce"`},
+		{kind: Ingress, ilb: true, wantKind: "Ingress", want: `kubernetes.io/ingress.class: "gce-internal"`},
+		{kind: Gateway, wantKind: "Gateway", want: "gke-l7-global-external-managed"},
+		{kind: Gateway, ilb: true, wantKind: "Gateway", want: "gke-l7-rilb"},
+		{kind: Service, wantKind: "Service", want: "type: LoadBalancer"},
+		{kind: Service, ilb: true, wantKind: "Service", want: "networking.gke.io/load-balancer-type"},
+	} {
+		name := string(tc.kind) + "-basic"
+		if tc.ilb {
+			name = string(tc.kind) + "-internal"
+		}
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			p := "ingress/single-cluster/" + name
+			files, err := Scaffold(root, p, ScaffoldOptions{Kind: tc.kind, ILB: tc.ilb, Now: now})
+			if err != nil {
+				t.Fatalf("Scaffold(%q) = %v, want nil", p, err)
+			}
+			if len(files) != 6 {
+				t.Errorf("Scaffold(%q) = %q, want 6 files", p, files)
+			}
+
+			r, err := Load(root, p)
+			if err != nil {
+				t.Fatalf("Load(%q) = %v, want nil", p, err)
+			}
+			if !r.HasMetadata || !r.Tested() || len(r.Scripts()) != len(Scripts) {
+				t.Errorf("Load(%q) = %+v, want a tested recipe with metadata and all scripts", p, r)
+			}
+			if r.Metadata.Tags[0] != string(tc.kind) || (len(r.Metadata.Tags) == 2) != tc.ilb {
+				t.Errorf("Tags = %q, want %q first, and ilb: %v", r.Metadata.Tags, tc.kind, tc.ilb)
+			}
+
+			objects, err := manifest.Load(filepath.Join(r.Dir, name+".yaml"))
+			if err != nil {
+				t.Fatalf("manifest.Load() = %v, want nil", err)
+			}
+			kinds := make(map[string]bool)
+			for _, o := range objects {
+				kinds[o.GetKind()] = true
+			}
+			if !kinds[tc.wantKind] {
+				t.Errorf("manifest.Load() = %v, want a %s", objects, tc.wantKind)
+			}
+			b, err := os.ReadFile(filepath.Join(r.Dir, name+".yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(b), tc.want) || !strings.Contains(string(b), "Copyright 2024") {
+				t.Errorf("%s.yaml = %s, want it to contain %q", name, b, tc.want)
+			}
+
+			errs, err := naming.ValidateRecipe(r.Dir)
+			if err != nil || len(errs) > 0 {
+				t.Errorf("ValidateRecipe() = %v, %v, want no errors", errs, err)
+			}
+
+			for _, script := range r.Scripts() {
+				info, err := os.Stat(script)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode()&0100 == 0 {
+					t.Errorf("%s has mode %v, want executable", script, info.Mode())
+				}
+				b, err := os.ReadFile(script)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(string(b), "source ./test/helper.sh") {
+					t.Errorf("%s doesn't source the test helpers", script)
+				}
+				if bash, err := exec.LookPath("bash"); err == nil {
+					if out, err := exec.Command(bash, "-n", script).CombinedOutput(); err != nil {
+						t.Errorf("bash -n %s = %v: %s", script, err, out)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestScaffoldRefusesToOverwrite(t *testing.T) {
+	root := t.TempDir()
+	p := "gateway/my-recipe"
+	testfiles.Write(t, root, map[string]string{p + "/README.md": "mine"})
+
+	if files, err := Scaffold(root, p, ScaffoldOptions{Kind: Gateway}); err == nil {
+		t.Fatalf("Scaffold(%q) = %q, nil, want an error", p, files)
+	}
+	b, err := os.ReadFile(filepath.Join(root, p, "README.md"))
+	if err != nil || string(b) != "mine" {
+		t.Errorf("README.md = %q, %v, want it untouched", b, err)
+	}
+	entries, err := os.ReadDir(filepath.Join(root, p))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("ReadDir() = %v, %v, want no files written", entries, err)
+	}
+}
+
+func TestScaffoldInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		path string
+		kind Kind
+	}{
+		{path: "ingress", kind: Ingress},
+		{path: "docs/my-recipe", kind: Ingress},
+		{path: "/ingress/my-recipe", kind: Ingress},
+		{path: "../ingress/my-recipe", kind: Ingress},
+		{path: "ingress/My_Recipe", kind: Ingress},
+		{path: "ingress/my-recipe", kind: "mesh"},
+	} {
+		if _, err := Scaffold(t.TempDir(), tc.path, ScaffoldOptions{Kind: tc.kind}); err == nil {
+			t.Errorf("Scaffold(%q, %q) = nil, want an error", tc.path, tc.kind)
+		}
+	}
+}
@@ -15,85 +15,127 @@
 package test
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"io/fs"
-	"os"
-	"os/exec"
-	"path"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/preflight"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/provision"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/sweeper"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/utils"
+	"k8s.io/client-go/discovery"
 )
 
-var testFilePaths = []string{
-	"ingress/single-cluster/",
-	"authz/",
-}
+// configClusterMu serializes the tests of the recipes with a config cluster:
+// the Multi Cluster Ingress fleet feature is one per project, and has a single
+// config membership.
+var configClusterMu sync.Mutex
 
+// TestRecipe runs the tests of the recipes discovered in the repository, see
+// test/recipe. A recipe is tested if it has a run-test.sh.
 func TestRecipe(t *testing.T) {
-	for _, fp := range testFilePaths {
-		fileNames, err := os.ReadDir(fp)
-		if err != nil {
-			t.Fatalf("os.ReadDir(%q) = %v", fp, err)
-		}
-		runRecipeTests(t, fp, fileNames)
+	recipes, err := recipe.Discover(".")
+	if err != nil {
+		t.Fatalf("Discover() = %v", err)
 	}
-}
-
-// runRecipeTests iterates each recipe file, and run its test if it is a directory.
-func runRecipeTests(t *testing.T, parentPath string, fileNames []fs.DirEntry) {
-	for i, fileName := range fileNames {
-		i := i
-		fileName := fileName
-		t.Run(fileName.Name(), func(t *testing.T) {
+	i := 0
+	for _, r := range recipes {
+		if !r.Tested() {
+			continue
+		}
+		r := r
+		delay := time.Duration(i*30) * time.Second
+		i++
+		t.Run(r.Path, func(t *testing.T) {
 			t.Parallel()
-			// Pause 30*i seconds
-			time.Sleep(time.Duration(i*30) * time.Second)
-			path := path.Join(parentPath, fileName.Name())
-			if err := validateDir(path); err != nil {
-				t.Skipf("Skipping test %q: validateDir(%q) = %v", path, path, err)
-			}
-			runRecipeTest(t, path)
+			// Stagger the recipes, 30 seconds apart.
+			time.Sleep(delay)
+			runRecipeTest(t, r)
 		})
 	}
 }
 
-// runRecipeTest runs the testing scripts for a specific recipe.
-// Test will be skipped if setup.sh, run-test.sh, or cleanup.sh does not exist
-// in the target directory.
+// runRecipeTest runs the testing scripts of a recipe, see recipe.Run, once
+// its required environment variables and prerequisites are checked, see
+// test/preflight. Its result is recorded in results.
 // If a test fails, its cleanup needs to be run manually. See directions in
 // test/README.md.
-func runRecipeTest(t *testing.T, recipeDir string) {
-	var paths []string
-	for _, file := range []string{"setup.sh", "run-test.sh", "cleanup.sh"} {
-		path := path.Join(recipeDir, file)
-		_, err := os.Stat(path)
-		if err != nil && !strings.Contains(path, "authz") {
-			t.Logf("stat(%q) = %v", path, err)
-			t.Skipf("Skipping test %q: %q doesn't exist", recipeDir, path)
+func runRecipeTest(t *testing.T, r *recipe.Recipe) {
+	result := results.Start(t, r.Path)
+	if missing := r.MissingEnv(testEnv.Get); len(missing) > 0 {
+		if flags.requireAll {
+			result.Fatalf("missing required environment variables: %s", strings.Join(missing, ", "))
 		}
-		if err == nil {
-			paths = append(paths, path)
+		result.Skipf("missing required environment variables: %s", strings.Join(missing, ", "))
+	}
+	if !flags.skipPreflight {
+		if err := checkPrerequisites(t, r); err != nil {
+			result.Fatalf("%v", err)
 		}
 	}
 
-	for _, path := range paths {
-		out, err := exec.Command("bash", path).CombinedOutput()
+	if r.Metadata.ConfigCluster != "" {
+		configClusterMu.Lock()
+		defer configClusterMu.Unlock()
+	}
+	var out bytes.Buffer
+	err := recipe.Run(testEnv, r, recipe.RunOptions{
+		RunID:     flags.runID,
+		Owner:     runOwner,
+		ExpiresAt: runExpiresAt,
+		Output:    &out,
+		Clusters: provision.New(&provision.GcloudCloud{
+			Run:     sweeper.ExecRunner(testEnv.Environ()),
+			Project: testEnv.Get("CLOUDSDK_CORE_PROJECT"),
+		}),
+		OnClusters: checkClusters,
+	})
+	if err != nil {
+		// Fail now because we shouldn't continue testing if any step fails.
+		result.Fatalf("Test %s failed: %v, output: %q", r.Path, err, out.String())
+	}
+}
+
+// checkClusters checks that the control plane of each cluster of a
+// multi-cluster recipe is reachable through its handle, before the test
+// scripts of the recipe use it.
+func checkClusters(clusters map[string]*utils.Cluster) error {
+	var errs []error
+	for name, c := range clusters {
+		config, err := c.RESTConfig()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cluster %s: %w", name, err))
+			continue
+		}
+		client, err := discovery.NewDiscoveryClientForConfig(config)
 		if err != nil {
-			// Fail now because we shouldn't continue testing if any step fails.
-			t.Fatalf("Test %s failed when running %q: %q, err: %v", recipeDir, path, out, err)
+			errs = append(errs, fmt.Errorf("cluster %s: %w", name, err))
+			continue
+		}
+		if _, err := client.ServerVersion(); err != nil {
+			errs = append(errs, fmt.Errorf("cluster %s is not reachable: %w", name, err))
 		}
 	}
+	return errors.Join(errs...)
 }
 
-// validateDir validates if the given path corresponds to a directory.
-func validateDir(path string) error {
-	d, err := os.Stat(path)
+// checkPrerequisites returns an error listing the APIs, IAM roles and quotas
+// the recipe needs which are missing in the projects of the test environment.
+func checkPrerequisites(t *testing.T, r *recipe.Recipe) error {
+	d, err := recipe.Describe(r)
 	if err != nil {
-		return fmt.Errorf("stat(%q) failed: %w", path, err)
+		return err
 	}
-	if !d.IsDir() {
-		return fmt.Errorf("%q is not a directory", path)
+	projects := preflight.GcloudProjects(sweeper.ExecRunner(testEnv.Environ()), testEnv.Get, d)
+	report := preflight.Check(context.Background(), projects, testEnv.Get("REGION"), d)
+	for _, err := range report.Errors {
+		t.Logf("Prerequisite not checked: %v", err)
 	}
-	return nil
+	return report.Err()
 }
@@ -0,0 +1,414 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rollout runs the rollouts declared by recipes, see recipe.Rollout:
+// it applies their steps in order, e.g. the routes of a blue/green
+// deployment, and checks after each one that the load balancer sends the
+// declared share of the traffic to each version of the application.
+package rollout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/backend"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/placement"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/utils"
+)
+
+// BackendField is the field of the JSON responses of whereami identifying
+// the backend, set from its METADATA environment variable.
+const BackendField = "metadata"
+
+// ProbeIDHeader is the header identifying each request sent by the
+// assertions, to find its copies in the requests recorded by a mirror.
+const ProbeIDHeader = "X-Probe-Id"
+
+// retryInterval is the interval between two checks of the assertions of a
+// step.
+const retryInterval = 10 * time.Second
+
+// Runner runs rollouts.
+type Runner struct {
+	// Kubectl applies the steps, looks up the address of the target, and
+	// gets the requests recorded by the mirrors.
+	Kubectl placement.Kubectl
+	// Client sends the requests of the assertions, http.DefaultClient if
+	// nil. The target must be reachable from where it runs, e.g. from the
+	// VPC of the clusters for an internal load balancer.
+	Client *http.Client
+	// Sleep waits for d, or until ctx is done. It defaults to a timer.
+	Sleep func(ctx context.Context, d time.Duration) error
+	// Output receives the progress of the rollout. It is discarded if nil.
+	Output io.Writer
+}
+
+// StepResult is the result of a step.
+type StepResult struct {
+	// Name is the name of the step.
+	Name string
+	// Duration is the time spent applying the step and checking its
+	// assertions, waits included.
+	Duration time.Duration
+	// Attempts is the number of times the assertions were checked.
+	Attempts int
+	// Shares are the percentages of the requests of each assertion answered
+	// by each backend, in the last attempt.
+	Shares []map[string]float64
+	// Err is the error of the step, nil if it passed.
+	Err error
+}
+
+// String returns the result as a line of a report.
+func (s StepResult) String() string {
+	status := "PASS"
+	if s.Err != nil {
+		status = "FAIL"
+	}
+	var shares []string
+	for _, share := range s.Shares {
+		shares = append(shares, formatShare(share))
+	}
+	line := fmt.Sprintf("%s %s (%s, %d attempts)", status, s.Name, s.Duration.Round(time.Second), s.Attempts)
+	if len(shares) > 0 {
+		line += ": " + strings.Join(shares, "; ")
+	}
+	if s.Err != nil {
+		line += ": " + s.Err.Error()
+	}
+	return line
+}
+
+// Report is the result of a rollout, with a result for each step run.
+type Report struct {
+	Steps []StepResult
+}
+
+// Err returns the error of the failed step, nil if all the steps passed.
+func (r *Report) Err() error {
+	for _, s := range r.Steps {
+		if s.Err != nil {
+			return fmt.Errorf("step %s failed: %w", s.Name, s.Err)
+		}
+	}
+	return nil
+}
+
+// String returns the report, a line per step.
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, s := range r.Steps {
+		fmt.Fprintln(&b, s)
+	}
+	return b.String()
+}
+
+// Run applies the steps of the rollout of r in order to its cluster, the
+// handle of clusters named after it, the only one for a single-cluster
+// recipe. After each step, it waits and checks the assertions of the step
+// until they pass or the timeout of the rollout expires. It stops at the
+// first failing step.
+func (rn *Runner) Run(ctx context.Context, clusters map[string]*utils.Cluster, r *recipe.Recipe) (*Report, error) {
+	ro := r.Metadata.Rollout
+	if ro == nil {
+		return nil, fmt.Errorf("recipe %s declares no rollout in its %s", r.Path, recipe.MetadataFile)
+	}
+	cluster, ok := clusters[ro.Cluster]
+	if !ok && ro.Cluster == "" && len(clusters) == 1 {
+		for _, c := range clusters {
+			cluster, ok = c, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("no cluster %s to roll out recipe %s on", ro.Cluster, r.Path)
+	}
+	out := rn.Output
+	if out == nil {
+		out = io.Discard
+	}
+	wait, timeout := ro.Durations()
+
+	report := &Report{}
+	for _, s := range ro.Steps {
+		start := time.Now()
+		result := StepResult{Name: s.Name}
+		fmt.Fprintf(out, "Step %s: applying %s\n", s.Name, strings.Join(s.Files, ", "))
+		result.Err = rn.apply(ctx, cluster, r, s)
+		if result.Err == nil && len(s.Assertions) > 0 {
+			result.Err = rn.sleep(ctx, wait)
+			for waited := wait; result.Err == nil; waited += retryInterval {
+				result.Attempts++
+				var err error
+				result.Shares, err = rn.check(ctx, clusters, cluster, ro, s)
+				if err == nil || waited+retryInterval > wait+timeout || ctx.Err() != nil {
+					result.Err = err
+					break
+				}
+				fmt.Fprintf(out, "Step %s: %v, retrying\n", s.Name, err)
+				if err := rn.sleep(ctx, retryInterval); err != nil {
+					result.Err = err
+				}
+			}
+		}
+		result.Duration = time.Since(start)
+		report.Steps = append(report.Steps, result)
+		fmt.Fprintln(out, result)
+		if result.Err != nil {
+			break
+		}
+	}
+	return report, nil
+}
+
+// apply applies the files of a step.
+func (rn *Runner) apply(ctx context.Context, cluster *utils.Cluster, r *recipe.Recipe, s recipe.RolloutStep) error {
+	args := []string{"--kubeconfig=" + cluster.Kubeconfig, "--context=" + cluster.Context, "apply"}
+	for _, file := range s.Files {
+		args = append(args, "-f", filepath.Join(r.Dir, filepath.FromSlash(file)))
+	}
+	if _, err := rn.Kubectl(ctx, args...); err != nil {
+		return fmt.Errorf("failed to apply %q: %w", s.Files, err)
+	}
+	return nil
+}
+
+// check checks the assertions of a step on the target of the rollout in
+// cluster, and returns the shares of the backends for each of them.
+func (rn *Runner) check(ctx context.Context, clusters map[string]*utils.Cluster, cluster *utils.Cluster, ro *recipe.Rollout, s recipe.RolloutStep) ([]map[string]float64, error) {
+	address, err := rn.address(ctx, cluster, ro.Target)
+	if err != nil {
+		return nil, err
+	}
+	var shares []map[string]float64
+	for i, a := range s.Assertions {
+		share, ids, err := rn.share(ctx, address, a)
+		if err != nil {
+			return shares, fmt.Errorf("assertion %d: %w", i+1, err)
+		}
+		shares = append(shares, share)
+		if err := Compare(share, a); err != nil {
+			return shares, fmt.Errorf("assertion %d: %w", i+1, err)
+		}
+		if a.Mirror == nil {
+			continue
+		}
+		mirrorCluster, ok := clusters[a.Mirror.Cluster]
+		if !ok && a.Mirror.Cluster == ro.Cluster {
+			mirrorCluster, ok = cluster, true
+		}
+		if !ok {
+			return shares, fmt.Errorf("assertion %d: no cluster %s to check the mirror on", i+1, a.Mirror.Cluster)
+		}
+		if err := rn.checkMirror(ctx, mirrorCluster, a.Mirror, ids); err != nil {
+			return shares, fmt.Errorf("assertion %d: %w", i+1, err)
+		}
+	}
+	return shares, nil
+}
+
+// checkMirror returns an error if the pods of the mirror didn't receive a
+// copy of each of the requests identified by ids. It reads the requests they
+// recorded through the API server proxy.
+func (rn *Runner) checkMirror(ctx context.Context, cluster *utils.Cluster, m *recipe.Mirror, ids []string) error {
+	kubectl := func(args ...string) ([]byte, error) {
+		return rn.Kubectl(ctx, append([]string{"--kubeconfig=" + cluster.Kubeconfig, "--context=" + cluster.Context}, args...)...)
+	}
+	namespace := m.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	out, err := kubectl("get", "pods", "--namespace="+namespace, "--selector="+m.Selector, "--output=jsonpath={.items[*].metadata.name}")
+	if err != nil {
+		return fmt.Errorf("failed to list the pods of the mirror: %w", err)
+	}
+	pods := strings.Fields(string(out))
+	if len(pods) == 0 {
+		return fmt.Errorf("mirror %s has no pods", m.Selector)
+	}
+	received := make(map[string]bool)
+	for _, pod := range pods {
+		out, err := kubectl("get", "--raw", fmt.Sprintf("/api/v1/namespaces/%s/pods/%s:%d/proxy%s", namespace, pod, m.Port, backend.RequestsPath))
+		if err != nil {
+			return fmt.Errorf("failed to get the requests recorded by pod %s of the mirror, which must run the test backend: %w", pod, err)
+		}
+		var requests []backend.Request
+		if err := json.Unmarshal(out, &requests); err != nil {
+			return fmt.Errorf("pod %s of the mirror, which must run the test backend, recorded invalid requests: %w", pod, err)
+		}
+		for _, req := range requests {
+			received[req.Headers[ProbeIDHeader]] = true
+		}
+	}
+	missing := 0
+	for _, id := range ids {
+		if !received[id] {
+			missing++
+		}
+	}
+	if missing > 0 {
+		return fmt.Errorf("mirror %s received %d of the %d requests", m.Selector, len(ids)-missing, len(ids))
+	}
+	return nil
+}
+
+// address returns the host and port of the target, looked up in its
+// status.
+func (rn *Runner) address(ctx context.Context, cluster *utils.Cluster, t recipe.RolloutTarget) (string, error) {
+	args := []string{"--kubeconfig=" + cluster.Kubeconfig, "--context=" + cluster.Context, "get", t.Kind, t.Name}
+	if t.Namespace != "" {
+		args = append(args, "--namespace="+t.Namespace)
+	}
+	args = append(args, "--output=jsonpath="+recipe.RolloutTargetKinds[t.Kind])
+	out, err := rn.Kubectl(ctx, args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to get the address of %s %s: %w", t.Kind, t.Name, err)
+	}
+	ip := strings.TrimSpace(string(out))
+	if ip == "" {
+		return "", fmt.Errorf("%s %s has no address yet", t.Kind, t.Name)
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(t.Port)), nil
+}
+
+// share sends the requests of an assertion to address, and returns the
+// percentage of the requests answered by each backend, and the IDs of the
+// requests, in their ProbeIDHeader. Failed requests are counted as answered
+// by the backend "HTTP <status code>".
+func (rn *Runner) share(ctx context.Context, address string, a recipe.Assertion) (map[string]float64, []string, error) {
+	client := rn.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	counts := make(map[string]int)
+	var ids []string
+	prefix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	for i := 0; i < a.Requests; i++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+address+a.Path, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Host = a.Host
+		for k, v := range a.Headers {
+			req.Header.Set(k, v)
+		}
+		id := fmt.Sprintf("%s-%d", prefix, i)
+		req.Header.Set(ProbeIDHeader, id)
+		ids = append(ids, id)
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			counts[fmt.Sprintf("HTTP %d", resp.StatusCode)]++
+			continue
+		}
+		counts[Backend(body)]++
+	}
+	share := make(map[string]float64)
+	for backend, n := range counts {
+		share[backend] = 100 * float64(n) / float64(a.Requests)
+	}
+	return share, ids, nil
+}
+
+// Backend returns the backend which sent a response of whereami: its
+// BackendField for the JSON responses, the response itself for the
+// /metadata path.
+func Backend(body []byte) string {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err == nil {
+		if backend, ok := fields[BackendField].(string); ok {
+			return backend
+		}
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// Compare returns an error if the shares of the backends don't match the
+// ones declared by the assertion: they must be within its tolerance, and
+// backends declared with 0 or 100 percent must never, or always, answer.
+func Compare(share map[string]float64, a recipe.Assertion) error {
+	backends := make(map[string]bool)
+	for b := range share {
+		backends[b] = true
+	}
+	for b := range a.Backends {
+		backends[b] = true
+	}
+	var errs []string
+	for _, b := range sortedKeys(backends) {
+		want, got := float64(a.Backends[b]), share[b]
+		exact := want == 0 || want == 100
+		if (exact && got != want) || (!exact && (got < want-float64(a.Tolerance) || got > want+float64(a.Tolerance))) {
+			errs = append(errs, fmt.Sprintf("%s answered %.0f%% of the requests, want %.0f%%", b, got, want))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// sleep waits for d with the Sleep of the runner.
+func (rn *Runner) sleep(ctx context.Context, d time.Duration) error {
+	if rn.Sleep != nil {
+		return rn.Sleep(ctx, d)
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// formatShare formats the shares of the backends, e.g. "blue 90%, green
+// 10%".
+func formatShare(share map[string]float64) string {
+	backends := make(map[string]bool)
+	for b := range share {
+		backends[b] = true
+	}
+	var parts []string
+	for _, b := range sortedKeys(backends) {
+		parts = append(parts, fmt.Sprintf("%s %.0f%%", b, share[b]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,392 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/backend"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/manifest"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/recipe/recipetest"
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/utils"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// repoRoot is the root of the repository, relative to this package.
+const repoRoot = "../.."
+
+func TestBackend(t *testing.T) {
+	for _, tc := range []struct {
+		body, want string
+	}{
+		{`{"cluster_name": "gke-1", "metadata": "sample-app-blue"}`, "sample-app-blue"},
+		{"sample-app-green\n", "sample-app-green"},
+		{`{"cluster_name": "gke-1"}`, `{"cluster_name": "gke-1"}`},
+	} {
+		if got := Backend([]byte(tc.body)); got != tc.want {
+			t.Errorf("Backend(%q) = %q, want %q", tc.body, got, tc.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	canary := recipe.Assertion{Backends: map[string]int{"blue": 90, "green": 10}, Tolerance: 5}
+	only := recipe.Assertion{Backends: map[string]int{"blue": 100}, Tolerance: 5}
+	for _, tc := range []struct {
+		share   map[string]float64
+		a       recipe.Assertion
+		wantErr bool
+	}{
+		{map[string]float64{"blue": 87, "green": 13}, canary, false},
+		{map[string]float64{"blue": 80, "green": 20}, canary, true},
+		{map[string]float64{"blue": 90, "green": 5, "HTTP 503": 5}, canary, true},
+		{map[string]float64{"blue": 100}, only, false},
+		{map[string]float64{"blue": 99, "green": 1}, only, true},
+	} {
+		if err := Compare(tc.share, tc.a); (err != nil) != tc.wantErr {
+			t.Errorf("Compare(%v, %v) = %v, want error %v", tc.share, tc.a.Backends, err, tc.wantErr)
+		}
+	}
+}
+
+// fakeLoadBalancer answers like whereami behind a load balancer splitting the
+// traffic as configured by the last applied route, a file naming the
+// percentage of the requests going to blue, e.g. "blue: 90". The Cluster
+// header routes to a backend. It copies the requests to mirror, if any, but
+// every dropped-th copy.
+type fakeLoadBalancer struct {
+	mu      sync.Mutex
+	blue    int
+	pending int
+	n       int
+	mirror  *backend.Server
+	dropped int
+}
+
+func (lb *fakeLoadBalancer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	backend := "sample-app-green"
+	switch {
+	case req.Header.Get("Cluster") != "":
+		backend = "sample-app-" + req.Header.Get("Cluster")
+	case lb.n%100 < lb.blue:
+		backend = "sample-app-blue"
+	}
+	lb.n++
+	if lb.mirror != nil && (lb.dropped == 0 || lb.n%lb.dropped != 0) {
+		lb.mirror.ServeHTTP(httptest.NewRecorder(), req.Clone(req.Context()))
+	}
+	if req.URL.Path == "/metadata" {
+		fmt.Fprintln(w, backend)
+		return
+	}
+	fmt.Fprintf(w, `{"cluster_name": "gke-1", "metadata": %q}`, backend)
+}
+
+// kubectl applies the routes with a delay: the new split is only served after
+// the first sleep, like a load balancer taking time to be configured.
+func (lb *fakeLoadBalancer) kubectl(commands *[]string) func(context.Context, ...string) ([]byte, error) {
+	return func(_ context.Context, args ...string) ([]byte, error) {
+		*commands = append(*commands, strings.Join(args[1:], " "))
+		switch {
+		case args[2] == "get" && args[3] == "pods":
+			return []byte("green-1"), nil
+		case args[2] == "get" && args[3] == "--raw":
+			return json.Marshal(lb.mirror.Requests())
+		case args[2] == "get":
+			return []byte("127.0.0.1"), nil
+		case args[2] == "apply":
+			b, err := os.ReadFile(args[len(args)-1])
+			if err != nil {
+				return nil, err
+			}
+			lb.mu.Lock()
+			defer lb.mu.Unlock()
+			_, err = fmt.Sscanf(string(b), "blue: %d", &lb.pending)
+			return nil, err
+		}
+		return nil, fmt.Errorf("unexpected kubectl %q", args)
+	}
+}
+
+func (lb *fakeLoadBalancer) sleep(sleeps *[]time.Duration) func(context.Context, time.Duration) error {
+	return func(_ context.Context, d time.Duration) error {
+		*sleeps = append(*sleeps, d)
+		lb.mu.Lock()
+		defer lb.mu.Unlock()
+		lb.blue = lb.pending
+		return nil
+	}
+}
+
+func loadRecipe(t *testing.T, rollout string, port string) *recipe.Recipe {
+	t.Helper()
+	root := t.TempDir()
+	dir := filepath.Join(root, "gateway", "blue-green")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"recipe.yaml":       strings.ReplaceAll(rollout, "PORT", port),
+		"route-blue.yaml":   "blue: 100\n",
+		"route-canary.yaml": "blue: 90\n",
+		"route-split.yaml":  "blue: 50\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := recipe.Load(root, "gateway/blue-green")
+	if err != nil {
+		t.Fatalf("Load() = %v, want nil", err)
+	}
+	return r
+}
+
+func TestRun(t *testing.T) {
+	lb := &fakeLoadBalancer{}
+	server := httptest.NewServer(lb)
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := loadRecipe(t, `
+clusters:
+- name: gke-blue
+  region: us-west1
+rollout:
+  target:
+    kind: Gateway
+    namespace: bg
+    name: gateway
+    port: PORT
+  wait: 30s
+  timeout: 15s
+  steps:
+  - name: blue
+    files: [route-blue.yaml]
+    assertions:
+    - backends: {sample-app-blue: 100}
+  - name: canary
+    files: [route-canary.yaml]
+    assertions:
+    - path: /metadata
+      backends: {sample-app-blue: 90, sample-app-green: 10}
+      tolerance: 1
+    - headers: {Cluster: green}
+      requests: 10
+      backends: {sample-app-green: 100}
+  - name: split
+    files: [route-split.yaml]
+`, port)
+	clusters := map[string]*utils.Cluster{"gke-blue": {Context: "gke-blue", Kubeconfig: "kubeconfig"}}
+	var commands []string
+	var sleeps []time.Duration
+	rn := &Runner{Kubectl: lb.kubectl(&commands), Sleep: lb.sleep(&sleeps)}
+
+	report, err := rn.Run(context.Background(), clusters, r)
+	if err != nil {
+		t.Fatalf("Run() = %v, want nil", err)
+	}
+	if err := report.Err(); err != nil {
+		t.Fatalf("Run() = %v, want a passing rollout\n%s", err, report)
+	}
+	var got []string
+	for _, s := range report.Steps {
+		got = append(got, fmt.Sprintf("%s %d %v", s.Name, s.Attempts, s.Shares))
+	}
+	want := []string{
+		"blue 1 [map[sample-app-blue:100]]",
+		"canary 1 [map[sample-app-blue:90 sample-app-green:10] map[sample-app-green:100]]",
+		"split 0 []",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Run() = %q, want %q", got, want)
+	}
+	wantCommands := []string{"--context=gke-blue apply", "--context=gke-blue get", "--context=gke-blue apply", "--context=gke-blue get", "--context=gke-blue apply"}
+	for i, cmd := range commands {
+		if i >= len(wantCommands) || !strings.HasPrefix(cmd, wantCommands[i]) {
+			t.Errorf("kubectl commands = %q, want %q", commands, wantCommands)
+			break
+		}
+	}
+	if want := "--context=gke-blue get Gateway gateway --namespace=bg --output=jsonpath={.status.addresses[0].value}"; commands[1] != want {
+		t.Errorf("kubectl %q, want %q", commands[1], want)
+	}
+	if fmt.Sprint(sleeps) != "[30s 30s]" {
+		t.Errorf("sleeps = %v, want a wait after each step with assertions", sleeps)
+	}
+}
+
+func TestRunFailure(t *testing.T) {
+	lb := &fakeLoadBalancer{}
+	server := httptest.NewServer(lb)
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := loadRecipe(t, `
+rollout:
+  target:
+    kind: Service
+    name: lb
+    port: PORT
+  wait: 0s
+  timeout: 25s
+  steps:
+  - name: canary
+    files: [route-canary.yaml]
+    assertions:
+    - backends: {sample-app-blue: 50, sample-app-green: 50}
+  - name: split
+    files: [route-split.yaml]
+`, port)
+	clusters := map[string]*utils.Cluster{"gke-1": {Context: "gke-1", Kubeconfig: "kubeconfig"}}
+	var commands []string
+	var sleeps []time.Duration
+	rn := &Runner{Kubectl: lb.kubectl(&commands), Sleep: lb.sleep(&sleeps)}
+
+	report, err := rn.Run(context.Background(), clusters, r)
+	if err != nil {
+		t.Fatalf("Run() = %v, want nil", err)
+	}
+	if len(report.Steps) != 1 || report.Steps[0].Attempts != 3 {
+		t.Fatalf("Run() = %s, want the canary step only, checked 3 times", report)
+	}
+	if err := report.Err(); err == nil || !strings.Contains(err.Error(), "sample-app-blue answered 90% of the requests, want 50%") {
+		t.Errorf("Err() = %v, want the shares of the canary step", err)
+	}
+	if line := report.Steps[0].String(); !strings.HasPrefix(line, "FAIL canary") {
+		t.Errorf("String() = %q, want a failed canary step", line)
+	}
+}
+
+func TestRunMirror(t *testing.T) {
+	lb := &fakeLoadBalancer{mirror: backend.NewServer(backend.Config{Metadata: "sample-app-green"})}
+	server := httptest.NewServer(lb)
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := loadRecipe(t, `
+clusters:
+- name: gke-blue
+  region: us-west1
+- name: gke-green
+  region: us-west1
+rollout:
+  target:
+    kind: Gateway
+    name: gateway
+    port: PORT
+  wait: 0s
+  timeout: 0s
+  steps:
+  - name: mirroring
+    files: [route-blue.yaml]
+    assertions:
+    - path: /metadata
+      backends: {sample-app-blue: 100}
+      mirror:
+        cluster: gke-green
+        namespace: bg
+        selector: app=sample-app,version=v2
+`, port)
+	clusters := map[string]*utils.Cluster{
+		"gke-blue":  {Context: "gke-blue", Kubeconfig: "kubeconfig"},
+		"gke-green": {Context: "gke-green", Kubeconfig: "kubeconfig"},
+	}
+	var commands []string
+	var sleeps []time.Duration
+	rn := &Runner{Kubectl: lb.kubectl(&commands), Sleep: lb.sleep(&sleeps)}
+
+	report, err := rn.Run(context.Background(), clusters, r)
+	if err != nil {
+		t.Fatalf("Run() = %v, want nil", err)
+	}
+	if err := report.Err(); err != nil {
+		t.Fatalf("Run() = %v, want a passing rollout", err)
+	}
+	want := []string{
+		"--context=gke-green get pods --namespace=bg --selector=app=sample-app,version=v2 --output=jsonpath={.items[*].metadata.name}",
+		"--context=gke-green get --raw /api/v1/namespaces/bg/pods/green-1:8080/proxy/admin/requests",
+	}
+	if got := commands[len(commands)-2:]; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("kubectl commands = %q, want %q", got, want)
+	}
+
+	lb.dropped = 10
+	report, err = rn.Run(context.Background(), clusters, r)
+	if err != nil {
+		t.Fatalf("Run() = %v, want nil", err)
+	}
+	if err := report.Err(); err == nil || !strings.Contains(err.Error(), "mirror app=sample-app,version=v2 received 90 of the 100 requests") {
+		t.Errorf("Run() = %v, want an error for the dropped copies", err)
+	}
+}
+
+// TestRecipes checks that the backends the rollouts of the recipes of the
+// repository assert on are whereami backends of the recipe, named by their
+// METADATA environment variable.
+func TestRecipes(t *testing.T) {
+	recipetest.ForEach(t, repoRoot, func(t *testing.T, r *recipe.Recipe) {
+		ro := r.Metadata.Rollout
+		if ro == nil {
+			return
+		}
+		objects, err := manifest.LoadDir(r.Dir)
+		if err != nil {
+			t.Fatalf("LoadDir(%s) = %v, want nil", r.Dir, err)
+		}
+		backends := make(map[string]bool)
+		for _, o := range objects {
+			containers, _, _ := unstructured.NestedSlice(o.Object, "spec", "template", "spec", "containers")
+			for _, c := range containers {
+				env, _, _ := unstructured.NestedSlice(c.(map[string]interface{}), "env")
+				for _, e := range env {
+					if e := e.(map[string]interface{}); e["name"] == "METADATA" {
+						backends[fmt.Sprint(e["value"])] = true
+					}
+				}
+			}
+		}
+		for _, s := range ro.Steps {
+			for _, a := range s.Assertions {
+				for b := range a.Backends {
+					if !backends[b] {
+						t.Errorf("step %s asserts on backend %s, want one of %v", s.Name, b, backends)
+					}
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,105 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sweeper
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// FakeInventory is an in-memory Inventory. Like GCE, it refuses to delete a
+// network while other resources are still attached to it, an address while a
+// DNS record or a forwarding rule still points to it, or a resource while
+// another resource still refers to it.
+type FakeInventory struct {
+	mu        sync.Mutex
+	resources []Resource
+	// Deleted lists the deleted resources, in deletion order.
+	Deleted []Resource
+	// DeleteErrors makes the deletion of the named resources fail.
+	DeleteErrors map[string]error
+}
+
+// NewFakeInventory returns a FakeInventory holding resources.
+func NewFakeInventory(resources ...Resource) *FakeInventory {
+	return &FakeInventory{
+		resources:    resources,
+		DeleteErrors: make(map[string]error),
+	}
+}
+
+// List implements Inventory.
+func (f *FakeInventory) List(_ context.Context, kind Kind) ([]Resource, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var resources []Resource
+	for _, r := range f.resources {
+		if r.Kind == kind {
+			resources = append(resources, r)
+		}
+	}
+	return resources, nil
+}
+
+// Delete implements Inventory.
+func (f *FakeInventory) Delete(_ context.Context, r Resource) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.DeleteErrors[r.Name]; err != nil {
+		return err
+	}
+	index := -1
+	for i, existing := range f.resources {
+		if existing.Kind == r.Kind && existing.Name == r.Name && existing.Location == r.Location {
+			index = i
+			continue
+		}
+		if r.Kind == Network && existing.Network == r.Name {
+			return fmt.Errorf("network %s is still used by %s", r.Name, existing)
+		}
+		if r.Kind == Address && pointsTo(existing, toSet(r.Addresses)) {
+			return fmt.Errorf("address %s is still used by %s", r.Name, existing)
+		}
+		for _, ref := range existing.References {
+			if ref == r.Ref() {
+				return fmt.Errorf("%s is still used by %s", r, existing)
+			}
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("%s not found", r)
+	}
+	f.resources = append(f.resources[:index], f.resources[index+1:]...)
+	f.Deleted = append(f.Deleted, r)
+	return nil
+}
+
+// Resources returns the resources left in the inventory.
+func (f *FakeInventory) Resources() []Resource {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Resource(nil), f.resources...)
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
@@ -0,0 +1,329 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sweeper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+)
+
+// Runner runs gcloud with the given arguments and returns its standard
+// output.
+type Runner func(ctx context.Context, args ...string) ([]byte, error)
+
+// ExecRunner returns a Runner executing the gcloud binary in env, in the
+// form "key=value". A nil env uses the environment of the current process.
+func ExecRunner(env []string) Runner {
+	return func(ctx context.Context, args ...string) ([]byte, error) {
+		cmd := exec.CommandContext(ctx, "gcloud", args...)
+		cmd.Env = env
+		out, err := cmd.Output()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return out, fmt.Errorf("gcloud %v: %w: %s", args, err, exitErr.Stderr)
+		}
+		return out, err
+	}
+}
+
+// GcloudInventory is an Inventory backed by gcloud.
+type GcloudInventory struct {
+	// Run runs gcloud.
+	Run Runner
+	// Project is the project to sweep. Empty uses the default project of
+	// gcloud.
+	Project string
+	// DNSProject and DNSZone identify the Cloud DNS zone the recipe tests
+	// create records in. DNS records are not swept if DNSZone is empty.
+	DNSProject string
+	DNSZone    string
+}
+
+// gcloudResource holds the fields of the JSON output of gcloud list commands
+// the sweeper needs. Compute resources refer to their zone, region and
+// network by URL, and fleet memberships are named by their full name.
+type gcloudResource struct {
+	Name              string            `json:"name"`
+	Zone              string            `json:"zone"`
+	Region            string            `json:"region"`
+	Location          string            `json:"location"`
+	Network           string            `json:"network"`
+	Labels            map[string]string `json:"labels"`
+	ResourceLabels    map[string]string `json:"resourceLabels"`
+	CreationTimestamp string            `json:"creationTimestamp"`
+	CreateTime        string            `json:"createTime"`
+	Address           string            `json:"address"`
+	NetworkInterfaces []struct {
+		Network string `json:"network"`
+	} `json:"networkInterfaces"`
+	// DNS record sets.
+	Type    string   `json:"type"`
+	Rrdatas []string `json:"rrdatas"`
+	// Load balancers.
+	IPAddress      string   `json:"IPAddress"`
+	Target         string   `json:"target"`
+	URLMap         string   `json:"urlMap"`
+	DefaultService string   `json:"defaultService"`
+	HealthChecks   []string `json:"healthChecks"`
+	SecurityPolicy string   `json:"securityPolicy"`
+	SSLPolicy      string   `json:"sslPolicy"`
+	Backends       []struct {
+		Group string `json:"group"`
+	} `json:"backends"`
+	PathMatchers []struct {
+		DefaultService string `json:"defaultService"`
+		PathRules      []struct {
+			Service string `json:"service"`
+		} `json:"pathRules"`
+		RouteRules []struct {
+			Service string `json:"service"`
+		} `json:"routeRules"`
+	} `json:"pathMatchers"`
+}
+
+// references returns the resources referred to by a load balancer resource.
+func (item *gcloudResource) references() []Ref {
+	urls := []string{item.Target, item.URLMap, item.DefaultService, item.SecurityPolicy, item.SSLPolicy}
+	urls = append(urls, item.HealthChecks...)
+	for _, b := range item.Backends {
+		urls = append(urls, b.Group)
+	}
+	for _, m := range item.PathMatchers {
+		urls = append(urls, m.DefaultService)
+		for _, r := range m.PathRules {
+			urls = append(urls, r.Service)
+		}
+		for _, r := range m.RouteRules {
+			urls = append(urls, r.Service)
+		}
+	}
+	var refs []Ref
+	for _, url := range urls {
+		if ref, ok := parseRef(url); ok {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// collectionKinds maps the collections of the compute API to the kinds of
+// their resources.
+var collectionKinds = map[string]Kind{
+	"targetHttpProxies":     TargetHTTPProxy,
+	"targetHttpsProxies":    TargetHTTPSProxy,
+	"urlMaps":               URLMap,
+	"backendServices":       BackendService,
+	"healthChecks":          HealthCheck,
+	"networkEndpointGroups": NEG,
+	"sslPolicies":           SSLPolicy,
+	"securityPolicies":      SecurityPolicy,
+}
+
+// parseRef parses the URL of a compute resource, e.g.
+// https://www.googleapis.com/compute/v1/projects/p/zones/us-central1-c/networkEndpointGroups/neg.
+// It returns false for the kinds of resources the sweeper doesn't delete.
+func parseRef(url string) (Ref, bool) {
+	segments := strings.Split(url, "/")
+	if len(segments) < 2 {
+		return Ref{}, false
+	}
+	kind, ok := collectionKinds[segments[len(segments)-2]]
+	if !ok {
+		return Ref{}, false
+	}
+	ref := Ref{Kind: kind, Name: segments[len(segments)-1]}
+	for i := 0; i+1 < len(segments)-2; i++ {
+		if segments[i] == "zones" || segments[i] == "regions" {
+			ref.Location = segments[i+1]
+		}
+	}
+	return ref, true
+}
+
+// listCommands are the gcloud commands listing each kind of resource.
+var listCommands = map[Kind][]string{
+	Membership:       {"container", "fleet", "memberships"},
+	Cluster:          {"container", "clusters"},
+	Instance:         {"compute", "instances"},
+	ForwardingRule:   {"compute", "forwarding-rules"},
+	TargetHTTPProxy:  {"compute", "target-http-proxies"},
+	TargetHTTPSProxy: {"compute", "target-https-proxies"},
+	URLMap:           {"compute", "url-maps"},
+	BackendService:   {"compute", "backend-services"},
+	HealthCheck:      {"compute", "health-checks"},
+	NEG:              {"compute", "network-endpoint-groups"},
+	SSLPolicy:        {"compute", "ssl-policies"},
+	SecurityPolicy:   {"compute", "security-policies"},
+	Address:          {"compute", "addresses"},
+	Firewall:         {"compute", "firewall-rules"},
+	Subnet:           {"compute", "networks", "subnets"},
+	Network:          {"compute", "networks"},
+}
+
+// List implements Inventory.
+func (g *GcloudInventory) List(ctx context.Context, kind Kind) ([]Resource, error) {
+	var args []string
+	if kind == DNSRecord {
+		if g.DNSZone == "" {
+			return nil, nil
+		}
+		args = []string{"dns", "record-sets", "list", "--zone=" + g.DNSZone}
+		if g.DNSProject != "" {
+			args = append(args, "--project="+g.DNSProject)
+		}
+	} else {
+		command, ok := listCommands[kind]
+		if !ok {
+			return nil, fmt.Errorf("unknown kind %q", kind)
+		}
+		args = append(append(args, command...), "list")
+		if g.Project != "" {
+			args = append(args, "--project="+g.Project)
+		}
+	}
+	out, err := g.Run(ctx, append(args, "--format=json")...)
+	if err != nil {
+		return nil, err
+	}
+	return parseResources(kind, out)
+}
+
+// parseResources parses the JSON output of a gcloud list command.
+func parseResources(kind Kind, out []byte) ([]Resource, error) {
+	var items []gcloudResource
+	if err := json.Unmarshal(out, &items); err != nil {
+		return nil, fmt.Errorf("failed to parse %s list: %w", kind, err)
+	}
+
+	var resources []Resource
+	for _, item := range items {
+		r := Resource{
+			Kind:       kind,
+			Name:       lastSegment(item.Name),
+			Location:   lastSegment(item.Location),
+			Network:    lastSegment(item.Network),
+			Labels:     item.Labels,
+			RecordType: item.Type,
+			References: item.references(),
+		}
+		if r.Location == "" {
+			// Fleet memberships are named by their full name.
+			if _, location, ok := strings.Cut(item.Name, "/locations/"); ok {
+				r.Location, _, _ = strings.Cut(location, "/")
+			}
+		}
+		if r.Location == "" {
+			r.Location = lastSegment(item.Zone)
+			r.Zonal = r.Location != ""
+		}
+		if r.Location == "" {
+			r.Location = lastSegment(item.Region)
+		}
+		if item.ResourceLabels != nil {
+			r.Labels = item.ResourceLabels
+		}
+		if r.Network == "" && len(item.NetworkInterfaces) > 0 {
+			r.Network = lastSegment(item.NetworkInterfaces[0].Network)
+		}
+		if item.Address != "" {
+			r.Addresses = []string{item.Address}
+		}
+		if item.IPAddress != "" {
+			r.Addresses = []string{item.IPAddress}
+		}
+		if kind == DNSRecord {
+			r.Addresses = item.Rrdatas
+		}
+		for _, ts := range []string{item.CreationTimestamp, item.CreateTime} {
+			if ts == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, ts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse creation time of %s %s: %w", kind, item.Name, err)
+			}
+			r.CreationTime = t
+		}
+		resources = append(resources, r)
+	}
+	return resources, nil
+}
+
+// Delete implements Inventory.
+func (g *GcloudInventory) Delete(ctx context.Context, r Resource) error {
+	var args []string
+	switch r.Kind {
+	case DNSRecord:
+		args = []string{"dns", "record-sets", "delete", r.Name, "--type=" + r.RecordType, "--zone=" + g.DNSZone}
+		if g.DNSProject != "" {
+			args = append(args, "--project="+g.DNSProject)
+		}
+		_, err := g.Run(ctx, args...)
+		return err
+	case Cluster:
+		args = []string{"container", "clusters", "delete", r.Name, "--location=" + r.Location}
+	case Instance:
+		args = append(append(args, listCommands[r.Kind]...), "delete", r.Name, "--zone="+r.Location)
+	case NEG:
+		args = append(append(args, listCommands[r.Kind]...), "delete", r.Name)
+		switch {
+		case r.Location == "":
+			args = append(args, "--global")
+		case r.Zonal:
+			args = append(args, "--zone="+r.Location)
+		default:
+			args = append(args, "--region="+r.Location)
+		}
+	case Subnet:
+		args = append(append(args, listCommands[r.Kind]...), "delete", r.Name, "--region="+r.Location)
+	case Membership:
+		args = append(append(args, listCommands[r.Kind]...), "delete", r.Name)
+		if r.Location != "" {
+			args = append(args, "--location="+r.Location)
+		}
+	case Address, ForwardingRule, TargetHTTPProxy, TargetHTTPSProxy, URLMap, BackendService, HealthCheck:
+		args = append(append(args, listCommands[r.Kind]...), "delete", r.Name)
+		if r.Location == "" {
+			args = append(args, "--global")
+		} else {
+			args = append(args, "--region="+r.Location)
+		}
+	case SSLPolicy, SecurityPolicy, Firewall, Network:
+		args = append(append(args, listCommands[r.Kind]...), "delete", r.Name)
+		if r.Location != "" {
+			args = append(args, "--region="+r.Location)
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", r.Kind)
+	}
+	if g.Project != "" {
+		args = append(args, "--project="+g.Project)
+	}
+	_, err := g.Run(ctx, append(args, "--quiet")...)
+	return err
+}
+
+// lastSegment returns the last segment of a resource URL, e.g. the zone name
+// of https://www.googleapis.com/compute/v1/projects/p/zones/us-central1-c.
+func lastSegment(url string) string {
+	if url == "" {
+		return ""
+	}
+	return path.Base(url)
+}
@@ -0,0 +1,328 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sweeper finds the resources left behind by recipe tests in a
+// project and deletes them in dependency order.
+package sweeper
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/naming"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+// Kind is a kind of resource the sweeper knows how to delete.
+type Kind string
+
+const (
+	DNSRecord        Kind = "dns-record"
+	Membership       Kind = "membership"
+	Cluster          Kind = "cluster"
+	Instance         Kind = "instance"
+	ForwardingRule   Kind = "forwarding-rule"
+	TargetHTTPProxy  Kind = "target-http-proxy"
+	TargetHTTPSProxy Kind = "target-https-proxy"
+	URLMap           Kind = "url-map"
+	BackendService   Kind = "backend-service"
+	HealthCheck      Kind = "health-check"
+	NEG              Kind = "network-endpoint-group"
+	SSLPolicy        Kind = "ssl-policy"
+	SecurityPolicy   Kind = "security-policy"
+	Address          Kind = "address"
+	Firewall         Kind = "firewall-rule"
+	Subnet           Kind = "subnet"
+	Network          Kind = "network"
+)
+
+// DeletionOrder lists the kinds in the order they must be deleted in, so
+// that no resource is deleted while another resource still depends on it:
+// the load balancers left behind by the Ingresses and Gateways of deleted
+// clusters are deleted from their forwarding rules down to the NEGs, health
+// checks and security policies of their backend services.
+var DeletionOrder = []Kind{
+	DNSRecord,
+	Membership,
+	Cluster,
+	Instance,
+	ForwardingRule,
+	TargetHTTPProxy,
+	TargetHTTPSProxy,
+	URLMap,
+	BackendService,
+	HealthCheck,
+	NEG,
+	SSLPolicy,
+	SecurityPolicy,
+	Address,
+	Firewall,
+	Subnet,
+	Network,
+}
+
+// Resource is a resource found in the project.
+type Resource struct {
+	Kind Kind
+	Name string
+	// Location is the zone or region of the resource, empty if it is global.
+	Location string
+	// Zonal is true if Location is a zone, false if it is a region.
+	Zonal bool
+	// Network is the name of the network the resource is attached to, if
+	// any.
+	Network string
+	// Labels are the labels of the resource, if the resource supports them.
+	Labels map[string]string
+	// CreationTime is when the resource was created, zero if unknown.
+	CreationTime time.Time
+	// Addresses are the IP addresses of an address or a forwarding rule, or
+	// the data of a DNS record.
+	Addresses []string
+	// References are the resources it refers to, e.g. the target proxy of a
+	// forwarding rule or the health checks of a backend service.
+	References []Ref
+	// RecordType is the type of a DNS record, e.g. "A".
+	RecordType string
+}
+
+// Ref identifies a resource by kind, location and name, names being only
+// unique among the resources of a kind and location.
+type Ref struct {
+	Kind     Kind
+	Location string
+	Name     string
+}
+
+// Ref returns the identifier of r.
+func (r Resource) Ref() Ref {
+	return Ref{Kind: r.Kind, Location: r.Location, Name: r.Name}
+}
+
+// String returns a human readable identifier of the resource.
+func (r Resource) String() string {
+	if r.Location == "" {
+		return fmt.Sprintf("%s %s", r.Kind, r.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", r.Kind, r.Location, r.Name)
+}
+
+// Inventory lists and deletes the resources of a project.
+type Inventory interface {
+	// List returns all the resources of the given kind.
+	List(ctx context.Context, kind Kind) ([]Resource, error)
+	// Delete deletes the given resource.
+	Delete(ctx context.Context, r Resource) error
+}
+
+// Options selects the resources to sweep.
+type Options struct {
+	// Prefix is the name prefix of the resources created by recipe tests.
+	Prefix string
+	// Label is the key of the label holding the run ID of the resources
+	// created by recipe tests. Other labels, e.g. the recipe label, are also
+	// attached by the recipes deployed outside of tests and don't make a
+	// resource owned by a test.
+	Label string
+	// OlderThan only selects resources created at least this long ago, or
+	// whose expires-at label is in the past. When a resource has an
+	// expires-at label, it is used instead of the creation time. Resources
+	// of unknown age, e.g. DNS records, are only selected if they belong to
+	// the run RunID, to a run started at least this long ago, or point to a
+	// selected address.
+	OlderThan time.Duration
+	// RunID is the ID of the current test run, whose resources are selected
+	// whatever their age.
+	RunID string
+	// DryRun only reports the resources that would be deleted.
+	DryRun bool
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// DefaultOptions returns the options selecting every resource created by the
+// recipe tests.
+func DefaultOptions() Options {
+	return Options{
+		Prefix: naming.Prefix,
+		Label:  naming.LabelRunID,
+	}
+}
+
+// Sweeper deletes the resources created by recipe tests.
+type Sweeper struct {
+	inventory Inventory
+	opts      Options
+}
+
+// New returns a Sweeper working on the resources of inventory.
+func New(inventory Inventory, opts Options) *Sweeper {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Sweeper{inventory: inventory, opts: opts}
+}
+
+// Plan returns the resources to delete, in deletion order.
+func (s *Sweeper) Plan(ctx context.Context) ([]Resource, error) {
+	all := make(map[Kind][]Resource)
+	for _, kind := range DeletionOrder {
+		resources, err := s.inventory.List(ctx, kind)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %ss: %w", kind, err)
+		}
+		all[kind] = resources
+	}
+
+	// Resources attached to a network created by a recipe test are owned by
+	// the test, whatever their names.
+	networks := make(map[string]bool)
+	for _, r := range all[Network] {
+		if s.owned(r) {
+			networks[r.Name] = true
+		}
+	}
+	// DNS records don't support labels, and the forwarding rules created by
+	// the Ingress and Gateway controllers don't have the labels of the test,
+	// so they are owned by the test if they point to an address it reserved.
+	ips := make(map[string]bool)
+	for _, r := range all[Address] {
+		if (s.owned(r) || networks[r.Network]) && s.oldEnough(r, false) {
+			for _, ip := range r.Addresses {
+				ips[ip] = true
+			}
+		}
+	}
+
+	// The resources referred to by a swept resource are owned by the test,
+	// e.g. the URL map of its target proxy. DeletionOrder lists the referring
+	// kinds first, so they are all known when a kind is planned.
+	referenced := make(map[Ref]bool)
+	var plan []Resource
+	for _, kind := range DeletionOrder {
+		resources := all[kind]
+		sort.Slice(resources, func(i, j int) bool { return resources[i].String() < resources[j].String() })
+		for _, r := range resources {
+			addressed := pointsTo(r, ips)
+			if !s.owned(r) && !networks[r.Network] && !addressed && !referenced[r.Ref()] {
+				continue
+			}
+			// A resource pointing to a swept address is as old as it.
+			if !s.oldEnough(r, addressed) {
+				klog.Infof("[Sweeper] Skipping %s created at %s, labels %v", r, r.CreationTime, r.Labels)
+				continue
+			}
+			plan = append(plan, r)
+			for _, ref := range r.References {
+				referenced[ref] = true
+			}
+		}
+	}
+	return plan, nil
+}
+
+// Sweep deletes the resources returned by Plan, and returns them.
+// A failure to delete a resource does not stop the sweep, all the failures
+// are returned together.
+func (s *Sweeper) Sweep(ctx context.Context) ([]Resource, error) {
+	plan, err := s.Plan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, r := range plan {
+		if s.opts.DryRun {
+			klog.Infof("[Sweeper] Would delete %s", r)
+			continue
+		}
+		klog.Infof("[Sweeper] Deleting %s", r)
+		if err := s.inventory.Delete(ctx, r); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete %s: %w", r, err))
+		}
+	}
+	return plan, utilerrors.NewAggregate(errs)
+}
+
+// owned returns true if r was created by a recipe test.
+func (s *Sweeper) owned(r Resource) bool {
+	if s.opts.Prefix != "" && strings.HasPrefix(r.Name, s.opts.Prefix) {
+		return true
+	}
+	if s.opts.Label != "" {
+		if _, ok := r.Labels[s.opts.Label]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// oldEnough returns true if r was created long enough ago to be swept. The
+// age of a resource without creation time is taken from its run-id label,
+// unless unknownAgeOK.
+func (s *Sweeper) oldEnough(r Resource, unknownAgeOK bool) bool {
+	if s.opts.OlderThan == 0 {
+		return true
+	}
+	if expired, ok := naming.Expired(r.Labels, s.opts.Now()); ok {
+		return expired
+	}
+	if !r.CreationTime.IsZero() {
+		return s.opts.Now().Sub(r.CreationTime) >= s.opts.OlderThan
+	}
+	if unknownAgeOK {
+		return true
+	}
+	runID, ok := r.Labels[s.opts.Label]
+	if !ok {
+		return false
+	}
+	if s.opts.RunID != "" && runID == naming.LabelValue(s.opts.RunID) {
+		return true
+	}
+	started, ok := runStart(runID)
+	return ok && s.opts.Now().Sub(started) >= s.opts.OlderThan
+}
+
+// runStart returns when the run of the given run-id label value started,
+// if its run ID was returned by naming.NewRunID.
+func runStart(runID string) (time.Time, bool) {
+	const layout = "20060102-150405"
+	if len(runID) < len(layout) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(layout, runID[:len(layout)])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// pointsTo returns true if r is a DNS record or a forwarding rule pointing to
+// one of ips.
+func pointsTo(r Resource, ips map[string]bool) bool {
+	if r.Kind != DNSRecord && r.Kind != ForwardingRule {
+		return false
+	}
+	for _, ip := range r.Addresses {
+		if ips[ip] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,413 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sweeper
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/naming"
+)
+
+var now = time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// testInventory returns the resources left behind by an ingress-https test,
+// and resources that don't belong to any recipe test.
+func testInventory() *FakeInventory {
+	old := now.Add(-5 * time.Hour)
+	network := "gke-net-recipes-0123456789abcdef0123"
+	return NewFakeInventory(
+		// Resources of the recipe test.
+		Resource{Kind: Network, Name: network, CreationTime: old},
+		Resource{Kind: Subnet, Name: network, Location: "us-central1", Network: network, CreationTime: old},
+		Resource{Kind: Subnet, Name: "proxy-only-0123456789abcdef0123", Location: "us-central1", Network: network, CreationTime: old},
+		Resource{Kind: Firewall, Name: "allow-ssh-0123456789abcdef0123", Network: network, CreationTime: old},
+		Resource{Kind: Firewall, Name: "gke-gke-net-recipes-0123-all", Network: network, CreationTime: old},
+		Resource{Kind: Instance, Name: network, Location: "us-central1-c", Network: network, CreationTime: old},
+		Resource{Kind: Cluster, Name: network, Location: "us-central1-c", Network: network, CreationTime: old},
+		Resource{Kind: Membership, Name: network, Labels: map[string]string{"run-id": "0123456789abcdef0123"}, CreationTime: old},
+		Resource{Kind: NEG, Name: "k8s1-1234abcd-ingress-https-foo-80-5678", Location: "us-central1-c", Zonal: true, Network: network, CreationTime: old},
+		Resource{Kind: Address, Name: "gke-foobar-public-ip", Labels: map[string]string{"recipe": "ingress-https", "run-id": "0123456789abcdef0123"}, Addresses: []string{"203.0.113.10"}, CreationTime: old},
+		// Load balancer of the Ingress of the recipe, left behind when its
+		// cluster was deleted.
+		Resource{Kind: ForwardingRule, Name: "k8s2-fs-1234abcd-default-foo-5678", Addresses: []string{"203.0.113.10"}, References: []Ref{{Kind: TargetHTTPSProxy, Name: "k8s2-ts-1234abcd-default-foo-5678"}}, CreationTime: old},
+		Resource{Kind: TargetHTTPSProxy, Name: "k8s2-ts-1234abcd-default-foo-5678", References: []Ref{{Kind: URLMap, Name: "k8s2-um-1234abcd-default-foo-5678"}, {Kind: SSLPolicy, Name: "gke-net-recipes-ssl-policy"}}, CreationTime: old},
+		Resource{Kind: URLMap, Name: "k8s2-um-1234abcd-default-foo-5678", References: []Ref{{Kind: BackendService, Name: "k8s1-1234abcd-ingress-https-foo-80-5678"}}, CreationTime: old},
+		Resource{Kind: BackendService, Name: "k8s1-1234abcd-ingress-https-foo-80-5678", References: []Ref{{Kind: HealthCheck, Name: "k8s1-1234abcd-ingress-https-foo-80-5678"}, {Kind: NEG, Location: "us-central1-c", Name: "k8s1-1234abcd-ingress-https-foo-80-5678"}, {Kind: SecurityPolicy, Name: "gke-net-recipes-cloud-armor"}}, CreationTime: old},
+		Resource{Kind: HealthCheck, Name: "k8s1-1234abcd-ingress-https-foo-80-5678", CreationTime: old},
+		Resource{Kind: SSLPolicy, Name: "gke-net-recipes-ssl-policy", CreationTime: old},
+		Resource{Kind: SecurityPolicy, Name: "gke-net-recipes-cloud-armor", Labels: map[string]string{"recipe": "ingress-cloudarmor"}, CreationTime: old},
+		Resource{Kind: DNSRecord, Name: "foo.example.com.", RecordType: "A", Addresses: []string{"203.0.113.10"}},
+		// Resources not created by recipe tests.
+		Resource{Kind: Network, Name: "default", CreationTime: old},
+		Resource{Kind: Firewall, Name: "default-allow-ssh", Network: "default", CreationTime: old},
+		Resource{Kind: Instance, Name: "bastion", Location: "us-central1-c", Network: "default", CreationTime: old},
+		Resource{Kind: Address, Name: "prod-ip", Addresses: []string{"203.0.113.20"}, CreationTime: old},
+		Resource{Kind: DNSRecord, Name: "www.example.com.", RecordType: "A", Addresses: []string{"203.0.113.20"}},
+		Resource{Kind: ForwardingRule, Name: "prod-fr", Addresses: []string{"203.0.113.20"}, References: []Ref{{Kind: TargetHTTPProxy, Name: "prod-proxy"}}, CreationTime: old},
+		Resource{Kind: TargetHTTPProxy, Name: "prod-proxy", CreationTime: old},
+		// Deployed from a recipe outside of the tests.
+		Resource{Kind: SecurityPolicy, Name: "prod-cloud-armor", Labels: map[string]string{"recipe": "ingress-cloudarmor"}, CreationTime: old},
+	)
+}
+
+func names(resources []Resource) []string {
+	var names []string
+	for _, r := range resources {
+		names = append(names, r.String())
+	}
+	return names
+}
+
+func TestSweep(t *testing.T) {
+	inventory := testInventory()
+	opts := DefaultOptions()
+	opts.Now = func() time.Time { return now }
+
+	deleted, err := New(inventory, opts).Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Sweep() = %v, want nil", err)
+	}
+	want := []string{
+		"dns-record foo.example.com.",
+		"membership gke-net-recipes-0123456789abcdef0123",
+		"cluster us-central1-c/gke-net-recipes-0123456789abcdef0123",
+		"instance us-central1-c/gke-net-recipes-0123456789abcdef0123",
+		"forwarding-rule k8s2-fs-1234abcd-default-foo-5678",
+		"target-https-proxy k8s2-ts-1234abcd-default-foo-5678",
+		"url-map k8s2-um-1234abcd-default-foo-5678",
+		"backend-service k8s1-1234abcd-ingress-https-foo-80-5678",
+		"health-check k8s1-1234abcd-ingress-https-foo-80-5678",
+		"network-endpoint-group us-central1-c/k8s1-1234abcd-ingress-https-foo-80-5678",
+		"ssl-policy gke-net-recipes-ssl-policy",
+		"security-policy gke-net-recipes-cloud-armor",
+		"address gke-foobar-public-ip",
+		"firewall-rule allow-ssh-0123456789abcdef0123",
+		"firewall-rule gke-gke-net-recipes-0123-all",
+		"subnet us-central1/gke-net-recipes-0123456789abcdef0123",
+		"subnet us-central1/proxy-only-0123456789abcdef0123",
+		"network gke-net-recipes-0123456789abcdef0123",
+	}
+	if got := names(deleted); !reflect.DeepEqual(got, want) {
+		t.Errorf("Sweep() deleted %v, want %v", got, want)
+	}
+	if got := names(inventory.Deleted); !reflect.DeepEqual(got, want) {
+		t.Errorf("inventory deleted %v, want %v", got, want)
+	}
+	wantLeft := []string{
+		"network default",
+		"firewall-rule default-allow-ssh",
+		"instance us-central1-c/bastion",
+		"address prod-ip",
+		"dns-record www.example.com.",
+		"forwarding-rule prod-fr",
+		"target-http-proxy prod-proxy",
+		"security-policy prod-cloud-armor",
+	}
+	if got := names(inventory.Resources()); !reflect.DeepEqual(got, wantLeft) {
+		t.Errorf("inventory left %v, want %v", got, wantLeft)
+	}
+}
+
+func TestSweepDryRun(t *testing.T) {
+	inventory := testInventory()
+	opts := DefaultOptions()
+	opts.DryRun = true
+
+	planned, err := New(inventory, opts).Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Sweep() = %v, want nil", err)
+	}
+	if len(planned) != 18 {
+		t.Errorf("Sweep() planned %d deletions, want 18: %v", len(planned), names(planned))
+	}
+	if len(inventory.Deleted) != 0 {
+		t.Errorf("Sweep() in dry run mode deleted %v", names(inventory.Deleted))
+	}
+}
+
+func TestSweepOlderThan(t *testing.T) {
+	inventory := NewFakeInventory(
+		Resource{Kind: Network, Name: "gke-net-recipes-old", CreationTime: now.Add(-3 * time.Hour)},
+		Resource{Kind: Network, Name: "gke-net-recipes-new", CreationTime: now.Add(-time.Hour)},
+		Resource{Kind: Address, Name: "gke-net-recipes-new", Addresses: []string{"203.0.113.30"}, CreationTime: now.Add(-time.Hour)},
+		Resource{Kind: DNSRecord, Name: "new.example.com.", RecordType: "A", Addresses: []string{"203.0.113.30"}},
+	)
+	opts := DefaultOptions()
+	opts.OlderThan = 2 * time.Hour
+	opts.Now = func() time.Time { return now }
+
+	deleted, err := New(inventory, opts).Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Sweep() = %v, want nil", err)
+	}
+	if got, want := names(deleted), []string{"network gke-net-recipes-old"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Sweep() deleted %v, want %v", got, want)
+	}
+}
+
+func TestSweepExpiresAt(t *testing.T) {
+	expiresAt := func(at time.Time) map[string]string {
+		return map[string]string{naming.LabelRunID: "r", naming.LabelExpiresAt: strconv.FormatInt(at.Unix(), 10)}
+	}
+	inventory := NewFakeInventory(
+		// Recently created, but expired.
+		Resource{Kind: Cluster, Name: "expired", Labels: expiresAt(now.Add(-time.Minute)), CreationTime: now.Add(-time.Hour)},
+		// Created long ago, but still needed.
+		Resource{Kind: Cluster, Name: "not-expired", Labels: expiresAt(now.Add(time.Hour)), CreationTime: now.Add(-5 * time.Hour)},
+	)
+	opts := DefaultOptions()
+	opts.OlderThan = 2 * time.Hour
+	opts.Now = func() time.Time { return now }
+
+	deleted, err := New(inventory, opts).Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Sweep() = %v, want nil", err)
+	}
+	if got, want := names(deleted), []string{"cluster expired"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Sweep() deleted %v, want %v", got, want)
+	}
+}
+
+func TestSweepUnknownAge(t *testing.T) {
+	runID := func(id string) map[string]string {
+		return map[string]string{naming.LabelRunID: id}
+	}
+	inventory := NewFakeInventory(
+		Resource{Kind: Membership, Name: "gke-net-recipes-old-run", Labels: runID("20230601-080000-abcdef")},
+		Resource{Kind: Membership, Name: "gke-net-recipes-new-run", Labels: runID("20230601-113000-abcdef")},
+		Resource{Kind: Membership, Name: "gke-net-recipes-this-run", Labels: runID(naming.LabelValue("20230601-115500-ABCDEF"))},
+		Resource{Kind: Membership, Name: "gke-net-recipes-custom-run", Labels: runID("custom")},
+		Resource{Kind: Membership, Name: "gke-net-recipes-unlabeled"},
+		// Points to an address too recent to be swept.
+		Resource{Kind: Address, Name: "gke-net-recipes-new", Addresses: []string{"203.0.113.30"}, CreationTime: now.Add(-time.Hour)},
+		Resource{Kind: DNSRecord, Name: "new.example.com.", RecordType: "A", Addresses: []string{"203.0.113.30"}},
+	)
+	opts := DefaultOptions()
+	opts.OlderThan = 2 * time.Hour
+	opts.RunID = "20230601-115500-ABCDEF"
+	opts.Now = func() time.Time { return now }
+
+	deleted, err := New(inventory, opts).Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Sweep() = %v, want nil", err)
+	}
+	want := []string{"membership gke-net-recipes-old-run", "membership gke-net-recipes-this-run"}
+	if got := names(deleted); !reflect.DeepEqual(got, want) {
+		t.Errorf("Sweep() deleted %v, want %v", got, want)
+	}
+}
+
+func TestSweepReferencesOfOtherKinds(t *testing.T) {
+	old := now.Add(-5 * time.Hour)
+	inventory := NewFakeInventory(
+		Resource{Kind: URLMap, Name: "gke-net-recipes-um", References: []Ref{{Kind: BackendService, Name: "shared"}}, CreationTime: old},
+		Resource{Kind: BackendService, Name: "shared", CreationTime: old},
+		// Same names as the referenced backend service, different kinds or
+		// locations.
+		Resource{Kind: HealthCheck, Name: "shared", CreationTime: old},
+		Resource{Kind: BackendService, Name: "shared", Location: "us-central1", CreationTime: old},
+		Resource{Kind: NEG, Name: "shared", Location: "us-central1-c", Zonal: true, CreationTime: old},
+	)
+	opts := DefaultOptions()
+	opts.Now = func() time.Time { return now }
+
+	deleted, err := New(inventory, opts).Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Sweep() = %v, want nil", err)
+	}
+	want := []string{"url-map gke-net-recipes-um", "backend-service shared"}
+	if got := names(deleted); !reflect.DeepEqual(got, want) {
+		t.Errorf("Sweep() deleted %v, want %v", got, want)
+	}
+}
+
+func TestSweepContinuesOnError(t *testing.T) {
+	inventory := testInventory()
+	inventory.DeleteErrors["gke-net-recipes-ssl-policy"] = errors.New("resource in use")
+
+	_, err := New(inventory, DefaultOptions()).Sweep(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "gke-net-recipes-ssl-policy") {
+		t.Fatalf("Sweep() = %v, want error about the SSL policy", err)
+	}
+	// Everything else is still deleted.
+	if got, want := len(inventory.Deleted), 17; got != want {
+		t.Errorf("Sweep() deleted %d resources, want %d: %v", got, want, names(inventory.Deleted))
+	}
+}
+
+func TestGcloudInventory(t *testing.T) {
+	var calls []string
+	outputs := map[string]string{
+		"compute instances list": `[{
+			"name": "gke-net-recipes-abc",
+			"zone": "https://www.googleapis.com/compute/v1/projects/p/zones/us-central1-c",
+			"labels": {"recipe": "ingress-https"},
+			"creationTimestamp": "2023-05-31T10:00:00.000-07:00",
+			"networkInterfaces": [{"network": "https://www.googleapis.com/compute/v1/projects/p/global/networks/gke-net-recipes-abc"}]
+		}]`,
+		"container clusters list": `[{
+			"name": "gke-net-recipes-abc",
+			"location": "us-central1-c",
+			"network": "gke-net-recipes-abc",
+			"resourceLabels": {"recipe": "ingress-https"},
+			"createTime": "2023-05-31T17:00:00+00:00"
+		}]`,
+		"dns record-sets list": `[{"name": "foo.example.com.", "type": "A", "rrdatas": ["203.0.113.10"]}]`,
+		"container fleet memberships list": `[{
+			"name": "projects/p/locations/global/memberships/gke-net-recipes-abc-1",
+			"labels": {"run-id": "abc"},
+			"createTime": "2023-05-31T17:00:00Z"
+		}]`,
+		"compute forwarding-rules list": `[{
+			"name": "k8s2-fs-abc",
+			"region": "https://www.googleapis.com/compute/v1/projects/p/regions/us-central1",
+			"IPAddress": "10.0.0.10",
+			"target": "https://www.googleapis.com/compute/v1/projects/p/regions/us-central1/targetHttpsProxies/k8s2-ts-abc"
+		}]`,
+		"compute backend-services list": `[{
+			"name": "k8s1-abc",
+			"healthChecks": ["https://www.googleapis.com/compute/v1/projects/p/global/healthChecks/k8s1-abc"],
+			"backends": [{"group": "https://www.googleapis.com/compute/v1/projects/p/zones/us-central1-c/networkEndpointGroups/k8s1-abc"}],
+			"securityPolicy": "https://www.googleapis.com/compute/v1/projects/p/global/securityPolicies/gke-net-recipes-armor"
+		}]`,
+	}
+	inventory := &GcloudInventory{
+		Project:    "test-project",
+		DNSProject: "dns-project",
+		DNSZone:    "example-zone",
+		Run: func(_ context.Context, args ...string) ([]byte, error) {
+			calls = append(calls, strings.Join(args, " "))
+			for prefix, out := range outputs {
+				if strings.HasPrefix(strings.Join(args, " "), prefix) {
+					return []byte(out), nil
+				}
+			}
+			return []byte("[]"), nil
+		},
+	}
+	ctx := context.Background()
+
+	instances, err := inventory.List(ctx, Instance)
+	if err != nil {
+		t.Fatalf("List(%q) = %v, want nil", Instance, err)
+	}
+	wantInstance := Resource{
+		Kind:         Instance,
+		Name:         "gke-net-recipes-abc",
+		Location:     "us-central1-c",
+		Zonal:        true,
+		Network:      "gke-net-recipes-abc",
+		Labels:       map[string]string{"recipe": "ingress-https"},
+		CreationTime: time.Date(2023, 5, 31, 17, 0, 0, 0, time.UTC),
+	}
+	if len(instances) != 1 || !instances[0].CreationTime.Equal(wantInstance.CreationTime) {
+		t.Fatalf("List(%q) = %+v, want [%+v]", Instance, instances, wantInstance)
+	}
+	instances[0].CreationTime = wantInstance.CreationTime
+	if !reflect.DeepEqual(instances[0], wantInstance) {
+		t.Errorf("List(%q) = %+v, want %+v", Instance, instances[0], wantInstance)
+	}
+
+	clusters, err := inventory.List(ctx, Cluster)
+	if err != nil {
+		t.Fatalf("List(%q) = %v, want nil", Cluster, err)
+	}
+	if len(clusters) != 1 || clusters[0].Labels["recipe"] != "ingress-https" || clusters[0].Location != "us-central1-c" {
+		t.Errorf("List(%q) = %+v, want the recipe cluster", Cluster, clusters)
+	}
+
+	memberships, err := inventory.List(ctx, Membership)
+	if err != nil {
+		t.Fatalf("List(%q) = %v, want nil", Membership, err)
+	}
+	if len(memberships) != 1 || memberships[0].Name != "gke-net-recipes-abc-1" || memberships[0].Location != "global" {
+		t.Errorf("List(%q) = %+v, want the global membership named gke-net-recipes-abc-1", Membership, memberships)
+	}
+	rules, err := inventory.List(ctx, ForwardingRule)
+	if err != nil {
+		t.Fatalf("List(%q) = %v, want nil", ForwardingRule, err)
+	}
+	wantRule := Resource{Kind: ForwardingRule, Name: "k8s2-fs-abc", Location: "us-central1", Addresses: []string{"10.0.0.10"}, References: []Ref{{Kind: TargetHTTPSProxy, Location: "us-central1", Name: "k8s2-ts-abc"}}}
+	if len(rules) != 1 || !reflect.DeepEqual(rules[0], wantRule) {
+		t.Errorf("List(%q) = %+v, want [%+v]", ForwardingRule, rules, wantRule)
+	}
+	services, err := inventory.List(ctx, BackendService)
+	if err != nil {
+		t.Fatalf("List(%q) = %v, want nil", BackendService, err)
+	}
+	want := []Ref{
+		{Kind: SecurityPolicy, Name: "gke-net-recipes-armor"},
+		{Kind: HealthCheck, Name: "k8s1-abc"},
+		{Kind: NEG, Location: "us-central1-c", Name: "k8s1-abc"},
+	}
+	if len(services) != 1 || !reflect.DeepEqual(services[0].References, want) {
+		t.Errorf("List(%q) = %+v, want references %v", BackendService, services, want)
+	}
+
+	records, err := inventory.List(ctx, DNSRecord)
+	if err != nil {
+		t.Fatalf("List(%q) = %v, want nil", DNSRecord, err)
+	}
+	if err := inventory.Delete(ctx, records[0]); err != nil {
+		t.Fatalf("Delete(%v) = %v, want nil", records[0], err)
+	}
+	if err := inventory.Delete(ctx, Resource{Kind: Address, Name: "gke-net-recipes-ip"}); err != nil {
+		t.Fatalf("Delete() = %v, want nil", err)
+	}
+	if err := inventory.Delete(ctx, clusters[0]); err != nil {
+		t.Fatalf("Delete(%v) = %v, want nil", clusters[0], err)
+	}
+	if err := inventory.Delete(ctx, memberships[0]); err != nil {
+		t.Fatalf("Delete(%v) = %v, want nil", memberships[0], err)
+	}
+	if err := inventory.Delete(ctx, rules[0]); err != nil {
+		t.Fatalf("Delete(%v) = %v, want nil", rules[0], err)
+	}
+	for _, neg := range []Resource{
+		{Kind: NEG, Name: "zonal-neg", Location: "us-central1-c", Zonal: true},
+		{Kind: NEG, Name: "regional-neg", Location: "us-central1"},
+		{Kind: NEG, Name: "global-neg"},
+	} {
+		if err := inventory.Delete(ctx, neg); err != nil {
+			t.Fatalf("Delete(%v) = %v, want nil", neg, err)
+		}
+	}
+
+	wantCalls := []string{
+		"compute instances list --project=test-project --format=json",
+		"container clusters list --project=test-project --format=json",
+		"container fleet memberships list --project=test-project --format=json",
+		"compute forwarding-rules list --project=test-project --format=json",
+		"compute backend-services list --project=test-project --format=json",
+		"dns record-sets list --zone=example-zone --project=dns-project --format=json",
+		"dns record-sets delete foo.example.com. --type=A --zone=example-zone --project=dns-project",
+		"compute addresses delete gke-net-recipes-ip --global --project=test-project --quiet",
+		"container clusters delete gke-net-recipes-abc --location=us-central1-c --project=test-project --quiet",
+		"container fleet memberships delete gke-net-recipes-abc-1 --location=global --project=test-project --quiet",
+		"compute forwarding-rules delete k8s2-fs-abc --region=us-central1 --project=test-project --quiet",
+		"compute network-endpoint-groups delete zonal-neg --zone=us-central1-c --project=test-project --quiet",
+		"compute network-endpoint-groups delete regional-neg --region=us-central1 --project=test-project --quiet",
+		"compute network-endpoint-groups delete global-neg --global --project=test-project --quiet",
+	}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("gcloud calls = %q, want %q", calls, wantCalls)
+	}
+}
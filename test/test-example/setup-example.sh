@@ -30,7 +30,8 @@ if [[ -z "${context}" ]]; then
     exit 1
 fi
 
-kubectl --context "${context}" create namespace "${test_name}"
+create_namespace "${context}" "${test_name}"
 # TODO: Add any addition setup if needed(gcloud, kubectl, etc.), and deploy the k8s resources.
 # gcloud ...
 # kubectl --context "${context}" apply -f YOUR_YAML.yaml -n "${test_name}"
+# label_resources "${context}" "${test_name}"
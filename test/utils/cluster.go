@@ -0,0 +1,81 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Cluster is a handle to a cluster the credentials of which are stored in a
+// kubeconfig file.
+type Cluster struct {
+	// Context is the name of the kubeconfig context of the cluster.
+	Context string
+	// Kubeconfig is the path of the kubeconfig file holding the context.
+	Kubeconfig string
+}
+
+// LoadCluster returns the cluster of the current context in the kubeconfig
+// file at path. gcloud container clusters get-credentials sets the current
+// context to the cluster it fetched the credentials of.
+func LoadCluster(path string) (*Cluster, error) {
+	config, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig %q: %w", path, err)
+	}
+	if config.CurrentContext == "" {
+		return nil, fmt.Errorf("kubeconfig %q has no current context", path)
+	}
+	if _, ok := config.Contexts[config.CurrentContext]; !ok {
+		return nil, fmt.Errorf("kubeconfig %q has no context %q", path, config.CurrentContext)
+	}
+	return &Cluster{
+		Context:    config.CurrentContext,
+		Kubeconfig: path,
+	}, nil
+}
+
+// LoadClusters returns the clusters of the named contexts of the kubeconfig
+// file at path, by context name. Multi-cluster recipes name the contexts of
+// their clusters after them, e.g. gke-1.
+func LoadClusters(path string, contexts ...string) (map[string]*Cluster, error) {
+	config, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig %q: %w", path, err)
+	}
+	clusters := make(map[string]*Cluster, len(contexts))
+	for _, context := range contexts {
+		if _, ok := config.Contexts[context]; !ok {
+			return nil, fmt.Errorf("kubeconfig %q has no context %q", path, context)
+		}
+		clusters[context] = &Cluster{Context: context, Kubeconfig: path}
+	}
+	return clusters, nil
+}
+
+// RESTConfig returns the client configuration for the cluster.
+func (c *Cluster) RESTConfig() (*rest.Config, error) {
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: c.Kubeconfig},
+		&clientcmd.ConfigOverrides{CurrentContext: c.Context},
+	).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client config for context %q: %w", c.Context, err)
+	}
+	return config, nil
+}
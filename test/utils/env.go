@@ -0,0 +1,261 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/naming"
+)
+
+// gcloudCredentialFiles are the files in a gcloud configuration directory
+// holding the credentials of the logged in accounts.
+var gcloudCredentialFiles = []string{
+	"access_tokens.db",
+	"application_default_credentials.json",
+	"credentials.db",
+	"legacy_credentials",
+}
+
+// Env is the environment the test scripts run in: the environment of the
+// current process, with variables set on top of it, e.g. the projects of the
+// boskos leases. The zero Env is the environment of the current process.
+// An Env created by NewEnv uses its own gcloud configuration directory, so
+// that the project and credentials used by the tests are only visible to the
+// processes started through it, and the gcloud configuration of the user is
+// never modified.
+type Env struct {
+	// Dir is the temporary directory holding the gcloud configuration and
+	// kubeconfig of the environment, empty for the zero Env.
+	Dir string
+	// vars are the environment variables set on top of the environment of
+	// the current process.
+	vars map[string]string
+}
+
+// NewEnv creates an isolated environment using project as the default
+// project, unless project is empty. The credentials are taken from
+// GOOGLE_APPLICATION_CREDENTIALS if set, or copied from the gcloud
+// configuration of the user otherwise.
+func NewEnv(project string) (*Env, error) {
+	dir, err := os.MkdirTemp("", "gke-net-recipes-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create environment directory: %w", err)
+	}
+	e := &Env{
+		Dir: dir,
+		vars: map[string]string{
+			"CLOUDSDK_CONFIG":               filepath.Join(dir, "gcloud"),
+			"CLOUDSDK_CORE_DISABLE_PROMPTS": "1",
+			"KUBECONFIG":                    filepath.Join(dir, "kubeconfig"),
+		},
+	}
+	if project != "" {
+		e.vars["CLOUDSDK_CORE_PROJECT"] = project
+		e.vars["PROJECT"] = project
+	}
+	if err := os.Mkdir(e.vars["CLOUDSDK_CONFIG"], 0700); err != nil {
+		e.Cleanup()
+		return nil, fmt.Errorf("failed to create gcloud config directory: %w", err)
+	}
+	if err := e.setupCredentials(); err != nil {
+		e.Cleanup()
+		return nil, err
+	}
+	return e, nil
+}
+
+// setupCredentials makes the credentials of the user available to gcloud in
+// the environment.
+func (e *Env) setupCredentials() error {
+	if creds := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); creds != "" {
+		e.vars["CLOUDSDK_AUTH_CREDENTIAL_FILE_OVERRIDE"] = creds
+		return nil
+	}
+
+	userConfig := userGcloudConfigDir()
+	for _, name := range gcloudCredentialFiles {
+		src := filepath.Join(userConfig, name)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+		if err := copyPath(src, filepath.Join(e.vars["CLOUDSDK_CONFIG"], name)); err != nil {
+			return fmt.Errorf("failed to copy gcloud credentials %q: %w", src, err)
+		}
+	}
+	account, err := activeAccount(userConfig)
+	if err != nil {
+		return err
+	}
+	if account != "" {
+		e.vars["CLOUDSDK_CORE_ACCOUNT"] = account
+	}
+	return nil
+}
+
+// Set sets an environment variable for the processes started in the
+// environment.
+func (e *Env) Set(key, value string) {
+	if e.vars == nil {
+		e.vars = make(map[string]string)
+	}
+	e.vars[key] = value
+}
+
+// Get returns the value of an environment variable in the environment.
+func (e *Env) Get(key string) string {
+	if v, ok := e.vars[key]; ok {
+		return v
+	}
+	return os.Getenv(key)
+}
+
+// SetLeases exposes the project of every lease through the environment
+// variable returned by Lease.EnvVar. The project of the main lease is also
+// used as the default gcloud project.
+func (e *Env) SetLeases(leases []Lease, projects map[string]string) error {
+	for _, l := range leases {
+		project, ok := projects[l.Name]
+		if !ok {
+			return fmt.Errorf("no project acquired for lease %q", l.Name)
+		}
+		if l.Name == MainLease {
+			e.Set("CLOUDSDK_CORE_PROJECT", project)
+		}
+		e.Set(l.EnvVar(), project)
+	}
+	return nil
+}
+
+// SetNamer makes the test scripts name and label the resources they create
+// as derived by n, through RUN_ID, RESOURCE_SUFFIX and RESOURCE_LABELS. See
+// test/helpers/naming.sh.
+func (e *Env) SetNamer(n *naming.Namer) {
+	e.Set("RUN_ID", n.RunID)
+	e.Set("RESOURCE_SUFFIX", n.Suffix())
+	e.Set("RESOURCE_LABELS", n.LabelsFlag())
+}
+
+// Environ returns the environment of the processes started in the
+// environment, in the form "key=value".
+func (e *Env) Environ() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if _, ok := e.vars[key]; !ok {
+			env = append(env, kv)
+		}
+	}
+	var keys []string
+	for key := range e.vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env = append(env, key+"="+e.vars[key])
+	}
+	return env
+}
+
+// Command returns a command running in the environment.
+func (e *Env) Command(name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	cmd.Env = e.Environ()
+	return cmd
+}
+
+// ForRecipe returns an environment for the recipe in recipeDir. It shares the
+// gcloud configuration of e, but has its own kubeconfig, so that recipes
+// running in parallel never write to the same kubeconfig file.
+func (e *Env) ForRecipe(recipeDir string) (*Env, error) {
+	name := strings.ReplaceAll(strings.Trim(filepath.ToSlash(recipeDir), "/"), "/", "_")
+	dir := filepath.Join(e.Dir, "recipes", name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create environment directory for %q: %w", recipeDir, err)
+	}
+	vars := make(map[string]string, len(e.vars))
+	for key, value := range e.vars {
+		vars[key] = value
+	}
+	vars["KUBECONFIG"] = filepath.Join(dir, "kubeconfig")
+	return &Env{Dir: dir, vars: vars}, nil
+}
+
+// Cluster returns the cluster of the current context in the kubeconfig of
+// the environment.
+func (e *Env) Cluster() (*Cluster, error) {
+	return LoadCluster(e.vars["KUBECONFIG"])
+}
+
+// Cleanup removes the directory of the environment.
+func (e *Env) Cleanup() error {
+	if err := os.RemoveAll(e.Dir); err != nil {
+		return fmt.Errorf("failed to remove %q: %w", e.Dir, err)
+	}
+	return nil
+}
+
+// userGcloudConfigDir returns the gcloud configuration directory of the user.
+func userGcloudConfigDir() string {
+	if dir := os.Getenv("CLOUDSDK_CONFIG"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "gcloud")
+}
+
+// activeAccount returns the account set in the active gcloud configuration
+// found in configDir, or "" if there is none.
+func activeAccount(configDir string) (string, error) {
+	if account := os.Getenv("CLOUDSDK_CORE_ACCOUNT"); account != "" {
+		return account, nil
+	}
+	config := "default"
+	if b, err := os.ReadFile(filepath.Join(configDir, "active_config")); err == nil {
+		config = strings.TrimSpace(string(b))
+	}
+	f, err := os.Open(filepath.Join(configDir, "configurations", "config_"+config))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read gcloud configuration %q: %w", config, err)
+	}
+	defer f.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.Trim(line, "[]")
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if ok && section == "core" && strings.TrimSpace(key) == "account" {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "", scanner.Err()
+}
@@ -0,0 +1,219 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/naming"
+)
+
+// writeFile writes content to path, creating its parent directories.
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatalf("MkdirAll(%q) = %v, want nil", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("WriteFile(%q) = %v, want nil", path, err)
+	}
+}
+
+func TestNewEnvCopiesUserCredentials(t *testing.T) {
+	userConfig := t.TempDir()
+	writeFile(t, filepath.Join(userConfig, "credentials.db"), "creds")
+	writeFile(t, filepath.Join(userConfig, "legacy_credentials", "me@example.com", "adc.json"), "adc")
+	writeFile(t, filepath.Join(userConfig, "active_config"), "work\n")
+	writeFile(t, filepath.Join(userConfig, "configurations", "config_work"), "[core]\naccount = me@example.com\nproject = user-project\n")
+	t.Setenv("CLOUDSDK_CONFIG", userConfig)
+	t.Setenv("CLOUDSDK_CORE_ACCOUNT", "")
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+
+	e, err := NewEnv("test-project")
+	if err != nil {
+		t.Fatalf("NewEnv() = %v, want nil", err)
+	}
+	defer e.Cleanup()
+
+	for key, want := range map[string]string{
+		"CLOUDSDK_CONFIG":       filepath.Join(e.Dir, "gcloud"),
+		"CLOUDSDK_CORE_PROJECT": "test-project",
+		"CLOUDSDK_CORE_ACCOUNT": "me@example.com",
+		"KUBECONFIG":            filepath.Join(e.Dir, "kubeconfig"),
+		"PROJECT":               "test-project",
+	} {
+		if got := e.Get(key); got != want {
+			t.Errorf("Get(%q) = %q, want %q", key, got, want)
+		}
+	}
+	for _, name := range []string{"credentials.db", "legacy_credentials/me@example.com/adc.json"} {
+		if _, err := os.Stat(filepath.Join(e.Get("CLOUDSDK_CONFIG"), name)); err != nil {
+			t.Errorf("credentials %q not copied: %v", name, err)
+		}
+	}
+	// The configuration of the user must not be visible in the environment.
+	if _, err := os.Stat(filepath.Join(e.Get("CLOUDSDK_CONFIG"), "configurations")); !os.IsNotExist(err) {
+		t.Errorf("user configurations copied to the environment: %v", err)
+	}
+	if got := os.Getenv("CLOUDSDK_CONFIG"); got != userConfig {
+		t.Errorf("CLOUDSDK_CONFIG of the current process = %q, want %q", got, userConfig)
+	}
+
+	if err := e.Cleanup(); err != nil {
+		t.Fatalf("Cleanup() = %v, want nil", err)
+	}
+	if _, err := os.Stat(e.Dir); !os.IsNotExist(err) {
+		t.Errorf("Stat(%q) = %v, want not exist", e.Dir, err)
+	}
+}
+
+func TestNewEnvServiceAccount(t *testing.T) {
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "/etc/sa/key.json")
+
+	e, err := NewEnv("test-project")
+	if err != nil {
+		t.Fatalf("NewEnv() = %v, want nil", err)
+	}
+	defer e.Cleanup()
+
+	if got, want := e.Get("CLOUDSDK_AUTH_CREDENTIAL_FILE_OVERRIDE"), "/etc/sa/key.json"; got != want {
+		t.Errorf("Get(CLOUDSDK_AUTH_CREDENTIAL_FILE_OVERRIDE) = %q, want %q", got, want)
+	}
+}
+
+func TestEnvSetLeases(t *testing.T) {
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "/etc/sa/key.json")
+	e, err := NewEnv("")
+	if err != nil {
+		t.Fatalf("NewEnv() = %v, want nil", err)
+	}
+	defer e.Cleanup()
+
+	leases := []Lease{{Name: MainLease}, {Name: "dns"}}
+	projects := map[string]string{MainLease: "main-project", "dns": "dns-project"}
+	if err := e.SetLeases(leases, projects); err != nil {
+		t.Fatalf("SetLeases() = %v, want nil", err)
+	}
+
+	environ := strings.Join(e.Environ(), "\n")
+	for _, want := range []string{"PROJECT=main-project", "CLOUDSDK_CORE_PROJECT=main-project", "DNS_PROJECT=dns-project"} {
+		if !strings.Contains(environ, want) {
+			t.Errorf("Environ() does not contain %q", want)
+		}
+	}
+
+	if err := e.SetLeases([]Lease{{Name: "host"}}, projects); err == nil {
+		t.Errorf("SetLeases() with a missing project = nil, want error")
+	}
+}
+
+func TestEnvForRecipe(t *testing.T) {
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "/etc/sa/key.json")
+	e, err := NewEnv("test-project")
+	if err != nil {
+		t.Fatalf("NewEnv() = %v, want nil", err)
+	}
+	defer e.Cleanup()
+
+	a, err := e.ForRecipe("ingress/single-cluster/ingress-https")
+	if err != nil {
+		t.Fatalf("ForRecipe() = %v, want nil", err)
+	}
+	b, err := e.ForRecipe("ingress/single-cluster/ingress-iap/")
+	if err != nil {
+		t.Fatalf("ForRecipe() = %v, want nil", err)
+	}
+
+	if a.Get("KUBECONFIG") == b.Get("KUBECONFIG") {
+		t.Errorf("recipes share the kubeconfig %q", a.Get("KUBECONFIG"))
+	}
+	if a.Get("KUBECONFIG") == e.Get("KUBECONFIG") {
+		t.Errorf("recipe shares the kubeconfig %q of the run", a.Get("KUBECONFIG"))
+	}
+	if got, want := a.Get("CLOUDSDK_CONFIG"), e.Get("CLOUDSDK_CONFIG"); got != want {
+		t.Errorf("recipe CLOUDSDK_CONFIG = %q, want %q", got, want)
+	}
+
+	// The recipe sets up its cluster credentials.
+	writeFile(t, a.Get("KUBECONFIG"), `apiVersion: v1
+kind: Config
+clusters:
+- name: gke_test-project_us-central1-c_gke-net-recipes-1234
+  cluster:
+    server: https://10.0.0.1
+contexts:
+- name: gke_test-project_us-central1-c_gke-net-recipes-1234
+  context:
+    cluster: gke_test-project_us-central1-c_gke-net-recipes-1234
+    user: gke_test-project_us-central1-c_gke-net-recipes-1234
+current-context: gke_test-project_us-central1-c_gke-net-recipes-1234
+users:
+- name: gke_test-project_us-central1-c_gke-net-recipes-1234
+  user:
+    token: secret
+`)
+	cluster, err := a.Cluster()
+	if err != nil {
+		t.Fatalf("Cluster() = %v, want nil", err)
+	}
+	if got, want := cluster.Context, "gke_test-project_us-central1-c_gke-net-recipes-1234"; got != want {
+		t.Errorf("Cluster().Context = %q, want %q", got, want)
+	}
+	config, err := cluster.RESTConfig()
+	if err != nil {
+		t.Fatalf("RESTConfig() = %v, want nil", err)
+	}
+	if got, want := config.Host, "https://10.0.0.1"; got != want {
+		t.Errorf("RESTConfig().Host = %q, want %q", got, want)
+	}
+	if _, err := b.Cluster(); err == nil {
+		t.Errorf("Cluster() without credentials = nil, want error")
+	}
+
+	if err := a.Cleanup(); err != nil {
+		t.Fatalf("Cleanup() = %v, want nil", err)
+	}
+	if _, err := os.Stat(a.Get("KUBECONFIG")); !os.IsNotExist(err) {
+		t.Errorf("Stat(%q) = %v, want not exist", a.Get("KUBECONFIG"), err)
+	}
+	if _, err := os.Stat(e.Get("CLOUDSDK_CONFIG")); err != nil {
+		t.Errorf("recipe cleanup removed the gcloud configuration of the run: %v", err)
+	}
+}
+
+func TestEnvSetNamer(t *testing.T) {
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "/etc/sa/key.json")
+	e, err := NewEnv("")
+	if err != nil {
+		t.Fatalf("NewEnv() = %v, want nil", err)
+	}
+	defer e.Cleanup()
+
+	n := naming.New("run-1", "ingress/single-cluster/ingress-https", "", time.Time{})
+	e.SetNamer(n)
+	for key, want := range map[string]string{
+		"RUN_ID":          "run-1",
+		"RESOURCE_SUFFIX": n.Suffix(),
+		"RESOURCE_LABELS": "recipe=ingress-https,run-id=run-1",
+	} {
+		if got := e.Get(key); got != want {
+			t.Errorf("Get(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -17,6 +17,10 @@ package utils
 import (
 	"fmt"
 	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -33,86 +37,239 @@ const (
 
 	// How often we send update to boskos client to refresh the resource.
 	updateInterval = 5 * time.Minute
+
+	// MainLease is the name of the lease holding the project recipes are
+	// deployed into.
+	MainLease = "main"
 )
 
+// leaseName matches the valid lease names, which are exposed in the names of
+// environment variables, see Lease.EnvVar.
+var leaseName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Lease describes a boskos resource to acquire under a logical name.
+type Lease struct {
+	// Name is the logical name of the lease, e.g. "main", "dns" or "host".
+	Name string
+	// ResourceType is the boskos resource type to reserve for this lease.
+	ResourceType string
+}
+
+// EnvVar returns the environment variable the leased project is exposed as
+// to the test scripts. The main lease is exposed as PROJECT, and every other
+// lease as <NAME>_PROJECT, e.g. DNS_PROJECT or HOST_PROJECT.
+func (l Lease) EnvVar() string {
+	if l.Name == MainLease {
+		return "PROJECT"
+	}
+	return strings.ToUpper(l.Name) + "_PROJECT"
+}
+
+// ParseLeases parses a comma separated list of name=resourceType pairs, e.g.
+// "dns=gke-dns-project,host=gke-host-project". Names are made of lower case
+// letters, digits and underscores.
+func ParseLeases(s string) ([]Lease, error) {
+	var leases []Lease
+	seen := make(map[string]bool)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, resourceType, ok := strings.Cut(pair, "=")
+		if !ok || name == "" || resourceType == "" {
+			return nil, fmt.Errorf("invalid lease %q, want name=resourceType", pair)
+		}
+		if !leaseName.MatchString(name) {
+			return nil, fmt.Errorf("invalid lease name %q, want lower case letters, digits and underscores", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate lease %q", name)
+		}
+		seen[name] = true
+		leases = append(leases, Lease{Name: name, ResourceType: resourceType})
+	}
+	return leases, nil
+}
+
 type ProjectHolder struct {
 	c *boskosclient.Client
 	// quit channel signals when we need to stop refresh the resource and release the boskos project.
 	quit chan struct{}
-	// Name of the project to use.
-	project string
+	// releaseOnce makes Release idempotent.
+	releaseOnce sync.Once
+	// mu guards projects and started.
+	mu sync.Mutex
+	// started is set once all the leases are acquired and the refresh
+	// goroutine is running.
+	started bool
+	// projects maps the name of each lease to the project acquired for it.
+	projects map[string]string
+	// backoff controls the retries when acquiring a project.
+	backoff wait.Backoff
+	// updateInterval is how often the acquired projects are refreshed.
+	updateInterval time.Duration
+	// after waits for the next refresh, time.After outside of tests.
+	after func(time.Duration) <-chan time.Time
 }
 
-func NewProjectHolder() (*ProjectHolder, error) {
-	jobName := os.Getenv("JOB_NAME")
-	if jobName == "" {
-		return nil, fmt.Errorf("JOB_NAME is required but not provided")
+// NewProjectHolder returns a ProjectHolder acquiring projects from the boskos
+// server at boskosURL on behalf of owner. If owner is empty, the Prow job
+// name from JOB_NAME is used.
+func NewProjectHolder(boskosURL, owner string) (*ProjectHolder, error) {
+	if owner == "" {
+		owner = os.Getenv("JOB_NAME")
+	}
+	if owner == "" {
+		return nil, fmt.Errorf("boskos owner is required but not provided, set it explicitly or through JOB_NAME")
 	}
-	c, err := boskosclient.NewClient(jobName, "http://boskos", "", "")
+	c, err := boskosclient.NewClient(owner, boskosURL, "", "")
 	if err != nil {
 		return nil, err
 	}
 	return &ProjectHolder{
-		c:    c,
-		quit: make(chan struct{}),
+		c:        c,
+		quit:     make(chan struct{}),
+		projects: make(map[string]string),
+		backoff: wait.Backoff{
+			Duration: retryDuration,
+			Factor:   retryFactor,
+			Steps:    retryStep,
+		},
+		updateInterval: updateInterval,
+		after:          time.After,
 	}, nil
 }
 
-// AcquireOrDie tries to get a boskso project. If succeeded, it spawns a
-// goroutine to refresh it and returns the name of the project to use.
-// If failed, it will terminate.
-func (ph *ProjectHolder) AcquireOrDie(resourceType string) string {
-	// Try to get a Boskos project
-	klog.Infof("Running in Prow, getting project resourceType = %q", resourceType)
+// Acquire tries to get a boskos project for each of the given leases, and
+// returns the name of the project acquired for each lease. The projects
+// acquired so far are refreshed while retrying the next ones, since acquiring
+// them can take longer than the reaper waits, and a goroutine refreshes them
+// all once every lease is acquired.
+// If any acquisition fails, the projects acquired so far are released and an
+// error is returned. Otherwise Release must be called once the projects are
+// no longer needed. Acquire can only succeed once.
+func (ph *ProjectHolder) Acquire(leases []Lease) (map[string]string, error) {
+	ph.mu.Lock()
+	started := ph.started
+	ph.mu.Unlock()
+	if started {
+		return nil, fmt.Errorf("boskos projects already acquired")
+	}
 
-	p := ph.getBoskosProjectOrDie(resourceType)
-	ph.project = p.Name
-	go ph.refresh()
+	next := ph.after(ph.updateInterval)
+	for _, l := range leases {
+		klog.Infof("Running in Prow, getting project for lease %q, resourceType = %q", l.Name, l.ResourceType)
 
-	return p.Name
+		p, err := ph.getBoskosProject(l.ResourceType, func() {
+			select {
+			case <-next:
+				ph.updateAll()
+				next = ph.after(ph.updateInterval)
+			default:
+			}
+		})
+		if err != nil {
+			ph.releaseAll()
+			return nil, fmt.Errorf("failed to acquire lease %q: %w", l.Name, err)
+		}
+		ph.mu.Lock()
+		ph.projects[l.Name] = p.Name
+		ph.mu.Unlock()
+	}
+
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	ph.started = true
+	go ph.refresh(next)
+	projects := make(map[string]string, len(ph.projects))
+	for name, project := range ph.projects {
+		projects[name] = project
+	}
+	return projects, nil
 }
 
-// Release stops the refresh goroutine, and releases the boskso project.
+// Release stops the refresh goroutine, and releases all the boskos projects.
+// It does nothing without a prior successful Acquire, and calls after the
+// first one do nothing either.
 func (ph *ProjectHolder) Release() {
-	ph.quit <- struct{}{}
+	ph.mu.Lock()
+	started := ph.started
+	ph.mu.Unlock()
+	if !started {
+		return
+	}
+	ph.releaseOnce.Do(func() {
+		ph.quit <- struct{}{}
 
-	// Wait until project cleanup is finished.
-	<-ph.quit
+		// Wait until project cleanup is finished.
+		<-ph.quit
+	})
 }
 
-// Periodically refresh the resource to avoid the resource being cleaned
+// Periodically refresh the resources to avoid the resources being cleaned
 // up accidentally.
 // Boskos Reaper component looks for resources that are owned but not
 // updated for a period of time, and resets stale resources to dirty state,
 // and Boskos Janitor component cleans up all dirty resources.
-func (ph *ProjectHolder) refresh() {
+// The first refresh happens when next fires.
+func (ph *ProjectHolder) refresh(next <-chan time.Time) {
 	for {
 		select {
-		case <-time.Tick(updateInterval):
-			if err := ph.c.UpdateOne(ph.project, common.Busy, nil); err != nil {
-				klog.Warningf("[Boskos] Update %s failed with %v", ph.project, err)
-			}
+		case <-next:
+			ph.updateAll()
+			next = ph.after(ph.updateInterval)
 		case <-ph.quit:
-			if err := ph.c.ReleaseOne(ph.project, common.Dirty); err != nil {
-				klog.Warningf("[Boskos] ReleaseOne %s failed with %v", ph.project, err)
-			}
+			ph.releaseAll()
 			ph.quit <- struct{}{}
 			return
 		}
 	}
 }
 
-// getBoskosProjectOrDie retries acquiring a boskos project until success or timeout and terminate.
-func (ph *ProjectHolder) getBoskosProjectOrDie(resourceType string) *common.Resource {
+// updateAll refreshes every project acquired so far.
+func (ph *ProjectHolder) updateAll() {
+	for _, project := range ph.sortedProjects() {
+		if err := ph.c.UpdateOne(project, common.Busy, nil); err != nil {
+			klog.Warningf("[Boskos] Update %s failed with %v", project, err)
+		}
+	}
+}
+
+// releaseAll releases every project acquired so far. A failure to release one
+// project does not prevent the others from being released.
+func (ph *ProjectHolder) releaseAll() {
+	for _, project := range ph.sortedProjects() {
+		if err := ph.c.ReleaseOne(project, common.Dirty); err != nil {
+			klog.Warningf("[Boskos] ReleaseOne %s failed with %v", project, err)
+		}
+	}
+	ph.mu.Lock()
+	ph.projects = make(map[string]string)
+	ph.mu.Unlock()
+}
+
+// sortedProjects returns the acquired projects in a stable order.
+func (ph *ProjectHolder) sortedProjects() []string {
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	var projects []string
+	for _, project := range ph.projects {
+		projects = append(projects, project)
+	}
+	sort.Strings(projects)
+	return projects
+}
+
+// getBoskosProject retries acquiring a boskos project until success or timeout.
+// beforeAttempt is called before each attempt.
+func (ph *ProjectHolder) getBoskosProject(resourceType string, beforeAttempt func()) (*common.Resource, error) {
 	var project *common.Resource
 	err := retry.OnError(
-		wait.Backoff{
-			Duration: retryDuration,
-			Factor:   retryFactor,
-			Steps:    retryStep,
-		},
+		ph.backoff,
 		func(err error) bool { return err != nil },
 		func() error {
+			beforeAttempt()
 			klog.Infof("Trying to acquire boskos project of type %s...", resourceType)
 			var err error
 			project, err = ph.c.Acquire(resourceType, common.Free, common.Busy)
@@ -122,8 +279,11 @@ func (ph *ProjectHolder) getBoskosProjectOrDie(resourceType string) *common.Reso
 			return nil
 		},
 	)
-	if err != nil || project == nil {
-		klog.Fatalf("Error trying to acquire boskos project: %v", err)
+	if err != nil {
+		return nil, fmt.Errorf("error trying to acquire boskos project: %w", err)
+	}
+	if project == nil {
+		return nil, fmt.Errorf("no boskos project of type %s returned", resourceType)
 	}
-	return project
+	return project, nil
 }
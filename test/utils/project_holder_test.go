@@ -0,0 +1,276 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gke-networking-recipes/test/fakeboskos"
+	"k8s.io/apimachinery/pkg/util/wait"
+	boskosclient "sigs.k8s.io/boskos/client"
+	"sigs.k8s.io/boskos/common"
+)
+
+func newTestProjectHolder(t *testing.T, config fakeboskos.Config, resources ...common.Resource) (*ProjectHolder, *fakeboskos.Server) {
+	t.Helper()
+	sleep := boskosclient.SleepFunc
+	boskosclient.SleepFunc = func(time.Duration) {}
+	t.Cleanup(func() { boskosclient.SleepFunc = sleep })
+	s := fakeboskos.NewServer(config, resources)
+	hs := httptest.NewServer(s)
+	t.Cleanup(hs.Close)
+
+	ph, err := NewProjectHolder(hs.URL, "test-job")
+	if err != nil {
+		t.Fatalf("NewProjectHolder(%q, %q) = %v, want nil", hs.URL, "test-job", err)
+	}
+	ph.backoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 2}
+	return ph, s
+}
+
+// fakeClock is a manually advanced clock.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func checkStates(t *testing.T, s *fakeboskos.Server, want map[string]string) {
+	t.Helper()
+	got := make(map[string]string)
+	for _, r := range s.Resources() {
+		got[r.Name] = r.State
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resource states = %v, want %v", got, want)
+	}
+}
+
+func TestNewProjectHolderOwner(t *testing.T) {
+	t.Setenv("JOB_NAME", "")
+	if _, err := NewProjectHolder("http://boskos", ""); err == nil {
+		t.Errorf("NewProjectHolder() without owner = nil, want error")
+	}
+	t.Setenv("JOB_NAME", "prow-job")
+	if _, err := NewProjectHolder("http://boskos", ""); err != nil {
+		t.Errorf("NewProjectHolder() with JOB_NAME = %v, want nil", err)
+	}
+}
+
+func TestAcquireRelease(t *testing.T) {
+	ph, s := newTestProjectHolder(t, fakeboskos.Config{},
+		common.Resource{Name: "project-a", Type: "gke-internal-project"},
+		common.Resource{Name: "dns-project", Type: "gke-dns-project"},
+	)
+
+	leases := []Lease{
+		{Name: MainLease, ResourceType: "gke-internal-project"},
+		{Name: "dns", ResourceType: "gke-dns-project"},
+	}
+	got, err := ph.Acquire(leases)
+	if err != nil {
+		t.Fatalf("Acquire(%+v) = %v, want nil", leases, err)
+	}
+	want := map[string]string{MainLease: "project-a", "dns": "dns-project"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Acquire(%+v) = %v, want %v", leases, got, want)
+	}
+	checkStates(t, s, map[string]string{"project-a": common.Busy, "dns-project": common.Busy})
+	if _, err := ph.Acquire(leases); err == nil {
+		t.Errorf("Acquire(%+v) after Acquire = nil, want error", leases)
+	}
+
+	ph.Release()
+	checkStates(t, s, map[string]string{"project-a": common.Dirty, "dns-project": common.Dirty})
+}
+
+func TestReleaseWithoutAcquire(t *testing.T) {
+	ph, s := newTestProjectHolder(t, fakeboskos.Config{},
+		common.Resource{Name: "project-a", Type: "gke-internal-project"},
+	)
+	ph.Release()
+	checkStates(t, s, map[string]string{"project-a": common.Free})
+}
+
+func TestAcquireFailureReleasesAcquired(t *testing.T) {
+	ph, s := newTestProjectHolder(t, fakeboskos.Config{},
+		common.Resource{Name: "project-a", Type: "gke-internal-project"},
+		common.Resource{Name: "dns-project", Type: "gke-dns-project", State: common.Dirty},
+	)
+
+	leases := []Lease{
+		{Name: MainLease, ResourceType: "gke-internal-project"},
+		{Name: "dns", ResourceType: "gke-dns-project"},
+	}
+	if _, err := ph.Acquire(leases); err == nil {
+		t.Fatalf("Acquire(%+v) = nil, want error", leases)
+	}
+	checkStates(t, s, map[string]string{"project-a": common.Dirty, "dns-project": common.Dirty})
+	// Nothing is left to release.
+	ph.Release()
+}
+
+func TestRefreshKeepsProjectsBusy(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	ph, s := newTestProjectHolder(t, fakeboskos.Config{ReapTimeout: 10 * time.Minute, Now: clock.Now},
+		common.Resource{Name: "project-a", Type: "gke-internal-project"},
+	)
+	// Acquire and the refresh goroutine wait on ready before each refresh,
+	// so that the clock is only advanced while no update is in flight.
+	ready := make(chan struct{})
+	ticks := make(chan time.Time)
+	ph.after = func(time.Duration) <-chan time.Time {
+		ready <- struct{}{}
+		return ticks
+	}
+
+	leases := []Lease{{Name: MainLease, ResourceType: "gke-internal-project"}}
+	errc := make(chan error)
+	go func() {
+		_, err := ph.Acquire(leases)
+		errc <- err
+	}()
+	<-ready
+	if err := <-errc; err != nil {
+		t.Fatalf("Acquire(%+v) = %v, want nil", leases, err)
+	}
+	for i := 0; i < 5; i++ {
+		clock.now = clock.now.Add(9 * time.Minute)
+		ticks <- clock.now
+		<-ready
+		s.Reap()
+	}
+	checkStates(t, s, map[string]string{"project-a": common.Busy})
+
+	ph.Release()
+	checkStates(t, s, map[string]string{"project-a": common.Dirty})
+}
+
+func TestRefreshWhileAcquiring(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	ph, s := newTestProjectHolder(t, fakeboskos.Config{ReapTimeout: 10 * time.Minute, CleanDelay: 30 * time.Minute, Now: clock.Now},
+		common.Resource{Name: "project-a", Type: "gke-internal-project"},
+		// The DNS project is only cleaned by the janitor after 30 minutes.
+		common.Resource{Name: "dns-project", Type: "gke-dns-project", State: common.Dirty},
+	)
+	ph.backoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 1 << 30}
+	ready := make(chan struct{})
+	ticks := make(chan time.Time)
+	ph.after = func(time.Duration) <-chan time.Time {
+		ready <- struct{}{}
+		return ticks
+	}
+
+	leases := []Lease{
+		{Name: MainLease, ResourceType: "gke-internal-project"},
+		{Name: "dns", ResourceType: "gke-dns-project"},
+	}
+	type result struct {
+		projects map[string]string
+		err      error
+	}
+	acquired := make(chan result)
+	go func() {
+		projects, err := ph.Acquire(leases)
+		acquired <- result{projects, err}
+	}()
+	select {
+	case <-ready:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Acquire(%+v) doesn't refresh the projects before all of them are acquired", leases)
+	}
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(time.Millisecond) {
+		if r, _ := s.Resource("project-a"); r.State == common.Busy {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("project-a was not acquired")
+		}
+	}
+	// The main project must be refreshed while the DNS project is acquired.
+	for i := 0; i < 4; i++ {
+		clock.now = clock.now.Add(9 * time.Minute)
+		ticks <- clock.now
+		<-ready
+		s.Reap()
+	}
+	got := <-acquired
+	if got.err != nil {
+		t.Fatalf("Acquire(%+v) = %v, want nil", leases, got.err)
+	}
+	if want := map[string]string{MainLease: "project-a", "dns": "dns-project"}; !reflect.DeepEqual(got.projects, want) {
+		t.Errorf("Acquire(%+v) = %v, want %v", leases, got.projects, want)
+	}
+	checkStates(t, s, map[string]string{"project-a": common.Busy, "dns-project": common.Busy})
+
+	ph.Release()
+	ph.Release()
+	checkStates(t, s, map[string]string{"project-a": common.Dirty, "dns-project": common.Dirty})
+}
+
+func TestParseLeases(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		in      string
+		want    []Lease
+		wantErr bool
+	}{
+		{
+			desc: "empty",
+			in:   "",
+		},
+		{
+			desc: "multiple leases",
+			in:   "dns=gke-dns-project, host=gke-host-project",
+			want: []Lease{
+				{Name: "dns", ResourceType: "gke-dns-project"},
+				{Name: "host", ResourceType: "gke-host-project"},
+			},
+		},
+		{
+			desc:    "missing resource type",
+			in:      "dns=",
+			wantErr: true,
+		},
+		{
+			desc:    "name not usable in an environment variable",
+			in:      "dns-zone=gke-dns-project",
+			wantErr: true,
+		},
+		{
+			desc:    "upper case name",
+			in:      "DNS=gke-dns-project",
+			wantErr: true,
+		},
+		{
+			desc:    "duplicate lease",
+			in:      "dns=a,dns=b",
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := ParseLeases(tc.in)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ParseLeases(%q) = %v, want error %v", tc.in, err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ParseLeases(%q) = %+v, want %+v", tc.in, got, tc.want)
+			}
+		})
+	}
+}
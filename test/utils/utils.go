@@ -16,14 +16,62 @@ package utils
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 )
 
-func SetEnvProject(project string) error {
-	if out, err := exec.Command("gcloud", "config", "set", "project", project).CombinedOutput(); err != nil {
-		return fmt.Errorf("SetEnvProject(%q) failed: %q: %w", project, out, err)
+// DefaultProject returns the project to run the tests in outside of Prow:
+// PROJECT if it is set, or the project of the active gcloud configuration.
+func DefaultProject() (string, error) {
+	if project := os.Getenv("PROJECT"); project != "" {
+		return project, nil
 	}
+	out, err := exec.Command("gcloud", "config", "get-value", "project").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get gcloud project: %q: %w", out, err)
+	}
+	project := strings.TrimSpace(string(out))
+	if project == "" {
+		return "", fmt.Errorf("no project set, set PROJECT or run `gcloud config set project PROJECT_ID`")
+	}
+	return project, nil
+}
+
+// copyPath copies the file or directory at src to dst.
+func copyPath(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0700)
+		}
+		return copyFile(path, target)
+	})
+}
 
-	return os.Setenv("PROJECT", project)
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
 }